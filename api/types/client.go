@@ -2,6 +2,7 @@ package types
 
 import (
 	"context"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 )
@@ -12,6 +13,32 @@ type ConnectorCreateOptions struct {
 	Cost             int32
 }
 
+type ConnectorTokenCreateOptions struct {
+	Name   string
+	Expiry time.Duration
+	Uses   int
+}
+
+type ServiceInterfaceBindOptions struct {
+	Weight         int
+	SitePreference string
+}
+
+type CertificatesRotateOptions struct {
+	Complete bool
+	Force    bool
+	Timeout  time.Duration
+}
+
+// ConnectorUpdateOptions holds the changes to an existing connection.
+// A cost or link capacity of zero is left as it is.
+type ConnectorUpdateOptions struct {
+	SkupperNamespace string
+	Name             string
+	Cost             int32
+	LinkCapacity     int32
+}
+
 type ConnectorRemoveOptions struct {
 	SkupperNamespace string
 	Name             string
@@ -19,9 +46,9 @@ type ConnectorRemoveOptions struct {
 }
 
 type ConnectorInspectResponse struct {
-	SkupperNamespace string
-	Connector        *Connector
-	Connected        bool
+	SkupperNamespace string     `json:"skupperNamespace,omitempty"`
+	Connector        *Connector `json:"connector"`
+	Connected        bool       `json:"connected"`
 }
 
 type SiteConfig struct {
@@ -40,9 +67,32 @@ type SiteConfigSpec struct {
 	AuthMode            string
 	User                string
 	Password            string
+	OidcIssuer          string
+	OidcGroups          []string
+	ConsoleOperators    []string
 	ClusterLocal        bool
 	Replicas            int32
 	SiteControlled      bool
+	ServiceSyncInterval time.Duration
+	ServiceSyncAgeOut   time.Duration
+	Router              Tuning
+	Controller          Tuning
+	// placement of the router and controller pods, the node selector
+	// and affinity as comma separated key=value pairs and each
+	// toleration as key[=value][:effect]
+	NodeSelector  string
+	NodeAffinity  string
+	Tolerations   []string
+	PriorityClass string
+}
+
+// The resources requested for and limiting a component, as quantities
+// such as 500m or 1Gi; none are set by default
+type Tuning struct {
+	Cpu         string
+	Memory      string
+	CpuLimit    string
+	MemoryLimit string
 }
 
 type SiteConfigReference struct {
@@ -60,32 +110,99 @@ type ServiceInterfaceCreateOptions struct {
 	Headless   bool
 }
 
+type ServiceInterfaceApplyOptions struct {
+	Prune  bool
+	DryRun bool
+}
+
+type ServiceInterfaceApplyResponse struct {
+	Created   []*ServiceInterface
+	Updated   []*ServiceInterface
+	Deleted   []*ServiceInterface
+	Unchanged []*ServiceInterface
+}
+
+// The json field names of RouterInspectResponse and
+// ConnectorInspectResponse form part of the structured output of the
+// skupper CLI, so should not be changed
 type RouterInspectResponse struct {
-	Status            RouterStatusSpec
-	TransportVersion  string
-	ControllerVersion string
-	ExposedServices   int
-	ConsoleUrl        string
+	Status            RouterStatusSpec `json:"status"`
+	TransportVersion  string           `json:"transportVersion"`
+	ControllerVersion string           `json:"controllerVersion"`
+	ExposedServices   int              `json:"exposedServices"`
+	ConsoleUrl        string           `json:"consoleUrl,omitempty"`
+	Warnings          []string         `json:"warnings,omitempty"`
+}
+
+// The request to expose a target through a service in the REST API of
+// the service controller. If a service definition is given it is used
+// in place of any existing definition for the address.
+type ServiceTargetRequest struct {
+	Type           string            `json:"type"`
+	Name           string            `json:"name"`
+	Protocol       string            `json:"protocol,omitempty"`
+	Port           int               `json:"port,omitempty"`
+	Weight         int               `json:"weight,omitempty"`
+	SitePreference string            `json:"sitePreference,omitempty"`
+	Service        *ServiceInterface `json:"service,omitempty"`
+}
+
+// The request to create a connection token in the REST API, where the
+// expiry is a duration such as 15m or 24h
+type TokenRequest struct {
+	Name    string `json:"name,omitempty"`
+	Subject string `json:"subject,omitempty"`
+	Expiry  string `json:"expiry,omitempty"`
+	Uses    int    `json:"uses,omitempty"`
+}
+
+type TokenResponse struct {
+	Token     *corev1.Secret `json:"token"`
+	LocalOnly bool           `json:"localOnly"`
+}
+
+// The request to change a connection in the REST API, where a value
+// that is omitted is left as it is
+type ConnectorUpdateRequest struct {
+	Cost         int32 `json:"cost,omitempty"`
+	LinkCapacity int32 `json:"linkCapacity,omitempty"`
+}
+
+type ConnectorUpdateResponse struct {
+	Updated bool `json:"updated"`
 }
 
 type VanClientInterface interface {
 	RouterCreate(ctx context.Context, options SiteConfig) error
 	RouterInspect(ctx context.Context) (*RouterInspectResponse, error)
+	RouterUpdate(ctx context.Context, options SiteConfig) (bool, error)
 	RouterRemove(ctx context.Context) error
+	RouterWaitReady(ctx context.Context) error
 	ConnectorCreateFromFile(ctx context.Context, secretFile string, options ConnectorCreateOptions) (*corev1.Secret, error)
 	ConnectorCreateSecretFromFile(ctx context.Context, secretFile string, options ConnectorCreateOptions) (*corev1.Secret, error)
 	ConnectorCreate(ctx context.Context, secret *corev1.Secret, options ConnectorCreateOptions) error
 	ConnectorInspect(ctx context.Context, name string) (*ConnectorInspectResponse, error)
 	ConnectorList(ctx context.Context) ([]*Connector, error)
 	ConnectorRemove(ctx context.Context, options ConnectorRemoveOptions) error
+	ConnectorUpdate(ctx context.Context, options ConnectorUpdateOptions) (bool, error)
+	ConnectorWaitConnected(ctx context.Context, name string) error
 	ConnectorTokenCreate(ctx context.Context, subject string, namespace string) (*corev1.Secret, bool, error)
 	ConnectorTokenCreateFile(ctx context.Context, subject string, secretFile string) error
+	ConnectorTokenCreateWithOptions(ctx context.Context, subject string, namespace string, options ConnectorTokenCreateOptions) (*corev1.Secret, bool, error)
+	ConnectorTokenCreateFileWithOptions(ctx context.Context, subject string, secretFile string, options ConnectorTokenCreateOptions) error
+	ConnectorTokenRevoke(ctx context.Context, name string) error
+	CertificatesRotate(ctx context.Context, options CertificatesRotateOptions) error
+	NetworkGraph(ctx context.Context) (*NetworkGraph, error)
+	NetworkServiceList(ctx context.Context) ([]*NetworkService, error)
 	ServiceInterfaceCreate(ctx context.Context, service *ServiceInterface) error
 	ServiceInterfaceInspect(ctx context.Context, address string) (*ServiceInterface, error)
 	ServiceInterfaceList(ctx context.Context) ([]*ServiceInterface, error)
 	ServiceInterfaceRemove(ctx context.Context, address string) error
 	ServiceInterfaceUpdate(ctx context.Context, service *ServiceInterface) error
+	ServiceInterfaceWaitReady(ctx context.Context, address string) error
+	ServiceInterfaceApply(ctx context.Context, services []*ServiceInterface, options ServiceInterfaceApplyOptions) (*ServiceInterfaceApplyResponse, error)
 	ServiceInterfaceBind(ctx context.Context, service *ServiceInterface, targetType string, targetName string, protocol string, targetPort int) error
+	ServiceInterfaceBindWithOptions(ctx context.Context, service *ServiceInterface, targetType string, targetName string, protocol string, targetPort int, options ServiceInterfaceBindOptions) error
 	GetHeadlessServiceConfiguration(targetName string, protocol string, address string, port int) (*ServiceInterface, error)
 	ServiceInterfaceUnbind(ctx context.Context, targetType string, targetName string, address string, deleteIfNoTargets bool) error
 	SiteConfigCreate(ctx context.Context, spec SiteConfigSpec) (*SiteConfig, error)
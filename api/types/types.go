@@ -15,6 +15,8 @@ limitations under the License.
 package types
 
 import (
+	"time"
+
 	routev1 "github.com/openshift/api/route/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
@@ -40,16 +42,19 @@ const (
 
 // Transport constants
 const (
-	TransportDeploymentName     string = "skupper-router"
-	TransportComponentName      string = "router"
-	DefaultTransportImage       string = "quay.io/skupper/qdrouterd:0.4"
-	TransportContainerName      string = "router"
-	TransportLivenessPort       int32  = 9090
-	TransportServiceAccountName string = "skupper"
-	TransportViewRoleName       string = "skupper-view"
-	TransportEnvConfig          string = "QDROUTERD_CONF"
-	TransportSaslConfig         string = "skupper-sasl-config"
-	TransportConfigFile         string = "qdrouterd.json"
+	TransportDeploymentName       string = "skupper-router"
+	TransportComponentName        string = "router"
+	DefaultTransportImage         string = "quay.io/skupper/qdrouterd:0.4"
+	TransportContainerName        string = "router"
+	TransportLivenessPort         int32  = 9090
+	TransportServiceAccountName   string = "skupper"
+	TransportViewRoleName         string = "skupper-view"
+	TransportEnvConfig            string = "QDROUTERD_CONF"
+	TransportSaslConfig           string = "skupper-sasl-config"
+	TransportConfigFile           string = "qdrouterd.json"
+	TransportDisruptionBudgetName string = "skupper-router"
+	TransportLinkCertsSecret      string = "skupper-link-certs"
+	TransportLinkCertsPath        string = "/etc/qpid-dispatch-certs/skupper-link-certs/"
 )
 
 var TransportViewPolicyRule = []rbacv1.PolicyRule{
@@ -74,6 +79,7 @@ const (
 	ControllerServiceAccountName string = "skupper-proxy-controller"
 	ControllerConfigPath         string = "/etc/messaging/"
 	ControllerEditRoleName       string = "skupper-edit"
+	ControllerOperatorRoleName   string = "skupper-operator"
 )
 
 var ControllerEditPolicyRule = []rbacv1.PolicyRule{
@@ -92,32 +98,141 @@ var ControllerEditPolicyRule = []rbacv1.PolicyRule{
 		APIGroups: []string{"route.openshift.io"},
 		Resources: []string{"routes"},
 	},
+	{
+		Verbs:     []string{"get", "list", "watch", "update"},
+		APIGroups: []string{"skupper.io"},
+		Resources: []string{"serviceinterfaces", "serviceinterfaces/status", "servicesyncpolicies", "servicesyncpolicies/status"},
+	},
+	{
+		Verbs:         []string{"get", "update"},
+		APIGroups:     []string{""},
+		Resources:     []string{"secrets"},
+		ResourceNames: []string{"skupper-ca", "skupper-internal-ca", "skupper-amqps", "skupper", "skupper-internal", TransportLinkCertsSecret},
+	},
+}
+
+// The controller is granted access to the connection tokens of the
+// site, whose names are chosen by the user, and to the management of
+// each router pod only when the site has console operators, who manage
+// connections through it
+var ControllerOperatorPolicyRule = []rbacv1.PolicyRule{
+	{
+		Verbs:     []string{"get", "list", "update", "delete"},
+		APIGroups: []string{""},
+		Resources: []string{"secrets"},
+	},
+	{
+		Verbs:     []string{"create"},
+		APIGroups: []string{""},
+		Resources: []string{"pods/exec"},
+	},
 }
 
 // Skupper qualifiers
 const (
-	BaseQualifier               string = "skupper.io"
-	InternalQualifier           string = "internal." + BaseQualifier
-	AddressQualifier            string = BaseQualifier + "/address"
-	PortQualifier               string = BaseQualifier + "/port"
-	ProxyQualifier              string = BaseQualifier + "/proxy"
-	TargetServiceQualifier      string = BaseQualifier + "/target"
-	ControlledQualifier         string = InternalQualifier + "/controlled"
-	ServiceQualifier            string = InternalQualifier + "/service"
-	OriginQualifier             string = InternalQualifier + "/origin"
-	OriginalSelectorQualifier   string = InternalQualifier + "/originalSelector"
-	OriginalTargetPortQualifier string = InternalQualifier + "/originalTargetPort"
-	OriginalAssignedQualifier   string = InternalQualifier + "/originalAssignedPort"
-	InternalTypeQualifier       string = InternalQualifier + "/type"
-	SkupperTypeQualifier        string = BaseQualifier + "/type"
-	TypeProxyQualifier          string = InternalTypeQualifier + "=proxy"
-	TypeToken                   string = "connection-token"
-	TypeTokenQualifier          string = BaseQualifier + "/type=connection-token"
-	TypeTokenRequestQualifier   string = BaseQualifier + "/type=connection-token-request"
-	TokenGeneratedBy            string = BaseQualifier + "/generated-by"
-	TokenCost                   string = BaseQualifier + "/cost"
+	BaseQualifier                string = "skupper.io"
+	InternalQualifier            string = "internal." + BaseQualifier
+	AddressQualifier             string = BaseQualifier + "/address"
+	PortQualifier                string = BaseQualifier + "/port"
+	ProxyQualifier               string = BaseQualifier + "/proxy"
+	TargetServiceQualifier       string = BaseQualifier + "/target"
+	ControlledQualifier          string = InternalQualifier + "/controlled"
+	ServiceQualifier             string = InternalQualifier + "/service"
+	OriginQualifier              string = InternalQualifier + "/origin"
+	OriginalSelectorQualifier    string = InternalQualifier + "/originalSelector"
+	OriginalTargetPortQualifier  string = InternalQualifier + "/originalTargetPort"
+	OriginalAssignedQualifier    string = InternalQualifier + "/originalAssignedPort"
+	OriginalTargetPortsQualifier string = InternalQualifier + "/originalTargetPorts"
+	InternalTypeQualifier        string = InternalQualifier + "/type"
+	SkupperTypeQualifier         string = BaseQualifier + "/type"
+	TypeProxyQualifier           string = InternalTypeQualifier + "=proxy"
+	TypeToken                    string = "connection-token"
+	TypeTokenQualifier           string = BaseQualifier + "/type=connection-token"
+	TypeTokenRequestQualifier    string = BaseQualifier + "/type=connection-token-request"
+	TokenGeneratedBy             string = BaseQualifier + "/generated-by"
+	TokenCost                    string = BaseQualifier + "/cost"
+	TokenName                    string = BaseQualifier + "/token-name"
+	TokenExpiry                  string = BaseQualifier + "/token-expiry"
+	IssuedTokensConfigMap        string = "skupper-issued-tokens"
+	CertsRotatedQualifier        string = BaseQualifier + "/certs-rotated"
+	WeightQualifier              string = BaseQualifier + "/weight"
+	SitePreferenceQualifier      string = BaseQualifier + "/site-preference"
+	SiteConfigUpdatedQualifier   string = BaseQualifier + "/site-config-updated"
+	SiteStatusQualifier          string = BaseQualifier + "/site-status"
+	SiteStatusMessageQualifier   string = BaseQualifier + "/site-status-message"
+	LinkStatusQualifier          string = BaseQualifier + "/link-status"
+	LinkRemoteSiteQualifier      string = BaseQualifier + "/remote-site-id"
+	LinkLastConnectedQualifier   string = BaseQualifier + "/last-connected"
 )
 
+// Site status values, as recorded on the skupper-site config map by the
+// site controller
+const (
+	SiteStatusReady string = "Ready"
+	SiteStatusError string = "Error"
+)
+
+// Link status values, as recorded on connection token secrets by the
+// site controller. A failed link has the reason appended, e.g.
+// "failed: <reason>".
+const (
+	LinkStatusConnected  string = "connected"
+	LinkStatusConnecting string = "connecting"
+	LinkStatusFailed     string = "failed"
+)
+
+// IssuedToken is the record kept by a site for each connection token
+// it generates. Redemptions holds the ids of the sites that have
+// connected using the token. CA holds the certificate of the CA that
+// signed the token, which the router trusts only while the token is
+// valid; tokens issued before each had its own CA have none.
+type IssuedToken struct {
+	Name        string    `json:"name"`
+	Serial      string    `json:"serial"`
+	Subject     string    `json:"subject"`
+	Issued      time.Time `json:"issued"`
+	Expiry      time.Time `json:"expiry"`
+	Uses        int       `json:"uses,omitempty"`
+	Redemptions []string  `json:"redemptions,omitempty"`
+	Revoked     bool      `json:"revoked,omitempty"`
+	CA          string    `json:"ca,omitempty"`
+}
+
+func (t *IssuedToken) IsExpired(now time.Time) bool {
+	return now.After(t.Expiry)
+}
+
+// IsTrusted returns true if connections made with the token are
+// accepted by the router
+func (t *IssuedToken) IsTrusted(now time.Time) bool {
+	return t.CA != "" && !t.Revoked && !t.IsExpired(now)
+}
+
+func (t *IssuedToken) IsRedeemedBy(site string) bool {
+	for _, s := range t.Redemptions {
+		if s == site {
+			return true
+		}
+	}
+	return false
+}
+
+// Determines whether a connection from the specified site should be
+// accepted for this token, recording the redemption if so.
+func (t *IssuedToken) Redeem(site string, now time.Time) (accepted bool, recorded bool) {
+	if t.Revoked || t.IsExpired(now) {
+		return false, false
+	}
+	if t.IsRedeemedBy(site) {
+		return true, false
+	}
+	if t.Uses > 0 && len(t.Redemptions) >= t.Uses {
+		return false, false
+	}
+	t.Redemptions = append(t.Redemptions, site)
+	return true, true
+}
+
 // Service Interface constants
 const (
 	ServiceInterfaceConfigMap string = "skupper-services"
@@ -138,6 +253,8 @@ const (
 	ConsoleOpenShiftOauthServicePort       int32  = 443
 	ConsoleOpenShiftOauthServiceTargetPort int32  = 8443
 	ConsoleOpenShiftServingCerts           string = "skupper-proxy-certs"
+	ConsoleHtpasswdSecret                  string = "skupper-console-htpasswd"
+	ConsoleOidcSecret                      string = "skupper-console-oidc"
 )
 
 type ConsoleAuthMode string
@@ -146,6 +263,20 @@ const (
 	ConsoleAuthModeOpenshift ConsoleAuthMode = "openshift"
 	ConsoleAuthModeInternal                  = "internal"
 	ConsoleAuthModeUnsecured                 = "unsecured"
+	// The htpasswd mode verifies users against the bcrypt hashes in the
+	// htpasswd key of the skupper-console-htpasswd secret
+	ConsoleAuthModeHtpasswd = "htpasswd"
+	// The oidc mode signs users in through an OpenID Connect provider,
+	// using the client-id and client-secret keys of the
+	// skupper-console-oidc secret
+	ConsoleAuthModeOidc = "oidc"
+)
+
+// Console users are viewers unless they are named, or for the oidc
+// mode belong to a group named, in the console operators of the site
+const (
+	ConsoleRoleViewer   string = "viewer"
+	ConsoleRoleOperator string = "operator"
 )
 
 // Assembly constants
@@ -163,7 +294,10 @@ const (
 
 // Service Sync constants
 const (
-	ServiceSyncAddress = "mc/$skupper-service-sync"
+	ServiceSyncAddress         = "mc/$skupper-service-sync"
+	ServiceSyncStateQualifier  = InternalQualifier + "/service-sync-state"
+	DefaultServiceSyncInterval = 5 * time.Second
+	DefaultServiceSyncAgeOut   = 60 * time.Second
 )
 
 // RouterSpec is the specification of VAN network with router, controller and assembly
@@ -196,6 +330,12 @@ type DeploymentSpec struct {
 	ServiceAccounts []*corev1.ServiceAccount `json:"serviceAccounts,omitempty"`
 	Services        []*corev1.Service        `json:"services,omitempty"`
 	Sidecars        []*corev1.Container      `json:"sidecars,omitempty"`
+	// placement and resources of the pods
+	Resources         corev1.ResourceRequirements `json:"resources,omitempty"`
+	NodeSelector      map[string]string           `json:"nodeSelector,omitempty"`
+	Affinity          *corev1.Affinity            `json:"affinity,omitempty"`
+	Tolerations       []corev1.Toleration         `json:"tolerations,omitempty"`
+	PriorityClassName string                      `json:"priorityClassName,omitempty"`
 }
 
 // AssemblySpec for the links and connectors that form the VAN topology
@@ -214,9 +354,20 @@ type AssemblySpec struct {
 type RouterStatusSpec struct {
 	SiteName               string                  `json:"siteName,omitempty"`
 	Mode                   string                  `json:"mode,omitempty"`
-	TransportReadyReplicas int32                   `json:"transportReadyReplicas,omitempty"`
-	ConnectedSites         TransportConnectedSites `json:"connectedSites,omitempty"`
+	TransportReadyReplicas int32                   `json:"transportReadyReplicas"`
+	ConnectedSites         TransportConnectedSites `json:"connectedSites"`
 	BindingsCount          int                     `json:"bindingsCount,omitempty"`
+	Replicas               []RouterReplicaStatus   `json:"replicas,omitempty"`
+}
+
+// RouterReplicaStatus reports the health of one replica of a router
+// run with more than one, as the number of active links it has to the
+// routers of other sites and to the other replicas
+type RouterReplicaStatus struct {
+	Name           string `json:"name"`
+	Ready          bool   `json:"ready"`
+	Links          int    `json:"links"`
+	LinkedReplicas int    `json:"linkedReplicas"`
 }
 
 type Listener struct {
@@ -278,10 +429,54 @@ type User struct {
 }
 
 type TransportConnectedSites struct {
-	Direct   int
-	Indirect int
-	Total    int
-	Warnings []string
+	Direct   int      `json:"direct"`
+	Indirect int      `json:"indirect"`
+	Total    int      `json:"total"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// NetworkGraph describes the sites of a network, the routers within
+// each site and the links between those routers
+type NetworkGraph struct {
+	Sites []NetworkGraphSite `json:"sites"`
+	Links []NetworkGraphLink `json:"links"`
+}
+
+// NetworkGraphSite lists the routers of a site and the addresses of
+// the services that have targets there
+type NetworkGraphSite struct {
+	Id       string   `json:"id"`
+	Edge     bool     `json:"edge"`
+	Routers  []string `json:"routers"`
+	Services []string `json:"services,omitempty"`
+}
+
+// NetworkGraphLink is a connection between two routers, established
+// by the From router. Cost applies only to inter-router links.
+type NetworkGraphLink struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Role string `json:"role"`
+	Cost int    `json:"cost,omitempty"`
+}
+
+// NetworkService describes where an address is served across the
+// network. Origin is the id of the site that defined the service, if
+// known. The sites listed are those that expose the address or have
+// targets for it; Reachable is false if none of them has a target.
+type NetworkService struct {
+	Address   string               `json:"address"`
+	Protocol  string               `json:"protocol"`
+	Origin    string               `json:"origin,omitempty"`
+	Sites     []NetworkServiceSite `json:"sites"`
+	Reachable bool                 `json:"reachable"`
+}
+
+// NetworkServiceSite records the number of targets a site has for a
+// service
+type NetworkServiceSite struct {
+	Id      string `json:"id"`
+	Targets int    `json:"targets"`
 }
 
 type ServiceInterface struct {
@@ -293,15 +488,75 @@ type ServiceInterface struct {
 	Headless     *Headless                `json:"headless,omitempty"`
 	Targets      []ServiceInterfaceTarget `json:"targets"`
 	Origin       string                   `json:"origin,omitempty"`
+	Tls          *ServiceInterfaceTls     `json:"tls,omitempty"`
+	Ports        []ServiceInterfacePort   `json:"ports,omitempty"`
+}
+
+// ServiceInterfacePort is one of the named ports of a service with
+// several. The first is also held in the Port field of the service,
+// and its traffic is carried on the service address, whereas each of
+// the others is carried on an address of its own.
+type ServiceInterfacePort struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+// GetAdditionalPorts returns the ports of the service other than the
+// first
+func (s *ServiceInterface) GetAdditionalPorts() []ServiceInterfacePort {
+	if len(s.Ports) < 2 {
+		return nil
+	}
+	return s.Ports[1:]
+}
+
+// GetPortAddress returns the address that carries traffic for the
+// named additional port of a service
+func GetPortAddress(address string, port string) string {
+	return address + ":" + port
+}
+
+// ServiceInterfaceTls names the secrets used to encrypt traffic
+// between the router and the clients and targets of a service in the
+// local site. Credentials is a secret holding tls.crt and tls.key,
+// served by the ingress listener; CaCertificate is a secret holding
+// ca.crt, used to verify targets on egress.
+type ServiceInterfaceTls struct {
+	Credentials   string `json:"credentials,omitempty"`
+	CaCertificate string `json:"caCertificate,omitempty"`
 }
 
 type ServiceInterfaceTarget struct {
-	Name       string `json:"name,omitempty"`
-	Selector   string `json:"selector,omitempty"`
-	TargetPort int    `json:"targetPort,omitempty"`
-	Service    string `json:"service,omitempty"`
+	Name           string         `json:"name,omitempty"`
+	Selector       string         `json:"selector,omitempty"`
+	TargetPort     int            `json:"targetPort,omitempty"`
+	Service        string         `json:"service,omitempty"`
+	Weight         int            `json:"weight,omitempty"`
+	SitePreference string         `json:"sitePreference,omitempty"`
+	TargetPorts    map[string]int `json:"targetPorts,omitempty"`
 }
 
+// The site preference of a target determines which clients it
+// serves. By default a target serves clients at any site. Clients at
+// the same site as a prefer-local target are routed by the router to
+// the targets in that site while any have endpoints available. A
+// local-only target serves only clients at its own site, which are
+// then served only by the targets in that site. A failover-only target
+// is used only when no other target in its site has endpoints
+// available.
+const (
+	SitePreferencePreferLocal  string = "prefer-local"
+	SitePreferenceLocalOnly    string = "local-only"
+	SitePreferenceFailoverOnly string = "failover-only"
+)
+
+// The weight of a target determines the share of connections it
+// receives relative to other targets, and is applied by registering
+// each of its endpoints with the router that many times. The router
+// has a connector for each endpoint, port and unit of weight, so the
+// weight is kept small.
+const MaxTargetWeight int = 10
+
 type Headless struct {
 	Name       string `json:"name"`
 	Size       int    `json:"size"`
@@ -0,0 +1,69 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1alpha1 holds the custom resources through which a site,
+// its connection tokens and its service interfaces can be managed as
+// an alternative to the skupper-site and skupper-services config maps
+// and labelled token secrets, along with the policies restricting the
+// services exchanged with other sites.
+package v1alpha1
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	GroupName string = "skupper.io"
+	Version   string = "v1alpha1"
+)
+
+var SchemeGroupVersion = schema.GroupVersion{Group: GroupName, Version: Version}
+
+var (
+	SkupperSiteResource       = SchemeGroupVersion.WithResource("skuppersites")
+	SkupperTokenResource      = SchemeGroupVersion.WithResource("skuppertokens")
+	ServiceInterfaceResource  = SchemeGroupVersion.WithResource("serviceinterfaces")
+	ServiceSyncPolicyResource = SchemeGroupVersion.WithResource("servicesyncpolicies")
+)
+
+const (
+	SkupperSiteKind       string = "SkupperSite"
+	SkupperTokenKind      string = "SkupperToken"
+	ServiceInterfaceKind  string = "ServiceInterface"
+	ServiceSyncPolicyKind string = "ServiceSyncPolicy"
+)
+
+// FromUnstructured converts an object retrieved through the dynamic
+// client into one of the resource types of this package
+func FromUnstructured(obj interface{}, into interface{}) error {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("Expected unstructured object but got %T", obj)
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), into)
+}
+
+// ToUnstructured converts one of the resource types of this package
+// into the form used by the dynamic client
+func ToUnstructured(obj interface{}) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
@@ -0,0 +1,222 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/skupperproject/skupper/api/types"
+)
+
+// Status values reported by the resources
+const (
+	StatusReady     string = "Ready"
+	StatusError     string = "Error"
+	StatusPending   string = "Pending"
+	StatusGenerated string = "Generated"
+	StatusConnected string = "Connected"
+)
+
+// SkupperSite configures the site in its namespace, as the skupper-site
+// config map does
+type SkupperSite struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SkupperSiteSpec   `json:"spec,omitempty"`
+	Status SkupperSiteStatus `json:"status,omitempty"`
+}
+
+// The fields of SkupperSiteSpec correspond to the keys of the
+// skupper-site config map and have the same defaults
+type SkupperSiteSpec struct {
+	Name                  string   `json:"name,omitempty"`
+	Edge                  bool     `json:"edge,omitempty"`
+	ClusterLocal          bool     `json:"clusterLocal,omitempty"`
+	Console               *bool    `json:"console,omitempty"`
+	ConsoleAuthentication string   `json:"consoleAuthentication,omitempty"`
+	ConsoleUser           string   `json:"consoleUser,omitempty"`
+	ConsolePassword       string   `json:"consolePassword,omitempty"`
+	ConsoleOidcIssuer     string   `json:"consoleOidcIssuer,omitempty"`
+	ConsoleOidcGroups     []string `json:"consoleOidcGroups,omitempty"`
+	ConsoleOperators      []string `json:"consoleOperators,omitempty"`
+	RouterConsole         bool     `json:"routerConsole,omitempty"`
+	ServiceController     *bool    `json:"serviceController,omitempty"`
+	ServiceSync           *bool    `json:"serviceSync,omitempty"`
+	ServiceSyncInterval   string   `json:"serviceSyncInterval,omitempty"`
+	ServiceSyncAgeOut     string   `json:"serviceSyncAgeOut,omitempty"`
+	RouterCpu             string   `json:"routerCpu,omitempty"`
+	RouterMemory          string   `json:"routerMemory,omitempty"`
+	RouterCpuLimit        string   `json:"routerCpuLimit,omitempty"`
+	RouterMemoryLimit     string   `json:"routerMemoryLimit,omitempty"`
+	ControllerCpu         string   `json:"controllerCpu,omitempty"`
+	ControllerMemory      string   `json:"controllerMemory,omitempty"`
+	ControllerCpuLimit    string   `json:"controllerCpuLimit,omitempty"`
+	ControllerMemoryLimit string   `json:"controllerMemoryLimit,omitempty"`
+	NodeSelector          string   `json:"nodeSelector,omitempty"`
+	NodeAffinity          string   `json:"nodeAffinity,omitempty"`
+	Tolerations           []string `json:"tolerations,omitempty"`
+	PriorityClass         string   `json:"priorityClass,omitempty"`
+	RouterReplicas        int32    `json:"routerReplicas,omitempty"`
+}
+
+type SkupperSiteStatus struct {
+	Status         string       `json:"status,omitempty"`
+	Message        string       `json:"message,omitempty"`
+	SiteId         string       `json:"siteId,omitempty"`
+	Routers        int32        `json:"routers"`
+	ReadyRouters   int32        `json:"readyRouters"`
+	ConnectedSites int          `json:"connectedSites"`
+	LastUpdated    *metav1.Time `json:"lastUpdated,omitempty"`
+}
+
+// The types of SkupperToken
+const (
+	// A token request has the site generate a token into the secret
+	// of the same name, for use by other sites
+	TokenTypeRequest string = "request"
+	// A token link has the site connect to another using the token
+	// held in the secret of the same name
+	TokenTypeLink string = "link"
+)
+
+// SkupperToken either requests a connection token from its site or
+// links its site to another using a token. In both cases the token is
+// held in the secret with the same name as the resource.
+type SkupperToken struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SkupperTokenSpec   `json:"spec,omitempty"`
+	Status SkupperTokenStatus `json:"status,omitempty"`
+}
+
+type SkupperTokenSpec struct {
+	Type string `json:"type"`
+	// Cost applies to links only
+	Cost int32 `json:"cost,omitempty"`
+	// Expiry and Uses apply to requests only
+	Expiry string `json:"expiry,omitempty"`
+	Uses   int    `json:"uses,omitempty"`
+}
+
+type SkupperTokenStatus struct {
+	Status      string   `json:"status,omitempty"`
+	Message     string   `json:"message,omitempty"`
+	Expiry      string   `json:"expiry,omitempty"`
+	Redemptions []string `json:"redemptions,omitempty"`
+}
+
+// ServiceInterface defines a service exposed over the network from
+// the site in its namespace, as an entry in the skupper-services
+// config map does
+type ServiceInterface struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ServiceInterfaceSpec   `json:"spec,omitempty"`
+	Status ServiceInterfaceStatus `json:"status,omitempty"`
+}
+
+// The address defaults to the name of the resource
+type ServiceInterfaceSpec struct {
+	Address      string                         `json:"address,omitempty"`
+	Protocol     string                         `json:"protocol"`
+	Port         int                            `json:"port"`
+	Ports        []types.ServiceInterfacePort   `json:"ports,omitempty"`
+	EventChannel bool                           `json:"eventchannel,omitempty"`
+	Aggregate    string                         `json:"aggregate,omitempty"`
+	Headless     *types.Headless                `json:"headless,omitempty"`
+	Targets      []types.ServiceInterfaceTarget `json:"targets,omitempty"`
+	Tls          *types.ServiceInterfaceTls     `json:"tls,omitempty"`
+}
+
+// The targets are those bound in this site and the endpoints the
+// pods or services currently available for them
+type ServiceInterfaceStatus struct {
+	Status    string `json:"status,omitempty"`
+	Message   string `json:"message,omitempty"`
+	Targets   int    `json:"targets"`
+	Endpoints int    `json:"endpoints"`
+}
+
+// GetServiceInterface returns the definition of the service, as held
+// in the skupper-services config map
+func (s *ServiceInterface) GetServiceInterface() types.ServiceInterface {
+	address := s.Spec.Address
+	if address == "" {
+		address = s.ObjectMeta.Name
+	}
+	targets := s.Spec.Targets
+	if targets == nil {
+		targets = []types.ServiceInterfaceTarget{}
+	}
+	return types.ServiceInterface{
+		Address:      address,
+		Protocol:     s.Spec.Protocol,
+		Port:         s.Spec.Port,
+		Ports:        s.Spec.Ports,
+		EventChannel: s.Spec.EventChannel,
+		Aggregate:    s.Spec.Aggregate,
+		Headless:     s.Spec.Headless,
+		Targets:      targets,
+		Tls:          s.Spec.Tls,
+	}
+}
+
+// ServiceSyncPolicy restricts the service definitions exchanged with
+// other sites through service sync. While no policy is defined in a
+// namespace, every definition is exchanged. Where several are
+// defined, a definition is exchanged if any of their rules allows it.
+type ServiceSyncPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ServiceSyncPolicySpec   `json:"spec,omitempty"`
+	Status ServiceSyncPolicyStatus `json:"status,omitempty"`
+}
+
+// Imports are the addresses remote sites may define in this site and
+// exports the local addresses advertised to remote sites. If no
+// policy has any import rules, all imports are allowed, and likewise
+// for exports.
+type ServiceSyncPolicySpec struct {
+	Imports []ServiceSyncRule `json:"imports,omitempty"`
+	Exports []ServiceSyncRule `json:"exports,omitempty"`
+}
+
+// A rule allows the addresses matching any of its patterns to be
+// exchanged with the sites matching any of its site patterns, sites
+// being matched by id. Patterns are those of path.Match, e.g. "db-*";
+// an empty list matches everything.
+type ServiceSyncRule struct {
+	Sites     []string `json:"sites,omitempty"`
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// A definition sent by a remote site that was not imported. The site
+// is identified by its id, and by its name where that is known.
+type ServiceSyncRejection struct {
+	Site     string `json:"site"`
+	SiteName string `json:"siteName,omitempty"`
+	Address  string `json:"address"`
+}
+
+// The rejected definitions are those of all policies in the namespace
+type ServiceSyncPolicyStatus struct {
+	Status   string                 `json:"status,omitempty"`
+	Message  string                 `json:"message,omitempty"`
+	Rejected []ServiceSyncRejection `json:"rejected,omitempty"`
+}
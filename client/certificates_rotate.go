@@ -0,0 +1,314 @@
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/certs"
+	"github.com/skupperproject/skupper/pkg/kube"
+)
+
+// Certificates expiring within this period are reported by RouterInspect
+const CertificateExpiryWarningPeriod time.Duration = 30 * 24 * time.Hour
+
+const defaultRotationTimeout time.Duration = 5 * time.Minute
+
+// The certificate authorities of a site, along with the secrets
+// holding the certificates issued by each of them
+var siteCertAuthorities = []struct {
+	name   string
+	issued []string
+}{
+	{
+		name:   "skupper-ca",
+		issued: []string{"skupper-amqps", "skupper"},
+	},
+	{
+		name:   "skupper-internal-ca",
+		issued: []string{"skupper-internal"},
+	},
+}
+
+// CertificatesRotate replaces the certificate authorities of the site
+// in two phases. The first issues new CAs and has both old and new
+// trusted by the router and controller; tokens issued from then on are
+// signed by the new CAs. Completing the rotation reissues the site's
+// certificates from the new CAs and then drops the old ones, after
+// which tokens issued before the rotation are no longer accepted.
+// Unless forced, completing the rotation is refused while any site
+// linked using such a token would be disconnected.
+func (cli *VanClient) CertificatesRotate(ctx context.Context, options types.CertificatesRotateOptions) error {
+	if options.Timeout == 0 {
+		options.Timeout = defaultRotationTimeout
+	}
+	if options.Complete {
+		if !options.Force {
+			links, err := cli.getLinksUsingPreviousCA(time.Now())
+			if err != nil {
+				return err
+			}
+			if len(links) > 0 {
+				return fmt.Errorf("Sites linked using tokens issued before the rotation started would be disconnected: %s. Issue them new tokens and revoke the old ones, or use --force", strings.Join(links, ", "))
+			}
+		}
+		rotating, err := cli.reissueCertificates()
+		if err != nil {
+			return err
+		}
+		// all components must be using the new certificates before
+		// the old CA is dropped
+		if err = cli.rolloutSiteDeployments(ctx, options.Timeout); err != nil {
+			return err
+		}
+		if err = cli.dropPreviousCertAuthorities(rotating); err != nil {
+			return err
+		}
+	} else {
+		if err := cli.rotateCertAuthorities(); err != nil {
+			return err
+		}
+	}
+	return cli.rolloutSiteDeployments(ctx, options.Timeout)
+}
+
+func (cli *VanClient) getCertAuthority(name string) (*corev1.Secret, error) {
+	ca, err := cli.KubeClient.CoreV1().Secrets(cli.Namespace).Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		// edge sites have no internal CA
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve CA %s: %w", name, err)
+	}
+	return ca, nil
+}
+
+func (cli *VanClient) updateCABundle(name string, ca *corev1.Secret) error {
+	secret, err := cli.KubeClient.CoreV1().Secrets(cli.Namespace).Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Failed to retrieve secret %s: %w", name, err)
+	}
+	secret.Data["ca.crt"], err = cli.getTrustBundle(name, cli.Namespace, ca)
+	if err != nil {
+		return err
+	}
+	_, err = cli.KubeClient.CoreV1().Secrets(cli.Namespace).Update(secret)
+	if err != nil {
+		return fmt.Errorf("Failed to update secret %s: %w", name, err)
+	}
+	return nil
+}
+
+func (cli *VanClient) rotateCertAuthorities() error {
+	cas := []*corev1.Secret{}
+	for _, site := range siteCertAuthorities {
+		ca, err := cli.getCertAuthority(site.name)
+		if err != nil {
+			return err
+		}
+		if ca != nil && certs.IsRotationInProgress(ca) {
+			return fmt.Errorf("Rotation of CA %s is already in progress", site.name)
+		}
+		cas = append(cas, ca)
+	}
+	for i, site := range siteCertAuthorities {
+		if cas[i] == nil {
+			continue
+		}
+		rotated := certs.GenerateRotatedCASecret(cas[i])
+		_, err := cli.KubeClient.CoreV1().Secrets(cli.Namespace).Update(&rotated)
+		if err != nil {
+			return fmt.Errorf("Failed to update CA %s: %w", site.name, err)
+		}
+		for _, name := range site.issued {
+			if err = cli.updateCABundle(name, &rotated); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Reissues the certificates of any CA being rotated, returning the
+// names of those CAs
+func (cli *VanClient) reissueCertificates() ([]string, error) {
+	rotating := []string{}
+	for _, site := range siteCertAuthorities {
+		ca, err := cli.getCertAuthority(site.name)
+		if err != nil {
+			return nil, err
+		}
+		if ca == nil || !certs.IsRotationInProgress(ca) {
+			continue
+		}
+		rotating = append(rotating, site.name)
+		for _, name := range site.issued {
+			current, err := cli.KubeClient.CoreV1().Secrets(cli.Namespace).Get(name, metav1.GetOptions{})
+			if errors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("Failed to retrieve secret %s: %w", name, err)
+			}
+			secret, err := certs.ReissueSecret(current, ca)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to reissue certificate %s: %w", name, err)
+			}
+			secret.Data["ca.crt"], err = cli.getTrustBundle(name, cli.Namespace, ca)
+			if err != nil {
+				return nil, err
+			}
+			_, err = cli.KubeClient.CoreV1().Secrets(cli.Namespace).Update(&secret)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to update secret %s: %w", name, err)
+			}
+		}
+	}
+	if len(rotating) == 0 {
+		return nil, fmt.Errorf("No certificate rotation is in progress")
+	}
+	return rotating, nil
+}
+
+func (cli *VanClient) dropPreviousCertAuthorities(rotating []string) error {
+	for _, site := range siteCertAuthorities {
+		if !contains(rotating, site.name) {
+			continue
+		}
+		ca, err := cli.getCertAuthority(site.name)
+		if err != nil {
+			return err
+		}
+		certs.DropPreviousCA(ca)
+		_, err = cli.KubeClient.CoreV1().Secrets(cli.Namespace).Update(ca)
+		if err != nil {
+			return fmt.Errorf("Failed to update CA %s: %w", site.name, err)
+		}
+		for _, name := range site.issued {
+			if err = cli.updateCABundle(name, ca); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the sites that have linked using a token issued before the
+// rotation of the internal CA started, which will not trust this site
+// once the previous CA is dropped
+func (cli *VanClient) getLinksUsingPreviousCA(now time.Time) ([]string, error) {
+	ca, err := cli.getCertAuthority("skupper-internal-ca")
+	if err != nil || ca == nil || !certs.IsRotationInProgress(ca) {
+		return nil, err
+	}
+	cert, err := certs.GetCertificateFromSecret(ca)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read CA skupper-internal-ca: %w", err)
+	}
+	// certificate times are truncated to the second, so a token
+	// issued in the same second as the new CA is treated as issued
+	// before it
+	started := cert.NotBefore.Add(time.Second)
+	_, tokens, err := kube.GetIssuedTokens(cli.Namespace, cli.KubeClient)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve issued tokens: %w", err)
+	}
+	links := []string{}
+	for name, token := range tokens {
+		if token.Revoked || token.IsExpired(now) || !token.Issued.Before(started) {
+			continue
+		}
+		for _, site := range token.Redemptions {
+			links = append(links, fmt.Sprintf("%s (token %s)", site, name))
+		}
+	}
+	sort.Strings(links)
+	return links, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Restarts the router and then the controller so that they load the
+// current certificates, waiting for each to become available
+func (cli *VanClient) rolloutSiteDeployments(ctx context.Context, timeout time.Duration) error {
+	rotated := time.Now().Format(time.RFC3339)
+	for _, name := range []string{types.TransportDeploymentName, types.ControllerDeploymentName} {
+		err := kube.RolloutDeployment(name, cli.Namespace, types.CertsRotatedQualifier, rotated, cli.KubeClient)
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("Failed to restart %s: %w", name, err)
+		}
+		waitCtx, cancel := context.WithTimeout(ctx, timeout)
+		err = kube.WaitDeploymentRolledOut(waitCtx, name, cli.Namespace, cli.KubeClient, time.Second)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("Failed waiting for %s to restart: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func getExpiryWarning(description string, cert *x509.Certificate, now time.Time) string {
+	if now.After(cert.NotAfter) {
+		return fmt.Sprintf("%s expired on %s", description, cert.NotAfter.Format(time.RFC3339))
+	} else if cert.NotAfter.Sub(now) < CertificateExpiryWarningPeriod {
+		return fmt.Sprintf("%s expires on %s", description, cert.NotAfter.Format(time.RFC3339))
+	}
+	return ""
+}
+
+// Returns warnings for any certificate authority that is part way
+// through a rotation and for any certificate, including those of the
+// connection tokens used to link to other sites, that is close to
+// expiry
+func (cli *VanClient) getCertificateWarnings(now time.Time) []string {
+	warnings := []string{}
+	for _, site := range siteCertAuthorities {
+		ca, err := cli.getCertAuthority(site.name)
+		if err != nil || ca == nil {
+			continue
+		}
+		if certs.IsRotationInProgress(ca) {
+			warnings = append(warnings, fmt.Sprintf("Rotation of CA %s has not been completed", site.name))
+		}
+		for _, name := range append([]string{site.name}, site.issued...) {
+			secret, err := cli.KubeClient.CoreV1().Secrets(cli.Namespace).Get(name, metav1.GetOptions{})
+			if err != nil {
+				continue
+			}
+			if cert, err := certs.GetCertificateFromSecret(secret); err == nil {
+				if warning := getExpiryWarning("Certificate "+name, cert, now); warning != "" {
+					warnings = append(warnings, warning)
+				}
+			}
+		}
+	}
+	tokens, err := cli.KubeClient.CoreV1().Secrets(cli.Namespace).List(metav1.ListOptions{LabelSelector: types.TypeTokenQualifier})
+	if err == nil {
+		for _, token := range tokens.Items {
+			if cert, err := certs.GetCertificateFromSecret(&token); err == nil {
+				if warning := getExpiryWarning("Connection token "+token.ObjectMeta.Name, cert, now); warning != "" {
+					warnings = append(warnings, warning)
+				}
+			}
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/certs"
+	"github.com/skupperproject/skupper/pkg/kube"
+)
+
+func countCertificates(data []byte) int {
+	count := 0
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		count++
+	}
+	return count
+}
+
+func TestCertificatesRotate(t *testing.T) {
+	cli, err := newMockClient("skupper", "", "")
+	assert.Assert(t, err)
+	_, err = kube.NewCertAuthority(types.CertAuthority{Name: "skupper-ca"}, nil, cli.Namespace, cli.KubeClient)
+	assert.Assert(t, err)
+	_, err = kube.NewSecret(types.Credential{
+		CA:          "skupper-ca",
+		Name:        "skupper",
+		Subject:     "skupper-messaging",
+		Hosts:       []string{"skupper-messaging", "10.0.0.1"},
+		ConnectJson: true,
+	}, nil, cli.Namespace, cli.KubeClient)
+	assert.Assert(t, err)
+
+	getSecret := func(name string) *x509.Certificate {
+		secret, err := cli.KubeClient.CoreV1().Secrets(cli.Namespace).Get(name, metav1.GetOptions{})
+		assert.Assert(t, err)
+		cert, err := certs.GetCertificateFromSecret(secret)
+		assert.Assert(t, err)
+		return cert
+	}
+	original := getSecret("skupper-ca")
+
+	// completing a rotation that has not been started is an error
+	_, err = cli.reissueCertificates()
+	assert.Error(t, err, "No certificate rotation is in progress")
+
+	assert.Assert(t, cli.rotateCertAuthorities())
+	assert.Error(t, cli.rotateCertAuthorities(), "Rotation of CA skupper-ca is already in progress")
+	rotated := getSecret("skupper-ca")
+	assert.Assert(t, !rotated.Equal(original))
+	secret, err := cli.KubeClient.CoreV1().Secrets(cli.Namespace).Get("skupper", metav1.GetOptions{})
+	assert.Assert(t, err)
+	assert.Equal(t, countCertificates(secret.Data["ca.crt"]), 2)
+	assert.Assert(t, getSecret("skupper").CheckSignatureFrom(original))
+	assert.Equal(t, len(cli.getCertificateWarnings(time.Now())), 1)
+
+	rotating, err := cli.reissueCertificates()
+	assert.Assert(t, err)
+	assert.DeepEqual(t, rotating, []string{"skupper-ca"})
+	reissued := getSecret("skupper")
+	assert.Assert(t, reissued.CheckSignatureFrom(rotated))
+	assert.Equal(t, reissued.Subject.CommonName, "skupper-messaging")
+	assert.DeepEqual(t, reissued.DNSNames, []string{"skupper-messaging"})
+	assert.Equal(t, reissued.IPAddresses[0].String(), "10.0.0.1")
+	secret, err = cli.KubeClient.CoreV1().Secrets(cli.Namespace).Get("skupper", metav1.GetOptions{})
+	assert.Assert(t, err)
+	assert.Equal(t, countCertificates(secret.Data["ca.crt"]), 2)
+	_, ok := secret.Data["connect.json"]
+	assert.Assert(t, ok)
+
+	assert.Assert(t, cli.dropPreviousCertAuthorities(rotating))
+	ca, err := cli.KubeClient.CoreV1().Secrets(cli.Namespace).Get("skupper-ca", metav1.GetOptions{})
+	assert.Assert(t, err)
+	assert.Assert(t, !certs.IsRotationInProgress(ca))
+	secret, err = cli.KubeClient.CoreV1().Secrets(cli.Namespace).Get("skupper", metav1.GetOptions{})
+	assert.Assert(t, err)
+	assert.DeepEqual(t, secret.Data["ca.crt"], ca.Data["tls.crt"])
+	assert.Equal(t, len(cli.getCertificateWarnings(time.Now())), 0)
+}
+
+func TestCertificateExpiryWarning(t *testing.T) {
+	now := time.Now()
+	cert := &x509.Certificate{NotAfter: now.Add(60 * 24 * time.Hour)}
+	assert.Equal(t, getExpiryWarning("Certificate foo", cert, now), "")
+	cert.NotAfter = now.Add(10 * 24 * time.Hour)
+	assert.Equal(t, getExpiryWarning("Certificate foo", cert, now), "Certificate foo expires on "+cert.NotAfter.Format(time.RFC3339))
+	cert.NotAfter = now.Add(-time.Hour)
+	assert.Equal(t, getExpiryWarning("Certificate foo", cert, now), "Certificate foo expired on "+cert.NotAfter.Format(time.RFC3339))
+}
+
+func TestCertificatesRotateLinksUsingPreviousCA(t *testing.T) {
+	cli, err := newMockClient("skupper", "", "")
+	assert.Assert(t, err)
+	_, err = kube.NewCertAuthority(types.CertAuthority{Name: "skupper-internal-ca"}, nil, cli.Namespace, cli.KubeClient)
+	assert.Assert(t, err)
+	now := time.Now()
+	for _, token := range []types.IssuedToken{
+		{Name: "old", Issued: now.Add(-time.Hour), Expiry: now.Add(time.Hour), Redemptions: []string{"site-b", "site-a"}},
+		{Name: "revoked", Issued: now.Add(-time.Hour), Expiry: now.Add(time.Hour), Redemptions: []string{"site-c"}, Revoked: true},
+		{Name: "expired", Issued: now.Add(-time.Hour), Expiry: now.Add(-time.Minute), Redemptions: []string{"site-d"}},
+		{Name: "unused", Issued: now.Add(-time.Hour), Expiry: now.Add(time.Hour)},
+		{Name: "new", Issued: now.Add(time.Hour), Expiry: now.Add(2 * time.Hour), Redemptions: []string{"site-e"}},
+	} {
+		token := token
+		assert.Assert(t, kube.RecordIssuedToken(&token, nil, cli.Namespace, cli.KubeClient))
+	}
+
+	// no rotation is in progress
+	links, err := cli.getLinksUsingPreviousCA(now)
+	assert.Assert(t, err)
+	assert.Equal(t, len(links), 0)
+
+	assert.Assert(t, cli.rotateCertAuthorities())
+	links, err = cli.getLinksUsingPreviousCA(now)
+	assert.Assert(t, err)
+	assert.DeepEqual(t, links, []string{"site-a (token old)", "site-b (token old)"})
+
+	err = cli.CertificatesRotate(context.Background(), types.CertificatesRotateOptions{Complete: true})
+	assert.ErrorContains(t, err, "site-a (token old), site-b (token old)")
+	assert.ErrorContains(t, err, "--force")
+	ca, err := cli.KubeClient.CoreV1().Secrets(cli.Namespace).Get("skupper-internal-ca", metav1.GetOptions{})
+	assert.Assert(t, err)
+	assert.Assert(t, certs.IsRotationInProgress(ca))
+}
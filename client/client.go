@@ -5,6 +5,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
@@ -14,10 +15,11 @@ import (
 
 // A VAN Client manages orchestration and communications with the network components
 type VanClient struct {
-	Namespace   string
-	KubeClient  kubernetes.Interface
-	RouteClient *routev1client.RouteV1Client
-	RestConfig  *restclient.Config
+	Namespace     string
+	KubeClient    kubernetes.Interface
+	RouteClient   *routev1client.RouteV1Client
+	DynamicClient dynamic.Interface
+	RestConfig    *restclient.Config
 }
 
 func (cli *VanClient) GetNamespace() string {
@@ -49,6 +51,10 @@ func NewClient(namespace string, context string, kubeConfigPath string) (*VanCli
 	if err != nil {
 		return c, err
 	}
+	c.DynamicClient, err = dynamic.NewForConfig(restconfig)
+	if err != nil {
+		return c, err
+	}
 	dc, err := discovery.NewDiscoveryClientForConfig(restconfig)
 	resources, err := dc.ServerResourcesForGroupVersion("route.openshift.io/v1")
 	if err == nil && len(resources.APIResources) > 0 {
@@ -163,9 +163,63 @@ func (cli *VanClient) ConnectorCreateSecretFromFile(ctx context.Context, secretF
 	}
 }
 
-func (cli *VanClient) ConnectorCreate(ctx context.Context, secret *corev1.Secret, options types.ConnectorCreateOptions) error {
+// Sets the role of a connector to match the mode of the router, taking
+// the host and port for that role from the token it was created with
+func setConnectorRole(connector *qdr.Connector, edge bool, token *corev1.Secret) {
+	if edge {
+		connector.Host = token.ObjectMeta.Annotations["edge-host"]
+		connector.Port = token.ObjectMeta.Annotations["edge-port"]
+		connector.Role = qdr.RoleEdge
+	} else {
+		connector.Host = token.ObjectMeta.Annotations["inter-router-host"]
+		connector.Port = token.ObjectMeta.Annotations["inter-router-port"]
+		connector.Role = qdr.RoleInterRouter
+	}
+}
 
-	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+// ConnectorCreate links the site to another using the token given. The
+// certificates from the token are added to the secret the router
+// mounts for links and the connector to the configuration, from which
+// the service controller applies it to the running router, so that
+// linking a site does not disrupt its existing links.
+func (cli *VanClient) ConnectorCreate(ctx context.Context, secret *corev1.Secret, options types.ConnectorCreateOptions) error {
+	configmap, err := kube.GetConfigMap("skupper-internal" /*TODO: change to constant*/, options.SkupperNamespace, cli.KubeClient)
+	if err != nil {
+		return fmt.Errorf("Failed to retrieve router configuration: %w", err)
+	}
+	current, err := qdr.GetRouterConfigFromConfigMap(configmap)
+	if err != nil {
+		return fmt.Errorf("Failed to retrieve router configuration: %w", err)
+	}
+	//read annotations to get the host and port to connect to
+	profile := getLinkSslProfile(options.Name)
+	connector := qdr.Connector{
+		Name:       options.Name,
+		Cost:       options.Cost,
+		SslProfile: profile.Name,
+	}
+	setConnectorRole(&connector, current.IsEdge(), secret)
+	// a connector that already exists for the same endpoint keeps its
+	// certificates, and only its cost may need to change
+	if existing, ok := current.Connectors[connector.Name]; ok && existing.Role == connector.Role && existing.Host == connector.Host && existing.Port == connector.Port {
+		// the cost is that of the token, so reverts to the router's
+		// default once the token no longer specifies one; the token
+		// is not annotated, as the update leaves 0 unchanged
+		_, err = cli.updateConnector(types.ConnectorUpdateOptions{
+			SkupperNamespace: options.SkupperNamespace,
+			Name:             options.Name,
+			Cost:             effectiveCost(options.Cost),
+		})
+		return err
+	}
+	var owner *metav1.OwnerReference
+	if len(configmap.ObjectMeta.OwnerReferences) > 0 {
+		owner = &configmap.ObjectMeta.OwnerReferences[0]
+	}
+	if err := cli.addLinkCerts(options.Name, secret, owner, options.SkupperNamespace); err != nil {
+		return fmt.Errorf("Failed to add certificates for connection: %w", err)
+	}
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		configmap, err := kube.GetConfigMap("skupper-internal" /*TODO: change to constant*/, options.SkupperNamespace, cli.KubeClient)
 		if err != nil {
 			return err
@@ -174,42 +228,30 @@ func (cli *VanClient) ConnectorCreate(ctx context.Context, secret *corev1.Secret
 		if err != nil {
 			return err
 		}
-		//read annotations to get the host and port to connect to
-		profileName := options.Name + "-profile"
-		current.AddSslProfile(qdr.SslProfile{
-			Name: profileName,
-		})
-		connector := qdr.Connector{
-			Name:       options.Name,
-			Cost:       options.Cost,
-			SslProfile: profileName,
-		}
-		if current.IsEdge() {
-			connector.Host = secret.ObjectMeta.Annotations["edge-host"]
-			connector.Port = secret.ObjectMeta.Annotations["edge-port"]
-			connector.Role = qdr.RoleEdge
-		} else {
-			connector.Host = secret.ObjectMeta.Annotations["inter-router-host"]
-			connector.Port = secret.ObjectMeta.Annotations["inter-router-port"]
-			connector.Role = qdr.RoleInterRouter
-		}
+		current.AddSslProfile(profile)
 		current.AddConnector(connector)
-		current.UpdateConfigMap(configmap)
-		_, err = cli.KubeClient.CoreV1().ConfigMaps(options.SkupperNamespace).Update(configmap)
-		if err != nil {
+		if _, err = current.UpdateConfigMap(configmap); err != nil {
 			return err
 		}
-		//need to mount the secret so router can access certs and key
+		_, err = cli.KubeClient.CoreV1().ConfigMaps(options.SkupperNamespace).Update(configmap)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to update router configuration: %w", err)
+	}
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		// sites created before links were applied in place need the
+		// secret mounted once, which restarts the router
 		deployment, err := kube.GetDeployment(types.TransportDeploymentName, options.SkupperNamespace, cli.KubeClient)
-		kube.AppendSecretVolume(&deployment.Spec.Template.Spec.Volumes, &deployment.Spec.Template.Spec.Containers[0].VolumeMounts, connector.Name, "/etc/qpid-dispatch-certs/"+profileName+"/")
-		_, err = cli.KubeClient.AppsV1().Deployments(options.SkupperNamespace).Update(deployment)
-		if err != nil {
+		if err != nil || kube.HasVolume(types.TransportLinkCertsSecret, deployment) {
 			return err
 		}
+		appendLinkCertsVolume(&deployment.Spec.Template.Spec.Volumes, &deployment.Spec.Template.Spec.Containers[0].VolumeMounts)
+		_, err = cli.KubeClient.AppsV1().Deployments(options.SkupperNamespace).Update(deployment)
 		return err
 	})
 	if err != nil {
 		return fmt.Errorf("Failed to update skupper-router deployment: %w", err)
 	}
-	return nil
+	return cli.restartRouterWithoutController(options.SkupperNamespace)
 }
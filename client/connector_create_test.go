@@ -7,9 +7,15 @@ import (
 	"strings"
 	"testing"
 
+	"gotest.tools/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
 	"github.com/skupperproject/skupper/api/types"
 	"github.com/skupperproject/skupper/pkg/kube"
-	"gotest.tools/assert"
+	"github.com/skupperproject/skupper/pkg/qdr"
 )
 
 var lightRed string = "\033[1;31m"
@@ -186,3 +192,86 @@ func configureSiteAndCreateRouter(t *testing.T, ctx context.Context, cli *VanCli
 	err = cli.RouterCreate(ctx, *siteConfig)
 	assert.Assert(t, err, "Unable to create %s VAN router", name)
 }
+
+func TestConnectorCreateAndRemoveInPlace(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cli, err := newMockClient("skupper", "", "")
+	assert.Assert(t, err)
+	err = cli.RouterCreate(ctx, types.SiteConfig{
+		Spec: types.SiteConfigSpec{
+			SkupperName:       "skupper",
+			EnableController:  true,
+			EnableServiceSync: true,
+			ClusterLocal:      true,
+		},
+	})
+	assert.Assert(t, err)
+
+	getDeployment := func() *appsv1.Deployment {
+		dep, err := kube.GetDeployment(types.TransportDeploymentName, "skupper", cli.KubeClient)
+		assert.Assert(t, err)
+		return dep
+	}
+	getLinkCerts := func() map[string][]byte {
+		secret, err := cli.KubeClient.CoreV1().Secrets("skupper").Get(types.TransportLinkCertsSecret, metav1.GetOptions{})
+		assert.Assert(t, err)
+		return secret.Data
+	}
+	before := getDeployment()
+
+	token := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "conn1",
+			Annotations: map[string]string{
+				"inter-router-host": "other-site",
+				"inter-router-port": "55671",
+			},
+		},
+		Data: map[string][]byte{
+			"ca.crt":  []byte("ca"),
+			"tls.crt": []byte("cert"),
+			"tls.key": []byte("key"),
+		},
+	}
+	_, err = cli.KubeClient.CoreV1().Secrets("skupper").Create(token)
+	assert.Assert(t, err)
+	err = cli.ConnectorCreate(ctx, token, types.ConnectorCreateOptions{Name: "conn1", SkupperNamespace: "skupper", Cost: 2})
+	assert.Assert(t, err)
+
+	// the router is not restarted to link the site
+	assert.DeepEqual(t, getDeployment().Spec.Template, before.Spec.Template)
+	assert.Equal(t, string(getLinkCerts()["conn1-tls.crt"]), "cert")
+	assert.Equal(t, string(getLinkCerts()["conn1-ca.crt"]), "ca")
+	configmap, err := kube.GetConfigMap("skupper-internal", "skupper", cli.KubeClient)
+	assert.Assert(t, err)
+	config, err := qdr.GetRouterConfigFromConfigMap(configmap)
+	assert.Assert(t, err)
+	assert.Equal(t, config.Connectors["conn1"].SslProfile, "conn1-profile")
+	assert.Equal(t, config.Connectors["conn1"].Cost, int32(2))
+	assert.Equal(t, config.SslProfiles["conn1-profile"].CertFile, types.TransportLinkCertsPath+"conn1-tls.crt")
+
+	// creating it again for the same endpoint leaves its certificates
+	duplicate := token.DeepCopy()
+	duplicate.Data["tls.crt"] = []byte("other")
+	err = cli.ConnectorCreate(ctx, duplicate, types.ConnectorCreateOptions{Name: "conn1", SkupperNamespace: "skupper", Cost: 2})
+	assert.Assert(t, err)
+	assert.Equal(t, string(getLinkCerts()["conn1-tls.crt"]), "cert")
+
+	// nor to unlink it
+	err = cli.ConnectorRemove(ctx, types.ConnectorRemoveOptions{Name: "conn1", SkupperNamespace: "skupper"})
+	assert.Assert(t, err)
+	assert.DeepEqual(t, getDeployment().Spec.Template, before.Spec.Template)
+	assert.Equal(t, len(getLinkCerts()), 0)
+	configmap, err = kube.GetConfigMap("skupper-internal", "skupper", cli.KubeClient)
+	assert.Assert(t, err)
+	config, err = qdr.GetRouterConfigFromConfigMap(configmap)
+	assert.Assert(t, err)
+	_, ok := config.Connectors["conn1"]
+	assert.Assert(t, !ok)
+	_, ok = config.SslProfiles["conn1-profile"]
+	assert.Assert(t, !ok)
+	_, err = cli.KubeClient.CoreV1().Secrets("skupper").Get("conn1", metav1.GetOptions{})
+	assert.Assert(t, errors.IsNotFound(err))
+}
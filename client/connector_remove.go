@@ -11,12 +11,13 @@ import (
 	"github.com/skupperproject/skupper/pkg/qdr"
 )
 
+// ConnectorRemove removes a link to another site. The connector is
+// removed from the configuration, from which the service controller
+// removes it from the running router, so that the site's other links
+// are not disrupted.
 func (cli *VanClient) ConnectorRemove(ctx context.Context, options types.ConnectorRemoveOptions) error {
+	removed := false
 	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		deployment, err := kube.GetDeployment(types.TransportDeploymentName, options.SkupperNamespace, cli.KubeClient)
-		if err != nil {
-			return err
-		}
 		configmap, err := kube.GetConfigMap("skupper-internal", options.SkupperNamespace, cli.KubeClient)
 		if err != nil {
 			return err
@@ -27,7 +28,8 @@ func (cli *VanClient) ConnectorRemove(ctx context.Context, options types.Connect
 		}
 
 		found, connector := current.RemoveConnector(options.Name)
-		if found || options.ForceCurrent {
+		removed = found || options.ForceCurrent
+		if removed {
 			if connector.SslProfile != "" {
 				current.RemoveSslProfile(connector.SslProfile)
 			}
@@ -36,18 +38,33 @@ func (cli *VanClient) ConnectorRemove(ctx context.Context, options types.Connect
 				return err
 			}
 			_, err = cli.KubeClient.CoreV1().ConfigMaps(options.SkupperNamespace).Update(configmap)
-			if err != nil {
-				return err
-			}
-			kube.RemoveSecretVolumeForDeployment(options.Name, deployment, 0)
-			kube.DeleteSecret(options.Name, options.SkupperNamespace, cli.KubeClient)
-			_, err = cli.KubeClient.AppsV1().Deployments(options.SkupperNamespace).Update(deployment)
 			return err
 		}
 		return nil
 	})
+	if err != nil {
+		return fmt.Errorf("Failed to update router configuration: %w", err)
+	}
+	if !removed {
+		return nil
+	}
+	if err := cli.removeLinkCerts(options.Name, options.SkupperNamespace); err != nil {
+		return fmt.Errorf("Failed to remove certificates for connection: %w", err)
+	}
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		// links made before they were applied in place have their own
+		// volume, which has to be removed before the token is
+		deployment, err := kube.GetDeployment(types.TransportDeploymentName, options.SkupperNamespace, cli.KubeClient)
+		if err != nil || !kube.HasVolume(options.Name, deployment) {
+			return err
+		}
+		kube.RemoveSecretVolumeForDeployment(options.Name, deployment, 0)
+		_, err = cli.KubeClient.AppsV1().Deployments(options.SkupperNamespace).Update(deployment)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("Failed to update skupper-router deployment: %w", err)
 	}
-	return nil
+	kube.DeleteSecret(options.Name, options.SkupperNamespace, cli.KubeClient)
+	return cli.restartRouterWithoutController(options.SkupperNamespace)
 }
@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"regexp"
+	"strconv"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -103,12 +106,37 @@ func configureHostPorts(result *RouterHostPorts, cli *VanClient, namespace strin
 	}
 }
 
+func generateTokenName(tokens map[string]*types.IssuedToken) string {
+	max := 1
+	token_name_pattern := regexp.MustCompile("token([0-9]+)")
+	for name := range tokens {
+		count := token_name_pattern.FindStringSubmatch(name)
+		if len(count) > 1 {
+			v, _ := strconv.Atoi(count[1])
+			if v >= max {
+				max = v + 1
+			}
+		}
+	}
+	return "token" + strconv.Itoa(max)
+}
+
 func (cli *VanClient) ConnectorTokenCreate(ctx context.Context, subject string, namespace string) (*corev1.Secret, bool, error) {
+	return cli.ConnectorTokenCreateWithOptions(ctx, subject, namespace, types.ConnectorTokenCreateOptions{})
+}
+
+func (cli *VanClient) ConnectorTokenCreateWithOptions(ctx context.Context, subject string, namespace string, options types.ConnectorTokenCreateOptions) (*corev1.Secret, bool, error) {
 	if namespace == "" {
 		namespace = cli.Namespace
 	}
+	if options.Expiry < 0 {
+		return nil, false, fmt.Errorf("Token expiry must be positive")
+	}
+	if options.Uses < 0 {
+		return nil, false, fmt.Errorf("Token uses must be positive")
+	}
 	// TODO: return error message for all the paths
-	configmap, err := kube.GetConfigMap("skupper-internal", cli.Namespace, cli.KubeClient)
+	configmap, err := kube.GetConfigMap("skupper-internal", namespace, cli.KubeClient)
 	if err != nil {
 		return nil, false, err
 	}
@@ -120,7 +148,7 @@ func (cli *VanClient) ConnectorTokenCreate(ctx context.Context, subject string,
 		return nil, false, fmt.Errorf("Edge configuration cannot accept connections")
 	}
 	//TODO: creat const for ca
-	caSecret, err := cli.KubeClient.CoreV1().Secrets(cli.Namespace).Get("skupper-internal-ca", metav1.GetOptions{})
+	caSecret, err := cli.KubeClient.CoreV1().Secrets(namespace).Get("skupper-internal-ca", metav1.GetOptions{})
 	if err != nil {
 		return nil, false, err
 	}
@@ -130,7 +158,22 @@ func (cli *VanClient) ConnectorTokenCreate(ctx context.Context, subject string,
 		//TODO: return the actual error
 		return nil, false, fmt.Errorf("Could not determine host/ports for token")
 	}
-	secret := certs.GenerateSecret(subject, subject, hostPorts.Hosts, caSecret)
+	_, issued, err := kube.GetIssuedTokens(namespace, cli.KubeClient)
+	if err != nil {
+		return nil, false, err
+	}
+	if options.Name == "" {
+		options.Name = generateTokenName(issued)
+	}
+	validity := options.Expiry
+	if validity == 0 {
+		validity = certs.DefaultValidity
+	}
+	secret, tokenCA := certs.GenerateTokenSecret(subject, subject, hostPorts.Hosts, validity, caSecret)
+	cert, err := certs.GetCertificateFromSecret(&secret)
+	if err != nil {
+		return nil, false, err
+	}
 	annotateConnectionToken(&secret, "inter-router", hostPorts.InterRouter.Host, hostPorts.InterRouter.Port)
 	annotateConnectionToken(&secret, "edge", hostPorts.Edge.Host, hostPorts.Edge.Port)
 	if secret.ObjectMeta.Labels == nil {
@@ -145,31 +188,64 @@ func (cli *VanClient) ConnectorTokenCreate(ctx context.Context, subject string,
 	if siteConfig != nil {
 		secret.ObjectMeta.Annotations[types.TokenGeneratedBy] = siteConfig.Reference.UID
 	}
+	secret.ObjectMeta.Annotations[types.TokenName] = options.Name
+	secret.ObjectMeta.Annotations[types.TokenExpiry] = cert.NotAfter.Format(time.RFC3339)
+	// record the token so that its use can be tracked and it can be
+	// revoked later; any token previously issued under the same name
+	// is superseded
+	var owner *metav1.OwnerReference
+	deployment, err := kube.GetDeployment(types.TransportDeploymentName, namespace, cli.KubeClient)
+	if err == nil {
+		ref := kube.GetDeploymentOwnerReference(deployment)
+		owner = &ref
+	}
+	err = kube.RecordIssuedToken(&types.IssuedToken{
+		Name:    options.Name,
+		Serial:  cert.SerialNumber.Text(16),
+		Subject: subject,
+		Issued:  cert.NotBefore,
+		Expiry:  cert.NotAfter,
+		Uses:    options.Uses,
+		CA:      string(tokenCA),
+	}, owner, namespace, cli.KubeClient)
+	if err != nil {
+		return nil, false, err
+	}
+	if err = cli.updateTrustedTokens(namespace); err != nil {
+		return nil, false, err
+	}
 	return &secret, hostPorts.LocalOnly, nil
 }
 
 func (cli *VanClient) ConnectorTokenCreateFile(ctx context.Context, subject string, secretFile string) error {
-	secret, localOnly, err := cli.ConnectorTokenCreate(ctx, subject, "")
-	if err == nil {
-		//generate yaml and save it to the specified path
-		s := json.NewYAMLSerializer(json.DefaultMetaFactory, scheme.Scheme, scheme.Scheme)
-		out, err := os.Create(secretFile)
-		if err != nil {
-			return fmt.Errorf("Could not write to file " + secretFile + ": " + err.Error())
-		}
-		err = s.Encode(secret, out)
-		if err != nil {
-			return fmt.Errorf("Could not write out generated secret: " + err.Error())
-		} else {
-			var extra string
-			if localOnly {
-				extra = "(Note: token will only be valid for local cluster)"
-			}
-			fmt.Printf("Connection token written to %s %s", secretFile, extra)
-			fmt.Println()
-			return nil
-		}
-	} else {
+	return cli.ConnectorTokenCreateFileWithOptions(ctx, subject, secretFile, types.ConnectorTokenCreateOptions{})
+}
+
+func (cli *VanClient) ConnectorTokenCreateFileWithOptions(ctx context.Context, subject string, secretFile string, options types.ConnectorTokenCreateOptions) error {
+	secret, localOnly, err := cli.ConnectorTokenCreateWithOptions(ctx, subject, "", options)
+	if err != nil {
 		return err
 	}
+	return writeTokenFile(secret, localOnly, secretFile)
+}
+
+func writeTokenFile(secret *corev1.Secret, localOnly bool, secretFile string) error {
+	//generate yaml and save it to the specified path
+	s := json.NewYAMLSerializer(json.DefaultMetaFactory, scheme.Scheme, scheme.Scheme)
+	out, err := os.Create(secretFile)
+	if err != nil {
+		return fmt.Errorf("Could not write to file " + secretFile + ": " + err.Error())
+	}
+	err = s.Encode(secret, out)
+	if err != nil {
+		return fmt.Errorf("Could not write out generated secret: " + err.Error())
+	} else {
+		var extra string
+		if localOnly {
+			extra = "(Note: token will only be valid for local cluster)"
+		}
+		fmt.Printf("Connection token %s written to %s %s", secret.ObjectMeta.Annotations[types.TokenName], secretFile, extra)
+		fmt.Println()
+		return nil
+	}
 }
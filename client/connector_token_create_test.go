@@ -2,13 +2,32 @@ package client
 
 import (
 	"context"
+	"crypto/x509"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/certs"
+	"github.com/skupperproject/skupper/pkg/kube"
 	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// Returns true if the certificate of the token is trusted for
+// connections to the router of the site that issued it
+func isTokenTrusted(t *testing.T, cli *VanClient, token *corev1.Secret) bool {
+	server, err := cli.KubeClient.CoreV1().Secrets(cli.Namespace).Get(types.InterRouterProfile, metav1.GetOptions{})
+	assert.Assert(t, err)
+	roots := x509.NewCertPool()
+	assert.Assert(t, roots.AppendCertsFromPEM(server.Data["ca.crt"]))
+	cert, err := certs.GetCertificateFromSecret(token)
+	assert.Assert(t, err)
+	_, err = cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	return err == nil
+}
+
 func TestConnectorCreateTokenInterior(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -61,3 +80,69 @@ func TestConnectorCreateTokenEdge(t *testing.T) {
 	assert.Error(t, err, "Edge configuration cannot accept connections", "Expect error when edge")
 
 }
+
+func TestConnectorCreateTokenWithOptions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cli, err := newMockClient("skupper", "", "")
+
+	err = cli.RouterCreate(ctx, types.SiteConfig{
+		Spec: types.SiteConfigSpec{
+			SkupperName:       "skupper",
+			IsEdge:            false,
+			EnableController:  true,
+			EnableServiceSync: true,
+			ClusterLocal:      true,
+		},
+	})
+	assert.Check(t, err, "Unable to create VAN router")
+
+	before := time.Now()
+	secret, _, err := cli.ConnectorTokenCreateWithOptions(ctx, "conn1", "", types.ConnectorTokenCreateOptions{
+		Expiry: time.Hour,
+		Uses:   1,
+	})
+	assert.Assert(t, err, "Unable to create connector token")
+	assert.Equal(t, secret.ObjectMeta.Annotations[types.TokenName], "token1")
+
+	cert, err := certs.GetCertificateFromSecret(secret)
+	assert.Assert(t, err)
+	assert.Assert(t, cert.NotAfter.Before(before.Add(time.Hour+time.Minute)))
+	assert.Assert(t, cert.NotAfter.After(before.Add(time.Hour-time.Minute)))
+	assert.Equal(t, certs.GetTokenSerialFromSubject(cert.Subject.String()), cert.SerialNumber.Text(16))
+
+	_, tokens, err := kube.GetIssuedTokens(cli.Namespace, cli.KubeClient)
+	assert.Assert(t, err)
+	assert.Equal(t, len(tokens), 1)
+	assert.Equal(t, tokens["token1"].Serial, cert.SerialNumber.Text(16))
+	assert.Equal(t, tokens["token1"].Uses, 1)
+	assert.Assert(t, !tokens["token1"].Revoked)
+	// the token is signed by its own CA, which the router trusts
+	token1 := secret
+	assert.Assert(t, isTokenTrusted(t, cli, token1))
+	caSecret, err := cli.KubeClient.CoreV1().Secrets(cli.Namespace).Get("skupper-internal-ca", metav1.GetOptions{})
+	assert.Assert(t, err)
+	assert.DeepEqual(t, token1.Data["ca.crt"], certs.GetCABundle(caSecret))
+
+	secret, _, err = cli.ConnectorTokenCreateWithOptions(ctx, "conn1", "", types.ConnectorTokenCreateOptions{})
+	assert.Assert(t, err, "Unable to create connector token")
+	assert.Equal(t, secret.ObjectMeta.Annotations[types.TokenName], "token2")
+	token2 := secret
+
+	_, _, err = cli.ConnectorTokenCreateWithOptions(ctx, "conn1", "", types.ConnectorTokenCreateOptions{Uses: -1})
+	assert.Error(t, err, "Token uses must be positive")
+
+	err = cli.ConnectorTokenRevoke(ctx, "token1")
+	assert.Assert(t, err)
+	_, tokens, err = kube.GetIssuedTokens(cli.Namespace, cli.KubeClient)
+	assert.Assert(t, err)
+	assert.Assert(t, tokens["token1"].Revoked)
+	assert.Assert(t, !tokens["token2"].Revoked)
+	// a revoked token is refused by the router
+	assert.Assert(t, !isTokenTrusted(t, cli, token1))
+	assert.Assert(t, isTokenTrusted(t, cli, token2))
+
+	err = cli.ConnectorTokenRevoke(ctx, "token3")
+	assert.Error(t, err, "No token named token3 has been issued")
+}
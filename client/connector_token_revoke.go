@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/client-go/util/retry"
+
+	"github.com/skupperproject/skupper/pkg/kube"
+)
+
+// ConnectorTokenRevoke stops the router trusting the token, so that
+// connections made with it are refused, and records the revocation so
+// that any connection already made with it is closed
+func (cli *VanClient) ConnectorTokenRevoke(ctx context.Context, name string) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, tokens, err := kube.GetIssuedTokens(cli.Namespace, cli.KubeClient)
+		if err != nil {
+			return err
+		}
+		token, ok := tokens[name]
+		if !ok {
+			return fmt.Errorf("No token named %s has been issued", name)
+		}
+		if token.Revoked {
+			return nil
+		}
+		// the record is retained until the token expires, so that
+		// connections made with it continue to be rejected
+		token.Revoked = true
+		if err = kube.UpdateIssuedTokensConfigMap(cm, tokens); err != nil {
+			return err
+		}
+		_, err = cli.KubeClient.CoreV1().ConfigMaps(cli.Namespace).Update(cm)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return cli.updateTrustedTokens(cli.Namespace)
+}
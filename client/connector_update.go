@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/kube"
+	"github.com/skupperproject/skupper/pkg/qdr"
+)
+
+// The router uses a cost of 1 for connectors that do not specify one
+func effectiveCost(cost int32) int32 {
+	if cost == 0 {
+		return 1
+	}
+	return cost
+}
+
+// ConnectorUpdate changes the cost or link capacity of an existing
+// connection. The change is recorded in the router configuration and
+// in the token the connection was made with, then applied to each
+// running router through its management agent rather than by
+// restarting the router deployment. The router cannot change the cost
+// of an established link, so the connector is deleted and created
+// again: the link it made drops and is re-established, while the
+// router's other links are unaffected. Returns true if anything was
+// changed.
+func (cli *VanClient) ConnectorUpdate(ctx context.Context, options types.ConnectorUpdateOptions) (bool, error) {
+	if options.Cost < 0 || options.LinkCapacity < 0 {
+		return false, fmt.Errorf("The cost and link capacity of a connection cannot be negative")
+	}
+	if options.SkupperNamespace == "" {
+		options.SkupperNamespace = cli.Namespace
+	}
+	changed, err := cli.updateConnector(options)
+	if err != nil {
+		return changed, err
+	}
+	if options.Cost != 0 {
+		if err := cli.setTokenCost(options.Name, options.SkupperNamespace, options.Cost); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// Changes the cost or link capacity of the connector in the router
+// configuration and in each running router, leaving those given as 0
+// unchanged
+func (cli *VanClient) updateConnector(options types.ConnectorUpdateOptions) (bool, error) {
+	var connector qdr.Connector
+	changed := false
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configmap, err := kube.GetConfigMap("skupper-internal", options.SkupperNamespace, cli.KubeClient)
+		if err != nil {
+			return err
+		}
+		current, err := qdr.GetRouterConfigFromConfigMap(configmap)
+		if err != nil {
+			return err
+		}
+		existing, ok := current.Connectors[options.Name]
+		if !ok {
+			return errors.NewNotFound(schema.GroupResource{Resource: "connectors"}, options.Name)
+		}
+		changed = false
+		if options.Cost != 0 && effectiveCost(existing.Cost) != options.Cost {
+			existing.Cost = options.Cost
+			changed = true
+		}
+		if options.LinkCapacity != 0 && existing.LinkCapacity != options.LinkCapacity {
+			existing.LinkCapacity = options.LinkCapacity
+			changed = true
+		}
+		connector = existing
+		if !changed {
+			return nil
+		}
+		current.AddConnector(existing)
+		if _, err = current.UpdateConfigMap(configmap); err != nil {
+			return err
+		}
+		_, err = cli.KubeClient.CoreV1().ConfigMaps(options.SkupperNamespace).Update(configmap)
+		return err
+	})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, err
+		}
+		return false, fmt.Errorf("Failed to update connector %s: %w", options.Name, err)
+	}
+	if !changed {
+		return false, nil
+	}
+	if err := cli.applyConnectorUpdateWithoutController(connector, options.SkupperNamespace); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// Records the cost on the token the connection was made with, so that
+// it is retained when the site controller next checks the token
+func (cli *VanClient) setTokenCost(name string, namespace string, cost int32) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := cli.KubeClient.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		value := strconv.Itoa(int(cost))
+		if secret.ObjectMeta.Annotations[types.TokenCost] == value {
+			return nil
+		}
+		if secret.ObjectMeta.Annotations == nil {
+			secret.ObjectMeta.Annotations = map[string]string{}
+		}
+		secret.ObjectMeta.Annotations[types.TokenCost] = value
+		_, err = cli.KubeClient.CoreV1().Secrets(namespace).Update(secret)
+		return err
+	})
+}
+
+// The service controller syncs the connectors of the running routers
+// with the router configuration, so a changed connector is applied
+// here only for sites without one
+func (cli *VanClient) applyConnectorUpdateWithoutController(connector qdr.Connector, namespace string) error {
+	_, err := kube.GetDeployment(types.ControllerDeploymentName, namespace, cli.KubeClient)
+	if err == nil {
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+	return cli.applyConnectorUpdate(connector, namespace)
+}
+
+// Deletes the connector in each running router and creates it again
+// with the new cost and link capacity, which re-establishes its link.
+// Routers that do not yet have the connector load it from the
+// configuration when they start.
+func (cli *VanClient) applyConnectorUpdate(connector qdr.Connector, namespace string) error {
+	pods, err := cli.KubeClient.CoreV1().Pods(namespace).List(metav1.ListOptions{LabelSelector: "skupper.io/component=" + types.TransportComponentName})
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods.Items {
+		if !kube.IsPodReady(&pod) {
+			continue
+		}
+		actual, err := qdr.GetConnectorsForPod(pod.Name, namespace, cli.KubeClient, cli.RestConfig)
+		if err != nil {
+			return fmt.Errorf("Could not retrieve connectors of %s: %w", pod.Name, err)
+		}
+		for _, running := range actual {
+			if running.Name != connector.Name {
+				continue
+			}
+			running.Cost = connector.Cost
+			running.LinkCapacity = connector.LinkCapacity
+			if err := qdr.DeleteConnectorForPod(pod.Name, running.Name, namespace, cli.KubeClient, cli.RestConfig); err != nil {
+				return fmt.Errorf("Could not remove connector %s from %s: %w", running.Name, pod.Name, err)
+			}
+			if err := qdr.CreateConnectorForPod(pod.Name, running, namespace, cli.KubeClient, cli.RestConfig); err != nil {
+				return fmt.Errorf("Could not add connector %s to %s: %w", running.Name, pod.Name, err)
+			}
+		}
+	}
+	return nil
+}
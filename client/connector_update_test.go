@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/kube"
+	"github.com/skupperproject/skupper/pkg/qdr"
+)
+
+func TestConnectorUpdate(t *testing.T) {
+	testcases := []struct {
+		doc                  string
+		options              types.ConnectorUpdateOptions
+		expectedError        string
+		expectedUpdated      bool
+		expectedCost         int32
+		expectedLinkCapacity int32
+		expectedAnnotation   string
+	}{
+		{
+			doc:                "The cost of a connection can be changed",
+			options:            types.ConnectorUpdateOptions{Name: "conn1", Cost: 5},
+			expectedUpdated:    true,
+			expectedCost:       5,
+			expectedAnnotation: "5",
+		},
+		{
+			doc:                  "The link capacity of a connection can be changed",
+			options:              types.ConnectorUpdateOptions{Name: "conn1", LinkCapacity: 100},
+			expectedUpdated:      true,
+			expectedCost:         5,
+			expectedLinkCapacity: 100,
+			expectedAnnotation:   "5",
+		},
+		{
+			doc:                  "Setting the current values changes nothing",
+			options:              types.ConnectorUpdateOptions{Name: "conn1", Cost: 5, LinkCapacity: 100},
+			expectedUpdated:      false,
+			expectedCost:         5,
+			expectedLinkCapacity: 100,
+			expectedAnnotation:   "5",
+		},
+		{
+			doc:           "A negative cost is rejected",
+			options:       types.ConnectorUpdateOptions{Name: "conn1", Cost: -1},
+			expectedError: "The cost and link capacity of a connection cannot be negative",
+		},
+		{
+			doc:           "A connection that does not exist cannot be updated",
+			options:       types.ConnectorUpdateOptions{Name: "conn2", Cost: 2},
+			expectedError: `connectors "conn2" not found`,
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cli, err := newMockClient("skupper", "", "")
+	assert.Check(t, err, "Unabled to create client.")
+
+	err = cli.RouterCreate(ctx, types.SiteConfig{
+		Spec: types.SiteConfigSpec{
+			SkupperName:       "skupper",
+			EnableController:  true,
+			EnableServiceSync: true,
+			ClusterLocal:      true,
+		},
+	})
+	assert.Check(t, err, "Unable to create VAN router")
+
+	token := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "conn1",
+			Annotations: map[string]string{
+				"inter-router-host": "other-site",
+				"inter-router-port": "55671",
+			},
+		},
+	}
+	_, err = cli.KubeClient.CoreV1().Secrets(cli.Namespace).Create(token)
+	assert.Assert(t, err)
+	err = cli.ConnectorCreate(ctx, token, types.ConnectorCreateOptions{Name: "conn1", SkupperNamespace: cli.Namespace})
+	assert.Assert(t, err)
+
+	for _, c := range testcases {
+		updated, err := cli.ConnectorUpdate(ctx, c.options)
+		if c.expectedError != "" {
+			assert.Error(t, err, c.expectedError, c.doc)
+			continue
+		}
+		assert.Assert(t, err, c.doc)
+		assert.Equal(t, updated, c.expectedUpdated, c.doc)
+
+		configmap, err := kube.GetConfigMap("skupper-internal", cli.Namespace, cli.KubeClient)
+		assert.Assert(t, err, c.doc)
+		config, err := qdr.GetRouterConfigFromConfigMap(configmap)
+		assert.Assert(t, err, c.doc)
+		connector := config.Connectors["conn1"]
+		assert.Equal(t, connector.Cost, c.expectedCost, c.doc)
+		assert.Equal(t, connector.LinkCapacity, c.expectedLinkCapacity, c.doc)
+		assert.Equal(t, connector.Host, "other-site", c.doc)
+
+		secret, err := cli.KubeClient.CoreV1().Secrets(cli.Namespace).Get("conn1", metav1.GetOptions{})
+		assert.Assert(t, err, c.doc)
+		assert.Equal(t, secret.ObjectMeta.Annotations[types.TokenCost], c.expectedAnnotation, c.doc)
+	}
+
+	// recreating the connector for the same endpoint keeps its link
+	// capacity and applies only the change of cost
+	err = cli.ConnectorCreate(ctx, token, types.ConnectorCreateOptions{Name: "conn1", SkupperNamespace: cli.Namespace, Cost: 3})
+	assert.Assert(t, err)
+	configmap, err := kube.GetConfigMap("skupper-internal", cli.Namespace, cli.KubeClient)
+	assert.Assert(t, err)
+	config, err := qdr.GetRouterConfigFromConfigMap(configmap)
+	assert.Assert(t, err)
+	assert.Equal(t, config.Connectors["conn1"].Cost, int32(3))
+	assert.Equal(t, config.Connectors["conn1"].LinkCapacity, int32(100))
+
+	// once the token no longer specifies a cost, the default is restored
+	err = cli.ConnectorCreate(ctx, token, types.ConnectorCreateOptions{Name: "conn1", SkupperNamespace: cli.Namespace})
+	assert.Assert(t, err)
+	configmap, err = kube.GetConfigMap("skupper-internal", cli.Namespace, cli.KubeClient)
+	assert.Assert(t, err)
+	config, err = qdr.GetRouterConfigFromConfigMap(configmap)
+	assert.Assert(t, err)
+	assert.Equal(t, effectiveCost(config.Connectors["conn1"].Cost), int32(1))
+	assert.Equal(t, config.Connectors["conn1"].LinkCapacity, int32(100))
+}
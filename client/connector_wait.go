@@ -0,0 +1,31 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/skupperproject/skupper/pkg/utils"
+)
+
+// ConnectorWaitConnected blocks until the link made by the named
+// connector is active, or until the context is done
+func (cli *VanClient) ConnectorWaitConnected(ctx context.Context, name string) error {
+	pending := "the connector has not been configured"
+	err := utils.RetryWithContext(ctx, time.Second*2, func() (bool, error) {
+		vci, err := cli.ConnectorInspect(ctx, name)
+		if err != nil {
+			pending = err.Error()
+			return false, nil
+		}
+		if vci.Connected {
+			return true, nil
+		}
+		pending = fmt.Sprintf("the link to %s:%s is not active", vci.Connector.Host, vci.Connector.Port)
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("Timed out waiting for connection %s: %s", name, pending)
+	}
+	return nil
+}
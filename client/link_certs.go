@@ -0,0 +1,126 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/kube"
+	"github.com/skupperproject/skupper/pkg/qdr"
+)
+
+// The certificates of every link a site makes are held in a single
+// secret, mounted in the router through a projected volume. Adding or
+// removing a link then changes only the data of that secret, which
+// reaches the running router without restarting it, and the service
+// controller applies the connector and sslProfile for the link through
+// the router's management agent.
+
+var linkCertFiles = []string{"ca.crt", "tls.crt", "tls.key"}
+
+// The key in the link certificates secret of a file from the token
+// for a link
+func getLinkCertKey(connector string, file string) string {
+	return connector + "-" + file
+}
+
+func getLinkSslProfile(connector string) qdr.SslProfile {
+	return qdr.SslProfile{
+		Name:           qdr.GetLinkSslProfileName(connector),
+		CertFile:       types.TransportLinkCertsPath + getLinkCertKey(connector, "tls.crt"),
+		PrivateKeyFile: types.TransportLinkCertsPath + getLinkCertKey(connector, "tls.key"),
+		CaCertFile:     types.TransportLinkCertsPath + getLinkCertKey(connector, "ca.crt"),
+	}
+}
+
+func appendLinkCertsVolume(volumes *[]corev1.Volume, mounts *[]corev1.VolumeMount) {
+	kube.AppendProjectedSecretVolume(volumes, mounts, types.TransportLinkCertsSecret, []string{types.TransportLinkCertsSecret}, types.TransportLinkCertsPath)
+}
+
+func (cli *VanClient) createLinkCertsSecret(owner *metav1.OwnerReference, namespace string) error {
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: types.TransportLinkCertsSecret,
+		},
+		Data: map[string][]byte{},
+	}
+	if owner != nil {
+		secret.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+	_, err := cli.KubeClient.CoreV1().Secrets(namespace).Create(secret)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("Failed to create %s: %w", types.TransportLinkCertsSecret, err)
+	}
+	return nil
+}
+
+// Copies the certificates from the token for a link into the link
+// certificates secret
+func (cli *VanClient) addLinkCerts(name string, token *corev1.Secret, owner *metav1.OwnerReference, namespace string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := cli.KubeClient.CoreV1().Secrets(namespace).Get(types.TransportLinkCertsSecret, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			if err = cli.createLinkCertsSecret(owner, namespace); err != nil {
+				return err
+			}
+			secret, err = cli.KubeClient.CoreV1().Secrets(namespace).Get(types.TransportLinkCertsSecret, metav1.GetOptions{})
+		}
+		if err != nil {
+			return err
+		}
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		for _, file := range linkCertFiles {
+			if data, ok := token.Data[file]; ok {
+				secret.Data[getLinkCertKey(name, file)] = data
+			}
+		}
+		_, err = cli.KubeClient.CoreV1().Secrets(namespace).Update(secret)
+		return err
+	})
+}
+
+func (cli *VanClient) removeLinkCerts(name string, namespace string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := cli.KubeClient.CoreV1().Secrets(namespace).Get(types.TransportLinkCertsSecret, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		removed := false
+		for _, file := range linkCertFiles {
+			if _, ok := secret.Data[getLinkCertKey(name, file)]; ok {
+				delete(secret.Data, getLinkCertKey(name, file))
+				removed = true
+			}
+		}
+		if !removed {
+			return nil
+		}
+		_, err = cli.KubeClient.CoreV1().Secrets(namespace).Update(secret)
+		return err
+	})
+}
+
+// Links are applied to the running router by the service controller.
+// If the site has none, the router is restarted to load them instead.
+func (cli *VanClient) restartRouterWithoutController(namespace string) error {
+	_, err := kube.GetDeployment(types.ControllerDeploymentName, namespace, cli.KubeClient)
+	if err == nil {
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+	return kube.RolloutDeployment(types.TransportDeploymentName, namespace, types.SiteConfigUpdatedQualifier, time.Now().Format(time.RFC3339), cli.KubeClient)
+}
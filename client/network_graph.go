@@ -0,0 +1,12 @@
+package client
+
+import (
+	"context"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/qdr"
+)
+
+func (cli *VanClient) NetworkGraph(ctx context.Context) (*types.NetworkGraph, error) {
+	return qdr.GetNetworkGraph(cli.Namespace, cli.KubeClient, cli.RestConfig)
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"context"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/kube"
+	"github.com/skupperproject/skupper/pkg/qdr"
+)
+
+// The origin of a service definition is the id of the site it was
+// synchronised from, or empty (or the means by which it was defined,
+// i.e. annotation or resource) if it was defined locally
+func setNetworkServiceOrigins(services []*types.NetworkService, definitions []*types.ServiceInterface, localSiteId string) {
+	origins := map[string]string{}
+	for _, def := range definitions {
+		if def.Origin == "" || def.Origin == "annotation" || def.Origin == "resource" {
+			origins[def.Address] = localSiteId
+		} else {
+			origins[def.Address] = def.Origin
+		}
+	}
+	for _, service := range services {
+		service.Origin = origins[service.Address]
+	}
+}
+
+// NetworkServiceList reports, for each address in the network, the
+// sites that serve it and how many targets each has
+func (cli *VanClient) NetworkServiceList(ctx context.Context) ([]*types.NetworkService, error) {
+	services, err := qdr.GetNetworkServices(cli.Namespace, cli.KubeClient, cli.RestConfig)
+	if err != nil {
+		return nil, err
+	}
+	definitions, err := cli.ServiceInterfaceList(ctx)
+	if err != nil {
+		return services, nil
+	}
+	localSiteId := ""
+	if transport, err := kube.GetDeployment(types.TransportDeploymentName, cli.Namespace, cli.KubeClient); err == nil {
+		if env := kube.FindEnvVar(transport.Spec.Template.Spec.Containers[0].Env, "SKUPPER_SITE_ID"); env != nil {
+			localSiteId = env.Value
+		}
+	}
+	setNetworkServiceOrigins(services, definitions, localSiteId)
+	return services, nil
+}
@@ -0,0 +1,28 @@
+package client
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper/api/types"
+)
+
+func TestSetNetworkServiceOrigins(t *testing.T) {
+	services := []*types.NetworkService{
+		{Address: "local"},
+		{Address: "annotated"},
+		{Address: "remote"},
+		{Address: "unknown"},
+	}
+	definitions := []*types.ServiceInterface{
+		{Address: "local"},
+		{Address: "annotated", Origin: "annotation"},
+		{Address: "remote", Origin: "site-b"},
+	}
+	setNetworkServiceOrigins(services, definitions, "site-a")
+	assert.Equal(t, services[0].Origin, "site-a")
+	assert.Equal(t, services[1].Origin, "site-a")
+	assert.Equal(t, services[2].Origin, "site-b")
+	assert.Equal(t, services[3].Origin, "")
+}
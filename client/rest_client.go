@@ -0,0 +1,346 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/skupperproject/skupper/api/types"
+)
+
+// RestClient implements VanClientInterface over the REST API of the
+// service controller, for use where there is no access to the cluster
+// itself. Only the operations the API supports are available; the
+// others fail.
+type RestClient struct {
+	Namespace  string
+	url        *url.URL
+	token      string
+	httpClient *http.Client
+}
+
+// The url is that of the console of the site, and may include the
+// credentials of a console user. Otherwise a bearer token, e.g. an OIDC
+// id token, may be supplied.
+func NewRestClient(apiUrl string, token string) (*RestClient, error) {
+	u, err := url.Parse(apiUrl)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid API url %s: %s", apiUrl, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Invalid API url %s: scheme must be http or https", apiUrl)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v1"
+	return &RestClient{
+		url:        u,
+		token:      token,
+		httpClient: &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+func (cli *RestClient) GetNamespace() string {
+	return cli.Namespace
+}
+
+func restUnsupported(operation string) error {
+	return fmt.Errorf("%s is not supported through the REST API", operation)
+}
+
+// Error responses hold a Kubernetes Status where the server could
+// provide one, so that they can be checked in the same way as errors
+// from VanClient
+func getRestError(resp *http.Response) error {
+	data, _ := ioutil.ReadAll(resp.Body)
+	status := metav1.Status{}
+	if err := json.Unmarshal(data, &status); err != nil || status.Kind != "Status" {
+		status = metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    int32(resp.StatusCode),
+			Message: strings.TrimSpace(string(data)),
+		}
+		if status.Message == "" {
+			status.Message = resp.Status
+		}
+		switch resp.StatusCode {
+		case http.StatusUnauthorized:
+			status.Reason = metav1.StatusReasonUnauthorized
+		case http.StatusForbidden:
+			status.Reason = metav1.StatusReasonForbidden
+		case http.StatusNotFound:
+			status.Reason = metav1.StatusReasonNotFound
+		}
+	}
+	return &errors.StatusError{ErrStatus: status}
+}
+
+func (cli *RestClient) do(ctx context.Context, method string, path string, query url.Values, in interface{}, out interface{}) error {
+	// the path is already escaped
+	target := cli.url.String() + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	// the API refuses changes from requests without this header
+	req.Header.Set("X-Requested-With", "skupper")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if cli.token != "" {
+		req.Header.Set("Authorization", "Bearer "+cli.token)
+	}
+	resp, err := cli.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return getRestError(resp)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+func (cli *RestClient) RouterCreate(ctx context.Context, options types.SiteConfig) error {
+	return restUnsupported("RouterCreate")
+}
+
+func (cli *RestClient) RouterInspect(ctx context.Context) (*types.RouterInspectResponse, error) {
+	site := &types.RouterInspectResponse{}
+	if err := cli.do(ctx, http.MethodGet, "/site", nil, nil, site); err != nil {
+		return nil, err
+	}
+	return site, nil
+}
+
+func (cli *RestClient) RouterUpdate(ctx context.Context, options types.SiteConfig) (bool, error) {
+	return false, restUnsupported("RouterUpdate")
+}
+
+func (cli *RestClient) RouterRemove(ctx context.Context) error {
+	return restUnsupported("RouterRemove")
+}
+
+func (cli *RestClient) RouterWaitReady(ctx context.Context) error {
+	return restUnsupported("RouterWaitReady")
+}
+
+func (cli *RestClient) ConnectorCreateFromFile(ctx context.Context, secretFile string, options types.ConnectorCreateOptions) (*corev1.Secret, error) {
+	return nil, restUnsupported("ConnectorCreateFromFile")
+}
+
+func (cli *RestClient) ConnectorCreateSecretFromFile(ctx context.Context, secretFile string, options types.ConnectorCreateOptions) (*corev1.Secret, error) {
+	return nil, restUnsupported("ConnectorCreateSecretFromFile")
+}
+
+func (cli *RestClient) ConnectorCreate(ctx context.Context, secret *corev1.Secret, options types.ConnectorCreateOptions) error {
+	return restUnsupported("ConnectorCreate")
+}
+
+func (cli *RestClient) ConnectorInspect(ctx context.Context, name string) (*types.ConnectorInspectResponse, error) {
+	connector := &types.ConnectorInspectResponse{}
+	if err := cli.do(ctx, http.MethodGet, "/connectors/"+url.PathEscape(name), nil, nil, connector); err != nil {
+		return nil, err
+	}
+	return connector, nil
+}
+
+func (cli *RestClient) ConnectorList(ctx context.Context) ([]*types.Connector, error) {
+	connectors := []*types.Connector{}
+	if err := cli.do(ctx, http.MethodGet, "/connectors", nil, nil, &connectors); err != nil {
+		return nil, err
+	}
+	return connectors, nil
+}
+
+func (cli *RestClient) ConnectorRemove(ctx context.Context, options types.ConnectorRemoveOptions) error {
+	return cli.do(ctx, http.MethodDelete, "/connectors/"+url.PathEscape(options.Name), nil, nil, nil)
+}
+
+func (cli *RestClient) ConnectorUpdate(ctx context.Context, options types.ConnectorUpdateOptions) (bool, error) {
+	request := types.ConnectorUpdateRequest{
+		Cost:         options.Cost,
+		LinkCapacity: options.LinkCapacity,
+	}
+	response := types.ConnectorUpdateResponse{}
+	if err := cli.do(ctx, http.MethodPut, "/connectors/"+url.PathEscape(options.Name), nil, request, &response); err != nil {
+		return false, err
+	}
+	return response.Updated, nil
+}
+
+func (cli *RestClient) ConnectorWaitConnected(ctx context.Context, name string) error {
+	return restUnsupported("ConnectorWaitConnected")
+}
+
+func (cli *RestClient) ConnectorTokenCreate(ctx context.Context, subject string, namespace string) (*corev1.Secret, bool, error) {
+	return cli.ConnectorTokenCreateWithOptions(ctx, subject, namespace, types.ConnectorTokenCreateOptions{})
+}
+
+func (cli *RestClient) ConnectorTokenCreateFile(ctx context.Context, subject string, secretFile string) error {
+	return cli.ConnectorTokenCreateFileWithOptions(ctx, subject, secretFile, types.ConnectorTokenCreateOptions{})
+}
+
+func (cli *RestClient) ConnectorTokenCreateWithOptions(ctx context.Context, subject string, namespace string, options types.ConnectorTokenCreateOptions) (*corev1.Secret, bool, error) {
+	request := types.TokenRequest{
+		Name:    options.Name,
+		Subject: subject,
+		Uses:    options.Uses,
+	}
+	if options.Expiry != 0 {
+		request.Expiry = options.Expiry.String()
+	}
+	response := types.TokenResponse{}
+	if err := cli.do(ctx, http.MethodPost, "/tokens", nil, request, &response); err != nil {
+		return nil, false, err
+	}
+	return response.Token, response.LocalOnly, nil
+}
+
+func (cli *RestClient) ConnectorTokenCreateFileWithOptions(ctx context.Context, subject string, secretFile string, options types.ConnectorTokenCreateOptions) error {
+	secret, localOnly, err := cli.ConnectorTokenCreateWithOptions(ctx, subject, "", options)
+	if err != nil {
+		return err
+	}
+	return writeTokenFile(secret, localOnly, secretFile)
+}
+
+func (cli *RestClient) ConnectorTokenRevoke(ctx context.Context, name string) error {
+	return cli.do(ctx, http.MethodDelete, "/tokens/"+url.PathEscape(name), nil, nil, nil)
+}
+
+func (cli *RestClient) CertificatesRotate(ctx context.Context, options types.CertificatesRotateOptions) error {
+	return restUnsupported("CertificatesRotate")
+}
+
+func (cli *RestClient) NetworkGraph(ctx context.Context) (*types.NetworkGraph, error) {
+	return nil, restUnsupported("NetworkGraph")
+}
+
+func (cli *RestClient) NetworkServiceList(ctx context.Context) ([]*types.NetworkService, error) {
+	return nil, restUnsupported("NetworkServiceList")
+}
+
+func (cli *RestClient) ServiceInterfaceCreate(ctx context.Context, service *types.ServiceInterface) error {
+	return cli.do(ctx, http.MethodPost, "/services", nil, service, nil)
+}
+
+// As for VanClient, a service that is not defined is not an error
+func (cli *RestClient) ServiceInterfaceInspect(ctx context.Context, address string) (*types.ServiceInterface, error) {
+	service := &types.ServiceInterface{}
+	err := cli.do(ctx, http.MethodGet, "/services/"+url.PathEscape(address), nil, nil, service)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+func (cli *RestClient) ServiceInterfaceList(ctx context.Context) ([]*types.ServiceInterface, error) {
+	services := []*types.ServiceInterface{}
+	if err := cli.do(ctx, http.MethodGet, "/services", nil, nil, &services); err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+func (cli *RestClient) ServiceInterfaceRemove(ctx context.Context, address string) error {
+	return cli.do(ctx, http.MethodDelete, "/services/"+url.PathEscape(address), nil, nil, nil)
+}
+
+// Unlike VanClient, a service that is not yet defined is created
+func (cli *RestClient) ServiceInterfaceUpdate(ctx context.Context, service *types.ServiceInterface) error {
+	current, err := cli.ServiceInterfaceInspect(ctx, service.Address)
+	if err != nil {
+		return err
+	} else if current == nil {
+		return cli.ServiceInterfaceCreate(ctx, service)
+	}
+	return cli.do(ctx, http.MethodPut, "/services/"+url.PathEscape(service.Address), nil, service, nil)
+}
+
+func (cli *RestClient) ServiceInterfaceWaitReady(ctx context.Context, address string) error {
+	return restUnsupported("ServiceInterfaceWaitReady")
+}
+
+func (cli *RestClient) ServiceInterfaceApply(ctx context.Context, services []*types.ServiceInterface, options types.ServiceInterfaceApplyOptions) (*types.ServiceInterfaceApplyResponse, error) {
+	return nil, restUnsupported("ServiceInterfaceApply")
+}
+
+func (cli *RestClient) ServiceInterfaceBind(ctx context.Context, service *types.ServiceInterface, targetType string, targetName string, protocol string, targetPort int) error {
+	return cli.ServiceInterfaceBindWithOptions(ctx, service, targetType, targetName, protocol, targetPort, types.ServiceInterfaceBindOptions{})
+}
+
+func (cli *RestClient) ServiceInterfaceBindWithOptions(ctx context.Context, service *types.ServiceInterface, targetType string, targetName string, protocol string, targetPort int, options types.ServiceInterfaceBindOptions) error {
+	request := types.ServiceTargetRequest{
+		Type:           targetType,
+		Name:           targetName,
+		Protocol:       protocol,
+		Port:           targetPort,
+		Weight:         options.Weight,
+		SitePreference: options.SitePreference,
+		Service:        service,
+	}
+	return cli.do(ctx, http.MethodPost, "/services/"+url.PathEscape(service.Address)+"/targets", nil, request, nil)
+}
+
+func (cli *RestClient) GetHeadlessServiceConfiguration(targetName string, protocol string, address string, port int) (*types.ServiceInterface, error) {
+	return nil, restUnsupported("GetHeadlessServiceConfiguration")
+}
+
+func (cli *RestClient) ServiceInterfaceUnbind(ctx context.Context, targetType string, targetName string, address string, deleteIfNoTargets bool) error {
+	if address == "" {
+		address = targetName
+	}
+	query := url.Values{}
+	if deleteIfNoTargets {
+		query.Set("deleteIfNoTargets", "true")
+	}
+	return cli.do(ctx, http.MethodDelete, "/services/"+url.PathEscape(address)+"/targets/"+url.PathEscape(targetType)+"/"+url.PathEscape(targetName), query, nil, nil)
+}
+
+func (cli *RestClient) SiteConfigCreate(ctx context.Context, spec types.SiteConfigSpec) (*types.SiteConfig, error) {
+	return nil, restUnsupported("SiteConfigCreate")
+}
+
+// The site config may hold console credentials, so is not available
+// through the REST API. As for a site without one, nil is returned.
+func (cli *RestClient) SiteConfigInspect(ctx context.Context, input *corev1.ConfigMap) (*types.SiteConfig, error) {
+	return nil, nil
+}
+
+func (cli *RestClient) SiteConfigRemove(ctx context.Context) error {
+	return restUnsupported("SiteConfigRemove")
+}
+
+func (cli *RestClient) SkupperDump(ctx context.Context, tarName string, version string, kubeConfigPath string, kubeConfigContext string) error {
+	return restUnsupported("SkupperDump")
+}
+
+var _ types.VanClientInterface = &RestClient{}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gotest.tools/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/skupperproject/skupper/api/types"
+)
+
+func TestRestClient(t *testing.T) {
+	type request struct {
+		method string
+		path   string
+		query  string
+		user   string
+		body   string
+	}
+	requests := []request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		user, _, _ := r.BasicAuth()
+		requests = append(requests, request{r.Method, r.URL.EscapedPath(), r.URL.RawQuery, user, string(body)})
+		switch r.URL.Path {
+		case "/api/v1/services/tcp-go-echo":
+			json.NewEncoder(w).Encode(types.ServiceInterface{Address: "tcp-go-echo", Protocol: "tcp", Port: 9090})
+		case "/api/v1/services/tcp-go-echo/targets/deployment/tcp-go-echo":
+			w.WriteHeader(http.StatusNoContent)
+		case "/api/v1/services":
+			json.NewEncoder(w).Encode([]types.ServiceInterface{{Address: "tcp-go-echo", Protocol: "tcp", Port: 9090}})
+		case "/api/v1/tokens/token1":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"kind": "Status", "apiVersion": "v1", "status": "Failure", "message": "The operator role is required", "reason": "Forbidden", "code": 403}`))
+		case "/api/v1/connectors":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("Unauthorized\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"kind": "Status", "apiVersion": "v1", "status": "Failure", "message": "Service other not defined", "reason": "NotFound", "code": 404}`))
+		}
+	}))
+	defer server.Close()
+
+	_, err := NewRestClient("ftp://example.com", "")
+	assert.Error(t, err, "Invalid API url ftp://example.com: scheme must be http or https")
+
+	cli, err := NewRestClient(server.URL+"/", "")
+	assert.Assert(t, err)
+	ctx := context.Background()
+
+	service, err := cli.ServiceInterfaceInspect(ctx, "tcp-go-echo")
+	assert.Assert(t, err)
+	assert.Equal(t, service.Port, 9090)
+
+	service, err = cli.ServiceInterfaceInspect(ctx, "other")
+	assert.Assert(t, err)
+	assert.Assert(t, service == nil)
+
+	services, err := cli.ServiceInterfaceList(ctx)
+	assert.Assert(t, err)
+	assert.Equal(t, len(services), 1)
+
+	err = cli.ConnectorTokenRevoke(ctx, "token1")
+	assert.Assert(t, errors.IsForbidden(err))
+	assert.Error(t, err, "The operator role is required")
+
+	_, err = cli.ConnectorList(ctx)
+	assert.Assert(t, errors.IsUnauthorized(err))
+	assert.Error(t, err, "Unauthorized")
+
+	err = cli.ServiceInterfaceUnbind(ctx, "deployment", "tcp-go-echo", "", true)
+	assert.Assert(t, err)
+
+	err = cli.ServiceInterfaceBind(ctx, &types.ServiceInterface{Address: "a/b", Protocol: "tcp"}, "deployment", "ab", "", 8080)
+	assert.Assert(t, errors.IsNotFound(err))
+
+	err = cli.RouterCreate(ctx, types.SiteConfig{})
+	assert.Error(t, err, "RouterCreate is not supported through the REST API")
+
+	assert.Equal(t, len(requests), 7)
+	assert.Equal(t, requests[5], request{http.MethodDelete, "/api/v1/services/tcp-go-echo/targets/deployment/tcp-go-echo", "deleteIfNoTargets=true", "", ""})
+	assert.Equal(t, requests[6].path, "/api/v1/services/a%2Fb/targets")
+	assert.Equal(t, requests[6].body, `{"type":"deployment","name":"ab","port":8080,"service":{"address":"a/b","protocol":"tcp","port":0,"targets":null}}`)
+
+	// credentials in the url are used for basic authentication
+	cli, err = NewRestClient("http://rubble:barney@"+server.Listener.Addr().String(), "")
+	assert.Assert(t, err)
+	_, err = cli.ServiceInterfaceList(ctx)
+	assert.Assert(t, err)
+	assert.Equal(t, requests[7].user, "rubble")
+}
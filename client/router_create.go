@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	routev1 "github.com/openshift/api/route/v1"
@@ -14,6 +15,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubetypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
 
 	"github.com/skupperproject/skupper/api/types"
 	"github.com/skupperproject/skupper/pkg/kube"
@@ -60,6 +62,8 @@ func (cli *VanClient) GetVanControllerSpec(options types.SiteConfigSpec, van *ty
 		van.Controller.Image = types.DefaultControllerImage
 	}
 	van.Controller.Replicas = 1
+	van.Controller.Resources, _ = kube.GetResourceRequirements(options.Controller)
+	setScheduling(&van.Controller, options)
 	//TODO: change these to types constants
 	van.Controller.Labels = map[string]string{
 		"application":          "skupper",
@@ -91,6 +95,19 @@ func (cli *VanClient) GetVanControllerSpec(options types.SiteConfigSpec, van *ty
 	} else if options.AuthMode == string(types.ConsoleAuthModeInternal) {
 		envVars = append(envVars, corev1.EnvVar{Name: "METRICS_USERS", Value: "/etc/console-users"})
 		kube.AppendSecretVolume(&volumes, &mounts[serviceController], "skupper-console-users", "/etc/console-users/")
+	} else if options.AuthMode == types.ConsoleAuthModeHtpasswd {
+		envVars = append(envVars, corev1.EnvVar{Name: "METRICS_HTPASSWD", Value: "/etc/console-htpasswd/htpasswd"})
+		kube.AppendSecretVolume(&volumes, &mounts[serviceController], types.ConsoleHtpasswdSecret, "/etc/console-htpasswd/")
+	} else if options.AuthMode == types.ConsoleAuthModeOidc {
+		envVars = append(envVars, corev1.EnvVar{Name: "METRICS_OIDC_ISSUER", Value: options.OidcIssuer})
+		envVars = append(envVars, corev1.EnvVar{Name: "METRICS_OIDC_CREDENTIALS", Value: "/etc/console-oidc"})
+		if len(options.OidcGroups) > 0 {
+			envVars = append(envVars, corev1.EnvVar{Name: "METRICS_OIDC_GROUPS", Value: strings.Join(options.OidcGroups, ",")})
+		}
+		kube.AppendSecretVolume(&volumes, &mounts[serviceController], types.ConsoleOidcSecret, "/etc/console-oidc/")
+	}
+	if len(options.ConsoleOperators) > 0 {
+		envVars = append(envVars, corev1.EnvVar{Name: "METRICS_OPERATORS", Value: strings.Join(options.ConsoleOperators, ",")})
 	}
 
 	if options.EnableServiceSync {
@@ -98,6 +115,12 @@ func (cli *VanClient) GetVanControllerSpec(options types.SiteConfigSpec, van *ty
 			Name:  "SKUPPER_SERVICE_SYNC_ORIGIN",
 			Value: siteId,
 		})
+		if options.ServiceSyncInterval != 0 {
+			envVars = append(envVars, corev1.EnvVar{Name: "SKUPPER_SERVICE_SYNC_INTERVAL", Value: options.ServiceSyncInterval.String()})
+		}
+		if options.ServiceSyncAgeOut != 0 {
+			envVars = append(envVars, corev1.EnvVar{Name: "SKUPPER_SERVICE_SYNC_AGE_OUT", Value: options.ServiceSyncAgeOut.String()})
+		}
 		kube.AppendSecretVolume(&volumes, &mounts[serviceController], "skupper", "/etc/messaging/")
 	}
 	van.Controller.EnvVar = envVars
@@ -135,6 +158,18 @@ func (cli *VanClient) GetVanControllerSpec(options types.SiteConfigSpec, van *ty
 		},
 		Rules: types.ControllerEditPolicyRule,
 	})
+	if len(options.ConsoleOperators) > 0 {
+		roles = append(roles, &rbacv1.Role{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "rbac.authorization.k8s.io/v1",
+				Kind:       "Role",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: types.ControllerOperatorRoleName,
+			},
+			Rules: types.ControllerOperatorPolicyRule,
+		})
+	}
 	van.Controller.Roles = roles
 
 	roleBindings := []*rbacv1.RoleBinding{}
@@ -155,6 +190,25 @@ func (cli *VanClient) GetVanControllerSpec(options types.SiteConfigSpec, van *ty
 			Name: "skupper-edit",
 		},
 	})
+	if len(options.ConsoleOperators) > 0 {
+		roleBindings = append(roleBindings, &rbacv1.RoleBinding{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "rbac.authorization.k8s.io/v1",
+				Kind:       "RoleBinding",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "skupper-proxy-controller-" + types.ControllerOperatorRoleName,
+			},
+			Subjects: []rbacv1.Subject{{
+				Kind: "ServiceAccount",
+				Name: "skupper-proxy-controller",
+			}},
+			RoleRef: rbacv1.RoleRef{
+				Kind: "Role",
+				Name: types.ControllerOperatorRoleName,
+			},
+		})
+	}
 	van.Controller.RoleBindings = roleBindings
 
 	svctype := corev1.ServiceTypeClusterIP
@@ -262,11 +316,21 @@ func (cli *VanClient) GetRouterSpecFromOpts(options types.SiteConfigSpec, siteId
 		van.Transport.Image = types.DefaultTransportImage
 	}
 	van.Transport.Replicas = 1
+	if options.Replicas > 1 {
+		van.Transport.Replicas = options.Replicas
+	}
 	van.Transport.Labels = map[string]string{
 		"application":          types.TransportDeploymentName,
 		"skupper.io/component": types.TransportComponentName,
 	}
 	van.Transport.Annotations = types.TransportPrometheusAnnotations
+	van.Transport.Resources, _ = kube.GetResourceRequirements(options.Router)
+	setScheduling(&van.Transport, options)
+	if van.Transport.Replicas > 1 {
+		van.Transport.Affinity = kube.WithReplicaAntiAffinity(van.Transport.Affinity, map[string]string{
+			"skupper.io/component": types.TransportComponentName,
+		})
+	}
 
 	routerConfig := qdr.InitialConfig(van.Name+"-${HOSTNAME}", siteId, options.IsEdge)
 	routerConfig.AddAddress(qdr.Address{
@@ -420,6 +484,7 @@ func (cli *VanClient) GetRouterSpecFromOpts(options types.SiteConfigSpec, siteId
 	if !options.IsEdge {
 		kube.AppendSecretVolume(&volumes, &mounts[qdrouterd], "skupper-internal", "/etc/qpid-dispatch-certs/skupper-internal/")
 	}
+	appendLinkCertsVolume(&volumes, &mounts[qdrouterd])
 	if options.EnableRouterConsole {
 		if options.AuthMode == string(types.ConsoleAuthModeOpenshift) {
 			sidecars = append(sidecars, OauthProxyContainer("skupper", strconv.Itoa(int(types.ConsoleOpenShiftServicePort))))
@@ -745,7 +810,95 @@ func (cli *VanClient) GetRouterSpecFromOpts(options types.SiteConfigSpec, siteId
 }
 
 // RouterCreate instantiates a VAN (router and controller) deployment
+func validateServiceSyncIntervals(spec types.SiteConfigSpec) error {
+	interval := spec.ServiceSyncInterval
+	if interval == 0 {
+		interval = types.DefaultServiceSyncInterval
+	}
+	ageOut := spec.ServiceSyncAgeOut
+	if ageOut == 0 {
+		ageOut = types.DefaultServiceSyncAgeOut
+	}
+	if interval < 0 || ageOut < 0 {
+		return fmt.Errorf("The service sync interval and age out cannot be negative")
+	} else if ageOut <= interval {
+		return fmt.Errorf("The service sync age out (%s) must be longer than the interval (%s)", ageOut, interval)
+	}
+	return nil
+}
+
+// The htpasswd and oidc modes are implemented by the skupper console
+// alone, so cannot be used with the router console
+func validateConsoleAuth(spec types.SiteConfigSpec) error {
+	switch spec.AuthMode {
+	case "", string(types.ConsoleAuthModeOpenshift), types.ConsoleAuthModeInternal, types.ConsoleAuthModeUnsecured:
+		return nil
+	case types.ConsoleAuthModeHtpasswd, types.ConsoleAuthModeOidc:
+		if spec.EnableRouterConsole {
+			return fmt.Errorf("The router console does not support console authentication mode %s", spec.AuthMode)
+		}
+		if spec.AuthMode == types.ConsoleAuthModeOidc && spec.OidcIssuer == "" {
+			return fmt.Errorf("An issuer is required for console authentication mode oidc")
+		}
+		return nil
+	default:
+		return fmt.Errorf("Invalid console authentication mode %s", spec.AuthMode)
+	}
+}
+
+// Applies the placement configured for the site, which has been
+// checked by validateScheduling, to a deployment
+func setScheduling(ds *types.DeploymentSpec, spec types.SiteConfigSpec) {
+	ds.NodeSelector, _ = kube.ParseNodeLabels(spec.NodeSelector)
+	affinity, _ := kube.ParseNodeLabels(spec.NodeAffinity)
+	ds.Affinity = kube.GetNodeAffinity(affinity)
+	ds.Tolerations, _ = kube.ParseTolerations(spec.Tolerations)
+	ds.PriorityClassName = spec.PriorityClass
+}
+
+func validateScheduling(spec types.SiteConfigSpec) error {
+	if _, err := kube.GetResourceRequirements(spec.Router); err != nil {
+		return fmt.Errorf("Invalid router resources: %s", err)
+	}
+	if _, err := kube.GetResourceRequirements(spec.Controller); err != nil {
+		return fmt.Errorf("Invalid controller resources: %s", err)
+	}
+	if _, err := kube.ParseNodeLabels(spec.NodeSelector); err != nil {
+		return fmt.Errorf("Invalid node selector: %s", err)
+	}
+	if _, err := kube.ParseNodeLabels(spec.NodeAffinity); err != nil {
+		return fmt.Errorf("Invalid node affinity: %s", err)
+	}
+	if _, err := kube.ParseTolerations(spec.Tolerations); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Replicas of an edge router each have their own uplink and cannot be
+// linked to each other, so only interior routers are replicated
+func validateReplicas(spec types.SiteConfigSpec) error {
+	if spec.Replicas < 0 {
+		return fmt.Errorf("The number of router replicas cannot be negative")
+	} else if spec.Replicas > 1 && spec.IsEdge {
+		return fmt.Errorf("An edge site cannot have more than one router replica")
+	}
+	return nil
+}
+
 func (cli *VanClient) RouterCreate(ctx context.Context, options types.SiteConfig) error {
+	if err := validateServiceSyncIntervals(options.Spec); err != nil {
+		return err
+	}
+	if err := validateScheduling(options.Spec); err != nil {
+		return err
+	}
+	if err := validateReplicas(options.Spec); err != nil {
+		return err
+	}
+	if err := validateConsoleAuth(options.Spec); err != nil {
+		return err
+	}
 	// todo return error
 	if options.Spec.EnableRouterConsole || options.Spec.EnableConsole {
 		if options.Spec.AuthMode == string(types.ConsoleAuthModeInternal) || options.Spec.AuthMode == "" {
@@ -781,15 +934,7 @@ func (cli *VanClient) RouterCreate(ctx context.Context, options types.SiteConfig
 		siteOwnerRef = &depRef
 	}
 	if options.Spec.AuthMode == string(types.ConsoleAuthModeInternal) {
-		config := `
-pwcheck_method: auxprop
-auxprop_plugin: sasldb
-sasldb_path: /tmp/qdrouterd.sasldb
-`
-		saslData := &map[string]string{
-			"qdrouterd.conf": config,
-		}
-		kube.NewConfigMap("skupper-sasl-config", saslData, siteOwnerRef, van.Namespace, cli.KubeClient)
+		newSaslConfig(siteOwnerRef, van.Namespace, cli.KubeClient)
 	}
 	for _, sa := range van.Transport.ServiceAccounts {
 		sa.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*siteOwnerRef}
@@ -811,6 +956,9 @@ sasldb_path: /tmp/qdrouterd.sasldb
 			kube.NewSecret(cred, siteOwnerRef, van.Namespace, cli.KubeClient)
 		}
 	}
+	if err := cli.createLinkCertsSecret(siteOwnerRef, van.Namespace); err != nil {
+		return err
+	}
 	for _, svc := range van.Transport.Services {
 		svc.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*siteOwnerRef}
 		kube.CreateService(svc, van.Namespace, cli.KubeClient)
@@ -822,6 +970,10 @@ sasldb_path: /tmp/qdrouterd.sasldb
 		}
 	}
 
+	if err := kube.SyncTransportDisruptionBudget(van, siteOwnerRef, van.Namespace, cli.KubeClient); err != nil {
+		return err
+	}
+
 	kube.NewConfigMap("skupper-services", nil, siteOwnerRef, van.Namespace, cli.KubeClient)
 	initialConfig := qdr.AsConfigMapData(van.RouterConfig)
 	kube.NewConfigMap("skupper-internal", &initialConfig, siteOwnerRef, van.Namespace, cli.KubeClient)
@@ -829,77 +981,107 @@ sasldb_path: /tmp/qdrouterd.sasldb
 	if !options.Spec.IsEdge {
 		for _, cred := range van.Credentials {
 			if cred.Post {
-				if cli.RouteClient != nil {
-					rte, err := kube.GetRoute(types.InterRouterRouteName, van.Namespace, cli.RouteClient)
-					if err == nil {
-						cred.Hosts = append(cred.Hosts, rte.Spec.Host)
-					} else {
-						fmt.Println("Failed to retrieve route: ", err.Error())
-					}
-					rte, err = kube.GetRoute(types.EdgeRouteName, van.Namespace, cli.RouteClient)
-					if err == nil {
-						cred.Hosts = append(cred.Hosts, rte.Spec.Host)
-					} else {
-						fmt.Println("Failed to retrieve route: ", err.Error())
-					}
-
-				} else {
-					service, err := kube.GetService(types.InterRouterProfile, van.Namespace, cli.KubeClient)
-					if err == nil {
-						host := kube.GetLoadBalancerHostOrIP(service)
-						for i := 0; host == "" && i < 120; i++ {
-							if i == 0 {
-								fmt.Println("Waiting for LoadBalancer IP or hostname...")
-							}
-							time.Sleep(time.Second)
-							service, err = kube.GetService(types.InterRouterProfile, van.Namespace, cli.KubeClient)
-							host = kube.GetLoadBalancerHostOrIP(service)
-						}
-						if host == "" {
-							return fmt.Errorf("Failed to get LoadBalancer IP or Hostname for service skupper-internal")
-						} else {
-							cred.Hosts = append(cred.Hosts, host)
-							if len(host) < 64 {
-								cred.Subject = host
-							}
-						}
-					}
+				if err := cli.createExposedCredential(cred, siteOwnerRef, van.Namespace); err != nil {
+					return err
 				}
-				kube.NewSecret(cred, siteOwnerRef, van.Namespace, cli.KubeClient)
 			}
 		}
 	}
 
 	if options.Spec.EnableController {
 		cli.GetVanControllerSpec(options.Spec, van, dep, siteId)
-		_, err := kube.NewControllerDeployment(van, siteOwnerRef, cli.KubeClient)
-		if err != nil {
+		if err := cli.createController(van, siteOwnerRef); err != nil {
 			return err
 		}
-		for _, sa := range van.Controller.ServiceAccounts {
-			sa.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*siteOwnerRef}
-			kube.CreateServiceAccount(van.Namespace, sa, cli.KubeClient)
-		}
-		for _, role := range van.Controller.Roles {
-			role.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*siteOwnerRef}
-			kube.CreateRole(van.Namespace, role, cli.KubeClient)
-		}
-		for _, roleBinding := range van.Controller.RoleBindings {
-			roleBinding.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*siteOwnerRef}
-			kube.CreateRoleBinding(van.Namespace, roleBinding, cli.KubeClient)
+	}
+
+	return nil
+}
+
+func newSaslConfig(owner *metav1.OwnerReference, namespace string, cli kubernetes.Interface) {
+	config := `
+pwcheck_method: auxprop
+auxprop_plugin: sasldb
+sasldb_path: /tmp/qdrouterd.sasldb
+`
+	saslData := &map[string]string{
+		"qdrouterd.conf": config,
+	}
+	kube.NewConfigMap("skupper-sasl-config", saslData, owner, namespace, cli)
+}
+
+// Creates a secret for a credential whose hosts include the address
+// through which the site is exposed outside the cluster
+func (cli *VanClient) createExposedCredential(cred types.Credential, owner *metav1.OwnerReference, namespace string) error {
+	if cli.RouteClient != nil {
+		rte, err := kube.GetRoute(types.InterRouterRouteName, namespace, cli.RouteClient)
+		if err == nil {
+			cred.Hosts = append(cred.Hosts, rte.Spec.Host)
+		} else {
+			fmt.Println("Failed to retrieve route: ", err.Error())
 		}
-		for _, svc := range van.Controller.Services {
-			svc.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*siteOwnerRef}
-			kube.CreateService(svc, van.Namespace, cli.KubeClient)
+		rte, err = kube.GetRoute(types.EdgeRouteName, namespace, cli.RouteClient)
+		if err == nil {
+			cred.Hosts = append(cred.Hosts, rte.Spec.Host)
+		} else {
+			fmt.Println("Failed to retrieve route: ", err.Error())
 		}
-		if cli.RouteClient != nil {
-			for _, rte := range van.Controller.Routes {
-				rte.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*siteOwnerRef}
-				kube.CreateRoute(rte, van.Namespace, cli.RouteClient)
+
+	} else {
+		service, err := kube.GetService(types.InterRouterProfile, namespace, cli.KubeClient)
+		if err == nil {
+			host := kube.GetLoadBalancerHostOrIP(service)
+			for i := 0; host == "" && i < 120; i++ {
+				if i == 0 {
+					fmt.Println("Waiting for LoadBalancer IP or hostname...")
+				}
+				time.Sleep(time.Second)
+				service, err = kube.GetService(types.InterRouterProfile, namespace, cli.KubeClient)
+				host = kube.GetLoadBalancerHostOrIP(service)
+			}
+			if host == "" {
+				return fmt.Errorf("Failed to get LoadBalancer IP or Hostname for service skupper-internal")
+			} else {
+				cred.Hosts = append(cred.Hosts, host)
+				if len(host) < 64 {
+					cred.Subject = host
+				}
 			}
 		}
 	}
+	kube.NewSecret(cred, owner, namespace, cli.KubeClient)
+	return nil
+}
 
+// Creates the controller deployment along with the accounts, services
+// and routes it uses
+func (cli *VanClient) createController(van *types.RouterSpec, owner *metav1.OwnerReference) error {
+	_, err := kube.NewControllerDeployment(van, owner, cli.KubeClient)
+	if err != nil {
+		return err
+	}
+	for _, sa := range van.Controller.ServiceAccounts {
+		sa.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*owner}
+		kube.CreateServiceAccount(van.Namespace, sa, cli.KubeClient)
+	}
+	for _, role := range van.Controller.Roles {
+		role.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*owner}
+		kube.CreateRole(van.Namespace, role, cli.KubeClient)
+	}
+	for _, roleBinding := range van.Controller.RoleBindings {
+		roleBinding.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*owner}
+		kube.CreateRoleBinding(van.Namespace, roleBinding, cli.KubeClient)
+	}
+	for _, svc := range van.Controller.Services {
+		svc.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*owner}
+		kube.CreateService(svc, van.Namespace, cli.KubeClient)
+	}
+	if cli.RouteClient != nil {
+		for _, rte := range van.Controller.Routes {
+			rte.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*owner}
+			kube.CreateRoute(rte, van.Namespace, cli.RouteClient)
+		}
+	}
 	return nil
 }
 
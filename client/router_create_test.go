@@ -60,7 +60,8 @@ func TestRouterCreateDefaults(t *testing.T) {
 				"skupper-internal-ca",
 				"skupper-amqps",
 				"skupper",
-				"skupper-internal"},
+				"skupper-internal",
+				"skupper-link-certs"},
 			svcsExpected:        []string{"skupper-messaging", "skupper-internal", "skupper-controller"},
 			svcAccountsExpected: []string{"skupper", "skupper-proxy-controller"},
 			opts: []cmp.Option{
@@ -90,7 +91,8 @@ func TestRouterCreateDefaults(t *testing.T) {
 				"skupper-internal-ca",
 				"skupper-amqps",
 				"skupper",
-				"skupper-internal"},
+				"skupper-internal",
+				"skupper-link-certs"},
 			svcsExpected:        []string{"skupper-messaging", "skupper-internal", "skupper-controller", "skupper-router-console"},
 			svcAccountsExpected: []string{"skupper", "skupper-proxy-controller"},
 			opts: []cmp.Option{
@@ -121,7 +123,8 @@ func TestRouterCreateDefaults(t *testing.T) {
 				"skupper-amqps",
 				"skupper",
 				"skupper-internal",
-				"skupper-console-users"},
+				"skupper-console-users",
+				"skupper-link-certs"},
 			svcsExpected:        []string{"skupper-messaging", "skupper-internal", "skupper-controller", "skupper-router-console"},
 			svcAccountsExpected: []string{"skupper", "skupper-proxy-controller"},
 			opts: []cmp.Option{
@@ -153,7 +156,8 @@ func TestRouterCreateDefaults(t *testing.T) {
 				"skupper",
 				"skupper-internal",
 				"skupper-controller-certs",
-				"skupper-proxy-certs"},
+				"skupper-proxy-certs",
+				"skupper-link-certs"},
 			svcsExpected:        []string{"skupper-messaging", "skupper-internal", "skupper-controller", "skupper-router-console"},
 			svcAccountsExpected: []string{"skupper", "skupper-proxy-controller"},
 			opts: []cmp.Option{
@@ -181,7 +185,8 @@ func TestRouterCreateDefaults(t *testing.T) {
 			roleBindingsExpected: []string{"skupper-skupper-view", "skupper-proxy-controller-skupper-edit"},
 			secretsExpected: []string{"skupper-ca",
 				"skupper-amqps",
-				"skupper"},
+				"skupper",
+				"skupper-link-certs"},
 			svcsExpected:        []string{"skupper-messaging", "skupper-controller", "skupper-router-console"},
 			svcAccountsExpected: []string{"skupper", "skupper-proxy-controller"},
 			opts: []cmp.Option{
@@ -326,3 +331,130 @@ func TestRouterCreateDefaults(t *testing.T) {
 		}
 	}
 }
+
+func TestServiceSyncIntervals(t *testing.T) {
+	assert.Assert(t, validateServiceSyncIntervals(types.SiteConfigSpec{}))
+	assert.Assert(t, validateServiceSyncIntervals(types.SiteConfigSpec{ServiceSyncInterval: 10 * time.Second, ServiceSyncAgeOut: 2 * time.Minute}))
+	assert.Error(t, validateServiceSyncIntervals(types.SiteConfigSpec{ServiceSyncInterval: 2 * time.Minute}), "The service sync age out (1m0s) must be longer than the interval (2m0s)")
+	assert.Error(t, validateServiceSyncIntervals(types.SiteConfigSpec{ServiceSyncAgeOut: -time.Second}), "The service sync interval and age out cannot be negative")
+
+	cli, err := newMockClient("skupper", "", "")
+	assert.Assert(t, err)
+	siteConfig, err := cli.SiteConfigCreate(context.Background(), types.SiteConfigSpec{
+		EnableController:    true,
+		EnableServiceSync:   true,
+		ServiceSyncInterval: 10 * time.Second,
+		ServiceSyncAgeOut:   2 * time.Minute,
+	})
+	assert.Assert(t, err)
+	assert.Equal(t, siteConfig.Spec.ServiceSyncInterval, 10*time.Second)
+	assert.Equal(t, siteConfig.Spec.ServiceSyncAgeOut, 2*time.Minute)
+
+	van := cli.GetRouterSpecFromOpts(siteConfig.Spec, "site-a")
+	cli.GetVanControllerSpec(siteConfig.Spec, van, &appsv1.Deployment{}, "site-a")
+	env := map[string]string{}
+	for _, e := range van.Controller.EnvVar {
+		env[e.Name] = e.Value
+	}
+	assert.Equal(t, env["SKUPPER_SERVICE_SYNC_INTERVAL"], "10s")
+	assert.Equal(t, env["SKUPPER_SERVICE_SYNC_AGE_OUT"], "2m0s")
+}
+
+func TestValidateConsoleAuth(t *testing.T) {
+	assert.Assert(t, validateConsoleAuth(types.SiteConfigSpec{}))
+	assert.Assert(t, validateConsoleAuth(types.SiteConfigSpec{AuthMode: types.ConsoleAuthModeHtpasswd}))
+	assert.Assert(t, validateConsoleAuth(types.SiteConfigSpec{AuthMode: types.ConsoleAuthModeOidc, OidcIssuer: "https://sso.example.com"}))
+	assert.Error(t, validateConsoleAuth(types.SiteConfigSpec{AuthMode: types.ConsoleAuthModeOidc}), "An issuer is required for console authentication mode oidc")
+	assert.Error(t, validateConsoleAuth(types.SiteConfigSpec{AuthMode: types.ConsoleAuthModeHtpasswd, EnableRouterConsole: true}), "The router console does not support console authentication mode htpasswd")
+	assert.Error(t, validateConsoleAuth(types.SiteConfigSpec{AuthMode: "ldap"}), "Invalid console authentication mode ldap")
+
+	cli, err := newMockClient("skupper", "", "")
+	assert.Assert(t, err)
+	siteConfig, err := cli.SiteConfigCreate(context.Background(), types.SiteConfigSpec{
+		EnableController: true,
+		EnableConsole:    true,
+		AuthMode:         types.ConsoleAuthModeOidc,
+		OidcIssuer:       "https://sso.example.com",
+		OidcGroups:       []string{"admins", "operators"},
+		ConsoleOperators: []string{"operators"},
+	})
+	assert.Assert(t, err)
+	assert.Equal(t, siteConfig.Spec.OidcIssuer, "https://sso.example.com")
+	assert.DeepEqual(t, siteConfig.Spec.OidcGroups, []string{"admins", "operators"})
+
+	van := cli.GetRouterSpecFromOpts(siteConfig.Spec, "site-a")
+	cli.GetVanControllerSpec(siteConfig.Spec, van, &appsv1.Deployment{}, "site-a")
+	env := map[string]string{}
+	for _, e := range van.Controller.EnvVar {
+		env[e.Name] = e.Value
+	}
+	assert.Equal(t, env["METRICS_OIDC_ISSUER"], "https://sso.example.com")
+	assert.Equal(t, env["METRICS_OIDC_CREDENTIALS"], "/etc/console-oidc")
+	assert.Equal(t, env["METRICS_OIDC_GROUPS"], "admins,operators")
+	assert.Equal(t, env["METRICS_OPERATORS"], "operators")
+}
+
+func TestValidateScheduling(t *testing.T) {
+	assert.Assert(t, validateScheduling(types.SiteConfigSpec{}))
+	assert.ErrorContains(t, validateScheduling(types.SiteConfigSpec{Router: types.Tuning{Cpu: "lots"}}), "Invalid router resources")
+	assert.Error(t, validateScheduling(types.SiteConfigSpec{Controller: types.Tuning{Memory: "1Gi", MemoryLimit: "512Mi"}}), "Invalid controller resources: The memory requested (1Gi) exceeds the limit (512Mi)")
+	assert.Error(t, validateScheduling(types.SiteConfigSpec{NodeSelector: "zone"}), `Invalid node selector: Invalid node label "zone", expected key=value`)
+	assert.ErrorContains(t, validateScheduling(types.SiteConfigSpec{Tolerations: []string{"dedicated=skupper:Never"}}), "Invalid toleration effect")
+
+	cli, err := newMockClient("skupper", "", "")
+	assert.Assert(t, err)
+	siteConfig, err := cli.SiteConfigCreate(context.Background(), types.SiteConfigSpec{
+		EnableController: true,
+		Router:           types.Tuning{Cpu: "500m", MemoryLimit: "1Gi"},
+		Controller:       types.Tuning{Memory: "128Mi"},
+		NodeSelector:     "zone=east",
+		NodeAffinity:     "disk=ssd",
+		Tolerations:      []string{"dedicated=skupper:NoSchedule", "spot"},
+		PriorityClass:    "high",
+	})
+	assert.Assert(t, err)
+	assert.Equal(t, siteConfig.Spec.Router, types.Tuning{Cpu: "500m", MemoryLimit: "1Gi"})
+	assert.DeepEqual(t, siteConfig.Spec.Tolerations, []string{"dedicated=skupper:NoSchedule", "spot"})
+	assert.Assert(t, validateScheduling(siteConfig.Spec))
+
+	van := cli.GetRouterSpecFromOpts(siteConfig.Spec, "site-a")
+	cli.GetVanControllerSpec(siteConfig.Spec, van, &appsv1.Deployment{}, "site-a")
+	cpu := van.Transport.Resources.Requests[corev1.ResourceCPU]
+	assert.Equal(t, cpu.String(), "500m")
+	memory := van.Transport.Resources.Limits[corev1.ResourceMemory]
+	assert.Equal(t, memory.String(), "1Gi")
+	memory = van.Controller.Resources.Requests[corev1.ResourceMemory]
+	assert.Equal(t, memory.String(), "128Mi")
+	for _, ds := range []types.DeploymentSpec{van.Transport, van.Controller} {
+		assert.DeepEqual(t, ds.NodeSelector, map[string]string{"zone": "east"})
+		assert.Equal(t, ds.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution[0].Preference.MatchExpressions[0].Key, "disk")
+		assert.Equal(t, len(ds.Tolerations), 2)
+		assert.Equal(t, ds.PriorityClassName, "high")
+	}
+	container := kube.ContainerForTransport(van.Transport)
+	assert.DeepEqual(t, container.Resources, van.Transport.Resources)
+}
+
+func TestValidateReplicas(t *testing.T) {
+	assert.Assert(t, validateReplicas(types.SiteConfigSpec{}))
+	assert.Assert(t, validateReplicas(types.SiteConfigSpec{Replicas: 3}))
+	assert.Assert(t, validateReplicas(types.SiteConfigSpec{Replicas: 1, IsEdge: true}))
+	assert.Error(t, validateReplicas(types.SiteConfigSpec{Replicas: -1}), "The number of router replicas cannot be negative")
+	assert.Error(t, validateReplicas(types.SiteConfigSpec{Replicas: 2, IsEdge: true}), "An edge site cannot have more than one router replica")
+
+	cli, err := newMockClient("skupper", "", "")
+	assert.Assert(t, err)
+	siteConfig, err := cli.SiteConfigCreate(context.Background(), types.SiteConfigSpec{Replicas: 3})
+	assert.Assert(t, err)
+	assert.Equal(t, siteConfig.Spec.Replicas, int32(3))
+
+	van := cli.GetRouterSpecFromOpts(siteConfig.Spec, "site-a")
+	assert.Equal(t, van.Transport.Replicas, int32(3))
+	assert.Equal(t, van.Transport.Affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution[0].PodAffinityTerm.TopologyKey, "kubernetes.io/hostname")
+	assert.Assert(t, kube.GetTransportDisruptionBudget(van, nil) != nil)
+
+	van = cli.GetRouterSpecFromOpts(types.SiteConfigSpec{}, "site-a")
+	assert.Equal(t, van.Transport.Replicas, int32(1))
+	assert.Assert(t, van.Transport.Affinity == nil)
+	assert.Assert(t, kube.GetTransportDisruptionBudget(van, nil) == nil)
+}
@@ -64,6 +64,12 @@ func (cli *VanClient) RouterInspect(ctx context.Context) (*types.RouterInspectRe
 		if err == nil {
 			vir.Status.ConnectedSites = connected
 		}
+		if current.Spec.Replicas != nil && *current.Spec.Replicas > 1 {
+			replicas, err := qdr.GetRouterReplicas(cli.Namespace, cli.KubeClient, cli.RestConfig)
+			if err == nil {
+				vir.Status.Replicas = replicas
+			}
+		}
 
 		vir.TransportVersion = kube.GetComponentVersion(cli.Namespace, cli.KubeClient, types.TransportComponentName, types.TransportContainerName)
 		vir.ControllerVersion = kube.GetComponentVersion(cli.Namespace, cli.KubeClient, types.ControllerComponentName, types.ControllerContainerName)
@@ -73,6 +79,7 @@ func (cli *VanClient) RouterInspect(ctx context.Context) (*types.RouterInspectRe
 		} else {
 			vir.ExposedServices = len(vsis)
 		}
+		vir.Warnings = cli.getCertificateWarnings(time.Now())
 		url, err := cli.getConsoleUrl()
 		if url != "" {
 			vir.ConsoleUrl = "https://" + url
@@ -0,0 +1,719 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/kube"
+	"github.com/skupperproject/skupper/pkg/qdr"
+	"github.com/skupperproject/skupper/pkg/utils"
+)
+
+// The volumes, services, routes and secrets that are only present for
+// some site configurations. Any of these that the desired configuration
+// does not include are removed when a site is updated; anything else,
+// e.g. the volumes for connection tokens, is left as it is.
+var (
+	siteTransportVolumes   = []string{types.InterRouterProfile, types.TransportLinkCertsSecret, "skupper-console-users", "skupper-sasl-config", "skupper-proxy-certs"}
+	siteControllerVolumes  = []string{"skupper", "skupper-console-users", "skupper-controller-certs", types.ConsoleHtpasswdSecret, types.ConsoleOidcSecret}
+	siteTransportServices  = []string{"skupper-router-console", types.InterRouterProfile}
+	siteTransportRoutes    = []string{types.InterRouterRouteName, types.EdgeRouteName}
+	siteControllerRoutes   = []string{"skupper-controller"}
+	siteOptionalSecrets    = []string{types.InterRouterProfile, "skupper-console-users"}
+	siteExposureComponents = []string{types.InterRouterProfile, types.InterRouterRouteName, types.EdgeRouteName}
+)
+
+// RouterUpdate brings an existing site into line with the supplied site
+// configuration, updating the router and controller deployments and the
+// services, routes and secrets they use in place. Returns true if
+// anything was changed.
+func (cli *VanClient) RouterUpdate(ctx context.Context, options types.SiteConfig) (bool, error) {
+	if err := validateServiceSyncIntervals(options.Spec); err != nil {
+		return false, err
+	}
+	if err := validateConsoleAuth(options.Spec); err != nil {
+		return false, err
+	}
+	if err := validateScheduling(options.Spec); err != nil {
+		return false, err
+	}
+	if err := validateReplicas(options.Spec); err != nil {
+		return false, err
+	}
+	if options.Spec.SkupperNamespace == "" {
+		options.Spec.SkupperNamespace = cli.Namespace
+	}
+	namespace := options.Spec.SkupperNamespace
+	transport, err := kube.GetDeployment(types.TransportDeploymentName, namespace, cli.KubeClient)
+	if err != nil {
+		return false, err
+	}
+	// the site id is retained from when the site was created
+	siteId := options.Reference.UID
+	if env := kube.FindEnvVar(transport.Spec.Template.Spec.Containers[0].Env, "SKUPPER_SITE_ID"); env != nil && env.Value != "" {
+		siteId = env.Value
+	}
+	cli.setConsoleCredentials(&options.Spec, namespace)
+	van := cli.GetRouterSpecFromOpts(options.Spec, siteId)
+	siteOwnerRef := asOwnerReference(options.Reference)
+	if siteOwnerRef == nil {
+		depRef := kube.GetDeploymentOwnerReference(transport)
+		siteOwnerRef = &depRef
+	}
+
+	configChanged, err := cli.updateRouterConfig(van)
+	if err != nil {
+		return false, err
+	}
+	if err = cli.updateServiceAccounts(van.Transport.ServiceAccounts, namespace); err != nil {
+		return false, err
+	}
+	if err = cli.updateRoles(van.Transport.Roles, siteOwnerRef, namespace); err != nil {
+		return false, err
+	}
+	services, err := cli.updateSiteServices(van.Transport.Services, siteTransportServices, siteOwnerRef, namespace)
+	if err != nil {
+		return false, err
+	}
+	routes, err := cli.updateSiteRoutes(van.Transport.Routes, siteTransportRoutes, siteOwnerRef, namespace)
+	if err != nil {
+		return false, err
+	}
+	exposureChanged := false
+	for _, name := range append(services, routes...) {
+		if contains(siteExposureComponents, name) {
+			exposureChanged = true
+		}
+	}
+	if options.Spec.AuthMode == string(types.ConsoleAuthModeInternal) {
+		newSaslConfig(siteOwnerRef, namespace, cli.KubeClient)
+	}
+	secretsChanged, err := cli.updateSiteCredentials(van, exposureChanged, siteOwnerRef)
+	if err != nil {
+		return false, err
+	}
+	transportChanged, err := cli.updateSiteDeployment(transport, van.Transport, siteTransportVolumes, configChanged || secretsChanged)
+	if err != nil {
+		return false, err
+	}
+	if err = kube.SyncTransportDisruptionBudget(van, siteOwnerRef, namespace, cli.KubeClient); err != nil {
+		return false, err
+	}
+	changed := configChanged || secretsChanged || transportChanged || len(services) > 0 || len(routes) > 0
+
+	if options.Spec.EnableController {
+		cli.GetVanControllerSpec(options.Spec, van, transport, siteId)
+		controller, err := kube.GetDeployment(types.ControllerDeploymentName, namespace, cli.KubeClient)
+		if errors.IsNotFound(err) {
+			if err = cli.createController(van, siteOwnerRef); err != nil {
+				return changed, err
+			}
+			changed = true
+		} else if err != nil {
+			return changed, err
+		} else {
+			if err = cli.updateServiceAccounts(van.Controller.ServiceAccounts, namespace); err != nil {
+				return changed, err
+			}
+			if err = cli.updateRoles(van.Controller.Roles, siteOwnerRef, namespace); err != nil {
+				return changed, err
+			}
+			if err = cli.updateRoleBindings(van.Controller.RoleBindings, siteOwnerRef, namespace); err != nil {
+				return changed, err
+			}
+			if len(options.Spec.ConsoleOperators) == 0 {
+				if err = cli.removeRole(types.ControllerOperatorRoleName, "skupper-proxy-controller-"+types.ControllerOperatorRoleName, namespace); err != nil {
+					return changed, err
+				}
+			}
+			services, err := cli.updateSiteServices(van.Controller.Services, nil, siteOwnerRef, namespace)
+			if err != nil {
+				return changed, err
+			}
+			routes, err := cli.updateSiteRoutes(van.Controller.Routes, siteControllerRoutes, siteOwnerRef, namespace)
+			if err != nil {
+				return changed, err
+			}
+			controllerChanged, err := cli.updateSiteDeployment(controller, van.Controller, siteControllerVolumes, secretsChanged)
+			if err != nil {
+				return changed, err
+			}
+			changed = changed || controllerChanged || len(services) > 0 || len(routes) > 0
+		}
+	}
+
+	// secrets are only removed once no deployment refers to them
+	removed, err := cli.removeUnusedSecrets(van)
+	if err != nil {
+		return changed, err
+	}
+	return changed || removed, nil
+}
+
+// Sets the console user and password for internal authentication,
+// retaining the password already issued for the user if none is
+// specified
+func (cli *VanClient) setConsoleCredentials(spec *types.SiteConfigSpec, namespace string) {
+	if !spec.EnableRouterConsole && !spec.EnableConsole {
+		return
+	}
+	if spec.AuthMode != string(types.ConsoleAuthModeInternal) && spec.AuthMode != "" {
+		return
+	}
+	spec.AuthMode = string(types.ConsoleAuthModeInternal)
+	if spec.User == "" {
+		spec.User = "admin"
+	}
+	if spec.Password == "" {
+		secret, err := cli.KubeClient.CoreV1().Secrets(namespace).Get("skupper-console-users", metav1.GetOptions{})
+		if err == nil {
+			if password, ok := secret.Data[spec.User]; ok {
+				spec.Password = string(password)
+				return
+			}
+		}
+		spec.Password = utils.RandomId(10)
+	}
+}
+
+// Updates the mode, listeners and ssl profiles of the current router
+// configuration to match those desired, retaining the connectors and
+// bridges. Returns true if the mode of the router was changed.
+func updateRouterSiteConfig(current *qdr.RouterConfig, desired *qdr.RouterConfig) bool {
+	modeChanged := current.Metadata.Mode != desired.Metadata.Mode
+	current.Metadata.Mode = desired.Metadata.Mode
+	current.Metadata.Id = desired.Metadata.Id
+	current.Listeners = desired.Listeners
+	for prefix, address := range desired.Addresses {
+		current.Addresses[prefix] = address
+	}
+	if _, ok := desired.SslProfiles[types.InterRouterProfile]; !ok {
+		current.RemoveSslProfile(types.InterRouterProfile)
+	}
+	for name, profile := range desired.SslProfiles {
+		current.SslProfiles[name] = profile
+	}
+	return modeChanged
+}
+
+func (cli *VanClient) updateRouterConfig(van *types.RouterSpec) (bool, error) {
+	desired, err := qdr.UnmarshalRouterConfig(van.RouterConfig)
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configmap, err := kube.GetConfigMap("skupper-internal", van.Namespace, cli.KubeClient)
+		if err != nil {
+			return err
+		}
+		current, err := qdr.GetRouterConfigFromConfigMap(configmap)
+		if err != nil {
+			return err
+		}
+		if updateRouterSiteConfig(current, &desired) {
+			if err = cli.updateConnectorRoles(current, van.Namespace); err != nil {
+				return err
+			}
+		}
+		changed, err = current.UpdateConfigMap(configmap)
+		if err != nil || !changed {
+			return err
+		}
+		_, err = cli.KubeClient.CoreV1().ConfigMaps(van.Namespace).Update(configmap)
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("Failed to update router config: %w", err)
+	}
+	return changed, nil
+}
+
+// When the mode of the router changes, each connector must be switched
+// to the role matching the new mode
+func (cli *VanClient) updateConnectorRoles(config *qdr.RouterConfig, namespace string) error {
+	for name, connector := range config.Connectors {
+		token, err := cli.KubeClient.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("Failed to retrieve token for connector %s: %w", name, err)
+		}
+		setConnectorRole(&connector, config.IsEdge(), token)
+		config.Connectors[name] = connector
+	}
+	return nil
+}
+
+func (cli *VanClient) updateServiceAccounts(desired []*corev1.ServiceAccount, namespace string) error {
+	for _, sa := range desired {
+		current, err := cli.KubeClient.CoreV1().ServiceAccounts(namespace).Get(sa.ObjectMeta.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			kube.CreateServiceAccount(namespace, sa, cli.KubeClient)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("Failed to retrieve service account %s: %w", sa.ObjectMeta.Name, err)
+		}
+		if updateAnnotations(&current.ObjectMeta, sa.ObjectMeta.Annotations) {
+			_, err = cli.KubeClient.CoreV1().ServiceAccounts(namespace).Update(current)
+			if err != nil {
+				return fmt.Errorf("Failed to update service account %s: %w", sa.ObjectMeta.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// The rules of a role are updated when a release grants the
+// components of a site access to further resources
+func (cli *VanClient) updateRoles(desired []*rbacv1.Role, owner *metav1.OwnerReference, namespace string) error {
+	for _, role := range desired {
+		current, err := cli.KubeClient.RbacV1().Roles(namespace).Get(role.ObjectMeta.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			role.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*owner}
+			if _, err = kube.CreateRole(namespace, role, cli.KubeClient); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return fmt.Errorf("Failed to retrieve role %s: %w", role.ObjectMeta.Name, err)
+		}
+		if equality.Semantic.DeepEqual(current.Rules, role.Rules) {
+			continue
+		}
+		current.Rules = role.Rules
+		_, err = cli.KubeClient.RbacV1().Roles(namespace).Update(current)
+		if err != nil {
+			return fmt.Errorf("Failed to update role %s: %w", role.ObjectMeta.Name, err)
+		}
+	}
+	return nil
+}
+
+// Role bindings are added when the site is changed to grant a component
+// a further role, e.g. when console operators are first named
+func (cli *VanClient) updateRoleBindings(desired []*rbacv1.RoleBinding, owner *metav1.OwnerReference, namespace string) error {
+	for _, roleBinding := range desired {
+		_, err := cli.KubeClient.RbacV1().RoleBindings(namespace).Get(roleBinding.ObjectMeta.Name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			roleBinding.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*owner}
+			if _, err = kube.CreateRoleBinding(namespace, roleBinding, cli.KubeClient); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return fmt.Errorf("Failed to retrieve role binding %s: %w", roleBinding.ObjectMeta.Name, err)
+		}
+	}
+	return nil
+}
+
+// Removes a role no longer granted, along with its binding
+func (cli *VanClient) removeRole(name string, binding string, namespace string) error {
+	err := cli.KubeClient.RbacV1().RoleBindings(namespace).Delete(binding, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("Failed to remove role binding %s: %w", binding, err)
+	}
+	err = cli.KubeClient.RbacV1().Roles(namespace).Delete(name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("Failed to remove role %s: %w", name, err)
+	}
+	return nil
+}
+
+func updateAnnotations(meta *metav1.ObjectMeta, desired map[string]string) bool {
+	changed := false
+	for key, value := range desired {
+		if meta.Annotations[key] != value {
+			if meta.Annotations == nil {
+				meta.Annotations = map[string]string{}
+			}
+			meta.Annotations[key] = value
+			changed = true
+		}
+	}
+	return changed
+}
+
+func getProtocolOrDefault(protocol corev1.Protocol) corev1.Protocol {
+	if protocol == "" {
+		return corev1.ProtocolTCP
+	}
+	return protocol
+}
+
+func equivalentServicePorts(actual []corev1.ServicePort, desired []corev1.ServicePort) bool {
+	if len(actual) != len(desired) {
+		return false
+	}
+	for i := range actual {
+		if actual[i].Name != desired[i].Name ||
+			getProtocolOrDefault(actual[i].Protocol) != getProtocolOrDefault(desired[i].Protocol) ||
+			actual[i].Port != desired[i].Port ||
+			actual[i].TargetPort != desired[i].TargetPort {
+			return false
+		}
+	}
+	return true
+}
+
+func getServiceTypeOrDefault(serviceType corev1.ServiceType) corev1.ServiceType {
+	if serviceType == "" {
+		return corev1.ServiceTypeClusterIP
+	}
+	return serviceType
+}
+
+// Updates the type, ports and annotations of a site service to match
+// those desired. Returns true if the service was changed.
+func updateServiceSpec(actual *corev1.Service, desired *corev1.Service) bool {
+	changed := updateAnnotations(&actual.ObjectMeta, desired.ObjectMeta.Annotations)
+	desiredType := getServiceTypeOrDefault(desired.Spec.Type)
+	if getServiceTypeOrDefault(actual.Spec.Type) != desiredType {
+		actual.Spec.Type = desiredType
+		if desiredType == corev1.ServiceTypeClusterIP {
+			actual.Spec.ExternalTrafficPolicy = ""
+		}
+		// any node ports allocated must be released
+		actual.Spec.Ports = desired.Spec.Ports
+		changed = true
+	} else if !equivalentServicePorts(actual.Spec.Ports, desired.Spec.Ports) {
+		actual.Spec.Ports = desired.Spec.Ports
+		changed = true
+	}
+	return changed
+}
+
+// Creates or updates each of the desired services and removes any of
+// those in managed that is no longer desired. Returns the names of the
+// services that were changed.
+func (cli *VanClient) updateSiteServices(desired []*corev1.Service, managed []string, owner *metav1.OwnerReference, namespace string) ([]string, error) {
+	changed := []string{}
+	names := []string{}
+	for _, svc := range desired {
+		names = append(names, svc.ObjectMeta.Name)
+		current, err := kube.GetService(svc.ObjectMeta.Name, namespace, cli.KubeClient)
+		if errors.IsNotFound(err) {
+			svc.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*owner}
+			if _, err = kube.CreateService(svc, namespace, cli.KubeClient); err != nil {
+				return changed, err
+			}
+			changed = append(changed, svc.ObjectMeta.Name)
+		} else if err != nil {
+			return changed, fmt.Errorf("Failed to retrieve service %s: %w", svc.ObjectMeta.Name, err)
+		} else if updateServiceSpec(current, svc) {
+			if _, err = cli.KubeClient.CoreV1().Services(namespace).Update(current); err != nil {
+				return changed, fmt.Errorf("Failed to update service %s: %w", svc.ObjectMeta.Name, err)
+			}
+			changed = append(changed, svc.ObjectMeta.Name)
+		}
+	}
+	for _, name := range managed {
+		if contains(names, name) {
+			continue
+		}
+		err := kube.DeleteService(name, namespace, cli.KubeClient)
+		if err == nil {
+			changed = append(changed, name)
+		} else if !errors.IsNotFound(err) {
+			return changed, fmt.Errorf("Failed to delete service %s: %w", name, err)
+		}
+	}
+	return changed, nil
+}
+
+func updateRouteSpec(actual *routev1.Route, desired *routev1.Route) bool {
+	if equality.Semantic.DeepEqual(actual.Spec.Port, desired.Spec.Port) &&
+		actual.Spec.To.Name == desired.Spec.To.Name &&
+		equality.Semantic.DeepEqual(actual.Spec.TLS, desired.Spec.TLS) {
+		return false
+	}
+	actual.Spec.Port = desired.Spec.Port
+	actual.Spec.To = desired.Spec.To
+	actual.Spec.TLS = desired.Spec.TLS
+	return true
+}
+
+// Creates or updates each of the desired routes and removes any of
+// those in managed that is no longer desired. Returns the names of the
+// routes that were changed.
+func (cli *VanClient) updateSiteRoutes(desired []*routev1.Route, managed []string, owner *metav1.OwnerReference, namespace string) ([]string, error) {
+	if cli.RouteClient == nil {
+		return nil, nil
+	}
+	changed := []string{}
+	names := []string{}
+	for _, rte := range desired {
+		if contains(names, rte.ObjectMeta.Name) {
+			// as on creation, the first route with a given name is used
+			continue
+		}
+		names = append(names, rte.ObjectMeta.Name)
+		current, err := kube.GetRoute(rte.ObjectMeta.Name, namespace, cli.RouteClient)
+		if errors.IsNotFound(err) {
+			rte.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*owner}
+			if _, err = kube.CreateRoute(rte, namespace, cli.RouteClient); err != nil {
+				return changed, err
+			}
+			changed = append(changed, rte.ObjectMeta.Name)
+		} else if err != nil {
+			return changed, fmt.Errorf("Failed to retrieve route %s: %w", rte.ObjectMeta.Name, err)
+		} else if updateRouteSpec(current, rte) {
+			if _, err = cli.RouteClient.Routes(namespace).Update(current); err != nil {
+				return changed, fmt.Errorf("Failed to update route %s: %w", rte.ObjectMeta.Name, err)
+			}
+			changed = append(changed, rte.ObjectMeta.Name)
+		}
+	}
+	for _, name := range managed {
+		if contains(names, name) {
+			continue
+		}
+		err := cli.RouteClient.Routes(namespace).Delete(name, &metav1.DeleteOptions{})
+		if err == nil {
+			changed = append(changed, name)
+		} else if !errors.IsNotFound(err) {
+			return changed, fmt.Errorf("Failed to delete route %s: %w", name, err)
+		}
+	}
+	return changed, nil
+}
+
+// Creates any of the site's certificate authorities and credentials that
+// are missing, updates the console users and reissues the inter-router
+// certificate when the way the site is exposed changes. Returns true if
+// any secret was changed.
+func (cli *VanClient) updateSiteCredentials(van *types.RouterSpec, exposureChanged bool, owner *metav1.OwnerReference) (bool, error) {
+	secrets := cli.KubeClient.CoreV1().Secrets(van.Namespace)
+	changed := false
+	for _, ca := range van.CertAuthoritys {
+		if _, err := kube.NewCertAuthority(ca, owner, van.Namespace, cli.KubeClient); err != nil {
+			return changed, err
+		}
+	}
+	for _, cred := range van.Credentials {
+		current, err := secrets.Get(cred.Name, metav1.GetOptions{})
+		if err == nil {
+			if cred.CA == "" {
+				if !equality.Semantic.DeepEqual(current.Data, cred.Data) {
+					current.Data = cred.Data
+					if _, err = secrets.Update(current); err != nil {
+						return changed, fmt.Errorf("Failed to update secret %s: %w", cred.Name, err)
+					}
+					changed = true
+				}
+				continue
+			} else if cred.Name != types.InterRouterProfile || !exposureChanged {
+				continue
+			}
+			// the hosts of the inter-router certificate depend on
+			// how the site is exposed
+			if err = secrets.Delete(cred.Name, &metav1.DeleteOptions{}); err != nil {
+				return changed, fmt.Errorf("Failed to delete secret %s: %w", cred.Name, err)
+			}
+		} else if !errors.IsNotFound(err) {
+			return changed, fmt.Errorf("Failed to retrieve secret %s: %w", cred.Name, err)
+		}
+		if cred.Post {
+			err = cli.createExposedCredential(cred, owner, van.Namespace)
+		} else {
+			_, err = kube.NewSecret(cred, owner, van.Namespace, cli.KubeClient)
+		}
+		if err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+func (cli *VanClient) removeUnusedSecrets(van *types.RouterSpec) (bool, error) {
+	desired := []string{}
+	for _, cred := range van.Credentials {
+		desired = append(desired, cred.Name)
+	}
+	removed := false
+	for _, name := range siteOptionalSecrets {
+		if contains(desired, name) {
+			continue
+		}
+		err := cli.KubeClient.CoreV1().Secrets(van.Namespace).Delete(name, &metav1.DeleteOptions{})
+		if err == nil {
+			removed = true
+		} else if !errors.IsNotFound(err) {
+			return removed, fmt.Errorf("Failed to delete secret %s: %w", name, err)
+		}
+	}
+	return removed, nil
+}
+
+func equivalentEnv(actual []corev1.EnvVar, desired []corev1.EnvVar) bool {
+	if len(actual) != len(desired) {
+		return false
+	}
+	for i := range actual {
+		if actual[i].Name != desired[i].Name || actual[i].Value != desired[i].Value {
+			return false
+		}
+		a := actual[i].ValueFrom
+		d := desired[i].ValueFrom
+		if a == nil || d == nil {
+			if a != d {
+				return false
+			}
+		} else if a.FieldRef != nil && d.FieldRef != nil {
+			// the api version of a field reference is defaulted
+			if a.FieldRef.FieldPath != d.FieldRef.FieldPath {
+				return false
+			}
+		} else if !equality.Semantic.DeepEqual(a, d) {
+			return false
+		}
+	}
+	return true
+}
+
+func equivalentContainerPorts(actual []corev1.ContainerPort, desired []corev1.ContainerPort) bool {
+	if len(actual) != len(desired) {
+		return false
+	}
+	for i := range actual {
+		if actual[i].Name != desired[i].Name || actual[i].ContainerPort != desired[i].ContainerPort {
+			return false
+		}
+	}
+	return true
+}
+
+func findVolume(volumes []corev1.Volume, name string) *corev1.Volume {
+	for i := range volumes {
+		if volumes[i].Name == name {
+			return &volumes[i]
+		}
+	}
+	return nil
+}
+
+func findVolumeMount(mounts []corev1.VolumeMount, name string) *corev1.VolumeMount {
+	for i := range mounts {
+		if mounts[i].Name == name {
+			return &mounts[i]
+		}
+	}
+	return nil
+}
+
+func findContainer(containers []corev1.Container, name string) *corev1.Container {
+	for i := range containers {
+		if containers[i].Name == name {
+			return &containers[i]
+		}
+	}
+	return nil
+}
+
+func updateVolumes(actual []corev1.Volume, desired []corev1.Volume, managed []string) []corev1.Volume {
+	var volumes []corev1.Volume
+	for _, v := range actual {
+		if findVolume(desired, v.Name) != nil || !contains(managed, v.Name) {
+			volumes = append(volumes, v)
+		}
+	}
+	for _, v := range desired {
+		if findVolume(volumes, v.Name) == nil {
+			volumes = append(volumes, v)
+		}
+	}
+	return volumes
+}
+
+func updateVolumeMounts(actual []corev1.VolumeMount, desired []corev1.VolumeMount, managed []string) []corev1.VolumeMount {
+	var mounts []corev1.VolumeMount
+	for _, m := range actual {
+		if findVolumeMount(desired, m.Name) != nil || !contains(managed, m.Name) {
+			mounts = append(mounts, m)
+		}
+	}
+	for _, m := range desired {
+		if findVolumeMount(mounts, m.Name) == nil {
+			mounts = append(mounts, m)
+		}
+	}
+	return mounts
+}
+
+// Updates the environment, ports, resources, placement, volumes and
+// sidecars of a site deployment to match those desired. Volumes not in managed, such as
+// those for connection tokens, are retained. Returns true if the pod
+// template was changed.
+func updateDeploymentSpec(dep *appsv1.Deployment, desired types.DeploymentSpec, managed []string) bool {
+	original := dep.Spec.Template.Spec.DeepCopy()
+	spec := &dep.Spec.Template.Spec
+	container := &spec.Containers[0]
+	if !equivalentEnv(container.Env, desired.EnvVar) {
+		container.Env = desired.EnvVar
+	}
+	if !equivalentContainerPorts(container.Ports, desired.Ports) {
+		container.Ports = desired.Ports
+	}
+	if !equality.Semantic.DeepEqual(container.Resources, desired.Resources) {
+		container.Resources = desired.Resources
+	}
+	kube.SetPodScheduling(spec, desired)
+	spec.Volumes = updateVolumes(spec.Volumes, desired.Volumes, managed)
+	if len(desired.VolumeMounts) > 0 {
+		container.VolumeMounts = updateVolumeMounts(container.VolumeMounts, desired.VolumeMounts[0], managed)
+	}
+	sidecars := []corev1.Container{}
+	for i, sc := range desired.Sidecars {
+		if existing := findContainer(spec.Containers[1:], sc.Name); existing != nil {
+			sidecars = append(sidecars, *existing)
+			continue
+		}
+		sidecar := *sc
+		if i+1 < len(desired.VolumeMounts) {
+			sidecar.VolumeMounts = desired.VolumeMounts[i+1]
+		}
+		sidecars = append(sidecars, sidecar)
+	}
+	spec.Containers = append(spec.Containers[:1], sidecars...)
+	return !equality.Semantic.DeepEqual(original, spec)
+}
+
+// Updates a site deployment to match the desired spec, restarting it if
+// requested even when the spec is unchanged, e.g. so that the router
+// loads a changed configuration. A change in replicas alone scales the
+// deployment without restarting the existing pods. Returns true if the
+// deployment was updated.
+func (cli *VanClient) updateSiteDeployment(dep *appsv1.Deployment, desired types.DeploymentSpec, managed []string, restart bool) (bool, error) {
+	restart = updateDeploymentSpec(dep, desired, managed) || restart
+	scaled := desired.Replicas > 0 && (dep.Spec.Replicas == nil || *dep.Spec.Replicas != desired.Replicas)
+	if !restart && !scaled {
+		return false, nil
+	}
+	if scaled {
+		replicas := desired.Replicas
+		dep.Spec.Replicas = &replicas
+	}
+	if restart {
+		if dep.Spec.Template.ObjectMeta.Annotations == nil {
+			dep.Spec.Template.ObjectMeta.Annotations = map[string]string{}
+		}
+		dep.Spec.Template.ObjectMeta.Annotations[types.SiteConfigUpdatedQualifier] = time.Now().Format(time.RFC3339)
+	}
+	_, err := cli.KubeClient.AppsV1().Deployments(dep.ObjectMeta.Namespace).Update(dep)
+	if err != nil {
+		return false, fmt.Errorf("Failed to update %s: %w", dep.ObjectMeta.Name, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,254 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/kube"
+	"github.com/skupperproject/skupper/pkg/qdr"
+)
+
+func TestRouterUpdate(t *testing.T) {
+	ctx := context.Background()
+	cli, err := newMockClient("skupper", "", "")
+	assert.Assert(t, err)
+	spec := types.SiteConfigSpec{
+		SkupperName:       "skupper",
+		SkupperNamespace:  "skupper",
+		EnableController:  true,
+		EnableServiceSync: true,
+		EnableConsole:     true,
+		AuthMode:          string(types.ConsoleAuthModeInternal),
+		User:              "admin",
+		ClusterLocal:      true,
+	}
+	assert.Assert(t, cli.RouterCreate(ctx, types.SiteConfig{Spec: spec}))
+
+	token := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "conn1",
+			Annotations: map[string]string{
+				"inter-router-host": "inter-router.example.com",
+				"inter-router-port": "55671",
+				"edge-host":         "edge.example.com",
+				"edge-port":         "45671",
+			},
+		},
+	}
+	_, err = cli.KubeClient.CoreV1().Secrets("skupper").Create(token)
+	assert.Assert(t, err)
+	assert.Assert(t, cli.ConnectorCreate(ctx, token, types.ConnectorCreateOptions{Name: "conn1", SkupperNamespace: "skupper"}))
+
+	getRouterConfig := func() *qdr.RouterConfig {
+		cm, err := kube.GetConfigMap("skupper-internal", "skupper", cli.KubeClient)
+		assert.Assert(t, err)
+		config, err := qdr.GetRouterConfigFromConfigMap(cm)
+		assert.Assert(t, err)
+		return config
+	}
+	getTransportPorts := func() []string {
+		dep, err := kube.GetDeployment(types.TransportDeploymentName, "skupper", cli.KubeClient)
+		assert.Assert(t, err)
+		ports := []string{}
+		for _, p := range dep.Spec.Template.Spec.Containers[0].Ports {
+			ports = append(ports, p.Name)
+		}
+		return ports
+	}
+	getTransportVolumes := func() []string {
+		dep, err := kube.GetDeployment(types.TransportDeploymentName, "skupper", cli.KubeClient)
+		assert.Assert(t, err)
+		volumes := []string{}
+		for _, v := range dep.Spec.Template.Spec.Volumes {
+			volumes = append(volumes, v.Name)
+		}
+		return volumes
+	}
+
+	// the password generated on creation is retained
+	updated, err := cli.RouterUpdate(ctx, types.SiteConfig{Spec: spec})
+	assert.Assert(t, err)
+	assert.Assert(t, !updated)
+
+	spec.IsEdge = true
+	updated, err = cli.RouterUpdate(ctx, types.SiteConfig{Spec: spec})
+	assert.Assert(t, err)
+	assert.Assert(t, updated)
+	config := getRouterConfig()
+	assert.Assert(t, config.IsEdge())
+	_, ok := config.Listeners["interior-listener"]
+	assert.Assert(t, !ok)
+	_, ok = config.SslProfiles[types.InterRouterProfile]
+	assert.Assert(t, !ok)
+	assert.Equal(t, config.Connectors["conn1"].Role, qdr.Role(qdr.RoleEdge))
+	assert.Equal(t, config.Connectors["conn1"].Host, "edge.example.com")
+	assert.DeepEqual(t, getTransportPorts(), []string{"amqps", "http"})
+	assert.DeepEqual(t, getTransportVolumes(), []string{"skupper-amqps", "router-config", types.TransportLinkCertsSecret})
+	_, err = kube.GetService(types.InterRouterProfile, "skupper", cli.KubeClient)
+	assert.Assert(t, errors.IsNotFound(err))
+	_, err = cli.KubeClient.CoreV1().Secrets("skupper").Get(types.InterRouterProfile, metav1.GetOptions{})
+	assert.Assert(t, errors.IsNotFound(err))
+
+	updated, err = cli.RouterUpdate(ctx, types.SiteConfig{Spec: spec})
+	assert.Assert(t, err)
+	assert.Assert(t, !updated)
+
+	spec.IsEdge = false
+	spec.ServiceSyncInterval = 10 * time.Second
+	updated, err = cli.RouterUpdate(ctx, types.SiteConfig{Spec: spec})
+	assert.Assert(t, err)
+	assert.Assert(t, updated)
+	config = getRouterConfig()
+	assert.Assert(t, !config.IsEdge())
+	assert.Equal(t, config.Connectors["conn1"].Role, qdr.RoleInterRouter)
+	assert.Equal(t, config.Connectors["conn1"].Host, "inter-router.example.com")
+	assert.DeepEqual(t, getTransportPorts(), []string{"amqps", "http", "inter-router", "edge"})
+	_, err = kube.GetService(types.InterRouterProfile, "skupper", cli.KubeClient)
+	assert.Assert(t, err)
+	_, err = cli.KubeClient.CoreV1().Secrets("skupper").Get(types.InterRouterProfile, metav1.GetOptions{})
+	assert.Assert(t, err)
+	controller, err := kube.GetDeployment(types.ControllerDeploymentName, "skupper", cli.KubeClient)
+	assert.Assert(t, err)
+	interval := kube.FindEnvVar(controller.Spec.Template.Spec.Containers[0].Env, "SKUPPER_SERVICE_SYNC_INTERVAL")
+	assert.Assert(t, interval != nil)
+	assert.Equal(t, interval.Value, "10s")
+
+	spec.AuthMode = string(types.ConsoleAuthModeUnsecured)
+	updated, err = cli.RouterUpdate(ctx, types.SiteConfig{Spec: spec})
+	assert.Assert(t, err)
+	assert.Assert(t, updated)
+	_, err = cli.KubeClient.CoreV1().Secrets("skupper").Get("skupper-console-users", metav1.GetOptions{})
+	assert.Assert(t, errors.IsNotFound(err))
+	controller, err = kube.GetDeployment(types.ControllerDeploymentName, "skupper", cli.KubeClient)
+	assert.Assert(t, err)
+	assert.Assert(t, kube.FindEnvVar(controller.Spec.Template.Spec.Containers[0].Env, "METRICS_USERS") == nil)
+
+	// scaling the router spreads its replicas and adds a disruption
+	// budget, which is removed again when it is scaled back
+	getTransport := func() *appsv1.Deployment {
+		dep, err := kube.GetDeployment(types.TransportDeploymentName, "skupper", cli.KubeClient)
+		assert.Assert(t, err)
+		return dep
+	}
+	spec.Replicas = 3
+	updated, err = cli.RouterUpdate(ctx, types.SiteConfig{Spec: spec})
+	assert.Assert(t, err)
+	assert.Assert(t, updated)
+	transport := getTransport()
+	assert.Equal(t, *transport.Spec.Replicas, int32(3))
+	assert.Assert(t, transport.Spec.Template.Spec.Affinity.PodAntiAffinity != nil)
+	budget, err := cli.KubeClient.PolicyV1beta1().PodDisruptionBudgets("skupper").Get(types.TransportDisruptionBudgetName, metav1.GetOptions{})
+	assert.Assert(t, err)
+	assert.Equal(t, budget.Spec.MaxUnavailable.IntValue(), 1)
+
+	spec.Replicas = 2
+	updated, err = cli.RouterUpdate(ctx, types.SiteConfig{Spec: spec})
+	assert.Assert(t, err)
+	assert.Assert(t, updated)
+	assert.Equal(t, *getTransport().Spec.Replicas, int32(2))
+	assert.Equal(t, getTransport().Spec.Template.ObjectMeta.Annotations[types.SiteConfigUpdatedQualifier], transport.Spec.Template.ObjectMeta.Annotations[types.SiteConfigUpdatedQualifier])
+
+	spec.Replicas = 0
+	updated, err = cli.RouterUpdate(ctx, types.SiteConfig{Spec: spec})
+	assert.Assert(t, err)
+	assert.Assert(t, updated)
+	assert.Equal(t, *getTransport().Spec.Replicas, int32(1))
+	assert.Assert(t, getTransport().Spec.Template.Spec.Affinity == nil)
+	_, err = cli.KubeClient.PolicyV1beta1().PodDisruptionBudgets("skupper").Get(types.TransportDisruptionBudgetName, metav1.GetOptions{})
+	assert.Assert(t, errors.IsNotFound(err))
+
+	// the rules of the roles for the site's components are restored
+	role, err := cli.KubeClient.RbacV1().Roles("skupper").Get(types.ControllerEditRoleName, metav1.GetOptions{})
+	assert.Assert(t, err)
+	role.Rules = role.Rules[:1]
+	_, err = cli.KubeClient.RbacV1().Roles("skupper").Update(role)
+	assert.Assert(t, err)
+	_, err = cli.RouterUpdate(ctx, types.SiteConfig{Spec: spec})
+	assert.Assert(t, err)
+	role, err = cli.KubeClient.RbacV1().Roles("skupper").Get(types.ControllerEditRoleName, metav1.GetOptions{})
+	assert.Assert(t, err)
+	assert.DeepEqual(t, role.Rules, types.ControllerEditPolicyRule)
+
+	// the controller is granted the operator role only while the site
+	// has console operators
+	_, err = cli.KubeClient.RbacV1().Roles("skupper").Get(types.ControllerOperatorRoleName, metav1.GetOptions{})
+	assert.Assert(t, errors.IsNotFound(err))
+	spec.ConsoleOperators = []string{"fred"}
+	_, err = cli.RouterUpdate(ctx, types.SiteConfig{Spec: spec})
+	assert.Assert(t, err)
+	role, err = cli.KubeClient.RbacV1().Roles("skupper").Get(types.ControllerOperatorRoleName, metav1.GetOptions{})
+	assert.Assert(t, err)
+	assert.DeepEqual(t, role.Rules, types.ControllerOperatorPolicyRule)
+	binding, err := cli.KubeClient.RbacV1().RoleBindings("skupper").Get("skupper-proxy-controller-"+types.ControllerOperatorRoleName, metav1.GetOptions{})
+	assert.Assert(t, err)
+	assert.Equal(t, binding.RoleRef.Name, types.ControllerOperatorRoleName)
+	spec.ConsoleOperators = nil
+	_, err = cli.RouterUpdate(ctx, types.SiteConfig{Spec: spec})
+	assert.Assert(t, err)
+	_, err = cli.KubeClient.RbacV1().Roles("skupper").Get(types.ControllerOperatorRoleName, metav1.GetOptions{})
+	assert.Assert(t, errors.IsNotFound(err))
+	_, err = cli.KubeClient.RbacV1().RoleBindings("skupper").Get("skupper-proxy-controller-"+types.ControllerOperatorRoleName, metav1.GetOptions{})
+	assert.Assert(t, errors.IsNotFound(err))
+}
+
+func TestUpdateServiceSpec(t *testing.T) {
+	ports := []corev1.ServicePort{
+		{
+			Name:       "inter-router",
+			Protocol:   "TCP",
+			Port:       types.InterRouterListenerPort,
+			TargetPort: intstr.FromInt(int(types.InterRouterListenerPort)),
+		},
+	}
+	actual := &corev1.Service{
+		Spec: corev1.ServiceSpec{
+			Type:                  corev1.ServiceTypeLoadBalancer,
+			ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyTypeCluster,
+			Ports:                 []corev1.ServicePort{ports[0]},
+		},
+	}
+	actual.Spec.Ports[0].NodePort = 31000
+	desired := &corev1.Service{
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeLoadBalancer,
+			Ports: ports,
+		},
+	}
+	assert.Assert(t, !updateServiceSpec(actual, desired))
+
+	desired.Spec.Type = corev1.ServiceTypeClusterIP
+	assert.Assert(t, updateServiceSpec(actual, desired))
+	assert.Equal(t, actual.Spec.Type, corev1.ServiceTypeClusterIP)
+	assert.Equal(t, actual.Spec.ExternalTrafficPolicy, corev1.ServiceExternalTrafficPolicyType(""))
+	assert.Equal(t, actual.Spec.Ports[0].NodePort, int32(0))
+
+	desired.ObjectMeta.Annotations = map[string]string{"foo": "bar"}
+	assert.Assert(t, updateServiceSpec(actual, desired))
+	assert.Equal(t, actual.ObjectMeta.Annotations["foo"], "bar")
+	assert.Assert(t, !updateServiceSpec(actual, desired))
+}
+
+func TestEquivalentEnv(t *testing.T) {
+	desired := []corev1.EnvVar{
+		{Name: "APPLICATION_NAME", Value: "skupper-router"},
+		{Name: "POD_NAMESPACE", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"}}},
+	}
+	// the api version of field references is defaulted by the api server
+	actual := []corev1.EnvVar{
+		{Name: "APPLICATION_NAME", Value: "skupper-router"},
+		{Name: "POD_NAMESPACE", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{APIVersion: "v1", FieldPath: "metadata.namespace"}}},
+	}
+	assert.Assert(t, equivalentEnv(actual, desired))
+	assert.Assert(t, !equivalentEnv(actual[:1], desired))
+	actual[0].Value = "other"
+	assert.Assert(t, !equivalentEnv(actual, desired))
+}
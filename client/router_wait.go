@@ -0,0 +1,16 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/kube"
+)
+
+// RouterWaitReady blocks until all replicas of the transport deployment
+// are ready, or until the context is done
+func (cli *VanClient) RouterWaitReady(ctx context.Context) error {
+	_, err := kube.WaitDeploymentReady(ctx, types.TransportDeploymentName, cli.Namespace, cli.KubeClient, time.Second)
+	return err
+}
@@ -0,0 +1,186 @@
+package client
+
+import (
+	"context"
+	jsonencoding "encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/skupperproject/skupper/api/types"
+)
+
+type byAddress []*types.ServiceInterface
+
+func (a byAddress) Len() int           { return len(a) }
+func (a byAddress) Less(i, j int) bool { return a[i].Address < a[j].Address }
+func (a byAddress) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+func parseServiceInterfaceDefinitions(cm *corev1.ConfigMap) (map[string]*types.ServiceInterface, error) {
+	definitions := map[string]*types.ServiceInterface{}
+	for k, v := range cm.Data {
+		if v == "" {
+			continue
+		}
+		si := types.ServiceInterface{}
+		err := jsonencoding.Unmarshal([]byte(v), &si)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read json for service interface %s: %s", k, err)
+		}
+		definitions[k] = &si
+	}
+	return definitions, nil
+}
+
+// Returns a copy of the definition with empty lists and maps set to
+// nil, as a definition read back from json has nil for those that were
+// omitted, so that a definition is only updated if it has changed
+func normaliseServiceInterface(service *types.ServiceInterface) types.ServiceInterface {
+	normalised := *service
+	if len(normalised.Ports) == 0 {
+		normalised.Ports = nil
+	}
+	if len(normalised.Targets) == 0 {
+		normalised.Targets = nil
+	} else {
+		normalised.Targets = make([]types.ServiceInterfaceTarget, len(service.Targets))
+		for i, target := range service.Targets {
+			if len(target.TargetPorts) == 0 {
+				target.TargetPorts = nil
+			}
+			normalised.Targets[i] = target
+		}
+	}
+	return normalised
+}
+
+func getServiceInterfaceChanges(desired []*types.ServiceInterface, actual map[string]*types.ServiceInterface, prune bool) *types.ServiceInterfaceApplyResponse {
+	result := &types.ServiceInterfaceApplyResponse{}
+	required := map[string]bool{}
+	for _, service := range desired {
+		required[service.Address] = true
+		if current, ok := actual[service.Address]; !ok {
+			result.Created = append(result.Created, service)
+		} else if reflect.DeepEqual(normaliseServiceInterface(current), normaliseServiceInterface(service)) {
+			result.Unchanged = append(result.Unchanged, service)
+		} else {
+			result.Updated = append(result.Updated, service)
+		}
+	}
+	if prune {
+		for address, service := range actual {
+			// only definitions created locally are candidates for
+			// pruning; those synced from other sites or derived from
+			// annotations are managed elsewhere
+			if !required[address] && service.Origin == "" {
+				result.Deleted = append(result.Deleted, service)
+			}
+		}
+	}
+	sort.Sort(byAddress(result.Created))
+	sort.Sort(byAddress(result.Updated))
+	sort.Sort(byAddress(result.Deleted))
+	sort.Sort(byAddress(result.Unchanged))
+	return result
+}
+
+func validateServiceInterfaceManifest(services []*types.ServiceInterface) error {
+	addresses := map[string]bool{}
+	for _, service := range services {
+		if service.Address == "" {
+			return fmt.Errorf("Service address must be specified")
+		}
+		if addresses[service.Address] {
+			return fmt.Errorf("Service %s is defined more than once", service.Address)
+		}
+		addresses[service.Address] = true
+		if err := ValidateServiceInterface(service); err != nil {
+			return fmt.Errorf("Invalid definition for service %s: %w", service.Address, err)
+		}
+	}
+	return nil
+}
+
+func (cli *VanClient) ServiceInterfaceApply(ctx context.Context, services []*types.ServiceInterface, options types.ServiceInterfaceApplyOptions) (*types.ServiceInterfaceApplyResponse, error) {
+	owner, err := getRootObject(cli)
+	if errors.IsNotFound(err) {
+		return nil, fmt.Errorf("Skupper not initialised in %s", cli.Namespace)
+	} else if err != nil {
+		return nil, err
+	}
+	for _, service := range services {
+		// definitions in a manifest are always owned by this site
+		service.Origin = ""
+		if service.Targets == nil {
+			service.Targets = []types.ServiceInterfaceTarget{}
+		}
+	}
+	if err = validateServiceInterfaceManifest(services); err != nil {
+		return nil, err
+	}
+
+	current, err := cli.KubeClient.CoreV1().ConfigMaps(cli.Namespace).Get(types.ServiceInterfaceConfigMap, metav1.GetOptions{})
+	exists := true
+	if errors.IsNotFound(err) {
+		exists = false
+		current = &corev1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "v1",
+				Kind:       "ConfigMap",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: types.ServiceInterfaceConfigMap,
+			},
+		}
+		if owner != nil {
+			current.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+				*owner,
+			}
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not retrieve service interface definitions from configmap: %s", err)
+	}
+
+	actual, err := parseServiceInterfaceDefinitions(current)
+	if err != nil {
+		return nil, err
+	}
+	result := getServiceInterfaceChanges(services, actual, options.Prune)
+	if options.DryRun || (len(result.Created) == 0 && len(result.Updated) == 0 && len(result.Deleted) == 0) {
+		return result, nil
+	}
+
+	if current.Data == nil {
+		current.Data = map[string]string{}
+	}
+	for _, changed := range [][]*types.ServiceInterface{result.Created, result.Updated} {
+		for _, service := range changed {
+			encoded, err := jsonencoding.Marshal(service)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to encode service interface as json: %s", err)
+			}
+			current.Data[service.Address] = string(encoded)
+		}
+	}
+	for _, service := range result.Deleted {
+		delete(current.Data, service.Address)
+	}
+	// all changes are applied through a single write, which will be
+	// rejected if the configmap was modified since it was read
+	if exists {
+		_, err = cli.KubeClient.CoreV1().ConfigMaps(cli.Namespace).Update(current)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to update skupper-services config map: %s", err)
+		}
+	} else {
+		_, err = cli.KubeClient.CoreV1().ConfigMaps(cli.Namespace).Create(current)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create skupper-services config map: %s", err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/skupperproject/skupper/api/types"
+)
+
+func getAddresses(services []*types.ServiceInterface) []string {
+	addresses := []string{}
+	for _, s := range services {
+		addresses = append(addresses, s.Address)
+	}
+	return addresses
+}
+
+func TestServiceInterfaceApply(t *testing.T) {
+	ctx := context.Background()
+	cli, err := newMockClient("skupper", "", "")
+	assert.Assert(t, err)
+
+	manifest := func() []*types.ServiceInterface {
+		return []*types.ServiceInterface{
+			{Address: "db", Protocol: "tcp", Port: 5432},
+			{Address: "web", Protocol: "http", Port: 8080, Targets: []types.ServiceInterfaceTarget{{Name: "web", Selector: "app=web"}}},
+		}
+	}
+
+	_, err = cli.ServiceInterfaceApply(ctx, manifest(), types.ServiceInterfaceApplyOptions{})
+	assert.Error(t, err, "Skupper not initialised in skupper")
+
+	_, err = cli.KubeClient.AppsV1().Deployments("skupper").Create(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: types.TransportDeploymentName},
+	})
+	assert.Assert(t, err)
+
+	invalid := append(manifest(), &types.ServiceInterface{Address: "db", Protocol: "tcp", Port: 1})
+	_, err = cli.ServiceInterfaceApply(ctx, invalid, types.ServiceInterfaceApplyOptions{})
+	assert.Error(t, err, "Service db is defined more than once")
+
+	invalid = []*types.ServiceInterface{{Address: "bad", Protocol: "sctp", Port: 1}}
+	_, err = cli.ServiceInterfaceApply(ctx, invalid, types.ServiceInterfaceApplyOptions{})
+	assert.ErrorContains(t, err, "Invalid definition for service bad")
+
+	// dry run makes no changes
+	result, err := cli.ServiceInterfaceApply(ctx, manifest(), types.ServiceInterfaceApplyOptions{DryRun: true})
+	assert.Assert(t, err)
+	assert.DeepEqual(t, getAddresses(result.Created), []string{"db", "web"})
+	list, err := cli.ServiceInterfaceList(ctx)
+	assert.Assert(t, err != nil || len(list) == 0)
+
+	result, err = cli.ServiceInterfaceApply(ctx, manifest(), types.ServiceInterfaceApplyOptions{})
+	assert.Assert(t, err)
+	assert.DeepEqual(t, getAddresses(result.Created), []string{"db", "web"})
+	list, err = cli.ServiceInterfaceList(ctx)
+	assert.Assert(t, err)
+	assert.Equal(t, len(list), 2)
+
+	// a service synced from another site and one created out of band
+	err = updateServiceInterface(&types.ServiceInterface{Address: "remote", Protocol: "tcp", Port: 9090, Origin: "other-site"}, true, nil, cli)
+	assert.Assert(t, err)
+	err = updateServiceInterface(&types.ServiceInterface{Address: "extra", Protocol: "tcp", Port: 9090}, true, nil, cli)
+	assert.Assert(t, err)
+
+	changed := manifest()
+	changed[0].Port = 5433
+	result, err = cli.ServiceInterfaceApply(ctx, changed, types.ServiceInterfaceApplyOptions{})
+	assert.Assert(t, err)
+	assert.DeepEqual(t, getAddresses(result.Updated), []string{"db"})
+	assert.DeepEqual(t, getAddresses(result.Unchanged), []string{"web"})
+	assert.Equal(t, len(result.Deleted), 0)
+
+	result, err = cli.ServiceInterfaceApply(ctx, changed, types.ServiceInterfaceApplyOptions{Prune: true, DryRun: true})
+	assert.Assert(t, err)
+	assert.DeepEqual(t, getAddresses(result.Deleted), []string{"extra"})
+	list, err = cli.ServiceInterfaceList(ctx)
+	assert.Assert(t, err)
+	assert.Equal(t, len(list), 4)
+
+	result, err = cli.ServiceInterfaceApply(ctx, changed, types.ServiceInterfaceApplyOptions{Prune: true})
+	assert.Assert(t, err)
+	assert.DeepEqual(t, getAddresses(result.Deleted), []string{"extra"})
+	db, err := cli.ServiceInterfaceInspect(ctx, "db")
+	assert.Assert(t, err)
+	assert.Equal(t, db.Port, 5433)
+	extra, err := cli.ServiceInterfaceInspect(ctx, "extra")
+	assert.Assert(t, err)
+	assert.Assert(t, extra == nil)
+	remote, err := cli.ServiceInterfaceInspect(ctx, "remote")
+	assert.Assert(t, err)
+	assert.Assert(t, remote != nil)
+}
+
+func TestServiceInterfaceApplyEmptyCollections(t *testing.T) {
+	// definitions read back from json have nil for omitted lists and
+	// maps, which are not a change from empty ones in the manifest
+	actual := map[string]*types.ServiceInterface{
+		"db": {Address: "db", Protocol: "tcp", Port: 5432, Targets: []types.ServiceInterfaceTarget{{Name: "db"}}},
+	}
+	desired := []*types.ServiceInterface{
+		{Address: "db", Protocol: "tcp", Port: 5432, Ports: []types.ServiceInterfacePort{}, Targets: []types.ServiceInterfaceTarget{{Name: "db", TargetPorts: map[string]int{}}}},
+	}
+	result := getServiceInterfaceChanges(desired, actual, false)
+	assert.DeepEqual(t, getAddresses(result.Unchanged), []string{"db"})
+	assert.Equal(t, len(result.Updated), 0)
+	assert.Assert(t, desired[0].Targets[0].TargetPorts != nil)
+}
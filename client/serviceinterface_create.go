@@ -12,7 +12,7 @@ import (
 func (cli *VanClient) ServiceInterfaceCreate(ctx context.Context, service *types.ServiceInterface) error {
 	owner, err := getRootObject(cli)
 	if err == nil {
-		err = validateServiceInterface(service)
+		err = ValidateServiceInterface(service)
 		if err != nil {
 			return err
 		}
@@ -151,7 +151,9 @@ func updateServiceInterface(service *types.ServiceInterface, overwriteIfExists b
 	}
 }
 
-func validateServiceInterface(service *types.ServiceInterface) error {
+// ValidateServiceInterface checks the definition of a service before
+// it is added to the skupper-services config map
+func ValidateServiceInterface(service *types.ServiceInterface) error {
 	if service.Headless != nil {
 		if service.Headless.TargetPort < 0 || 65535 < service.Headless.TargetPort {
 			return fmt.Errorf("Bad headless target port number: %d", service.Headless.TargetPort)
@@ -162,6 +164,23 @@ func validateServiceInterface(service *types.ServiceInterface) error {
 		if target.TargetPort < 0 || 65535 < target.TargetPort {
 			return fmt.Errorf("Bad target port number. Target: %s  Port: %d", target.Name, target.TargetPort)
 		}
+		if target.Weight < 0 || types.MaxTargetWeight < target.Weight {
+			return fmt.Errorf("Bad target weight. Target: %s  Weight: %d (must be between 1 and %d)", target.Name, target.Weight, types.MaxTargetWeight)
+		}
+		if err := validateSitePreference(target.SitePreference); err != nil {
+			return err
+		}
+		for name, port := range target.TargetPorts {
+			if !hasAdditionalPort(service, name) {
+				return fmt.Errorf("Target %s specifies a port for %s, which is not an additional port of the service", target.Name, name)
+			}
+			if port < 0 || 65535 < port {
+				return fmt.Errorf("Bad target port number. Target: %s  Port: %d", target.Name, port)
+			}
+		}
+	}
+	if err := validatePorts(service); err != nil {
+		return err
 	}
 
 	//TODO: change service.Protocol to service.Mapping
@@ -171,23 +190,74 @@ func validateServiceInterface(service *types.ServiceInterface) error {
 		return fmt.Errorf("Only one of aggregate and event-channel can be specified for a given service.")
 	} else if service.Aggregate != "" && service.Aggregate != "json" && service.Aggregate != "multipart" {
 		return fmt.Errorf("%s is not a valid aggregation strategy. Choose 'json' or 'multipart'.", service.Aggregate)
-	} else if service.Protocol != "" && service.Protocol != "tcp" && service.Protocol != "http" && service.Protocol != "http2" {
-		return fmt.Errorf("%s is not a valid mapping. Choose 'tcp', 'http' or 'http2'.", service.Protocol)
+	} else if service.Protocol != "" && service.Protocol != "tcp" && service.Protocol != "http" && service.Protocol != "http2" && service.Protocol != "udp" {
+		return fmt.Errorf("%s is not a valid mapping. Choose 'tcp', 'http', 'http2' or 'udp'.", service.Protocol)
 	} else if service.Aggregate != "" && service.Protocol != "http" {
 		return fmt.Errorf("The aggregate option is currently only valid for http")
 	} else if service.EventChannel && service.Protocol != "http" {
 		return fmt.Errorf("The event-channel option is currently only valid for http")
+	} else if service.Tls != nil && service.Headless != nil {
+		return fmt.Errorf("The tls options are not currently supported for headless services")
+	} else if service.Tls != nil && service.Protocol == "udp" {
+		return fmt.Errorf("The tls options are not supported for udp")
 	} else {
 		return nil
 	}
 }
 
+func hasAdditionalPort(service *types.ServiceInterface, name string) bool {
+	for _, p := range service.GetAdditionalPorts() {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func validatePorts(service *types.ServiceInterface) error {
+	if len(service.Ports) == 0 {
+		return nil
+	}
+	if service.Headless != nil && len(service.Ports) > 1 {
+		return fmt.Errorf("Multiple ports are not currently supported for headless services")
+	}
+	if service.Port != 0 && service.Port != service.Ports[0].Port {
+		return fmt.Errorf("Port %d does not match the first of the named ports (%d)", service.Port, service.Ports[0].Port)
+	}
+	names := map[string]bool{}
+	ports := map[int]bool{}
+	for _, p := range service.Ports {
+		if p.Name == "" {
+			return fmt.Errorf("Each port of a service with multiple ports must be named")
+		} else if names[p.Name] {
+			return fmt.Errorf("Duplicate port name %s", p.Name)
+		} else if p.Port < 1 || 65535 < p.Port {
+			return fmt.Errorf("Port %d is outside valid range.", p.Port)
+		} else if ports[p.Port] {
+			return fmt.Errorf("Duplicate port %d", p.Port)
+		}
+		names[p.Name] = true
+		ports[p.Port] = true
+	}
+	service.Port = service.Ports[0].Port
+	return nil
+}
+
+func validateSitePreference(preference string) error {
+	switch preference {
+	case "", types.SitePreferencePreferLocal, types.SitePreferenceLocalOnly, types.SitePreferenceFailoverOnly:
+		return nil
+	default:
+		return fmt.Errorf("%s is not a valid site preference. Choose '%s', '%s' or '%s'.", preference, types.SitePreferencePreferLocal, types.SitePreferenceLocalOnly, types.SitePreferenceFailoverOnly)
+	}
+}
+
 func (cli *VanClient) ServiceInterfaceUpdate(ctx context.Context, service *types.ServiceInterface) error {
 	owner, err := getRootObject(cli)
 	if err == nil {
 		_, err = cli.ServiceInterfaceInspect(ctx, service.Address)
 		if err == nil {
-			err = validateServiceInterface(service)
+			err = ValidateServiceInterface(service)
 			if err != nil {
 				return err
 			}
@@ -203,9 +273,13 @@ func (cli *VanClient) ServiceInterfaceUpdate(ctx context.Context, service *types
 }
 
 func (cli *VanClient) ServiceInterfaceBind(ctx context.Context, service *types.ServiceInterface, targetType string, targetName string, protocol string, targetPort int) error {
+	return cli.ServiceInterfaceBindWithOptions(ctx, service, targetType, targetName, protocol, targetPort, types.ServiceInterfaceBindOptions{})
+}
+
+func (cli *VanClient) ServiceInterfaceBindWithOptions(ctx context.Context, service *types.ServiceInterface, targetType string, targetName string, protocol string, targetPort int, options types.ServiceInterfaceBindOptions) error {
 	owner, err := getRootObject(cli)
 	if err == nil {
-		err = validateServiceInterface(service)
+		err = ValidateServiceInterface(service)
 		if err != nil {
 			return err
 		}
@@ -233,7 +307,13 @@ func (cli *VanClient) ServiceInterfaceBind(ctx context.Context, service *types.S
 				return fmt.Errorf("Service port required and cannot be deduced.")
 			}
 		}
+		target.Weight = options.Weight
+		target.SitePreference = options.SitePreference
 		addTargetToServiceInterface(service, target)
+		err = ValidateServiceInterface(service)
+		if err != nil {
+			return err
+		}
 		return updateServiceInterface(service, true, owner, cli)
 	} else if errors.IsNotFound(err) {
 		return fmt.Errorf("Skupper not initialised in %s", cli.Namespace)
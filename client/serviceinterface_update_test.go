@@ -408,3 +408,123 @@ func TestVanServiceInteraceUpdate(t *testing.T) {
 	assert.Equal(t, len(items), 0)
 
 }
+
+func TestValidateServiceInterfaceTargetPolicy(t *testing.T) {
+	testcases := []struct {
+		doc         string
+		target      types.ServiceInterfaceTarget
+		expectedErr string
+	}{
+		{
+			doc:    "Default policy.",
+			target: types.ServiceInterfaceTarget{Name: "t", Selector: "app=t"},
+		},
+		{
+			doc:    "Weighted, prefer local.",
+			target: types.ServiceInterfaceTarget{Name: "t", Selector: "app=t", Weight: 9, SitePreference: types.SitePreferencePreferLocal},
+		},
+		{
+			doc:         "Weight too large.",
+			target:      types.ServiceInterfaceTarget{Name: "t", Selector: "app=t", Weight: 11},
+			expectedErr: "Bad target weight",
+		},
+		{
+			doc:         "Negative weight.",
+			target:      types.ServiceInterfaceTarget{Name: "t", Selector: "app=t", Weight: -1},
+			expectedErr: "Bad target weight",
+		},
+		{
+			doc:         "Unknown site preference.",
+			target:      types.ServiceInterfaceTarget{Name: "t", Selector: "app=t", SitePreference: "remote-only"},
+			expectedErr: "remote-only is not a valid site preference",
+		},
+	}
+	for _, c := range testcases {
+		service := &types.ServiceInterface{
+			Address:  "svc",
+			Protocol: "tcp",
+			Port:     8080,
+			Targets:  []types.ServiceInterfaceTarget{c.target},
+		}
+		err := ValidateServiceInterface(service)
+		if c.expectedErr == "" {
+			assert.Assert(t, err, c.doc)
+		} else {
+			assert.ErrorContains(t, err, c.expectedErr, c.doc)
+		}
+	}
+}
+
+func TestValidateServiceInterfacePorts(t *testing.T) {
+	web := types.ServiceInterfacePort{Name: "web", Port: 8080}
+	admin := types.ServiceInterfacePort{Name: "admin", Port: 9090}
+	testcases := []struct {
+		doc         string
+		port        int
+		ports       []types.ServiceInterfacePort
+		targetPorts map[string]int
+		headless    *types.Headless
+		expectedErr string
+	}{
+		{
+			doc:   "Port taken from the first named port.",
+			ports: []types.ServiceInterfacePort{web, admin},
+		},
+		{
+			doc:         "Additional target port.",
+			port:        8080,
+			ports:       []types.ServiceInterfacePort{web, admin},
+			targetPorts: map[string]int{"admin": 9091},
+		},
+		{
+			doc:         "Port differs from first named port.",
+			port:        80,
+			ports:       []types.ServiceInterfacePort{web, admin},
+			expectedErr: "Port 80 does not match the first of the named ports (8080)",
+		},
+		{
+			doc:         "Unnamed port.",
+			ports:       []types.ServiceInterfacePort{web, {Port: 9090}},
+			expectedErr: "Each port of a service with multiple ports must be named",
+		},
+		{
+			doc:         "Duplicate name.",
+			ports:       []types.ServiceInterfacePort{web, {Name: "web", Port: 9090}},
+			expectedErr: "Duplicate port name web",
+		},
+		{
+			doc:         "Duplicate port.",
+			ports:       []types.ServiceInterfacePort{web, {Name: "admin", Port: 8080}},
+			expectedErr: "Duplicate port 8080",
+		},
+		{
+			doc:         "Target port for unknown port.",
+			ports:       []types.ServiceInterfacePort{web, admin},
+			targetPorts: map[string]int{"metrics": 9100},
+			expectedErr: "metrics",
+		},
+		{
+			doc:         "Headless.",
+			ports:       []types.ServiceInterfacePort{web, admin},
+			headless:    &types.Headless{Name: "db", Size: 1},
+			expectedErr: "Multiple ports are not currently supported for headless services",
+		},
+	}
+	for _, c := range testcases {
+		service := &types.ServiceInterface{
+			Address:  "svc",
+			Protocol: "tcp",
+			Port:     c.port,
+			Ports:    c.ports,
+			Headless: c.headless,
+			Targets:  []types.ServiceInterfaceTarget{{Name: "t", Selector: "app=t", TargetPorts: c.targetPorts}},
+		}
+		err := ValidateServiceInterface(service)
+		if c.expectedErr == "" {
+			assert.Assert(t, err, c.doc)
+			assert.Equal(t, service.Port, 8080, c.doc)
+		} else {
+			assert.ErrorContains(t, err, c.expectedErr, c.doc)
+		}
+	}
+}
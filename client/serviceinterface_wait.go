@@ -0,0 +1,74 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/utils"
+)
+
+// Returns true if any site in the network has a target for the address
+func hasReachableTarget(graph *types.NetworkGraph, address string) bool {
+	for _, site := range graph.Sites {
+		for _, service := range site.Services {
+			if service == address {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns a description of what is still needed before the service
+// can be used, or an empty string if it is ready
+func (cli *VanClient) getServiceInterfacePending(ctx context.Context, address string) (string, error) {
+	service, err := cli.ServiceInterfaceInspect(ctx, address)
+	if err != nil {
+		return "", err
+	} else if service == nil {
+		return "the service has not been defined", nil
+	}
+	name := service.Address
+	if service.Headless != nil {
+		name = service.Headless.Name
+	}
+	_, err = cli.KubeClient.CoreV1().Services(cli.Namespace).Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return fmt.Sprintf("no Kubernetes service %s has been created", name), nil
+	} else if err != nil {
+		return "", err
+	}
+	graph, err := cli.NetworkGraph(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !hasReachableTarget(graph, service.Address) {
+		return "no target is reachable in any site", nil
+	}
+	return "", nil
+}
+
+// ServiceInterfaceWaitReady blocks until the Kubernetes service for the
+// address has been created and a target for it is reachable in the
+// local or any remote site, or until the context is done
+func (cli *VanClient) ServiceInterfaceWaitReady(ctx context.Context, address string) error {
+	pending := "the service has not been defined"
+	err := utils.RetryWithContext(ctx, time.Second*5, func() (bool, error) {
+		current, err := cli.getServiceInterfacePending(ctx, address)
+		if err != nil {
+			pending = err.Error()
+			return false, nil
+		}
+		pending = current
+		return pending == "", nil
+	})
+	if err != nil {
+		return fmt.Errorf("Timed out waiting for service %s: %s", address, pending)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper/api/types"
+)
+
+func TestHasReachableTarget(t *testing.T) {
+	graph := &types.NetworkGraph{
+		Sites: []types.NetworkGraphSite{
+			{Id: "site-a", Routers: []string{"router-a"}},
+			{Id: "site-b", Routers: []string{"router-b"}, Services: []string{"backend", "frontend"}},
+		},
+	}
+	assert.Assert(t, hasReachableTarget(graph, "frontend"))
+	assert.Assert(t, !hasReachableTarget(graph, "database"))
+	assert.Assert(t, !hasReachableTarget(&types.NetworkGraph{}, "frontend"))
+}
+
+func TestServiceInterfaceWaitReadyTimeout(t *testing.T) {
+	cli, err := newMockClient("skupper", "", "")
+	assert.Check(t, err, "Unable to create client.")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = cli.ServiceInterfaceWaitReady(ctx, "frontend")
+	assert.Error(t, err, "Timed out waiting for service frontend: the service has not been defined")
+}
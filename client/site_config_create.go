@@ -2,6 +2,8 @@ package client
 
 import (
 	"context"
+	"strconv"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -58,10 +60,41 @@ func (cli *VanClient) SiteConfigCreate(ctx context.Context, spec types.SiteConfi
 	if spec.Password != "" {
 		siteConfig.Data["console-password"] = spec.Password
 	}
+	if spec.OidcIssuer != "" {
+		siteConfig.Data["console-oidc-issuer"] = spec.OidcIssuer
+	}
+	if len(spec.OidcGroups) > 0 {
+		siteConfig.Data["console-oidc-groups"] = strings.Join(spec.OidcGroups, ",")
+	}
+	if len(spec.ConsoleOperators) > 0 {
+		siteConfig.Data["console-operators"] = strings.Join(spec.ConsoleOperators, ",")
+	}
 	if spec.ClusterLocal {
 		siteConfig.Data["cluster-local"] = "true"
 	}
-	// TODO: allow Replicas to be set through skupper-site configmap?
+	if spec.ServiceSyncInterval != 0 {
+		siteConfig.Data["service-sync-interval"] = spec.ServiceSyncInterval.String()
+	}
+	if spec.ServiceSyncAgeOut != 0 {
+		siteConfig.Data["service-sync-age-out"] = spec.ServiceSyncAgeOut.String()
+	}
+	setTuning(siteConfig.Data, "router", spec.Router)
+	setTuning(siteConfig.Data, "controller", spec.Controller)
+	if spec.NodeSelector != "" {
+		siteConfig.Data["node-selector"] = spec.NodeSelector
+	}
+	if spec.NodeAffinity != "" {
+		siteConfig.Data["node-affinity"] = spec.NodeAffinity
+	}
+	if len(spec.Tolerations) > 0 {
+		siteConfig.Data["tolerations"] = strings.Join(spec.Tolerations, ",")
+	}
+	if spec.PriorityClass != "" {
+		siteConfig.Data["priority-class"] = spec.PriorityClass
+	}
+	if spec.Replicas > 1 {
+		siteConfig.Data["router-replicas"] = strconv.Itoa(int(spec.Replicas))
+	}
 	if !spec.SiteControlled {
 		siteConfig.ObjectMeta.Labels = map[string]string{
 			"internal.skupper.io/site-controller-ignore": "true",
@@ -76,3 +109,20 @@ func (cli *VanClient) SiteConfigCreate(ctx context.Context, spec types.SiteConfi
 	}
 	return cli.SiteConfigInspect(ctx, actual)
 }
+
+// Records the resources of a component under keys prefixed with its
+// name, e.g. router-cpu
+func setTuning(data map[string]string, component string, tuning types.Tuning) {
+	if tuning.Cpu != "" {
+		data[component+"-cpu"] = tuning.Cpu
+	}
+	if tuning.Memory != "" {
+		data[component+"-memory"] = tuning.Memory
+	}
+	if tuning.CpuLimit != "" {
+		data[component+"-cpu-limit"] = tuning.CpuLimit
+	}
+	if tuning.MemoryLimit != "" {
+		data[component+"-memory-limit"] = tuning.MemoryLimit
+	}
+}
@@ -3,12 +3,15 @@ package client
 import (
 	"context"
 	"strconv"
+	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/api/v1alpha1"
 )
 
 func (cli *VanClient) SiteConfigInspect(ctx context.Context, input *corev1.ConfigMap) (*types.SiteConfig, error) {
@@ -16,7 +19,7 @@ func (cli *VanClient) SiteConfigInspect(ctx context.Context, input *corev1.Confi
 	if input == nil {
 		cm, err := cli.KubeClient.CoreV1().ConfigMaps(cli.Namespace).Get("skupper-site", metav1.GetOptions{})
 		if errors.IsNotFound(err) {
-			return nil, nil
+			return cli.skupperSiteInspect()
 		} else if err != nil {
 			return nil, err
 		}
@@ -73,12 +76,38 @@ func (cli *VanClient) SiteConfigInspect(ctx context.Context, input *corev1.Confi
 	} else {
 		result.Spec.Password = ""
 	}
+	if issuer, ok := siteConfig.Data["console-oidc-issuer"]; ok {
+		result.Spec.OidcIssuer = issuer
+	}
+	if groups, ok := siteConfig.Data["console-oidc-groups"]; ok && groups != "" {
+		result.Spec.OidcGroups = strings.Split(groups, ",")
+	}
+	if operators, ok := siteConfig.Data["console-operators"]; ok && operators != "" {
+		result.Spec.ConsoleOperators = strings.Split(operators, ",")
+	}
 	if clusterLocal, ok := siteConfig.Data["cluster-local"]; ok {
 		result.Spec.ClusterLocal, _ = strconv.ParseBool(clusterLocal)
 	} else {
 		result.Spec.ClusterLocal = false
 	}
-	// TODO: allow Replicas to be set through skupper-site configmap?
+	if interval, ok := siteConfig.Data["service-sync-interval"]; ok {
+		result.Spec.ServiceSyncInterval, _ = time.ParseDuration(interval)
+	}
+	if ageOut, ok := siteConfig.Data["service-sync-age-out"]; ok {
+		result.Spec.ServiceSyncAgeOut, _ = time.ParseDuration(ageOut)
+	}
+	result.Spec.Router = getTuning(siteConfig.Data, "router")
+	result.Spec.Controller = getTuning(siteConfig.Data, "controller")
+	result.Spec.NodeSelector = siteConfig.Data["node-selector"]
+	result.Spec.NodeAffinity = siteConfig.Data["node-affinity"]
+	if tolerations, ok := siteConfig.Data["tolerations"]; ok && tolerations != "" {
+		result.Spec.Tolerations = strings.Split(tolerations, ",")
+	}
+	result.Spec.PriorityClass = siteConfig.Data["priority-class"]
+	if replicas, ok := siteConfig.Data["router-replicas"]; ok {
+		count, _ := strconv.Atoi(replicas)
+		result.Spec.Replicas = int32(count)
+	}
 	if siteConfig.ObjectMeta.Labels == nil {
 		result.Spec.SiteControlled = true
 	} else if ignore, ok := siteConfig.ObjectMeta.Labels["internal.skupper.io/site-controller-ignore"]; ok {
@@ -93,3 +122,97 @@ func (cli *VanClient) SiteConfigInspect(ctx context.Context, input *corev1.Confi
 	result.Reference.APIVersion = siteConfig.TypeMeta.APIVersion
 	return &result, nil
 }
+
+// A site may be configured through a SkupperSite resource rather than
+// the skupper-site config map, if the resource has been defined
+func (cli *VanClient) skupperSiteInspect() (*types.SiteConfig, error) {
+	if cli.DynamicClient == nil {
+		return nil, nil
+	}
+	list, err := cli.DynamicClient.Resource(v1alpha1.SkupperSiteResource).Namespace(cli.Namespace).List(metav1.ListOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+	site := v1alpha1.SkupperSite{}
+	if err = v1alpha1.FromUnstructured(&list.Items[0], &site); err != nil {
+		return nil, err
+	}
+	return GetSiteConfigForSkupperSite(&site), nil
+}
+
+// GetSiteConfigForSkupperSite returns the configuration of the site
+// defined by a SkupperSite resource, with the same defaults as apply
+// to the skupper-site config map
+func GetSiteConfigForSkupperSite(site *v1alpha1.SkupperSite) *types.SiteConfig {
+	var result types.SiteConfig
+	result.Spec.SkupperNamespace = site.ObjectMeta.Namespace
+	result.Spec.SkupperName = site.Spec.Name
+	if result.Spec.SkupperName == "" {
+		result.Spec.SkupperName = site.ObjectMeta.Namespace
+	}
+	result.Spec.IsEdge = site.Spec.Edge
+	result.Spec.EnableController = getBoolOrDefault(site.Spec.ServiceController, true)
+	result.Spec.EnableServiceSync = getBoolOrDefault(site.Spec.ServiceSync, true)
+	result.Spec.EnableConsole = getBoolOrDefault(site.Spec.Console, true)
+	result.Spec.EnableRouterConsole = site.Spec.RouterConsole
+	result.Spec.AuthMode = site.Spec.ConsoleAuthentication
+	if result.Spec.AuthMode == "" {
+		result.Spec.AuthMode = "internal"
+	}
+	result.Spec.User = site.Spec.ConsoleUser
+	result.Spec.Password = site.Spec.ConsolePassword
+	result.Spec.OidcIssuer = site.Spec.ConsoleOidcIssuer
+	result.Spec.OidcGroups = site.Spec.ConsoleOidcGroups
+	result.Spec.ConsoleOperators = site.Spec.ConsoleOperators
+	result.Spec.ClusterLocal = site.Spec.ClusterLocal
+	if site.Spec.ServiceSyncInterval != "" {
+		result.Spec.ServiceSyncInterval, _ = time.ParseDuration(site.Spec.ServiceSyncInterval)
+	}
+	if site.Spec.ServiceSyncAgeOut != "" {
+		result.Spec.ServiceSyncAgeOut, _ = time.ParseDuration(site.Spec.ServiceSyncAgeOut)
+	}
+	result.Spec.Router = types.Tuning{
+		Cpu:         site.Spec.RouterCpu,
+		Memory:      site.Spec.RouterMemory,
+		CpuLimit:    site.Spec.RouterCpuLimit,
+		MemoryLimit: site.Spec.RouterMemoryLimit,
+	}
+	result.Spec.Controller = types.Tuning{
+		Cpu:         site.Spec.ControllerCpu,
+		Memory:      site.Spec.ControllerMemory,
+		CpuLimit:    site.Spec.ControllerCpuLimit,
+		MemoryLimit: site.Spec.ControllerMemoryLimit,
+	}
+	result.Spec.NodeSelector = site.Spec.NodeSelector
+	result.Spec.NodeAffinity = site.Spec.NodeAffinity
+	result.Spec.Tolerations = site.Spec.Tolerations
+	result.Spec.PriorityClass = site.Spec.PriorityClass
+	result.Spec.Replicas = site.Spec.RouterReplicas
+	result.Spec.SiteControlled = true
+	result.Reference.UID = string(site.ObjectMeta.UID)
+	result.Reference.Name = site.ObjectMeta.Name
+	result.Reference.Kind = v1alpha1.SkupperSiteKind
+	result.Reference.APIVersion = v1alpha1.SchemeGroupVersion.String()
+	return &result
+}
+
+func getTuning(data map[string]string, component string) types.Tuning {
+	return types.Tuning{
+		Cpu:         data[component+"-cpu"],
+		Memory:      data[component+"-memory"],
+		CpuLimit:    data[component+"-cpu-limit"],
+		MemoryLimit: data[component+"-memory-limit"],
+	}
+}
+
+func getBoolOrDefault(value *bool, defaultValue bool) bool {
+	if value == nil {
+		return defaultValue
+	}
+	return *value
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/api/v1alpha1"
+)
+
+func TestSkupperSiteInspect(t *testing.T) {
+	cli, err := newMockClient("skupper", "", "")
+	assert.Assert(t, err)
+	siteConfig, err := cli.SiteConfigInspect(context.Background(), nil)
+	assert.Assert(t, err)
+	assert.Assert(t, siteConfig == nil)
+
+	site := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "skupper.io/v1alpha1",
+			"kind":       "SkupperSite",
+			"metadata": map[string]interface{}{
+				"name":      "mysite",
+				"namespace": "skupper",
+				"uid":       "1234",
+			},
+			"spec": map[string]interface{}{
+				"edge":                true,
+				"console":             false,
+				"consoleUser":         "admin",
+				"serviceSyncInterval": "10s",
+			},
+		},
+	}
+	cli.DynamicClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), site)
+	siteConfig, err = cli.SiteConfigInspect(context.Background(), nil)
+	assert.Assert(t, err)
+	assert.Assert(t, siteConfig != nil)
+	assert.DeepEqual(t, siteConfig.Spec, types.SiteConfigSpec{
+		SkupperName:         "skupper",
+		SkupperNamespace:    "skupper",
+		IsEdge:              true,
+		EnableController:    true,
+		EnableServiceSync:   true,
+		EnableConsole:       false,
+		AuthMode:            "internal",
+		User:                "admin",
+		SiteControlled:      true,
+		ServiceSyncInterval: 10 * time.Second,
+	})
+	assert.DeepEqual(t, siteConfig.Reference, types.SiteConfigReference{
+		UID:        "1234",
+		Name:       "mysite",
+		Kind:       v1alpha1.SkupperSiteKind,
+		APIVersion: "skupper.io/v1alpha1",
+	})
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/certs"
+	"github.com/skupperproject/skupper/pkg/kube"
+)
+
+// Each connection token is signed by its own CA, which the router
+// trusts for connections from other sites only while the token is
+// valid. A token that is revoked or superseded is then refused when a
+// connection is made with it, once the change to the mounted secret
+// has reached the router, rather than being closed after the fact.
+
+// Returns the certificates trusted by the router for connections from
+// other sites: those of the site CA and of the CA of each valid token
+func (cli *VanClient) getInterRouterTrustBundle(namespace string, ca *corev1.Secret) ([]byte, error) {
+	_, tokens, err := kube.GetIssuedTokens(namespace, cli.KubeClient)
+	if err != nil {
+		return nil, err
+	}
+	return append(certs.GetCABundle(ca), kube.GetTrustedTokenCAs(tokens, time.Now())...), nil
+}
+
+// Returns the certificates to be held as the ca.crt of a secret
+// issued by the specified CA
+func (cli *VanClient) getTrustBundle(name string, namespace string, ca *corev1.Secret) ([]byte, error) {
+	if name == types.InterRouterProfile {
+		return cli.getInterRouterTrustBundle(namespace, ca)
+	}
+	return certs.GetCABundle(ca), nil
+}
+
+func (cli *VanClient) updateTrustedTokens(namespace string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		ca, err := cli.KubeClient.CoreV1().Secrets(namespace).Get("skupper-internal-ca", metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			// edge sites accept no connections from other sites
+			return nil
+		} else if err != nil {
+			return err
+		}
+		secret, err := cli.KubeClient.CoreV1().Secrets(namespace).Get(types.InterRouterProfile, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		bundle, err := cli.getInterRouterTrustBundle(namespace, ca)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(secret.Data["ca.crt"], bundle) {
+			return nil
+		}
+		secret.Data["ca.crt"] = bundle
+		_, err = cli.KubeClient.CoreV1().Secrets(namespace).Update(secret)
+		if err != nil {
+			return fmt.Errorf("Failed to update trusted tokens: %w", err)
+		}
+		return nil
+	})
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -14,6 +15,7 @@ import (
 	"k8s.io/client-go/tools/cache"
 
 	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/kube"
 	"github.com/skupperproject/skupper/pkg/qdr"
 )
 
@@ -26,24 +28,39 @@ func getBridgeName(address string, host string) string {
 }
 
 type EgressBindings struct {
-	name       string
-	selector   string
-	service    string
-	egressPort int
-	informer   cache.SharedIndexInformer
-	stopper    chan struct{}
+	name           string
+	selector       string
+	service        string
+	egressPort     int
+	weight         int
+	sitePreference string
+	// egress ports for the additional ports of the service, by name
+	additionalPorts map[string]int
+	informer        cache.SharedIndexInformer
+	stopper         chan struct{}
+}
+
+// An additional port of a service with several, which is carried on
+// an address of its own
+type PortBindings struct {
+	name        string
+	publicPort  int
+	ingressPort int
 }
 
 type ServiceBindings struct {
-	origin       string
-	protocol     string
-	address      string
-	publicPort   int
-	ingressPort  int
-	aggregation  string
-	eventChannel bool
-	headless     *types.Headless
-	targets      map[string]*EgressBindings
+	origin          string
+	protocol        string
+	address         string
+	publicPort      int
+	ingressPort     int
+	portName        string
+	additionalPorts []*PortBindings
+	aggregation     string
+	eventChannel    bool
+	headless        *types.Headless
+	tls             *types.ServiceInterfaceTls
+	targets         map[string]*EgressBindings
 }
 
 func asServiceInterface(bindings *ServiceBindings) types.ServiceInterface {
@@ -55,7 +72,100 @@ func asServiceInterface(bindings *ServiceBindings) types.ServiceInterface {
 		EventChannel: bindings.eventChannel,
 		Headless:     bindings.headless,
 		Origin:       bindings.origin,
+		Tls:          bindings.tls,
+		Ports:        bindings.getPorts(),
+	}
+}
+
+func (sb *ServiceBindings) getPorts() []types.ServiceInterfacePort {
+	if len(sb.additionalPorts) == 0 && sb.portName == "" {
+		return nil
+	}
+	ports := []types.ServiceInterfacePort{
+		{
+			Name: sb.portName,
+			Port: sb.publicPort,
+		},
+	}
+	for _, p := range sb.additionalPorts {
+		ports = append(ports, types.ServiceInterfacePort{
+			Name: p.name,
+			Port: p.publicPort,
+		})
+	}
+	return ports
+}
+
+func (sb *ServiceBindings) getServicePortName() string {
+	if sb.portName != "" {
+		return sb.portName
+	}
+	return sb.address
+}
+
+// Returns the ports of the kubernetes service through which clients
+// in the local site access the service
+func (sb *ServiceBindings) getServicePorts() []corev1.ServicePort {
+	ports := []corev1.ServicePort{
+		kube.NewServicePort(sb.getServicePortName(), sb.protocol, sb.publicPort, sb.ingressPort),
+	}
+	for _, p := range sb.additionalPorts {
+		ports = append(ports, kube.NewServicePort(p.name, sb.protocol, p.publicPort, p.ingressPort))
+	}
+	return ports
+}
+
+// Allocates an ingress port for each additional port of the service
+// not yet bound, releasing those of any that are no longer required
+func (sb *ServiceBindings) updateAdditionalPorts(required types.ServiceInterface, ports *FreePorts, portAllocations map[string]int) error {
+	if len(required.Ports) > 0 {
+		sb.portName = required.Ports[0].Name
+	} else {
+		sb.portName = ""
+	}
+	current := map[string]*PortBindings{}
+	for _, p := range sb.additionalPorts {
+		current[p.name] = p
+	}
+	updated := []*PortBindings{}
+	for _, p := range required.GetAdditionalPorts() {
+		if existing, ok := current[p.Name]; ok {
+			existing.publicPort = p.Port
+			updated = append(updated, existing)
+			delete(current, p.Name)
+			continue
+		}
+		ingressPort := portAllocations[types.GetPortAddress(sb.address, p.Name)]
+		if ingressPort == 0 {
+			var err error
+			ingressPort, err = ports.nextFreePort()
+			if err != nil {
+				return err
+			}
+		}
+		updated = append(updated, &PortBindings{
+			name:        p.Name,
+			publicPort:  p.Port,
+			ingressPort: ingressPort,
+		})
+	}
+	for _, p := range current {
+		ports.release(p.ingressPort)
+	}
+	sb.additionalPorts = updated
+	return nil
+}
+
+func getAdditionalTargetPorts(service types.ServiceInterface, target types.ServiceInterfaceTarget) map[string]int {
+	ports := map[string]int{}
+	for _, p := range service.GetAdditionalPorts() {
+		if port, ok := target.TargetPorts[p.Name]; ok && port != 0 {
+			ports[p.Name] = port
+		} else {
+			ports[p.Name] = p.Port
+		}
 	}
+	return ports
 }
 
 type ServiceController struct {
@@ -118,12 +228,17 @@ func (c *Controller) updateServiceBindings(required types.ServiceInterface, port
 				}
 			}
 		}
-		sb := newServiceBindings(required.Origin, required.Protocol, required.Address, required.Port, required.Headless, port, required.Aggregate, required.EventChannel)
+		sb := newServiceBindings(required.Origin, required.Protocol, required.Address, required.Port, required.Headless, port, required.Aggregate, required.EventChannel, required.Tls)
+		if err := sb.updateAdditionalPorts(required, c.ports, portAllocations); err != nil {
+			return err
+		}
 		for _, t := range required.Targets {
 			if t.Selector != "" {
 				sb.addSelectorTarget(t.Name, t.Selector, getTargetPort(required, t), c)
+				sb.targets[t.Selector].setPolicy(required, t)
 			} else if t.Service != "" {
 				sb.addServiceTarget(t.Name, t.Service, getTargetPort(required, t), c)
+				sb.targets[t.Service].setPolicy(required, t)
 			}
 		}
 		c.bindings[required.Address] = sb
@@ -154,6 +269,12 @@ func (c *Controller) updateServiceBindings(required types.ServiceInterface, port
 		} else if bindings.headless != nil {
 			bindings.headless = nil
 		}
+		if !reflect.DeepEqual(bindings.tls, required.Tls) {
+			bindings.tls = required.Tls
+		}
+		if err := bindings.updateAdditionalPorts(required, c.ports, portAllocations); err != nil {
+			return err
+		}
 
 		hasSkupperSelector := false
 		for _, t := range required.Targets {
@@ -168,6 +289,7 @@ func (c *Controller) updateServiceBindings(required types.ServiceInterface, port
 				} else if target.egressPort != targetPort {
 					target.egressPort = targetPort
 				}
+				bindings.targets[t.Selector].setPolicy(required, t)
 			} else if t.Service != "" {
 				target := bindings.targets[t.Service]
 				if target == nil {
@@ -175,6 +297,7 @@ func (c *Controller) updateServiceBindings(required types.ServiceInterface, port
 				} else if target.egressPort != targetPort {
 					target.egressPort = targetPort
 				}
+				bindings.targets[t.Service].setPolicy(required, t)
 			}
 		}
 		for k, v := range bindings.targets {
@@ -192,7 +315,7 @@ func (c *Controller) updateServiceBindings(required types.ServiceInterface, port
 	return nil
 }
 
-func newServiceBindings(origin string, protocol string, address string, publicPort int, headless *types.Headless, ingressPort int, aggregation string, eventChannel bool) *ServiceBindings {
+func newServiceBindings(origin string, protocol string, address string, publicPort int, headless *types.Headless, ingressPort int, aggregation string, eventChannel bool, tls *types.ServiceInterfaceTls) *ServiceBindings {
 	return &ServiceBindings{
 		origin:       origin,
 		protocol:     protocol,
@@ -202,6 +325,7 @@ func newServiceBindings(origin string, protocol string, address string, publicPo
 		aggregation:  aggregation,
 		eventChannel: eventChannel,
 		headless:     headless,
+		tls:          tls,
 		targets:      map[string]*EgressBindings{},
 	}
 }
@@ -252,15 +376,66 @@ func (sb *ServiceBindings) stop() {
 	}
 }
 
+// Determines whether clients of the service in the local site should
+// use an address specific to that site, which is the case if it has
+// local-only targets. This does not depend on whether those targets
+// have endpoints available, as changing the address of the listener
+// would drop the connections made through it.
+func (sb *ServiceBindings) isLocal() bool {
+	for _, eb := range sb.targets {
+		if eb.sitePreference == types.SitePreferenceLocalOnly {
+			return true
+		}
+	}
+	return false
+}
+
+// Determines whether the router should route clients of the service to
+// the closest targets, which is the case if it has prefer-local
+// targets. The targets in the local site are then used while any have
+// endpoints available, without changing the address of the listener.
+func (sb *ServiceBindings) isClosest() bool {
+	for _, eb := range sb.targets {
+		if eb.sitePreference == types.SitePreferencePreferLocal {
+			return true
+		}
+	}
+	return false
+}
+
+func (sb *ServiceBindings) hasPrimaryEndpoints() bool {
+	for _, eb := range sb.targets {
+		if eb.sitePreference != types.SitePreferenceFailoverOnly && len(eb.getEndpoints()) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (sb *ServiceBindings) updateBridgeConfiguration(siteId string, bridges *qdr.BridgeConfig) {
 	if sb.headless == nil {
 		addIngressBridge(sb, siteId, bridges)
+		local := sb.isLocal()
+		failover := !sb.hasPrimaryEndpoints()
 		for _, eb := range sb.targets {
-			eb.updateBridgeConfiguration(sb.protocol, sb.address, siteId, bridges)
+			if eb.sitePreference == types.SitePreferenceFailoverOnly && !failover {
+				continue
+			}
+			eb.updateBridgeConfiguration(sb.protocol, sb.address, local, siteId, getEgressSslProfile(sb.tls), bridges)
 		}
 	} // headless proxies are not specified through the main bridge configuration
 }
 
+func getSiteLocalAddress(address string, siteId string) string {
+	return address + "@" + siteId
+}
+
+func (eb *EgressBindings) setPolicy(service types.ServiceInterface, target types.ServiceInterfaceTarget) {
+	eb.weight = target.Weight
+	eb.sitePreference = target.SitePreference
+	eb.additionalPorts = getAdditionalTargetPorts(service, target)
+}
+
 func (eb *EgressBindings) start() error {
 	go eb.informer.Run(eb.stopper)
 	if ok := cache.WaitForCacheSync(eb.stopper, eb.informer.HasSynced); !ok {
@@ -273,16 +448,83 @@ func (eb *EgressBindings) stop() {
 	close(eb.stopper)
 }
 
-func (eb *EgressBindings) updateBridgeConfiguration(protocol string, address string, siteId string, bridges *qdr.BridgeConfig) {
+type EgressEndpoint struct {
+	host           string
+	hostOverride   string
+	verifyHostname bool
+}
+
+func (eb *EgressBindings) getEndpoints() []EgressEndpoint {
+	endpoints := []EgressEndpoint{}
 	if eb.selector != "" {
 		pods := eb.informer.GetStore().List()
 		for _, p := range pods {
 			pod := p.(*corev1.Pod)
-			log.Printf("Adding pod for %s: %s", address, pod.ObjectMeta.Name)
-			addEgressBridge(protocol, pod.Status.PodIP, eb.egressPort, address, eb.name, siteId, "", bridges)
+			if pod.Status.PodIP == "" {
+				continue
+			}
+			//pods are addressed by ip, which their certificates are
+			//not expected to include, so only the ca is verified
+			endpoints = append(endpoints, EgressEndpoint{host: pod.Status.PodIP})
 		}
 	} else if eb.service != "" {
-		addEgressBridge(protocol, eb.service, eb.egressPort, address, eb.name, siteId, eb.service, bridges)
+		endpoints = append(endpoints, EgressEndpoint{host: eb.service, hostOverride: eb.service, verifyHostname: true})
+	}
+	return endpoints
+}
+
+// Returns the names under which connectors for the target are
+// registered with each of the specified addresses, one per unit of
+// weight, the first of which is the name of the target itself
+func (eb *EgressBindings) getConnectorNames(target string, address string, localAddress string) map[string]string {
+	addresses := []string{}
+	if eb.sitePreference != types.SitePreferenceLocalOnly {
+		addresses = append(addresses, address)
+	}
+	if localAddress != "" {
+		addresses = append(addresses, localAddress)
+	}
+	weight := eb.weight
+	if weight < 1 {
+		weight = 1
+	}
+	names := map[string]string{}
+	for _, a := range addresses {
+		name := target
+		if a == localAddress {
+			name += "/local"
+		}
+		for i := 1; i <= weight; i++ {
+			if i == 1 {
+				names[name] = a
+			} else {
+				names[fmt.Sprintf("%s#%d", name, i)] = a
+			}
+		}
+	}
+	return names
+}
+
+func getLocalAddressIf(local bool, address string, siteId string) string {
+	if local {
+		return getSiteLocalAddress(address, siteId)
+	}
+	return ""
+}
+
+func (eb *EgressBindings) updateBridgeConfiguration(protocol string, address string, local bool, siteId string, sslProfile string, bridges *qdr.BridgeConfig) {
+	names := eb.getConnectorNames(eb.name, address, getLocalAddressIf(local, address, siteId))
+	for _, endpoint := range eb.getEndpoints() {
+		log.Printf("Adding endpoint for %s: %s", address, endpoint.host)
+		for name, a := range names {
+			addEgressBridge(protocol, endpoint.host, eb.egressPort, a, name, siteId, endpoint.hostOverride, sslProfile, endpoint.verifyHostname, bridges)
+		}
+		for portName, port := range eb.additionalPorts {
+			portAddress := types.GetPortAddress(address, portName)
+			for name, a := range eb.getConnectorNames(types.GetPortAddress(eb.name, portName), portAddress, getLocalAddressIf(local, portAddress, siteId)) {
+				addEgressBridge(protocol, endpoint.host, port, a, name, siteId, endpoint.hostOverride, sslProfile, endpoint.verifyHostname, bridges)
+			}
+		}
 	}
 }
 
@@ -295,20 +537,27 @@ const (
 	ProtocolTCP   string = "tcp"
 	ProtocolHTTP  string = "http"
 	ProtocolHTTP2 string = "http2"
+	ProtocolUDP   string = "udp"
 )
 
-func addEgressBridge(protocol string, host string, port int, address string, target string, siteId string, hostOverride string, bridges *qdr.BridgeConfig) (bool, error) {
+func addEgressBridge(protocol string, host string, port int, address string, target string, siteId string, hostOverride string, sslProfile string, verifyHostname bool, bridges *qdr.BridgeConfig) (bool, error) {
 	if host == "" {
 		return false, fmt.Errorf("Cannot add connector without host (%s %s)", address, protocol)
 	}
+	var verify *bool
+	if sslProfile != "" {
+		verify = &verifyHostname
+	}
 	switch protocol {
 	case ProtocolHTTP:
 		b := qdr.HttpEndpoint{
-			Name:    getBridgeName(target, host),
-			Host:    host,
-			Port:    strconv.Itoa(port),
-			Address: address,
-			SiteId:  siteId,
+			Name:           getBridgeName(target, host),
+			Host:           host,
+			Port:           strconv.Itoa(port),
+			Address:        address,
+			SiteId:         siteId,
+			SslProfile:     sslProfile,
+			VerifyHostname: verify,
 		}
 		if hostOverride != "" {
 			b.HostOverride = hostOverride
@@ -322,9 +571,21 @@ func addEgressBridge(protocol string, host string, port int, address string, tar
 			Address:         address,
 			SiteId:          siteId,
 			ProtocolVersion: qdr.HttpVersion2,
+			SslProfile:      sslProfile,
+			VerifyHostname:  verify,
 		})
 	case ProtocolTCP:
 		bridges.AddTcpConnector(qdr.TcpEndpoint{
+			Name:           getBridgeName(target, host),
+			Host:           host,
+			Port:           strconv.Itoa(port),
+			Address:        address,
+			SiteId:         siteId,
+			SslProfile:     sslProfile,
+			VerifyHostname: verify,
+		})
+	case ProtocolUDP:
+		bridges.AddUdpConnector(qdr.UdpEndpoint{
 			Name:    getBridgeName(target, host),
 			Host:    host,
 			Port:    strconv.Itoa(port),
@@ -338,34 +599,62 @@ func addEgressBridge(protocol string, host string, port int, address string, tar
 }
 
 func addIngressBridge(sb *ServiceBindings, siteId string, bridges *qdr.BridgeConfig) (bool, error) {
+	local := sb.isLocal()
+	ok, err := addIngressListener(sb, sb.address, sb.ingressPort, local, siteId, bridges)
+	if !ok {
+		return ok, err
+	}
+	for _, p := range sb.additionalPorts {
+		addIngressListener(sb, types.GetPortAddress(sb.address, p.name), p.ingressPort, local, siteId, bridges)
+	}
+	return true, nil
+}
+
+func addIngressListener(sb *ServiceBindings, address string, ingressPort int, local bool, siteId string, bridges *qdr.BridgeConfig) (bool, error) {
+	sslProfile := getIngressSslProfile(sb.tls)
+	name := getBridgeName(address, "")
+	if local {
+		address = getSiteLocalAddress(address, siteId)
+	}
 	switch sb.protocol {
 	case ProtocolHTTP:
 		bridges.AddHttpListener(qdr.HttpEndpoint{
-			Name:         getBridgeName(sb.address, ""),
+			Name:         name,
 			Host:         "0.0.0.0",
-			Port:         strconv.Itoa(sb.ingressPort),
-			Address:      sb.address,
+			Port:         strconv.Itoa(ingressPort),
+			Address:      address,
 			SiteId:       siteId,
 			Aggregation:  sb.aggregation,
 			EventChannel: sb.eventChannel,
+			SslProfile:   sslProfile,
 		})
 	case ProtocolHTTP2:
 		bridges.AddHttpListener(qdr.HttpEndpoint{
-			Name:            getBridgeName(sb.address, ""),
+			Name:            name,
 			Host:            "0.0.0.0",
-			Port:            strconv.Itoa(sb.ingressPort),
-			Address:         sb.address,
+			Port:            strconv.Itoa(ingressPort),
+			Address:         address,
 			SiteId:          siteId,
 			Aggregation:     sb.aggregation,
 			EventChannel:    sb.eventChannel,
 			ProtocolVersion: qdr.HttpVersion2,
+			SslProfile:      sslProfile,
 		})
 	case ProtocolTCP:
 		bridges.AddTcpListener(qdr.TcpEndpoint{
-			Name:    getBridgeName(sb.address, ""),
+			Name:       name,
+			Host:       "0.0.0.0",
+			Port:       strconv.Itoa(ingressPort),
+			Address:    address,
+			SiteId:     siteId,
+			SslProfile: sslProfile,
+		})
+	case ProtocolUDP:
+		bridges.AddUdpListener(qdr.UdpEndpoint{
+			Name:    name,
 			Host:    "0.0.0.0",
-			Port:    strconv.Itoa(sb.ingressPort),
-			Address: sb.address,
+			Port:    strconv.Itoa(ingressPort),
+			Address: address,
 			SiteId:  siteId,
 		})
 	default:
@@ -374,6 +663,53 @@ func addIngressBridge(sb *ServiceBindings, siteId string, bridges *qdr.BridgeCon
 	return true, nil
 }
 
+// The prefix of the names of the addresses configured in the router
+// for services with prefer-local targets
+const ClosestAddressPrefix string = "skupper-closest-"
+
+func isClosestAddress(name string) bool {
+	return strings.HasPrefix(name, ClosestAddressPrefix)
+}
+
+func getClosestAddress(address string) qdr.Address {
+	return qdr.Address{
+		Name:         ClosestAddressPrefix + address,
+		Pattern:      address,
+		Distribution: qdr.DistributionClosest,
+	}
+}
+
+// Returns the addresses configured in the router for services with
+// prefer-local targets, keyed by name
+func requiredAddresses(services map[string]*ServiceBindings) map[string]qdr.Address {
+	addresses := map[string]qdr.Address{}
+	for _, service := range services {
+		if service.headless != nil || !service.isClosest() {
+			continue
+		}
+		closest := getClosestAddress(service.address)
+		addresses[closest.Name] = closest
+		for _, p := range service.additionalPorts {
+			closest = getClosestAddress(types.GetPortAddress(service.address, p.name))
+			addresses[closest.Name] = closest
+		}
+	}
+	return addresses
+}
+
+// Replaces the addresses for services in the router config with those
+// required
+func updateServiceAddresses(config *qdr.RouterConfig, required map[string]qdr.Address) {
+	for key, address := range config.Addresses {
+		if isClosestAddress(address.Name) {
+			config.RemoveAddress(key)
+		}
+	}
+	for _, address := range required {
+		config.AddAddress(address)
+	}
+}
+
 func requiredBridges(services map[string]*ServiceBindings, siteId string) *qdr.BridgeConfig {
 	//TODO: headless services not yet handled
 	//TODO: update for multicast when merged
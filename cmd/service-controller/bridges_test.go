@@ -0,0 +1,211 @@
+package main
+
+import (
+	"sort"
+	"testing"
+
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/qdr"
+)
+
+func addTestServiceTarget(sb *ServiceBindings, name string, weight int, preference string) {
+	sb.addServiceTarget(name, name, 8080, nil)
+	sb.targets[name].setPolicy(types.ServiceInterface{}, types.ServiceInterfaceTarget{Name: name, Service: name, Weight: weight, SitePreference: preference})
+}
+
+func getConnectorAddresses(bridges *qdr.BridgeConfig) []string {
+	connectors := []string{}
+	for name, c := range bridges.TcpConnectors {
+		connectors = append(connectors, name+" "+c.Address)
+	}
+	sort.Strings(connectors)
+	return connectors
+}
+
+func TestTargetWeight(t *testing.T) {
+	sb := newServiceBindings("", "tcp", "db", 5432, nil, 1024, "", false, nil)
+	addTestServiceTarget(sb, "primary", 3, "")
+	addTestServiceTarget(sb, "canary", 0, "")
+	bridges := newBridgeConfiguration()
+	sb.updateBridgeConfiguration("site-a", bridges)
+
+	assert.Equal(t, bridges.TcpListeners["db"].Address, "db")
+	assert.DeepEqual(t, getConnectorAddresses(bridges), []string{
+		"canary@canary db",
+		"primary#2@primary db",
+		"primary#3@primary db",
+		"primary@primary db",
+	})
+}
+
+func TestTargetWeightConnectorCount(t *testing.T) {
+	sb := newServiceBindings("", "tcp", "db", 5432, nil, 1024, "", false, nil)
+	addTestServiceTarget(sb, "primary", types.MaxTargetWeight, "")
+	sb.targets["primary"].additionalPorts = map[string]int{"admin": 9001}
+	bridges := newBridgeConfiguration()
+	sb.updateBridgeConfiguration("site-a", bridges)
+
+	// one connector per unit of weight for each port of the endpoint
+	assert.Equal(t, len(bridges.TcpConnectors), 2*types.MaxTargetWeight)
+
+	// a local-only target in the same site doubles that, as the
+	// target is also registered with the address for the site
+	addTestServiceTarget(sb, "private", 0, types.SitePreferenceLocalOnly)
+	bridges = newBridgeConfiguration()
+	sb.updateBridgeConfiguration("site-a", bridges)
+	assert.Equal(t, len(bridges.TcpConnectors), 4*types.MaxTargetWeight+1)
+}
+
+func TestTargetSitePreference(t *testing.T) {
+	sb := newServiceBindings("", "tcp", "db", 5432, nil, 1024, "", false, nil)
+	addTestServiceTarget(sb, "preferred", 0, types.SitePreferencePreferLocal)
+	addTestServiceTarget(sb, "shared", 0, "")
+	addTestServiceTarget(sb, "backup", 0, types.SitePreferenceFailoverOnly)
+	bridges := newBridgeConfiguration()
+	sb.updateBridgeConfiguration("site-a", bridges)
+
+	// prefer-local targets are chosen by the router, so the listener
+	// keeps the service address
+	assert.Equal(t, bridges.TcpListeners["db"].Address, "db")
+	assert.DeepEqual(t, getConnectorAddresses(bridges), []string{
+		"preferred@preferred db",
+		"shared@shared db",
+	})
+	assert.DeepEqual(t, requiredAddresses(map[string]*ServiceBindings{"db": sb}), map[string]qdr.Address{
+		"skupper-closest-db": qdr.Address{Name: "skupper-closest-db", Pattern: "db", Distribution: qdr.DistributionClosest},
+	})
+
+	// local-only targets are registered only with the address for the
+	// site, which is used by the listener whether or not they have
+	// endpoints available
+	addTestServiceTarget(sb, "private", 0, types.SitePreferenceLocalOnly)
+	bridges = newBridgeConfiguration()
+	sb.updateBridgeConfiguration("site-a", bridges)
+
+	assert.Equal(t, bridges.TcpListeners["db"].Address, "db@site-a")
+	assert.DeepEqual(t, getConnectorAddresses(bridges), []string{
+		"preferred/local@preferred db@site-a",
+		"preferred@preferred db",
+		"private/local@private db@site-a",
+		"shared/local@shared db@site-a",
+		"shared@shared db",
+	})
+
+	// without any primary targets the failover target is used, and
+	// without any prefer-local targets no address is required
+	sb.removeServiceTarget("preferred")
+	sb.removeServiceTarget("shared")
+	sb.removeServiceTarget("private")
+	bridges = newBridgeConfiguration()
+	sb.updateBridgeConfiguration("site-a", bridges)
+
+	assert.Equal(t, bridges.TcpListeners["db"].Address, "db")
+	assert.DeepEqual(t, getConnectorAddresses(bridges), []string{
+		"backup@backup db",
+	})
+	assert.Equal(t, len(requiredAddresses(map[string]*ServiceBindings{"db": sb})), 0)
+}
+
+func TestUpdateServiceAddresses(t *testing.T) {
+	config := qdr.InitialConfig("foo", "bar", false)
+	config.AddAddress(qdr.Address{Prefix: "mc", Distribution: qdr.DistributionMulticast})
+	config.AddAddress(getClosestAddress("web"))
+	updateServiceAddresses(&config, map[string]qdr.Address{"skupper-closest-db": getClosestAddress("db")})
+	keys := []string{}
+	for key := range config.Addresses {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	assert.DeepEqual(t, keys, []string{"db", "mc"})
+}
+
+func getListenerPorts(bridges *qdr.BridgeConfig) []string {
+	listeners := []string{}
+	for name, l := range bridges.TcpListeners {
+		listeners = append(listeners, name+" "+l.Address+" "+l.Port)
+	}
+	sort.Strings(listeners)
+	return listeners
+}
+
+func TestAdditionalPorts(t *testing.T) {
+	service := types.ServiceInterface{
+		Address:  "db",
+		Protocol: "tcp",
+		Port:     5432,
+		Ports: []types.ServiceInterfacePort{
+			{Name: "sql", Port: 5432},
+			{Name: "admin", Port: 9000},
+			{Name: "metrics", Port: 9090},
+		},
+	}
+	target := types.ServiceInterfaceTarget{
+		Name:        "primary",
+		Service:     "primary",
+		TargetPorts: map[string]int{"admin": 9001},
+	}
+	ports := newFreePorts()
+	sb := newServiceBindings("", "tcp", "db", 5432, nil, 1024, "", false, nil)
+	ports.inuse(1024)
+	ports.inuse(1030)
+	assert.Assert(t, sb.updateAdditionalPorts(service, ports, map[string]int{"db:metrics": 1030}))
+	sb.addServiceTarget("primary", "primary", 5432, nil)
+	sb.targets["primary"].setPolicy(service, target)
+	bridges := newBridgeConfiguration()
+	sb.updateBridgeConfiguration("site-a", bridges)
+
+	assert.Equal(t, sb.portName, "sql")
+	assert.DeepEqual(t, getListenerPorts(bridges), []string{
+		"db db 1024",
+		"db:admin db:admin 1025",
+		"db:metrics db:metrics 1030",
+	})
+	assert.DeepEqual(t, getConnectorAddresses(bridges), []string{
+		"primary:admin@primary db:admin",
+		"primary:metrics@primary db:metrics",
+		"primary@primary db",
+	})
+	assert.Equal(t, bridges.TcpConnectors["primary:admin@primary"].Port, "9001")
+	assert.Equal(t, bridges.TcpConnectors["primary:metrics@primary"].Port, "9090")
+	assert.DeepEqual(t, asServiceInterface(sb).Ports, service.Ports)
+	servicePorts := sb.getServicePorts()
+	assert.Equal(t, len(servicePorts), 3)
+	assert.Equal(t, servicePorts[0].Name, "sql")
+	assert.Equal(t, servicePorts[1].TargetPort.IntValue(), 1025)
+
+	// removing a port releases its ingress port for reuse
+	service.Ports = service.Ports[:2]
+	assert.Assert(t, sb.updateAdditionalPorts(service, ports, nil))
+	assert.Equal(t, len(sb.additionalPorts), 1)
+	assert.Assert(t, ports.inuse(1030))
+}
+
+func TestUdpBridges(t *testing.T) {
+	sb := newServiceBindings("", "udp", "dns", 53, nil, 1024, "", false, nil)
+	addTestServiceTarget(sb, "resolver", 0, "")
+	bridges := newBridgeConfiguration()
+	sb.updateBridgeConfiguration("site-a", bridges)
+
+	assert.Equal(t, len(bridges.TcpListeners), 0)
+	assert.Equal(t, len(bridges.TcpConnectors), 0)
+	assert.DeepEqual(t, bridges.UdpListeners["dns"], qdr.UdpEndpoint{
+		Name:    "dns",
+		Host:    "0.0.0.0",
+		Port:    "1024",
+		Address: "dns",
+		SiteId:  "site-a",
+	})
+	assert.DeepEqual(t, bridges.UdpConnectors["resolver@resolver"], qdr.UdpEndpoint{
+		Name:    "resolver@resolver",
+		Host:    "resolver",
+		Port:    "8080",
+		Address: "dns",
+		SiteId:  "site-a",
+	})
+	servicePorts := sb.getServicePorts()
+	assert.Equal(t, servicePorts[0].Protocol, corev1.ProtocolUDP)
+	assert.DeepEqual(t, newFreePorts().getPortAllocations(bridges), map[string]int{"dns": 1024})
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"math"
@@ -16,12 +17,48 @@ import (
 	"github.com/skupperproject/skupper/pkg/qdr"
 )
 
-// Syncs the live router config with the configmap (currently only
-// bridge configuration needs to be synced in this way)
+// Syncs the live router config with the configmap. The bridges, the
+// sslProfiles for service tls, the addresses for services with
+// prefer-local targets and the links to other sites are synced in this
+// way, so that services can be exposed and sites linked or unlinked
+// without restarting the router.
+//
+// The certificates for a new link reach the router through a projected
+// volume, which the kubelet may take a minute or more to update, and
+// the router cannot create the link's sslProfile until they are
+// present. Links that cannot yet be synced do not hold up the rest of
+// the config, and are retried with a backoff of their own.
 type ConfigSync struct {
 	informer  cache.SharedIndexInformer
 	events    workqueue.RateLimitingInterface
 	agentPool *qdr.AgentPool
+	linkRetry time.Duration
+}
+
+const (
+	minLinkRetry = 10 * time.Second
+	maxLinkRetry = 5 * time.Minute
+)
+
+// Returns the delay before links that could not be synced are next
+// retried, given the previous delay
+func nextLinkRetry(previous time.Duration) time.Duration {
+	if previous < minLinkRetry {
+		return minLinkRetry
+	}
+	if next := previous * 2; next < maxLinkRetry {
+		return next
+	}
+	return maxLinkRetry
+}
+
+// Returned when all but the links of the config were synced
+type linkSyncError struct {
+	err error
+}
+
+func (e *linkSyncError) Error() string {
+	return e.err.Error()
 }
 
 func newConfigSync(configInformer cache.SharedIndexInformer, config *tls.Config) *ConfigSync {
@@ -77,18 +114,29 @@ func (c *ConfigSync) processNextEvent() bool {
 				if !ok {
 					return fmt.Errorf("Expected ConfigMap for %s but got %#v", key, obj)
 				}
-				bridges, err := qdr.GetBridgeConfigFromConfigMap(configmap)
+				config, err := qdr.GetRouterConfigFromConfigMap(configmap)
 				if err != nil {
-					return fmt.Errorf("Error parsing bridge configuration from %s: %s", key, err)
+					return fmt.Errorf("Error parsing router configuration from %s: %s", key, err)
 				}
-				err = c.syncConfig(bridges)
-				if err != nil {
+				if config == nil {
+					return fmt.Errorf("Router config not defined in %s", key)
+				}
+				err = c.syncConfig(config)
+				var linkErr *linkSyncError
+				if errors.As(err, &linkErr) {
+					c.linkRetry = nextLinkRetry(c.linkRetry)
+					log.Printf("[config_sync] Links not yet synced, retrying in %s: %s", c.linkRetry, err)
+					c.events.Forget(obj)
+					c.events.AddAfter(obj, c.linkRetry)
+					return nil
+				} else if err != nil {
 					log.Printf("[config_sync] Sync failed")
 					return err
 				}
 			}
 		}
 		log.Printf("[config_sync] Sync suceeded")
+		c.linkRetry = 0
 		c.events.Forget(obj)
 		return nil
 	}(obj)
@@ -107,8 +155,8 @@ func (c *ConfigSync) processNextEvent() bool {
 	return true
 }
 
-func syncConfig(agent *qdr.Agent, desired *qdr.BridgeConfig) (bool, error) {
-	actual, err := agent.GetLocalBridgeConfig()
+func syncConfig(agent *qdr.Agent, address string, desired *qdr.BridgeConfig) (bool, error) {
+	actual, err := agent.GetBridgeConfigFor(address)
 	if err != nil {
 		return false, fmt.Errorf("Error retrieving bridges: %s", err)
 	}
@@ -117,29 +165,128 @@ func syncConfig(agent *qdr.Agent, desired *qdr.BridgeConfig) (bool, error) {
 		return true, nil
 	} else {
 		differences.Print()
-		if err = agent.UpdateLocalBridgeConfig(differences); err != nil {
+		if err = agent.UpdateBridgeConfigFor(address, differences); err != nil {
 			return false, fmt.Errorf("Error syncing bridges: %s", err)
 		}
 		return false, nil
 	}
 }
 
-func (c *ConfigSync) syncConfig(desired *qdr.BridgeConfig) error {
+func syncLinks(agent *qdr.Agent, address string, desired *qdr.LinkConfig) (bool, error) {
+	actual, err := agent.GetLinkConfigFor(address)
+	if err != nil {
+		return false, fmt.Errorf("Error retrieving links: %s", err)
+	}
+	differences := actual.Difference(desired)
+	if differences.Empty() {
+		return true, nil
+	} else {
+		differences.Print()
+		if err = agent.UpdateLinkConfigFor(address, differences); err != nil {
+			return false, fmt.Errorf("Error syncing links: %s", err)
+		}
+		return false, nil
+	}
+}
+
+// Returns the addresses for services in the addresses given, keyed by
+// name
+func getServiceAddresses(addresses map[string]qdr.Address) map[string]qdr.Address {
+	result := map[string]qdr.Address{}
+	for _, address := range addresses {
+		if isClosestAddress(address.Name) {
+			result[address.Name] = address
+		}
+	}
+	return result
+}
+
+// Syncs the router config of every router in the site, as each
+// replica of a replicated router has its own. The sslProfiles for
+// service tls and the addresses for services are added before the
+// bridges that use them, and removed only once those bridges have been.
+func (c *ConfigSync) syncConfig(config *qdr.RouterConfig) error {
+	links := config.GetLinkConfig()
+	profiles := getServiceTlsSslProfiles(config.SslProfiles)
+	serviceAddresses := getServiceAddresses(config.Addresses)
 	agent, err := c.agentPool.Get()
 	if err != nil {
 		return fmt.Errorf("Could not get management agent : %s", err)
 	}
-	var synced bool
-	for i := 0; i < 3 && err == nil && !synced; i++ {
-		synced, err = syncConfig(agent, desired)
-	}
-	c.agentPool.Put(agent)
+	defer c.agentPool.Put(agent)
+	addresses, err := agent.GetLocalSiteAgents()
 	if err != nil {
-		return fmt.Errorf("Error while syncing bridge config : %s", err)
+		return fmt.Errorf("Could not determine routers of site : %s", err)
+	}
+	var linkErr *linkSyncError
+	for _, address := range addresses {
+		actual, err := agent.GetSslProfilesFor(address)
+		if err != nil {
+			return fmt.Errorf("Error retrieving ssl profiles: %s", err)
+		}
+		profileChanges := qdr.GetSslProfileDifference(getServiceTlsSslProfiles(actual), profiles)
+		changed := profileChanges.Changed()
+		replaced := []string{}
+		unused := []string{}
+		for _, name := range profileChanges.Deleted {
+			if changed[name] {
+				replaced = append(replaced, name)
+			} else {
+				unused = append(unused, name)
+			}
+		}
+		if !profileChanges.Empty() {
+			profileChanges.Print()
+		}
+		if err := agent.DeleteSslProfilesFor(address, replaced); err != nil {
+			return err
+		}
+		if err := agent.AddSslProfilesFor(address, profileChanges.Added); err != nil {
+			return err
+		}
+		actualAddresses, err := agent.GetAddressesFor(address)
+		if err != nil {
+			return fmt.Errorf("Error retrieving addresses: %s", err)
+		}
+		addressChanges := qdr.GetAddressDifference(getServiceAddresses(actualAddresses), serviceAddresses)
+		if !addressChanges.Empty() {
+			addressChanges.Print()
+		}
+		if err := agent.DeleteAddressesFor(address, addressChanges.Deleted); err != nil {
+			return err
+		}
+		if err := agent.AddAddressesFor(address, addressChanges.Added); err != nil {
+			return err
+		}
+
+		var synced bool
+		for i := 0; i < 3 && err == nil && !synced; i++ {
+			synced, err = syncLinks(agent, address, &links)
+		}
+		if err != nil {
+			linkErr = &linkSyncError{fmt.Errorf("Error while syncing link config : %s", err)}
+		} else if !synced {
+			linkErr = &linkSyncError{fmt.Errorf("Failed to sync link config")}
+		}
+		err = nil
+		synced = false
+		for i := 0; i < 3 && err == nil && !synced; i++ {
+			synced, err = syncConfig(agent, address, &config.Bridges)
+		}
+		if err != nil {
+			return fmt.Errorf("Error while syncing bridge config : %s", err)
+		}
+		if !synced {
+			return fmt.Errorf("Failed to sync bridge config")
+		}
+
+		if err := agent.DeleteSslProfilesFor(address, unused); err != nil {
+			return err
+		}
 	}
-	if !synced {
-		return fmt.Errorf("Failed to sync bridge config")
+	if linkErr != nil {
+		return linkErr
 	}
-	log.Println("Bridge config synced")
+	log.Println("Bridge, ssl profile, address and link config synced")
 	return nil
 }
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextLinkRetry(t *testing.T) {
+	expected := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second, 160 * time.Second, 5 * time.Minute, 5 * time.Minute}
+	retry := time.Duration(0)
+	for i, e := range expected {
+		retry = nextLinkRetry(retry)
+		if retry != e {
+			t.Errorf("Expected retry %d to be after %s, got %s", i, e, retry)
+		}
+	}
+}
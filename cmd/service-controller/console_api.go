@@ -0,0 +1,480 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/client"
+	"github.com/skupperproject/skupper/pkg/kube"
+)
+
+const consoleApiPrefix = "/api/v1/"
+
+// Requests other than GET must set this header, which a browser will
+// only send from a page of the console's own origin, so that another
+// site cannot make them with the credentials the browser has cached
+const consoleApiRequestHeader = "X-Requested-With"
+
+// ConsoleApi is the REST API through which the site can be managed
+// without access to the cluster, backed by the VanClient of the
+// controller. Any console user may view the site, but only operators
+// may change it.
+type ConsoleApi struct {
+	vanClient *client.VanClient
+}
+
+func newConsoleApi(cli *client.VanClient) *ConsoleApi {
+	return &ConsoleApi{
+		vanClient: cli,
+	}
+}
+
+func writeJson(w http.ResponseWriter, status int, obj interface{}) {
+	bytes, err := json.MarshalIndent(obj, "", "    ")
+	if err != nil {
+		log.Printf("Error writing json: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(bytes, '\n'))
+}
+
+func readJson(r *http.Request, obj interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(obj); err != nil {
+		return fmt.Errorf("Invalid request body: %s", err)
+	}
+	return nil
+}
+
+var statusReasons = map[int]metav1.StatusReason{
+	http.StatusBadRequest:           metav1.StatusReasonBadRequest,
+	http.StatusUnauthorized:         metav1.StatusReasonUnauthorized,
+	http.StatusForbidden:            metav1.StatusReasonForbidden,
+	http.StatusNotFound:             metav1.StatusReasonNotFound,
+	http.StatusMethodNotAllowed:     metav1.StatusReasonMethodNotAllowed,
+	http.StatusUnsupportedMediaType: metav1.StatusReasonUnsupportedMediaType,
+	http.StatusConflict:             metav1.StatusReasonAlreadyExists,
+	http.StatusInternalServerError:  metav1.StatusReasonInternalError,
+}
+
+// Errors are returned as Kubernetes Status objects. Those from the
+// Kubernetes API keep their code and reason, others are given the code
+// supplied.
+func getErrorStatus(err error, code int) metav1.Status {
+	var apiStatus apierrors.APIStatus
+	if errors.As(err, &apiStatus) {
+		status := apiStatus.Status()
+		status.TypeMeta = metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}
+		return status
+	}
+	return metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Message:  err.Error(),
+		Reason:   statusReasons[code],
+		Code:     int32(code),
+	}
+}
+
+func writeError(w http.ResponseWriter, err error, code int) {
+	status := getErrorStatus(err, code)
+	writeJson(w, int(status.Code), status)
+}
+
+func isOperator(w http.ResponseWriter, r *http.Request) bool {
+	user := getConsoleUser(r)
+	if user.Role != types.ConsoleRoleOperator {
+		log.Printf("Console user %q with role %s denied %s %s", user.Name, user.Role, r.Method, r.URL.Path)
+		writeError(w, fmt.Errorf("The %s role is required", types.ConsoleRoleOperator), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// Refuses requests other than GET that a page of another origin could
+// have made, i.e. those from another origin or without the custom
+// request header, and those whose body is not json
+func isSameOrigin(w http.ResponseWriter, r *http.Request) bool {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			log.Printf("Refused %s %s from origin %s", r.Method, r.URL.Path, origin)
+			writeError(w, fmt.Errorf("Requests from origin %s are not allowed", origin), http.StatusForbidden)
+			return false
+		}
+	}
+	if r.Header.Get(consoleApiRequestHeader) == "" {
+		writeError(w, fmt.Errorf("The %s header is required", consoleApiRequestHeader), http.StatusForbidden)
+		return false
+	}
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+			writeError(w, fmt.Errorf("The request body must be application/json"), http.StatusUnsupportedMediaType)
+			return false
+		}
+	}
+	return true
+}
+
+type consoleOperations map[string]http.HandlerFunc
+
+// Returns the handler for each method supported on the given path, or
+// nil if there is no such path
+func (api *ConsoleApi) route(path []string) consoleOperations {
+	switch {
+	case len(path) == 1 && path[0] == "openapi.yaml":
+		return consoleOperations{http.MethodGet: serveOpenApi}
+	case len(path) == 1 && path[0] == "user":
+		return consoleOperations{
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+				writeJson(w, http.StatusOK, getConsoleUser(r))
+			},
+		}
+	case len(path) == 1 && path[0] == "site":
+		return consoleOperations{http.MethodGet: api.getSite}
+	case len(path) == 1 && path[0] == "services":
+		return consoleOperations{
+			http.MethodGet:  api.listServices,
+			http.MethodPost: api.createService,
+		}
+	case len(path) == 2 && path[0] == "services":
+		address := path[1]
+		return consoleOperations{
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+				if service := api.getService(r.Context(), w, address); service != nil {
+					writeJson(w, http.StatusOK, service)
+				}
+			},
+			http.MethodPut: func(w http.ResponseWriter, r *http.Request) {
+				api.updateService(w, r, address)
+			},
+			http.MethodDelete: func(w http.ResponseWriter, r *http.Request) {
+				api.removeService(w, r, address)
+			},
+		}
+	case len(path) == 3 && path[0] == "services" && path[2] == "targets":
+		return consoleOperations{
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request) {
+				api.bindTarget(w, r, path[1])
+			},
+		}
+	case len(path) == 5 && path[0] == "services" && path[2] == "targets":
+		return consoleOperations{
+			http.MethodDelete: func(w http.ResponseWriter, r *http.Request) {
+				api.unbindTarget(w, r, path[1], path[3], path[4])
+			},
+		}
+	case len(path) == 1 && path[0] == "connectors":
+		return consoleOperations{http.MethodGet: api.listConnectors}
+	case len(path) == 2 && path[0] == "connectors":
+		name := path[1]
+		return consoleOperations{
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+				api.inspectConnector(w, r, name)
+			},
+			http.MethodPut: func(w http.ResponseWriter, r *http.Request) {
+				api.updateConnector(w, r, name)
+			},
+			http.MethodDelete: func(w http.ResponseWriter, r *http.Request) {
+				api.removeConnector(w, r, name)
+			},
+		}
+	case len(path) == 1 && path[0] == "tokens":
+		return consoleOperations{http.MethodPost: api.createToken}
+	case len(path) == 2 && path[0] == "tokens":
+		return consoleOperations{
+			http.MethodDelete: func(w http.ResponseWriter, r *http.Request) {
+				api.revokeToken(w, r, path[1])
+			},
+		}
+	}
+	return nil
+}
+
+func (api *ConsoleApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, consoleApiPrefix), "/"), "/")
+	operations := api.route(path)
+	if operations == nil {
+		writeError(w, fmt.Errorf("No such resource %s", r.URL.Path), http.StatusNotFound)
+		return
+	}
+	handler, ok := operations[r.Method]
+	if !ok {
+		methods := []string{}
+		for method := range operations {
+			methods = append(methods, method)
+		}
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeError(w, fmt.Errorf("Method %s not allowed for %s", r.Method, r.URL.Path), http.StatusMethodNotAllowed)
+		return
+	}
+	// anything other than a read requires the operator role
+	if r.Method != http.MethodGet && (!isSameOrigin(w, r) || !isOperator(w, r)) {
+		return
+	}
+	handler(w, r)
+}
+
+func (api *ConsoleApi) getSite(w http.ResponseWriter, r *http.Request) {
+	site, err := api.vanClient.RouterInspect(r.Context())
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJson(w, http.StatusOK, site)
+}
+
+func (api *ConsoleApi) listServices(w http.ResponseWriter, r *http.Request) {
+	services, err := api.vanClient.ServiceInterfaceList(r.Context())
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJson(w, http.StatusOK, services)
+}
+
+func (api *ConsoleApi) getService(ctx context.Context, w http.ResponseWriter, address string) *types.ServiceInterface {
+	service, err := api.vanClient.ServiceInterfaceInspect(ctx, address)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return nil
+	}
+	if service == nil {
+		writeError(w, fmt.Errorf("Service %s not defined", address), http.StatusNotFound)
+		return nil
+	}
+	return service
+}
+
+func (api *ConsoleApi) createService(w http.ResponseWriter, r *http.Request) {
+	service := types.ServiceInterface{}
+	if err := readJson(r, &service); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	if current, err := api.vanClient.ServiceInterfaceInspect(r.Context(), service.Address); err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	} else if current != nil {
+		writeError(w, fmt.Errorf("Service %s already defined", service.Address), http.StatusConflict)
+		return
+	}
+	if err := api.vanClient.ServiceInterfaceCreate(r.Context(), &service); err != nil {
+		log.Printf("Console user %q failed to create service %s: %s", getConsoleUser(r).Name, service.Address, err)
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	log.Printf("Console user %q created service %s", getConsoleUser(r).Name, service.Address)
+	writeJson(w, http.StatusCreated, service)
+}
+
+func (api *ConsoleApi) updateService(w http.ResponseWriter, r *http.Request, address string) {
+	service := types.ServiceInterface{}
+	if err := readJson(r, &service); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	if service.Address != address {
+		writeError(w, fmt.Errorf("Service address %s does not match %s", service.Address, address), http.StatusBadRequest)
+		return
+	}
+	if api.getService(r.Context(), w, address) == nil {
+		return
+	}
+	if err := api.vanClient.ServiceInterfaceUpdate(r.Context(), &service); err != nil {
+		log.Printf("Console user %q failed to update service %s: %s", getConsoleUser(r).Name, address, err)
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	log.Printf("Console user %q updated service %s", getConsoleUser(r).Name, address)
+	writeJson(w, http.StatusOK, service)
+}
+
+func (api *ConsoleApi) removeService(w http.ResponseWriter, r *http.Request, address string) {
+	if api.getService(r.Context(), w, address) == nil {
+		return
+	}
+	if err := api.vanClient.ServiceInterfaceRemove(r.Context(), address); err != nil {
+		log.Printf("Console user %q failed to remove service %s: %s", getConsoleUser(r).Name, address, err)
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Console user %q removed service %s", getConsoleUser(r).Name, address)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *ConsoleApi) bindTarget(w http.ResponseWriter, r *http.Request, address string) {
+	target := types.ServiceTargetRequest{}
+	if err := readJson(r, &target); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	service := target.Service
+	if service == nil {
+		if service = api.getService(r.Context(), w, address); service == nil {
+			return
+		}
+	} else if service.Address != address {
+		writeError(w, fmt.Errorf("Service address %s does not match %s", service.Address, address), http.StatusBadRequest)
+		return
+	}
+	options := types.ServiceInterfaceBindOptions{
+		Weight:         target.Weight,
+		SitePreference: target.SitePreference,
+	}
+	if err := api.vanClient.ServiceInterfaceBindWithOptions(r.Context(), service, target.Type, target.Name, target.Protocol, target.Port, options); err != nil {
+		log.Printf("Console user %q failed to expose %s %s as %s: %s", getConsoleUser(r).Name, target.Type, target.Name, address, err)
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	log.Printf("Console user %q exposed %s %s as %s", getConsoleUser(r).Name, target.Type, target.Name, address)
+	writeJson(w, http.StatusOK, service)
+}
+
+func (api *ConsoleApi) unbindTarget(w http.ResponseWriter, r *http.Request, address string, targetType string, targetName string) {
+	if api.getService(r.Context(), w, address) == nil {
+		return
+	}
+	deleteIfNoTargets := r.URL.Query().Get("deleteIfNoTargets") == "true"
+	if err := api.vanClient.ServiceInterfaceUnbind(r.Context(), targetType, targetName, address, deleteIfNoTargets); err != nil {
+		log.Printf("Console user %q failed to unexpose %s %s from %s: %s", getConsoleUser(r).Name, targetType, targetName, address, err)
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	log.Printf("Console user %q unexposed %s %s from %s", getConsoleUser(r).Name, targetType, targetName, address)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *ConsoleApi) listConnectors(w http.ResponseWriter, r *http.Request) {
+	connectors, err := api.vanClient.ConnectorList(r.Context())
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJson(w, http.StatusOK, connectors)
+}
+
+func (api *ConsoleApi) inspectConnector(w http.ResponseWriter, r *http.Request, name string) {
+	connector, err := api.vanClient.ConnectorInspect(r.Context(), name)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	writeJson(w, http.StatusOK, connector)
+}
+
+func (api *ConsoleApi) updateConnector(w http.ResponseWriter, r *http.Request, name string) {
+	request := types.ConnectorUpdateRequest{}
+	if err := readJson(r, &request); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	updated, err := api.vanClient.ConnectorUpdate(r.Context(), types.ConnectorUpdateOptions{
+		Name:             name,
+		SkupperNamespace: api.vanClient.Namespace,
+		Cost:             request.Cost,
+		LinkCapacity:     request.LinkCapacity,
+	})
+	if err != nil {
+		log.Printf("Console user %q failed to update connection %s: %s", getConsoleUser(r).Name, name, err)
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	if updated {
+		log.Printf("Console user %q updated connection %s", getConsoleUser(r).Name, name)
+	}
+	writeJson(w, http.StatusOK, types.ConnectorUpdateResponse{Updated: updated})
+}
+
+func (api *ConsoleApi) removeConnector(w http.ResponseWriter, r *http.Request, name string) {
+	// the token is looked up first, as the removal of its connector
+	// does not fail if there is no such connector
+	if _, err := api.vanClient.KubeClient.CoreV1().Secrets(api.vanClient.Namespace).Get(name, metav1.GetOptions{}); err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	err := api.vanClient.ConnectorRemove(r.Context(), types.ConnectorRemoveOptions{
+		Name:             name,
+		SkupperNamespace: api.vanClient.Namespace,
+	})
+	if err != nil {
+		log.Printf("Console user %q failed to remove connection %s: %s", getConsoleUser(r).Name, name, err)
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Console user %q removed connection %s", getConsoleUser(r).Name, name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// The token is returned with the secret to be applied in the site that
+// is to connect, as written by skupper connection-token
+func (api *ConsoleApi) createToken(w http.ResponseWriter, r *http.Request) {
+	request := types.TokenRequest{}
+	if err := readJson(r, &request); err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	options := types.ConnectorTokenCreateOptions{
+		Name: request.Name,
+		Uses: request.Uses,
+	}
+	if request.Expiry != "" {
+		expiry, err := time.ParseDuration(request.Expiry)
+		if err != nil {
+			writeError(w, fmt.Errorf("Invalid token expiry: %s", err), http.StatusBadRequest)
+			return
+		}
+		options.Expiry = expiry
+	}
+	subject := request.Subject
+	if subject == "" {
+		subject = types.DefaultVanName
+	}
+	secret, localOnly, err := api.vanClient.ConnectorTokenCreateWithOptions(r.Context(), subject, "", options)
+	if err != nil {
+		log.Printf("Console user %q failed to create token: %s", getConsoleUser(r).Name, err)
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	log.Printf("Console user %q created token %s", getConsoleUser(r).Name, secret.ObjectMeta.Annotations[types.TokenName])
+	secret.TypeMeta.Kind = "Secret"
+	secret.TypeMeta.APIVersion = "v1"
+	writeJson(w, http.StatusCreated, types.TokenResponse{
+		Token:     secret,
+		LocalOnly: localOnly,
+	})
+}
+
+func (api *ConsoleApi) revokeToken(w http.ResponseWriter, r *http.Request, name string) {
+	_, tokens, err := kube.GetIssuedTokens(api.vanClient.Namespace, api.vanClient.KubeClient)
+	if err != nil {
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if _, ok := tokens[name]; !ok {
+		writeError(w, fmt.Errorf("No token named %s has been issued", name), http.StatusNotFound)
+		return
+	}
+	if err := api.vanClient.ConnectorTokenRevoke(r.Context(), name); err != nil {
+		log.Printf("Console user %q failed to revoke token %s: %s", getConsoleUser(r).Name, name, err)
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	log.Printf("Console user %q revoked token %s", getConsoleUser(r).Name, name)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/client"
+)
+
+func TestGetConsoleRole(t *testing.T) {
+	operators := []string{"rubble", "admins"}
+	if role := getConsoleRole(operators, "rubble"); role != types.ConsoleRoleOperator {
+		t.Errorf("Expected rubble to be an operator, got %s", role)
+	}
+	if role := getConsoleRole(operators, "users", "admins"); role != types.ConsoleRoleOperator {
+		t.Errorf("Expected member of admins to be an operator, got %s", role)
+	}
+	if role := getConsoleRole(operators, "fred"); role != types.ConsoleRoleViewer {
+		t.Errorf("Expected fred to be a viewer, got %s", role)
+	}
+	if role := getConsoleRole(nil); role != types.ConsoleRoleViewer {
+		t.Errorf("Expected no names to be a viewer, got %s", role)
+	}
+}
+
+func TestConsoleApi(t *testing.T) {
+	const NS = "test"
+	api := newConsoleApi(&client.VanClient{
+		Namespace: NS,
+		KubeClient: fake.NewSimpleClientset(&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      types.TransportDeploymentName,
+				Namespace: NS,
+			},
+		}),
+	})
+	users := map[string]string{
+		"rubble": "barney",
+		"flint":  "fred",
+	}
+	handler := basicAuthenticated(func(user string, password string) bool {
+		return users[user] != "" && users[user] == password
+	}, []string{"rubble"})(api)
+
+	type test struct {
+		name   string
+		user   string
+		method string
+		path   string
+		body   string
+		status int
+		result string
+	}
+	tests := []test{
+		{"unauthenticated", "", http.MethodGet, "/api/v1/user", "", http.StatusUnauthorized, ""},
+		{"viewer user", "flint", http.MethodGet, "/api/v1/user", "", http.StatusOK, `"role": "viewer"`},
+		{"operator user", "rubble", http.MethodGet, "/api/v1/user", "", http.StatusOK, `"role": "operator"`},
+		{"viewer create", "flint", http.MethodPost, "/api/v1/services", `{"address": "tcp-go-echo", "protocol": "tcp", "port": 9090}`, http.StatusForbidden, ""},
+		{"operator create", "rubble", http.MethodPost, "/api/v1/services", `{"address": "tcp-go-echo", "protocol": "tcp", "port": 9090}`, http.StatusCreated, `"address": "tcp-go-echo"`},
+		{"operator create again", "rubble", http.MethodPost, "/api/v1/services", `{"address": "tcp-go-echo", "protocol": "tcp", "port": 9090}`, http.StatusConflict, "Service tcp-go-echo already defined"},
+		{"operator create invalid", "rubble", http.MethodPost, "/api/v1/services", `{"address": "sctp-echo", "protocol": "sctp", "port": 9090}`, http.StatusBadRequest, ""},
+		{"operator create malformed", "rubble", http.MethodPost, "/api/v1/services", `{"address": `, http.StatusBadRequest, "Invalid request body"},
+		{"viewer list", "flint", http.MethodGet, "/api/v1/services", "", http.StatusOK, `"address": "tcp-go-echo"`},
+		{"viewer get", "flint", http.MethodGet, "/api/v1/services/tcp-go-echo", "", http.StatusOK, `"port": 9090`},
+		{"viewer get undefined", "flint", http.MethodGet, "/api/v1/services/other", "", http.StatusNotFound, `"reason": "NotFound"`},
+		{"viewer update", "flint", http.MethodPut, "/api/v1/services/tcp-go-echo", `{"address": "tcp-go-echo", "protocol": "tcp", "port": 8080}`, http.StatusForbidden, `"reason": "Forbidden"`},
+		{"operator update", "rubble", http.MethodPut, "/api/v1/services/tcp-go-echo", `{"address": "tcp-go-echo", "protocol": "tcp", "port": 8080}`, http.StatusOK, `"port": 8080`},
+		{"operator update mismatched", "rubble", http.MethodPut, "/api/v1/services/tcp-go-echo", `{"address": "other", "protocol": "tcp", "port": 8080}`, http.StatusBadRequest, "does not match"},
+		{"wrong method", "rubble", http.MethodPatch, "/api/v1/services/tcp-go-echo", "", http.StatusMethodNotAllowed, `"reason": "MethodNotAllowed"`},
+		{"unknown path", "rubble", http.MethodGet, "/api/v1/sites", "", http.StatusNotFound, ""},
+		{"viewer list connectors without router config", "flint", http.MethodGet, "/api/v1/connectors", "", http.StatusNotFound, `configmaps \"skupper-internal\" not found`},
+		{"operator remove undefined connector", "rubble", http.MethodDelete, "/api/v1/connectors/conn1", "", http.StatusNotFound, `"reason": "NotFound"`},
+		{"viewer revoke token", "flint", http.MethodDelete, "/api/v1/tokens/token1", "", http.StatusForbidden, ""},
+		{"operator revoke undefined token", "rubble", http.MethodDelete, "/api/v1/tokens/token1", "", http.StatusNotFound, "No token named token1 has been issued"},
+		{"viewer openapi", "flint", http.MethodGet, "/api/v1/openapi.yaml", "", http.StatusOK, "openapi: 3.0.3"},
+		{"viewer remove", "flint", http.MethodDelete, "/api/v1/services/tcp-go-echo", "", http.StatusForbidden, ""},
+		{"viewer expose", "flint", http.MethodPost, "/api/v1/services/tcp-go-echo/targets", `{"type": "deployment", "name": "tcp-go-echo"}`, http.StatusForbidden, ""},
+		{"viewer unexpose", "flint", http.MethodDelete, "/api/v1/services/tcp-go-echo/targets/deployment/tcp-go-echo", "", http.StatusForbidden, ""},
+		{"viewer token", "flint", http.MethodPost, "/api/v1/tokens", `{}`, http.StatusForbidden, ""},
+		{"operator token invalid expiry", "rubble", http.MethodPost, "/api/v1/tokens", `{"expiry": "soon"}`, http.StatusBadRequest, "Invalid token expiry"},
+		{"operator expose undefined", "rubble", http.MethodPost, "/api/v1/services/other/targets", `{"type": "deployment", "name": "other"}`, http.StatusNotFound, "Service other not defined"},
+		{"operator remove", "rubble", http.MethodDelete, "/api/v1/services/tcp-go-echo", "", http.StatusNoContent, ""},
+		{"operator remove undefined", "rubble", http.MethodDelete, "/api/v1/services/tcp-go-echo", "", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			if test.user != "" {
+				r.SetBasicAuth(test.user, users[test.user])
+			}
+			r.Header.Set("X-Requested-With", "test")
+			if test.body != "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != test.status {
+				t.Errorf("Expected status %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+			if test.result != "" && !strings.Contains(w.Body.String(), test.result) {
+				t.Errorf("Expected response to contain %q, got %s", test.result, w.Body.String())
+			}
+		})
+	}
+
+	// changes that a page of another origin could make are refused
+	body := `{"address": "tcp-go-echo", "protocol": "tcp", "port": 9090}`
+	for headers, status := range map[[3]string]int{
+		{"application/json", "", ""}:                                 http.StatusForbidden,
+		{"application/json", "test", "https://attacker.example.com"}: http.StatusForbidden,
+		{"text/plain", "test", ""}:                                   http.StatusUnsupportedMediaType,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/services", strings.NewReader(body))
+		r.SetBasicAuth("rubble", users["rubble"])
+		r.Header.Set("Content-Type", headers[0])
+		r.Header.Set("X-Requested-With", headers[1])
+		r.Header.Set("Origin", headers[2])
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != status {
+			t.Errorf("Expected status %d for request with headers %v, got %d: %s", status, headers, w.Code, w.Body.String())
+		}
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/services", strings.NewReader(body))
+	r.SetBasicAuth("rubble", users["rubble"])
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	r.Header.Set("X-Requested-With", "test")
+	r.Header.Set("Origin", "https://"+r.Host)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected request from the same origin to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/user", nil)
+	w = httptest.NewRecorder()
+	unsecured(api).ServeHTTP(w, r)
+	user := consoleUser{}
+	if err := json.Unmarshal(w.Body.Bytes(), &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != types.ConsoleRoleViewer || user.Name != "" {
+		t.Errorf("Expected anonymous viewer when unsecured, got %v", user)
+	}
+}
+
+// Every path the API serves should be described by its OpenAPI spec,
+// and every operation described should be served
+func TestConsoleOpenApi(t *testing.T) {
+	spec := struct {
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}{}
+	if err := yaml.Unmarshal([]byte(consoleOpenApi), &spec); err != nil {
+		t.Fatalf("Invalid OpenAPI spec: %s", err)
+	}
+	api := newConsoleApi(nil)
+	described := 0
+	for path, item := range spec.Paths {
+		segments := strings.Split(strings.Trim(path, "/"), "/")
+		for i, segment := range segments {
+			if strings.HasPrefix(segment, "{") {
+				segments[i] = "x"
+			}
+		}
+		operations := api.route(segments)
+		if operations == nil {
+			t.Errorf("Path %s is not served", path)
+			continue
+		}
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			described++
+			if _, ok := operations[strings.ToUpper(method)]; !ok {
+				t.Errorf("Operation %s %s is not served", method, path)
+			}
+		}
+	}
+	served := 0
+	for _, path := range [][]string{{"user"}, {"site"}, {"services"}, {"services", "x"}, {"services", "x", "targets"}, {"services", "x", "targets", "x", "x"}, {"connectors"}, {"connectors", "x"}, {"tokens"}, {"tokens", "x"}} {
+		served += len(api.route(path))
+	}
+	if served != described {
+		t.Errorf("Expected %d operations to be described, got %d", served, described)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/skupperproject/skupper/api/types"
+)
+
+// A consoleAuth wraps the handlers of the console server so that only
+// authenticated requests reach them
+type consoleAuth func(h http.Handler) http.Handler
+
+// The user an authenticated request was made by, which is recorded in
+// the context of the request
+type consoleUser struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type consoleUserKey struct{}
+
+func withConsoleUser(r *http.Request, user consoleUser) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), consoleUserKey{}, user))
+}
+
+// Requests not authenticated by the console server itself, as in the
+// unsecured and openshift modes, are made by an anonymous viewer
+func getConsoleUser(r *http.Request) consoleUser {
+	if user, ok := r.Context().Value(consoleUserKey{}).(consoleUser); ok {
+		return user
+	}
+	return consoleUser{Role: types.ConsoleRoleViewer}
+}
+
+// Returns the operator role if any of the given user or group names is
+// one of the operators
+func getConsoleRole(operators []string, names ...string) string {
+	for _, name := range names {
+		if containsString(operators, name) {
+			return types.ConsoleRoleOperator
+		}
+	}
+	return types.ConsoleRoleViewer
+}
+
+func splitList(list string) []string {
+	result := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func unsecured(h http.Handler) http.Handler {
+	return h
+}
+
+// The authentication mode is determined by the environment the
+// controller was deployed with
+func newConsoleAuth() (consoleAuth, error) {
+	operators := splitList(os.Getenv("METRICS_OPERATORS"))
+	if dir := os.Getenv("METRICS_USERS"); dir != "" {
+		return basicAuthenticated(func(user string, password string) bool {
+			return authenticate(dir, user, password)
+		}, operators), nil
+	} else if file := os.Getenv("METRICS_HTPASSWD"); file != "" {
+		return basicAuthenticated(func(user string, password string) bool {
+			return authenticateHtpasswd(file, user, password)
+		}, operators), nil
+	} else if issuer := os.Getenv("METRICS_OIDC_ISSUER"); issuer != "" {
+		oidc, err := newOidcAuthenticator(issuer, os.Getenv("METRICS_OIDC_CREDENTIALS"), os.Getenv("METRICS_OIDC_GROUPS"), operators)
+		if err != nil {
+			return nil, err
+		}
+		return oidc.authenticated, nil
+	}
+	return unsecured, nil
+}
+
+func basicAuthenticated(check func(user string, password string) bool, operators []string) consoleAuth {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, password, _ := r.BasicAuth()
+
+			if check(user, password) {
+				h.ServeHTTP(w, withConsoleUser(r, consoleUser{Name: user, Role: getConsoleRole(operators, user)}))
+			} else {
+				w.Header().Set("WWW-Authenticate", "Basic realm=skupper")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+// Comparing digests of equal length in constant time avoids revealing
+// anything about the expected password through the time taken
+func equalPasswords(expected []byte, actual []byte) bool {
+	a := sha256.Sum256(expected)
+	b := sha256.Sum256(actual)
+	return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+}
+
+// The internal mode reads the password for each user from a file named
+// for that user in the given directory
+// Each user is a file in the directory the users secret is mounted
+// in, so a name is only valid if it cannot refer to a file elsewhere,
+// nor to one of the entries the kubelet adds, which begin with '.'
+func isValidUserName(user string) bool {
+	return user != "" && !strings.ContainsAny(user, `/\`) && !strings.HasPrefix(user, ".")
+}
+
+func authenticate(dir string, user string, password string) bool {
+	if !isValidUserName(user) {
+		log.Printf("Failed to authenticate %q, invalid user name", user)
+		return false
+	}
+	filename := path.Join(dir, user)
+	file, err := os.Open(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to authenticate %s, no such user exists", user)
+		} else {
+			log.Printf("Failed to authenticate %s: %s", user, err)
+		}
+		return false
+	}
+	defer file.Close()
+
+	bytes, err := ioutil.ReadAll(file)
+	if err != nil {
+		log.Printf("Failed to authenticate %s: %s", user, err)
+		return false
+	}
+	return equalPasswords(bytes, []byte(password))
+}
+
+// Returns the hash held for the user in an htpasswd file, of which only
+// the bcrypt format is supported
+func getHtpasswdHash(data []byte, user string) ([]byte, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || parts[0] != user {
+			continue
+		}
+		if !strings.HasPrefix(parts[1], "$2a$") && !strings.HasPrefix(parts[1], "$2b$") && !strings.HasPrefix(parts[1], "$2y$") {
+			return nil, fmt.Errorf("only bcrypt hashes are supported")
+		}
+		return []byte(parts[1]), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no such user exists")
+}
+
+func authenticateHtpasswd(file string, user string, password string) bool {
+	// the file is read for each request, so that changes to the
+	// secret it is mounted from take effect without a restart
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Printf("Failed to authenticate %s: %s", user, err)
+		return false
+	}
+	hash, err := getHtpasswdHash(data, user)
+	if err != nil {
+		log.Printf("Failed to authenticate %s, %s", user, err)
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+func TestEqualPasswords(t *testing.T) {
+	if !equalPasswords([]byte("secret"), []byte("secret")) {
+		t.Errorf("Expected equal passwords to match")
+	}
+	if equalPasswords([]byte("secret"), []byte("secrets")) {
+		t.Errorf("Expected different passwords not to match")
+	}
+	if equalPasswords([]byte("secret"), []byte("")) {
+		t.Errorf("Expected empty password not to match")
+	}
+}
+
+func TestAuthenticateHtpasswd(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("barney"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "htpasswd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "htpasswd")
+	data := "# console users\nfred:{SHA}WuTQzhUX2A8z4cE4Rmu3mEzplDI=\nrubble:" + string(hash) + "\n"
+	if err = ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := getHtpasswdHash([]byte(data), "fred"); err == nil || err.Error() != "only bcrypt hashes are supported" {
+		t.Errorf("Expected unsupported hash error, got %v", err)
+	}
+	if _, err := getHtpasswdHash([]byte(data), "wilma"); err == nil || err.Error() != "no such user exists" {
+		t.Errorf("Expected no such user error, got %v", err)
+	}
+	if !authenticateHtpasswd(file, "rubble", "barney") {
+		t.Errorf("Expected rubble to be authenticated")
+	}
+	if authenticateHtpasswd(file, "rubble", "fred") {
+		t.Errorf("Expected rubble not to be authenticated with wrong password")
+	}
+	if authenticateHtpasswd(file, "fred", "fred") {
+		t.Errorf("Expected fred not to be authenticated with unsupported hash")
+	}
+	if authenticateHtpasswd(path.Join(dir, "missing"), "rubble", "barney") {
+		t.Errorf("Expected authentication to fail without htpasswd file")
+	}
+}
+
+func TestOidcSignedValues(t *testing.T) {
+	a := &oidcAuthenticator{signingKey: []byte("0123456789abcdef0123456789abcdef")}
+	signed, err := a.sign(oidcSession{User: "rubble", Expiry: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := oidcSession{}
+	if err = a.verify(signed, &session); err != nil {
+		t.Errorf("Failed to verify signed value: %s", err)
+	} else if session.User != "rubble" || session.Expiry != 100 {
+		t.Errorf("Unexpected session %v", session)
+	}
+	tampered, _ := a.sign(oidcSession{User: "fred", Expiry: 100})
+	tampered = strings.Split(tampered, ".")[0] + "." + strings.Split(signed, ".")[1]
+	if err = a.verify(tampered, &session); err == nil {
+		t.Errorf("Expected tampered value to be rejected")
+	}
+	other := &oidcAuthenticator{signingKey: []byte("fedcba9876543210fedcba9876543210")}
+	if err = other.verify(signed, &session); err == nil {
+		t.Errorf("Expected value signed with another key to be rejected")
+	}
+}
+
+// A minimal OIDC provider, serving its discovery document and the key
+// that signs its id tokens
+type testOidcProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+}
+
+func newTestOidcProvider(t *testing.T) *testOidcProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testOidcProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/auth",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "key1", Algorithm: "RS256", Use: "sig"}},
+		})
+	})
+	p.server = httptest.NewServer(mux)
+	return p
+}
+
+func signIdToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, (&jose.SignerOptions{}).WithHeader("kid", "key1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := signed.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestOidcVerifyIdToken(t *testing.T) {
+	provider := newTestOidcProvider(t)
+	defer provider.server.Close()
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &oidcAuthenticator{
+		issuer:   provider.server.URL,
+		clientId: "skupper",
+		groups:   []string{"admins"},
+		client:   provider.server.Client(),
+	}
+	now := time.Now()
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":                provider.server.URL,
+			"sub":                "1234",
+			"aud":                []string{"other", "skupper"},
+			"exp":                now.Add(time.Minute).Unix(),
+			"nonce":              "abc",
+			"preferred_username": "rubble",
+			"groups":             []string{"users", "admins"},
+		}
+		for k, v := range changes {
+			c[k] = v
+		}
+		return c
+	}
+	ctx := context.Background()
+
+	result, err := a.verifyIdToken(ctx, signIdToken(t, provider.key, claims(nil)), "abc")
+	if err != nil {
+		t.Errorf("Expected valid id token, got %s", err)
+	} else {
+		if result.getUser() != "rubble" {
+			t.Errorf("Expected user rubble, got %s", result.getUser())
+		}
+		if !a.isAllowed(result) {
+			t.Errorf("Expected member of admins to be allowed")
+		}
+	}
+	result, err = a.verifyIdToken(ctx, signIdToken(t, provider.key, claims(map[string]interface{}{"aud": "skupper", "groups": []string{"users"}})), "")
+	if err != nil {
+		t.Errorf("Expected valid id token with single audience, got %s", err)
+	} else if a.isAllowed(result) {
+		t.Errorf("Expected user outside allowed groups to be denied")
+	}
+
+	invalid := []struct {
+		doc   string
+		token string
+		nonce string
+	}{
+		{"wrong issuer", signIdToken(t, provider.key, claims(map[string]interface{}{"iss": "https://other.example.com"})), ""},
+		{"wrong audience", signIdToken(t, provider.key, claims(map[string]interface{}{"aud": "other"})), ""},
+		{"expired", signIdToken(t, provider.key, claims(map[string]interface{}{"exp": now.Add(-time.Minute).Unix()})), ""},
+		{"wrong nonce", signIdToken(t, provider.key, claims(nil)), "xyz"},
+		{"wrong key", signIdToken(t, other, claims(nil)), ""},
+		{"malformed", "abc.def", ""},
+	}
+	for _, c := range invalid {
+		if _, err := a.verifyIdToken(ctx, c.token, c.nonce); err == nil {
+			t.Errorf("%s: expected id token to be rejected", c.doc)
+		}
+	}
+}
+
+func TestOidcLoginState(t *testing.T) {
+	provider := newTestOidcProvider(t)
+	defer provider.server.Close()
+	a := &oidcAuthenticator{
+		issuer:     provider.server.URL,
+		clientId:   "skupper",
+		signingKey: []byte("0123456789abcdef0123456789abcdef"),
+		client:     provider.server.Client(),
+	}
+	handler := a.authenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := httptest.NewRequest(http.MethodGet, "/site", nil)
+	request.Header.Set("Accept", "text/html")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusFound {
+		t.Fatalf("Expected redirect to provider, got %d", response.Code)
+	}
+	location, err := url.Parse(response.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := location.Query().Get("state")
+	if state == "" || location.Query().Get("nonce") == "" {
+		t.Errorf("Expected state and nonce in redirect to provider, got %s", location)
+	}
+	var cookie *http.Cookie
+	for _, c := range response.Result().Cookies() {
+		if c.Name == oidcStateCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatalf("Expected login state cookie to be set")
+	}
+	if cookie.Value != state || !cookie.HttpOnly || cookie.Path != oidcCallbackPath {
+		t.Errorf("Unexpected login state cookie %v", cookie)
+	}
+
+	callback := oidcCallbackPath + "?" + url.Values{"state": {state}, "error": {"access_denied"}}.Encode()
+	request = httptest.NewRequest(http.MethodGet, callback, nil)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected callback without login state cookie to be rejected, got %d", response.Code)
+	}
+
+	request = httptest.NewRequest(http.MethodGet, callback, nil)
+	request.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: "other"})
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Expected callback with other login state to be rejected, got %d", response.Code)
+	}
+
+	// the provider's error is reported only once the state is accepted
+	request = httptest.NewRequest(http.MethodGet, callback, nil)
+	request.AddCookie(cookie)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Expected callback with login state to be accepted, got %d", response.Code)
+	}
+}
+
+func TestIsValidUserName(t *testing.T) {
+	for _, user := range []string{"rubble", "fred.flintstone", "admin@example.com"} {
+		if !isValidUserName(user) {
+			t.Errorf("Expected %q to be valid", user)
+		}
+	}
+	for _, user := range []string{"", "..", "../secret", "a/b", "a\\b", "..data", ".hidden"} {
+		if isValidUserName(user) {
+			t.Errorf("Expected %q to be invalid", user)
+		}
+	}
+}
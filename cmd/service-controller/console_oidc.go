@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcCallbackPath  = "/oauth/callback"
+	oidcSessionCookie = "skupper-console-session"
+	oidcStateCookie   = "skupper-console-login"
+	oidcSessionPeriod = 8 * time.Hour
+	oidcLoginPeriod   = 10 * time.Minute
+)
+
+type idTokenClaims struct {
+	Subject           string   `json:"sub"`
+	PreferredUsername string   `json:"preferred_username"`
+	Email             string   `json:"email"`
+	Groups            []string `json:"groups"`
+}
+
+func (c *idTokenClaims) getUser() string {
+	if c.PreferredUsername != "" {
+		return c.PreferredUsername
+	} else if c.Email != "" {
+		return c.Email
+	}
+	return c.Subject
+}
+
+// The state passed through the provider during login, and the session
+// established on its completion, are signed by the controller rather
+// than held by it. The state is also set in a cookie, so that a login
+// can only be completed by the browser that started it.
+type oidcState struct {
+	Path   string `json:"path"`
+	Nonce  string `json:"nonce"`
+	Expiry int64  `json:"exp"`
+}
+
+type oidcSession struct {
+	User   string `json:"user"`
+	Role   string `json:"role"`
+	Expiry int64  `json:"exp"`
+}
+
+// oidcAuthenticator signs users in to the console through the
+// authorization code flow of an OpenID Connect provider, admitting
+// only members of the allowed groups if any are specified. Members of
+// the operator groups are granted the operator role. API clients may
+// instead present an id token issued by the provider as a bearer token.
+type oidcAuthenticator struct {
+	issuer       string
+	clientId     string
+	clientSecret string
+	groups       []string
+	operators    []string
+	signingKey   []byte
+	client       *http.Client
+	lock         sync.Mutex
+	provider     *oidc.Provider
+	verifier     *oidc.IDTokenVerifier
+}
+
+func readCredential(dir string, name string) (string, error) {
+	data, err := ioutil.ReadFile(path.Join(dir, name))
+	if err != nil {
+		return "", fmt.Errorf("Could not read OIDC %s: %s", name, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func randomBytes(length int) ([]byte, error) {
+	b := make([]byte, length)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func newOidcAuthenticator(issuer string, credentials string, groups string, operators []string) (*oidcAuthenticator, error) {
+	a := &oidcAuthenticator{
+		issuer:    issuer,
+		groups:    splitList(groups),
+		operators: operators,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+	var err error
+	if a.clientId, err = readCredential(credentials, "client-id"); err != nil {
+		return nil, err
+	}
+	if a.clientSecret, err = readCredential(credentials, "client-secret"); err != nil {
+		return nil, err
+	}
+	// sessions do not survive a restart of the controller
+	if a.signingKey, err = randomBytes(32); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// The provider is discovered when first needed. Its signing keys are
+// retrieved again whenever a token is signed by a key not yet known, as
+// providers rotate their keys.
+func (a *oidcAuthenticator) getProvider() (*oidc.Provider, *oidc.IDTokenVerifier, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.provider != nil {
+		return a.provider, a.verifier, nil
+	}
+	provider, err := oidc.NewProvider(oidc.ClientContext(context.Background(), a.client), a.issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not discover OIDC provider: %s", err)
+	}
+	a.provider = provider
+	a.verifier = provider.Verifier(&oidc.Config{ClientID: a.clientId})
+	return a.provider, a.verifier, nil
+}
+
+// Verifies the signature and claims of an id token, and that it was
+// issued for the login request with the nonce given, if any
+func (a *oidcAuthenticator) verifyIdToken(ctx context.Context, token string, nonce string) (*idTokenClaims, error) {
+	_, verifier, err := a.getProvider()
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := verifier.Verify(oidc.ClientContext(ctx, a.client), token)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid id token: %s", err)
+	}
+	if nonce != "" && idToken.Nonce != nonce {
+		return nil, fmt.Errorf("Id token does not match login request")
+	}
+	claims := &idTokenClaims{}
+	if err = idToken.Claims(claims); err != nil {
+		return nil, fmt.Errorf("Malformed id token claims: %s", err)
+	}
+	return claims, nil
+}
+
+func (a *oidcAuthenticator) isAllowed(claims *idTokenClaims) bool {
+	if len(a.groups) == 0 {
+		return true
+	}
+	for _, group := range claims.Groups {
+		if containsString(a.groups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *oidcAuthenticator) getUser(claims *idTokenClaims) consoleUser {
+	return consoleUser{
+		Name: claims.getUser(),
+		Role: getConsoleRole(a.operators, claims.Groups...),
+	}
+}
+
+func (a *oidcAuthenticator) sign(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, a.signingKey)
+	mac.Write(data)
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (a *oidcAuthenticator) verify(signed string, value interface{}) error {
+	parts := strings.Split(signed, ".")
+	if len(parts) != 2 {
+		return fmt.Errorf("Malformed signed value")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, a.signingKey)
+	mac.Write(data)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return fmt.Errorf("Invalid signature")
+	}
+	return json.Unmarshal(data, value)
+}
+
+func (a *oidcAuthenticator) getSession(r *http.Request, now time.Time) *oidcSession {
+	cookie, err := r.Cookie(oidcSessionCookie)
+	if err != nil {
+		return nil
+	}
+	session := &oidcSession{}
+	if err = a.verify(cookie.Value, session); err != nil || now.Unix() >= session.Expiry {
+		return nil
+	}
+	return session
+}
+
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+func (a *oidcAuthenticator) getOauth2Config(provider *oidc.Provider, r *http.Request) *oauth2.Config {
+	scheme := "http"
+	if isSecureRequest(r) {
+		scheme = "https"
+	}
+	scopes := []string{"openid", "profile", "email"}
+	if len(a.groups) > 0 {
+		scopes = append(scopes, "groups")
+	}
+	return &oauth2.Config{
+		ClientID:     a.clientId,
+		ClientSecret: a.clientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  scheme + "://" + r.Host + oidcCallbackPath,
+		Scopes:       scopes,
+	}
+}
+
+func (a *oidcAuthenticator) login(w http.ResponseWriter, r *http.Request) {
+	provider, _, err := a.getProvider()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Authentication provider unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	nonce, err := randomBytes(16)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	state, err := a.sign(oidcState{
+		Path:   r.URL.RequestURI(),
+		Nonce:  base64.RawURLEncoding.EncodeToString(nonce),
+		Expiry: time.Now().Add(oidcLoginPeriod).Unix(),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     oidcCallbackPath,
+		MaxAge:   int(oidcLoginPeriod.Seconds()),
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	url := a.getOauth2Config(provider, r).AuthCodeURL(state, oidc.Nonce(base64.RawURLEncoding.EncodeToString(nonce)))
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// Returns true if the state returned by the provider is that set in
+// the cookie by the login request
+func isLoginState(r *http.Request, state string) bool {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) == 1
+}
+
+func (a *oidcAuthenticator) callback(w http.ResponseWriter, r *http.Request) {
+	state := oidcState{}
+	signed := r.URL.Query().Get("state")
+	if !isLoginState(r, signed) {
+		http.Error(w, "Login request not started by this browser", http.StatusBadRequest)
+		return
+	}
+	// the state is only used once
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     oidcCallbackPath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+	})
+	if err := a.verify(signed, &state); err != nil || time.Now().Unix() >= state.Expiry {
+		http.Error(w, "Invalid or expired login request", http.StatusBadRequest)
+		return
+	}
+	if reason := r.URL.Query().Get("error"); reason != "" {
+		http.Error(w, "Login failed: "+reason, http.StatusUnauthorized)
+		return
+	}
+	provider, _, err := a.getProvider()
+	if err != nil {
+		log.Println(err)
+		http.Error(w, "Authentication provider unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	ctx := oidc.ClientContext(r.Context(), a.client)
+	token, err := a.getOauth2Config(provider, r).Exchange(ctx, r.URL.Query().Get("code"))
+	if err != nil {
+		log.Printf("Failed to complete OIDC login: %s", err)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+	idToken, _ := token.Extra("id_token").(string)
+	claims, err := a.verifyIdToken(r.Context(), idToken, state.Nonce)
+	if err != nil {
+		log.Printf("Failed to complete OIDC login: %s", err)
+		http.Error(w, "Login failed", http.StatusUnauthorized)
+		return
+	}
+	if !a.isAllowed(claims) {
+		log.Printf("Console access denied to %s, not a member of an allowed group", claims.getUser())
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	user := a.getUser(claims)
+	session, err := a.sign(oidcSession{
+		User:   user.Name,
+		Role:   user.Role,
+		Expiry: time.Now().Add(oidcSessionPeriod).Unix(),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcSessionCookie,
+		Value:    session,
+		Path:     "/",
+		MaxAge:   int(oidcSessionPeriod.Seconds()),
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	target := state.Path
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") {
+		target = "/"
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func (a *oidcAuthenticator) authenticated(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == oidcCallbackPath {
+			a.callback(w, r)
+			return
+		}
+		if session := a.getSession(r, time.Now()); session != nil {
+			h.ServeHTTP(w, withConsoleUser(r, consoleUser{Name: session.User, Role: session.Role}))
+			return
+		}
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			claims, err := a.verifyIdToken(r.Context(), strings.TrimPrefix(auth, "Bearer "), "")
+			if err != nil {
+				log.Printf("Failed to authenticate bearer token: %s", err)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			} else if !a.isAllowed(claims) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+			} else {
+				h.ServeHTTP(w, withConsoleUser(r, a.getUser(claims)))
+			}
+			return
+		}
+		// only browsers are redirected to sign in
+		if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			a.login(w, r)
+			return
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
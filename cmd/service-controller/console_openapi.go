@@ -0,0 +1,521 @@
+package main
+
+import (
+	"net/http"
+)
+
+// The OpenAPI description of the REST API served by ConsoleApi
+const consoleOpenApi = `openapi: 3.0.3
+info:
+  title: Skupper site API
+  description: >-
+    Manages the services, connections and tokens of a Skupper site. Any
+    console user may use the GET operations; all others require the
+    operator role and the X-Requested-With header, take application/json
+    bodies and are refused from other origins. Errors are returned as
+    Kubernetes Status objects.
+  version: v1
+servers:
+- url: /api/v1
+security:
+- basic: []
+- bearer: []
+paths:
+  /user:
+    get:
+      summary: Returns the name and role of the current user
+      operationId: getUser
+      responses:
+        "200":
+          description: The current user
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/User'
+        default:
+          $ref: '#/components/responses/Error'
+  /site:
+    get:
+      summary: Returns the status of the site
+      operationId: getSite
+      responses:
+        "200":
+          description: The status of the site
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Site'
+        default:
+          $ref: '#/components/responses/Error'
+  /services:
+    get:
+      summary: Lists the services defined in the site
+      operationId: listServices
+      responses:
+        "200":
+          description: The services
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: '#/components/schemas/Service'
+        default:
+          $ref: '#/components/responses/Error'
+    post:
+      summary: Creates a service
+      operationId: createService
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Service'
+      responses:
+        "201":
+          description: The service was created
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Service'
+        default:
+          $ref: '#/components/responses/Error'
+  /services/{address}:
+    parameters:
+    - $ref: '#/components/parameters/Address'
+    get:
+      summary: Returns a service
+      operationId: getService
+      responses:
+        "200":
+          description: The service
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Service'
+        default:
+          $ref: '#/components/responses/Error'
+    put:
+      summary: Replaces the definition of a service
+      operationId: updateService
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Service'
+      responses:
+        "200":
+          description: The service was updated
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Service'
+        default:
+          $ref: '#/components/responses/Error'
+    delete:
+      summary: Removes a service
+      operationId: removeService
+      responses:
+        "204":
+          description: The service was removed
+        default:
+          $ref: '#/components/responses/Error'
+  /services/{address}/targets:
+    parameters:
+    - $ref: '#/components/parameters/Address'
+    post:
+      summary: Exposes a deployment, statefulset, pods or service through a service
+      operationId: bindTarget
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/TargetRequest'
+      responses:
+        "200":
+          description: The target was exposed
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Service'
+        default:
+          $ref: '#/components/responses/Error'
+  /services/{address}/targets/{type}/{name}:
+    parameters:
+    - $ref: '#/components/parameters/Address'
+    - name: type
+      in: path
+      required: true
+      schema:
+        type: string
+        enum:
+        - deployment
+        - statefulset
+        - pods
+        - service
+    - name: name
+      in: path
+      required: true
+      schema:
+        type: string
+    - name: deleteIfNoTargets
+      in: query
+      description: Removes the service if it has no other targets
+      schema:
+        type: boolean
+    delete:
+      summary: Unexposes a target of a service
+      operationId: unbindTarget
+      responses:
+        "204":
+          description: The target was unexposed
+        default:
+          $ref: '#/components/responses/Error'
+  /connectors:
+    get:
+      summary: Lists the connections made from the site to other sites
+      operationId: listConnectors
+      responses:
+        "200":
+          description: The connections
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: '#/components/schemas/Connector'
+        default:
+          $ref: '#/components/responses/Error'
+  /connectors/{name}:
+    parameters:
+    - name: name
+      in: path
+      required: true
+      schema:
+        type: string
+    get:
+      summary: Returns a connection and whether it is connected
+      operationId: inspectConnector
+      responses:
+        "200":
+          description: The connection
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/ConnectorStatus'
+        default:
+          $ref: '#/components/responses/Error'
+    put:
+      summary: >-
+        Changes the cost or link capacity of a connection. Its connector
+        is deleted and created again, so the link it made drops and is
+        re-established; the site's other links are unaffected
+      operationId: updateConnector
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/ConnectorUpdate'
+      responses:
+        "200":
+          description: Whether the connection was changed
+          content:
+            application/json:
+              schema:
+                type: object
+                properties:
+                  updated:
+                    type: boolean
+        default:
+          $ref: '#/components/responses/Error'
+    delete:
+      summary: Removes a connection
+      operationId: removeConnector
+      responses:
+        "204":
+          description: The connection was removed
+        default:
+          $ref: '#/components/responses/Error'
+  /tokens:
+    post:
+      summary: Creates a token with which another site may connect to this one
+      operationId: createToken
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/TokenRequest'
+      responses:
+        "201":
+          description: >-
+            The token was created, as a secret to apply in the site that
+            is to connect
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Token'
+        default:
+          $ref: '#/components/responses/Error'
+  /tokens/{name}:
+    parameters:
+    - name: name
+      in: path
+      required: true
+      schema:
+        type: string
+    delete:
+      summary: Revokes a token, closing any connections made with it
+      operationId: revokeToken
+      responses:
+        "204":
+          description: The token was revoked
+        default:
+          $ref: '#/components/responses/Error'
+components:
+  securitySchemes:
+    basic:
+      type: http
+      scheme: basic
+    bearer:
+      type: http
+      scheme: bearer
+      description: An id token issued by the OpenID Connect provider of the console
+  parameters:
+    Address:
+      name: address
+      in: path
+      required: true
+      schema:
+        type: string
+  responses:
+    Error:
+      description: The operation failed
+      content:
+        application/json:
+          schema:
+            $ref: '#/components/schemas/Status'
+  schemas:
+    User:
+      type: object
+      properties:
+        name:
+          type: string
+        role:
+          type: string
+          enum:
+          - viewer
+          - operator
+    Site:
+      type: object
+      properties:
+        status:
+          type: object
+          properties:
+            siteName:
+              type: string
+            mode:
+              type: string
+            transportReadyReplicas:
+              type: integer
+            connectedSites:
+              type: object
+              properties:
+                direct:
+                  type: integer
+                indirect:
+                  type: integer
+                total:
+                  type: integer
+            replicas:
+              type: array
+              items:
+                type: object
+                properties:
+                  name:
+                    type: string
+                  ready:
+                    type: boolean
+                  links:
+                    type: integer
+                  linkedReplicas:
+                    type: integer
+        transportVersion:
+          type: string
+        controllerVersion:
+          type: string
+        exposedServices:
+          type: integer
+        consoleUrl:
+          type: string
+        warnings:
+          type: array
+          items:
+            type: string
+    Service:
+      type: object
+      required:
+      - address
+      - protocol
+      properties:
+        address:
+          type: string
+        protocol:
+          type: string
+          enum:
+          - tcp
+          - http
+          - http2
+          - udp
+        port:
+          type: integer
+        ports:
+          type: array
+          items:
+            type: object
+            properties:
+              name:
+                type: string
+              port:
+                type: integer
+        eventchannel:
+          type: boolean
+        aggregate:
+          type: string
+        headless:
+          type: object
+          properties:
+            name:
+              type: string
+            size:
+              type: integer
+            targetPort:
+              type: integer
+        targets:
+          type: array
+          items:
+            type: object
+            properties:
+              name:
+                type: string
+              selector:
+                type: string
+              service:
+                type: string
+              targetPort:
+                type: integer
+              targetPorts:
+                type: object
+                additionalProperties:
+                  type: integer
+              weight:
+                type: integer
+              sitePreference:
+                type: string
+        origin:
+          type: string
+        tls:
+          type: object
+          properties:
+            credentials:
+              type: string
+            caCertificate:
+              type: string
+    TargetRequest:
+      type: object
+      required:
+      - type
+      - name
+      properties:
+        type:
+          type: string
+          enum:
+          - deployment
+          - statefulset
+          - pods
+          - service
+        name:
+          type: string
+        protocol:
+          type: string
+        port:
+          type: integer
+        weight:
+          type: integer
+        sitePreference:
+          type: string
+        service:
+          $ref: '#/components/schemas/Service'
+    Connector:
+      type: object
+      properties:
+        name:
+          type: string
+        role:
+          type: string
+        host:
+          type: string
+        port:
+          type: string
+        cost:
+          type: integer
+    ConnectorStatus:
+      type: object
+      properties:
+        connector:
+          $ref: '#/components/schemas/Connector'
+        connected:
+          type: boolean
+    ConnectorUpdate:
+      type: object
+      description: A value that is omitted is left as it is
+      properties:
+        cost:
+          type: integer
+          minimum: 1
+        linkCapacity:
+          type: integer
+          minimum: 1
+    TokenRequest:
+      type: object
+      properties:
+        name:
+          type: string
+        subject:
+          type: string
+        expiry:
+          type: string
+          description: A duration such as 15m or 24h
+        uses:
+          type: integer
+    Token:
+      type: object
+      properties:
+        token:
+          type: object
+          description: The token secret
+        localOnly:
+          type: boolean
+          description: Whether the token can only be used within the cluster
+    Status:
+      type: object
+      properties:
+        kind:
+          type: string
+        apiVersion:
+          type: string
+        status:
+          type: string
+        message:
+          type: string
+        reason:
+          type: string
+        code:
+          type: integer
+`
+
+func serveOpenApi(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write([]byte(consoleOpenApi))
+}
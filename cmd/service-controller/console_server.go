@@ -3,13 +3,10 @@ package main
 import (
 	"crypto/tls"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
-	"path"
 	"strings"
 
 	"github.com/skupperproject/skupper/client"
@@ -19,62 +16,29 @@ import (
 type ConsoleServer struct {
 	agentPool *qdr.AgentPool
 	iplookup  *IpLookup
+	api       *ConsoleApi
 }
 
 func newConsoleServer(cli *client.VanClient, config *tls.Config) *ConsoleServer {
 	return &ConsoleServer{
 		agentPool: qdr.NewAgentPool("amqps://skupper-messaging:5671", config),
 		iplookup:  NewIpLookup(cli),
+		api:       newConsoleApi(cli),
 	}
 }
 
-func authenticate(dir string, user string, password string) bool {
-	filename := path.Join(dir, user)
-	file, err := os.Open(filename)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			log.Printf("Failed to authenticate %s, no such user exists", user)
-		} else {
-			log.Printf("Failed to authenticate %s: %s", user, err)
-		}
-		return false
-	}
-	defer file.Close()
-
-	bytes, err := ioutil.ReadAll(file)
-	if err != nil {
-		log.Printf("Failed to authenticate %s: %s", user, err)
-		return false
-	}
-	return string(bytes) == password
-}
-
-func authenticated(h http.Handler) http.Handler {
-	dir := os.Getenv("METRICS_USERS")
-	if dir != "" {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			user, password, _ := r.BasicAuth()
-
-			if authenticate(dir, user, password) {
-				h.ServeHTTP(w, r)
-			} else {
-				w.Header().Set("WWW-Authenticate", "Basic realm=skupper")
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			}
-		})
-	} else {
-		return h
-	}
-}
-
-func (server *ConsoleServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+func (server *ConsoleServer) getConsoleData() (*ConsoleData, error) {
 	agent, err := server.agentPool.Get()
 	if err != nil {
-		log.Printf("Could not get management agent : %s", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, fmt.Errorf("Could not get management agent : %s", err)
 	}
 	data, err := getConsoleData(agent, server.iplookup)
 	server.agentPool.Put(agent)
+	return data, err
+}
+
+func (server *ConsoleServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, err := server.getConsoleData()
 	if err != nil {
 		log.Printf("Error retrieving console data: %s", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -89,6 +53,19 @@ func (server *ConsoleServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (server *ConsoleServer) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	data, err := server.getConsoleData()
+	if err != nil {
+		log.Printf("Error retrieving console data for metrics: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := getConsoleMetrics(data).write(w); err != nil {
+		log.Printf("Error writing metrics: %s", err)
+	}
+}
+
 func (server *ConsoleServer) start(stopCh <-chan struct{}) error {
 	err := server.iplookup.start(stopCh)
 	go server.listen()
@@ -103,8 +80,14 @@ func (server *ConsoleServer) listen() {
 	if os.Getenv("METRICS_HOST") != "" {
 		addr = os.Getenv("METRICS_HOST") + addr
 	}
+	authenticated, err := newConsoleAuth()
+	if err != nil {
+		log.Fatal("Error configuring console authentication: ", err)
+	}
 	log.Printf("Console server listening on %s", addr)
 	http.Handle("/DATA", authenticated(server))
+	http.Handle("/metrics", authenticated(http.HandlerFunc(server.serveMetrics)))
+	http.Handle(consoleApiPrefix, authenticated(server.api))
 	http.Handle("/", authenticated(http.FileServer(http.Dir("/app/console/"))))
 	log.Fatal(http.ListenAndServe(addr, nil))
 }
@@ -280,9 +263,30 @@ func getTargetHost(iplookup *IpLookup, host string) string {
 	}
 }
 
-func getServiceStats(bridges []qdr.BridgeConfig, sites []Site, tcpconnections [][]qdr.TcpConnection, httpRequests [][]qdr.HttpRequestInfo, iplookup *IpLookup) []interface{} {
+// Every router of a site has the same bridge configuration, so a
+// target is listed only once however many routers report it
+func addTargets(targets []ServiceTarget, added ...ServiceTarget) []ServiceTarget {
+	for _, target := range added {
+		found := false
+		for _, existing := range targets {
+			if existing == target {
+				found = true
+				break
+			}
+		}
+		if !found {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// The tcp connections and http requests are given per router, in the
+// order of routers, and are aggregated over the routers of each site
+func getServiceStats(bridges []qdr.BridgeConfig, routers []qdr.Router, tcpconnections [][]qdr.TcpConnection, httpRequests [][]qdr.HttpRequestInfo, iplookup *IpLookup) []interface{} {
 	tcpServices := TcpServiceStatsMap{}
 	httpServices := HttpServiceStatsMap{}
+	udpServices := map[string]ServiceStats{}
 	for _, b := range bridges {
 		for _, c := range b.TcpConnectors {
 			target := []ServiceTarget{
@@ -294,7 +298,7 @@ func getServiceStats(bridges []qdr.BridgeConfig, sites []Site, tcpconnections []
 			}
 			service, ok := tcpServices[c.Address]
 			if ok {
-				service.Targets = append(service.Targets, target...)
+				service.Targets = addTargets(service.Targets, target...)
 				tcpServices[c.Address] = service
 			} else {
 				service = TcpServiceStats{
@@ -328,7 +332,7 @@ func getServiceStats(bridges []qdr.BridgeConfig, sites []Site, tcpconnections []
 			}
 			service, ok := httpServices[c.Address]
 			if ok {
-				service.Targets = append(service.Targets, target...)
+				service.Targets = addTargets(service.Targets, target...)
 				httpServices[c.Address] = service
 			} else {
 				service = HttpServiceStats{
@@ -356,12 +360,48 @@ func getServiceStats(bridges []qdr.BridgeConfig, sites []Site, tcpconnections []
 			}
 
 		}
+		for _, c := range b.UdpConnectors {
+			service, ok := udpServices[c.Address]
+			if !ok {
+				service = ServiceStats{
+					Address:  c.Address,
+					Protocol: "udp",
+				}
+			}
+			service.Targets = addTargets(service.Targets, ServiceTarget{
+				Name:   getTargetHost(iplookup, c.Host),
+				Target: getTargetName(c.Name),
+				SiteId: c.SiteId,
+			})
+			udpServices[c.Address] = service
+		}
+		for _, l := range b.UdpListeners {
+			if _, ok := udpServices[l.Address]; !ok {
+				udpServices[l.Address] = ServiceStats{
+					Address:  l.Address,
+					Protocol: "udp",
+				}
+			}
+		}
 	}
-	for i, c := range tcpconnections {
-		tcpServices.updateTcpConnectionStats(sites[i].SiteId, c, iplookup)
+	siteIds := []string{}
+	tcpConnectionsBySite := map[string][]qdr.TcpConnection{}
+	httpRequestsBySite := map[string][]qdr.HttpRequestInfo{}
+	for i, r := range routers {
+		if _, ok := tcpConnectionsBySite[r.SiteId]; !ok {
+			siteIds = append(siteIds, r.SiteId)
+			tcpConnectionsBySite[r.SiteId] = []qdr.TcpConnection{}
+		}
+		if i < len(tcpconnections) {
+			tcpConnectionsBySite[r.SiteId] = append(tcpConnectionsBySite[r.SiteId], tcpconnections[i]...)
+		}
+		if i < len(httpRequests) {
+			httpRequestsBySite[r.SiteId] = append(httpRequestsBySite[r.SiteId], httpRequests[i]...)
+		}
 	}
-	for i, r := range httpRequests {
-		httpServices.updateHttpRequestStats(sites[i].SiteId, r, iplookup)
+	for _, siteId := range siteIds {
+		tcpServices.updateTcpConnectionStats(siteId, tcpConnectionsBySite[siteId], iplookup)
+		httpServices.updateHttpRequestStats(siteId, httpRequestsBySite[siteId], iplookup)
 	}
 
 	services := []interface{}{}
@@ -371,6 +411,9 @@ func getServiceStats(bridges []qdr.BridgeConfig, sites []Site, tcpconnections []
 	for _, s := range tcpServices {
 		services = append(services, s)
 	}
+	for _, s := range udpServices {
+		services = append(services, s)
+	}
 	return services
 }
 
@@ -551,6 +594,28 @@ func replace(in []string, lookup map[string]string) []string {
 	return out
 }
 
+// The routers of a site connect to each other and often to the same
+// remote sites, so each site connected to is listed only once and the
+// site itself is omitted
+func addConnectedSites(connected []string, siteId string, added []string) []string {
+	for _, id := range added {
+		if id == siteId || id == "" {
+			continue
+		}
+		found := false
+		for _, existing := range connected {
+			if existing == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			connected = append(connected, id)
+		}
+	}
+	return connected
+}
+
 func getSiteInfo(routers []qdr.Router) []Site {
 	sites := map[string]Site{}
 	lookup := map[string]string{}
@@ -562,13 +627,13 @@ func getSiteInfo(routers []qdr.Router) []Site {
 	for _, r := range routers {
 		if strings.Contains(r.Id, "skupper-router") {
 			if site, ok := sites[r.SiteId]; ok {
-				site.Connected = append(site.Connected, replace(r.ConnectedTo, lookup)...)
+				site.Connected = addConnectedSites(site.Connected, r.SiteId, replace(r.ConnectedTo, lookup))
 				sites[r.SiteId] = site
 				log.Printf("Updating site %s based on router %s ", r.SiteId, r.Id)
 			} else {
 				sites[r.SiteId] = Site{
 					SiteId:    r.SiteId,
-					Connected: replace(r.ConnectedTo, lookup),
+					Connected: addConnectedSites([]string{}, r.SiteId, replace(r.ConnectedTo, lookup)),
 					Edge:      r.Edge,
 				}
 				log.Printf("Adding site %s based on router %s ", r.SiteId, r.Id)
@@ -590,17 +655,15 @@ type ConsoleData struct {
 	Services []interface{} `json:"services"`
 }
 
+// Returns the routers of skupper sites, of which there may be several
+// per site
 func getSiteRouters(routers []qdr.Router) []qdr.Router {
-	sites := map[string]qdr.Router{}
+	list := []qdr.Router{}
 	for _, r := range routers {
 		if strings.Contains(r.Id, "skupper-router") {
-			sites[r.SiteId] = r
+			list = append(list, r)
 		}
 	}
-	list := []qdr.Router{}
-	for _, r := range sites {
-		list = append(list, r)
-	}
 	return list
 }
 
@@ -609,7 +672,6 @@ func getConsoleData(agent *qdr.Agent, iplookup *IpLookup) (*ConsoleData, error)
 	if err != nil {
 		return nil, fmt.Errorf("Error retrieving routers: %s", err)
 	}
-	//TODO: handle multiple routers per site, for now ensure we only have one router per site
 	routers = getSiteRouters(routers)
 	bridges, err := agent.GetBridges(routers)
 	if err != nil {
@@ -627,7 +689,7 @@ func getConsoleData(agent *qdr.Agent, iplookup *IpLookup) (*ConsoleData, error)
 	data := ConsoleData{
 		Sites: getSiteInfo(routers),
 	}
-	data.Services = getServiceStats(bridges, data.Sites, tcpConns, httpReqs, iplookup)
+	data.Services = getServiceStats(bridges, routers, tcpConns, httpReqs, iplookup)
 	//query each site for remaining information
 	err = getAllSiteInfo(agent, data.Sites)
 	if err != nil {
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper/pkg/qdr"
+)
+
+func TestConsoleDataWithRouterReplicas(t *testing.T) {
+	routers := getSiteRouters([]qdr.Router{
+		{Id: "skupper-router-a1", SiteId: "site-a", ConnectedTo: []string{"skupper-router-a2", "skupper-router-b"}},
+		{Id: "skupper-router-a2", SiteId: "site-a", ConnectedTo: []string{"skupper-router-a1", "skupper-router-b"}},
+		{Id: "skupper-router-b", SiteId: "site-b", ConnectedTo: []string{"skupper-router-a1"}},
+		{Id: "other", SiteId: "site-c"},
+	})
+	assert.Equal(t, len(routers), 3)
+
+	sites := map[string]Site{}
+	for _, site := range getSiteInfo(routers) {
+		sites[site.SiteId] = site
+	}
+	assert.Equal(t, len(sites), 2)
+	assert.DeepEqual(t, sites["site-a"].Connected, []string{"site-b"})
+	assert.DeepEqual(t, sites["site-b"].Connected, []string{"site-a"})
+
+	// both routers of site-a have the connector to the target, but only
+	// one of them handles a connection to it
+	bridges := []qdr.BridgeConfig{qdr.NewBridgeConfig(), qdr.NewBridgeConfig(), qdr.NewBridgeConfig()}
+	for i := 0; i < 2; i++ {
+		bridges[i].AddTcpConnector(qdr.TcpEndpoint{Name: "db@10.0.0.1", Host: "10.0.0.1", Port: "5432", Address: "db", SiteId: "site-a"})
+	}
+	bridges[2].AddTcpListener(qdr.TcpEndpoint{Name: "db:5432", Port: "5432", Address: "db", SiteId: "site-b"})
+	tcpConnections := [][]qdr.TcpConnection{
+		{},
+		{{Name: "conn1", Host: "10.0.0.1:5432", Address: "db", Direction: "out"}},
+		{{Name: "conn2", Host: "10.0.1.1:40000", Address: "db", Direction: "in"}},
+	}
+	services := getServiceStats(bridges, routers, tcpConnections, [][]qdr.HttpRequestInfo{{}, {}, {}}, &IpLookup{})
+	assert.Equal(t, len(services), 1)
+	service := services[0].(TcpServiceStats)
+	assert.DeepEqual(t, service.Targets, []ServiceTarget{{Name: "10.0.0.1", Target: "db", SiteId: "site-a"}})
+	assert.Equal(t, len(service.ConnectionsEgress), 1)
+	assert.Equal(t, service.ConnectionsEgress[0].SiteId, "site-a")
+	assert.Equal(t, len(service.ConnectionsIngress), 1)
+	assert.Equal(t, service.ConnectionsIngress[0].SiteId, "site-b")
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/skupperproject/skupper/pkg/utils"
@@ -27,6 +28,7 @@ import (
 	amqp "github.com/interconnectedcloud/go-amqp"
 
 	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/api/v1alpha1"
 	"github.com/skupperproject/skupper/client"
 	"github.com/skupperproject/skupper/pkg/kube"
 	"github.com/skupperproject/skupper/pkg/qdr"
@@ -34,11 +36,17 @@ import (
 
 type Controller struct {
 	origin            string
+	siteName          string
 	vanClient         *client.VanClient
 	bridgeDefInformer cache.SharedIndexInformer
 	svcDefInformer    cache.SharedIndexInformer
 	svcInformer       cache.SharedIndexInformer
 	headlessInformer  cache.SharedIndexInformer
+	routerInformer    cache.SharedIndexInformer
+	// only set if the ServiceInterface resource has been defined
+	serviceInterfaceInformer cache.SharedIndexInformer
+	// only set if the ServiceSyncPolicy resource has been defined
+	serviceSyncPolicyInformer cache.SharedIndexInformer
 
 	//control loop state:
 	events   workqueue.RateLimitingInterface
@@ -49,16 +57,33 @@ type Controller struct {
 	tlsConfig       *tls.Config
 	amqpClient      *amqp.Client
 	amqpSession     *amqp.Session
+	desiredServices map[string]types.ServiceInterface
+	sendLocal       chan bool
+	syncInterval    time.Duration
+	syncAgeOut      time.Duration
+	// orders the changes service sync makes to the skupper-services
+	// configmap, which are made without serviceSyncLock held
+	serviceDefinitionsLock sync.Mutex
+	// the definitions known to service sync, their versions, the
+	// names of remote sites and the definitions rejected from them,
+	// shared by the controller and the service sync sender and
+	// receiver
+	serviceSyncLock sync.Mutex
 	byOrigin        map[string]map[string]types.ServiceInterface
 	localServices   map[string]types.ServiceInterface
 	byName          map[string]types.ServiceInterface
-	desiredServices map[string]types.ServiceInterface
 	heardFrom       map[string]time.Time
+	versions        map[string]uint64
+	localVersion    uint64
+	siteNames       map[string]string
+	rejected        map[string][]string
 
 	definitionMonitor *DefinitionMonitor
 	consoleServer     *ConsoleServer
 	siteQueryServer   *SiteQueryServer
 	configSync        *ConfigSync
+	tokenMonitor      *TokenMonitor
+	routerPeers       *RouterPeers
 }
 
 func hasProxyAnnotation(service corev1.Service) bool {
@@ -95,11 +120,25 @@ func hasOriginalTargetPort(service corev1.Service) bool {
 	return hasSkupperAnnotation(service, types.OriginalTargetPortQualifier)
 }
 
+func hasOriginalTargetPorts(service corev1.Service) bool {
+	return hasSkupperAnnotation(service, types.OriginalTargetPortsQualifier)
+}
+
+// Records the target ports of all but the first port of a service in
+// the same form as a selector, i.e. name=port,name=port
+func stringifyTargetPorts(ports []corev1.ServicePort) string {
+	targetPorts := map[string]string{}
+	for _, p := range ports {
+		targetPorts[p.Name] = strconv.Itoa(p.TargetPort.IntValue())
+	}
+	return utils.StringifySelector(targetPorts)
+}
+
 func hasOriginalAssigned(service corev1.Service) bool {
 	return hasSkupperAnnotation(service, types.OriginalAssignedQualifier)
 }
 
-func NewController(cli *client.VanClient, origin string, tlsConfig *tls.Config) (*Controller, error) {
+func NewController(cli *client.VanClient, origin string, syncInterval time.Duration, syncAgeOut time.Duration, tlsConfig *tls.Config) (*Controller, error) {
 
 	// create informers
 	svcInformer := corev1informer.NewServiceInformer(
@@ -132,18 +171,31 @@ func NewController(cli *client.VanClient, origin string, tlsConfig *tls.Config)
 			options.LabelSelector = "internal.skupper.io/type=proxy"
 		}))
 
+	routerInformer := appsv1informer.NewFilteredDeploymentInformer(
+		cli.KubeClient,
+		cli.Namespace,
+		time.Second*30,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		internalinterfaces.TweakListOptionsFunc(func(options *metav1.ListOptions) {
+			options.FieldSelector = "metadata.name=" + types.TransportDeploymentName
+		}))
+
 	events := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "skupper-service-controller")
 
 	controller := &Controller{
 		vanClient:         cli,
 		origin:            origin,
+		siteName:          os.Getenv("SKUPPER_SITE_NAME"),
 		tlsConfig:         tlsConfig,
 		bridgeDefInformer: bridgeDefInformer,
 		svcDefInformer:    svcDefInformer,
 		svcInformer:       svcInformer,
 		headlessInformer:  headlessInformer,
+		routerInformer:    routerInformer,
 		events:            events,
 		ports:             newFreePorts(),
+		syncInterval:      syncInterval,
+		syncAgeOut:        syncAgeOut,
 	}
 
 	// Organize service definitions
@@ -152,17 +204,33 @@ func NewController(cli *client.VanClient, origin string, tlsConfig *tls.Config)
 	controller.byName = make(map[string]types.ServiceInterface)
 	controller.desiredServices = make(map[string]types.ServiceInterface)
 	controller.heardFrom = make(map[string]time.Time)
+	controller.versions = make(map[string]uint64)
+	controller.sendLocal = make(chan bool, 1)
+	controller.siteNames = make(map[string]string)
+	controller.rejected = make(map[string][]string)
 
 	log.Println("Setting up event handlers")
 	svcDefInformer.AddEventHandler(controller.newEventHandler("servicedefs", AnnotatedKey, ConfigMapResourceVersionTest))
 	bridgeDefInformer.AddEventHandler(controller.newEventHandler("bridges", AnnotatedKey, ConfigMapResourceVersionTest))
 	svcInformer.AddEventHandler(controller.newEventHandler("actual-services", AnnotatedKey, ServiceResourceVersionTest))
 	headlessInformer.AddEventHandler(controller.newEventHandler("statefulset", AnnotatedKey, StatefulSetResourceVersionTest))
+	if kube.IsResourceAvailable(v1alpha1.ServiceInterfaceResource, cli.KubeClient) {
+		log.Println("Watching ServiceInterface resources")
+		controller.serviceInterfaceInformer = newServiceInterfaceInformer(cli)
+		controller.serviceInterfaceInformer.AddEventHandler(controller.newEventHandler("serviceinterfaces", AnnotatedKey, UnstructuredResourceVersionTest))
+	}
+	if kube.IsResourceAvailable(v1alpha1.ServiceSyncPolicyResource, cli.KubeClient) {
+		log.Println("Watching ServiceSyncPolicy resources")
+		controller.serviceSyncPolicyInformer = newServiceSyncPolicyInformer(cli)
+		controller.serviceSyncPolicyInformer.AddEventHandler(controller.newEventHandler("servicesyncpolicies", AnnotatedKey, UnstructuredResourceVersionTest))
+	}
 	controller.consoleServer = newConsoleServer(cli, tlsConfig)
 	controller.siteQueryServer = newSiteQueryServer(tlsConfig)
 
 	controller.definitionMonitor = newDefinitionMonitor(controller.origin, controller.vanClient, controller.svcDefInformer, controller.svcInformer)
 	controller.configSync = newConfigSync(controller.bridgeDefInformer, tlsConfig)
+	controller.tokenMonitor = newTokenMonitor(cli, tlsConfig)
+	controller.routerPeers = newRouterPeers(cli, tlsConfig)
 	return controller, nil
 }
 
@@ -260,6 +328,16 @@ func (c *Controller) Run(stopCh <-chan struct{}) error {
 	go c.bridgeDefInformer.Run(stopCh)
 	go c.svcInformer.Run(stopCh)
 	go c.headlessInformer.Run(stopCh)
+	go c.routerInformer.Run(stopCh)
+	synced := []cache.InformerSynced{c.svcDefInformer.HasSynced, c.bridgeDefInformer.HasSynced, c.svcInformer.HasSynced, c.headlessInformer.HasSynced, c.routerInformer.HasSynced}
+	if c.serviceInterfaceInformer != nil {
+		go c.serviceInterfaceInformer.Run(stopCh)
+		synced = append(synced, c.serviceInterfaceInformer.HasSynced)
+	}
+	if c.serviceSyncPolicyInformer != nil {
+		go c.serviceSyncPolicyInformer.Run(stopCh)
+		synced = append(synced, c.serviceSyncPolicyInformer.HasSynced)
+	}
 
 	defer utilruntime.HandleCrash()
 	defer c.events.ShutDown()
@@ -267,11 +345,12 @@ func (c *Controller) Run(stopCh <-chan struct{}) error {
 	log.Println("Starting the Skupper controller")
 
 	log.Println("Waiting for informer caches to sync")
-	if ok := cache.WaitForCacheSync(stopCh, c.svcDefInformer.HasSynced, c.bridgeDefInformer.HasSynced, c.svcInformer.HasSynced, c.headlessInformer.HasSynced); !ok {
+	if ok := cache.WaitForCacheSync(stopCh, synced...); !ok {
 		return fmt.Errorf("Failed to wait for caches to sync")
 	}
 
 	log.Println("Starting workers")
+	c.loadServiceSyncState()
 	c.siteQueryServer.getLocalSiteInfo(c.vanClient)
 	go wait.Until(c.siteQueryServer.run, time.Second, stopCh)
 	go wait.Until(c.runServiceSync, time.Second, stopCh)
@@ -279,6 +358,8 @@ func (c *Controller) Run(stopCh <-chan struct{}) error {
 	c.definitionMonitor.start(stopCh)
 	c.consoleServer.start(stopCh)
 	c.configSync.start(stopCh)
+	c.tokenMonitor.start(stopCh)
+	c.routerPeers.start(stopCh)
 
 	log.Println("Started workers")
 	<-stopCh
@@ -291,7 +372,7 @@ func (c *Controller) Run(stopCh <-chan struct{}) error {
 
 func (c *Controller) createServiceFor(desired *ServiceBindings) error {
 	log.Println("Creating new service for ", desired.address)
-	_, err := kube.NewServiceForAddress(desired.address, desired.publicPort, desired.ingressPort, getOwnerReference(), c.vanClient.Namespace, c.vanClient.KubeClient)
+	_, err := kube.NewServiceForAddress(desired.address, desired.getServicePorts(), getOwnerReference(), c.vanClient.Namespace, c.vanClient.KubeClient)
 	if err != nil {
 		log.Printf("Error while creating service %s: %s", desired.address, err)
 	}
@@ -300,7 +381,7 @@ func (c *Controller) createServiceFor(desired *ServiceBindings) error {
 
 func (c *Controller) createHeadlessServiceFor(desired *ServiceBindings) error {
 	log.Println("Creating new headless service for ", desired.address)
-	_, err := kube.NewHeadlessServiceForAddress(desired.address, desired.publicPort, desired.ingressPort, getOwnerReference(), c.vanClient.Namespace, c.vanClient.KubeClient)
+	_, err := kube.NewHeadlessServiceForAddress(desired.address, desired.protocol, desired.publicPort, desired.ingressPort, getOwnerReference(), c.vanClient.Namespace, c.vanClient.KubeClient)
 	if err != nil {
 		log.Printf("Error while creating headless service %s: %s", desired.address, err)
 	}
@@ -324,10 +405,41 @@ func equivalentSelectors(a map[string]string, b map[string]string) bool {
 	return true
 }
 
+// An unspecified service port protocol defaults to TCP
+func equivalentProtocols(a corev1.Protocol, b corev1.Protocol) bool {
+	if a == "" {
+		a = corev1.ProtocolTCP
+	}
+	if b == "" {
+		b = corev1.ProtocolTCP
+	}
+	return a == b
+}
+
+func equivalentServicePorts(a []corev1.ServicePort, b []corev1.ServicePort) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || !equivalentProtocols(a[i].Protocol, b[i].Protocol) || a[i].Port != b[i].Port || a[i].TargetPort.IntValue() != b[i].TargetPort.IntValue() {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *Controller) checkServiceFor(desired *ServiceBindings, actual *corev1.Service) error {
 	log.Printf("Checking service changes for %s", actual.ObjectMeta.Name)
 	update := false
 	if len(actual.Spec.Ports) > 0 {
+		if desired.portName != "" && actual.Spec.Ports[0].Name != desired.portName {
+			update = true
+			actual.Spec.Ports[0].Name = desired.portName
+		}
+		if protocol := kube.GetServicePortProtocol(desired.protocol); !equivalentProtocols(actual.Spec.Ports[0].Protocol, protocol) {
+			update = true
+			actual.Spec.Ports[0].Protocol = protocol
+		}
 		if actual.Spec.Ports[0].Port != int32(desired.publicPort) {
 			update = true
 			actual.Spec.Ports[0].Port = int32(desired.publicPort)
@@ -346,6 +458,17 @@ func (c *Controller) checkServiceFor(desired *ServiceBindings, actual *corev1.Se
 			actual.ObjectMeta.Annotations[types.OriginalAssignedQualifier] = strconv.Itoa(desired.ingressPort)
 			actual.Spec.Ports[0].TargetPort = intstr.FromInt(desired.ingressPort)
 		}
+		additional := desired.getServicePorts()[1:]
+		if !equivalentServicePorts(actual.Spec.Ports[1:], additional) {
+			update = true
+			if len(actual.Spec.Ports) > 1 && !hasOriginalTargetPorts(*actual) {
+				if actual.ObjectMeta.Annotations == nil {
+					actual.ObjectMeta.Annotations = map[string]string{}
+				}
+				actual.ObjectMeta.Annotations[types.OriginalTargetPortsQualifier] = stringifyTargetPorts(actual.Spec.Ports[1:])
+			}
+			actual.Spec.Ports = append(actual.Spec.Ports[:1], additional...)
+		}
 	}
 	if desired.headless == nil && !equivalentSelectors(actual.Spec.Selector, kube.GetLabelsForRouter()) {
 		update = true
@@ -502,8 +625,16 @@ func (c *Controller) updateBridgeConfig(name string) error {
 		if !ok {
 			return fmt.Errorf("Expected ConfigMap for %s but got %#v", name, obj)
 		}
-		desiredBridges := requiredBridges(c.bindings, c.origin)
-		update, err := desiredBridges.UpdateConfigMap(cm)
+		current, err := qdr.GetRouterConfigFromConfigMap(cm)
+		if err != nil {
+			return fmt.Errorf("Error reading router config from %s: %s", cm.ObjectMeta.Name, err)
+		} else if current == nil {
+			return fmt.Errorf("Router config not defined in %s", cm.ObjectMeta.Name)
+		}
+		current.Bridges = *requiredBridges(c.bindings, c.origin)
+		updateServiceSslProfiles(current, requiredSslProfiles(c.bindings))
+		updateServiceAddresses(current, requiredAddresses(c.bindings))
+		update, err := current.UpdateConfigMap(cm)
 		if err != nil {
 			return fmt.Errorf("Error updating %s: %s", cm.ObjectMeta.Name, err)
 		}
@@ -514,8 +645,10 @@ func (c *Controller) updateBridgeConfig(name string) error {
 				return fmt.Errorf("Failed to update %s: %v", name, err.Error())
 			}
 		}
+		//the router needs access to any certificates referenced by
+		//the sslProfiles for services
+		return c.updateTlsSecretVolumes()
 	}
-	return nil
 }
 
 func (c *Controller) initialiseServiceBindingsMap() (map[string]int, error) {
@@ -656,6 +789,9 @@ func (c *Controller) processNextEvent() bool {
 				c.updateBridgeConfig(c.namespaced("skupper-internal"))
 				c.updateActualServices()
 				c.updateHeadlessProxies()
+				if err := c.reconcileServiceInterfaceResources(); err != nil {
+					return err
+				}
 			case "bridges":
 				if c.bindings == nil {
 					//not yet initialised
@@ -716,6 +852,9 @@ func (c *Controller) processNextEvent() bool {
 				log.Printf("Got targetpods event %s", name)
 				//name is the address of the skupper service
 				c.updateBridgeConfig(c.namespaced("skupper-internal"))
+				if err := c.reconcileServiceInterfaceResources(); err != nil {
+					return err
+				}
 			case "statefulset":
 				log.Printf("Got statefulset proxy event %s", name)
 				obj, exists, err := c.headlessInformer.GetStore().GetByKey(name)
@@ -755,6 +894,26 @@ func (c *Controller) processNextEvent() bool {
 					}
 
 				}
+			case "serviceinterfaces":
+				log.Printf("Got ServiceInterface event %s", name)
+				if c.bindings == nil {
+					//not yet initialised, resources are
+					//reconciled once the service definitions
+					//have been read
+					return nil
+				}
+				if err := c.reconcileServiceInterfaceResources(); err != nil {
+					return err
+				}
+			case "servicesyncpolicies":
+				log.Printf("Got ServiceSyncPolicy event %s", name)
+				if name != "rejections" {
+					// the services exported may have changed
+					c.requestServiceSyncUpdate()
+				}
+				if err := c.reconcileServiceSyncPolicies(); err != nil {
+					return err
+				}
 			default:
 				c.events.Forget(obj)
 				return fmt.Errorf("unexpected event key %s (%s, %s)", key, category, name)
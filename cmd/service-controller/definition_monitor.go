@@ -4,6 +4,7 @@ import (
 	jsonencoding "encoding/json"
 	"fmt"
 	"log"
+	"reflect"
 	"strconv"
 	"time"
 
@@ -108,6 +109,71 @@ func deducePort(deployment *appsv1.Deployment) int {
 	}
 }
 
+// Deduces the named ports of an annotated deployment from the ports of
+// its containers, if there is more than one and each is named
+func deducePorts(deployment *appsv1.Deployment) []types.ServiceInterfacePort {
+	if _, ok := deployment.ObjectMeta.Annotations[types.PortQualifier]; ok {
+		return nil
+	}
+	ports := []types.ServiceInterfacePort{}
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		for _, p := range container.Ports {
+			if p.Name == "" {
+				return nil
+			}
+			ports = append(ports, types.ServiceInterfacePort{
+				Name: p.Name,
+				Port: int(p.ContainerPort),
+			})
+		}
+	}
+	if len(ports) < 2 {
+		return nil
+	}
+	return ports
+}
+
+func deducePortsFromService(service *corev1.Service) []types.ServiceInterfacePort {
+	if len(service.Spec.Ports) < 2 {
+		return nil
+	}
+	ports := []types.ServiceInterfacePort{}
+	for _, p := range service.Spec.Ports {
+		ports = append(ports, types.ServiceInterfacePort{
+			Name: p.Name,
+			Port: int(p.Port),
+		})
+	}
+	return ports
+}
+
+// Deduces the target ports for all but the first port of an annotated
+// service, using those recorded before the service was updated to
+// point at the router where present
+func deduceTargetPortsFromService(service *corev1.Service) map[string]int {
+	if len(service.Spec.Ports) < 2 {
+		return nil
+	}
+	original := map[string]string{}
+	if hasOriginalTargetPorts(*service) {
+		original = utils.LabelToMap(service.Annotations[types.OriginalTargetPortsQualifier])
+	}
+	targetPorts := map[string]int{}
+	for _, p := range service.Spec.Ports[1:] {
+		port := p.TargetPort.IntValue()
+		if value, ok := original[p.Name]; ok {
+			port, _ = strconv.Atoi(value)
+		}
+		if port != 0 && port != int(p.Port) {
+			targetPorts[p.Name] = port
+		}
+	}
+	if len(targetPorts) == 0 {
+		return nil
+	}
+	return targetPorts
+}
+
 func deducePortFromService(service *corev1.Service) int {
 	if len(service.Spec.Ports) > 0 {
 		return int(service.Spec.Ports[0].Port)
@@ -122,11 +188,29 @@ func deduceTargetPortFromService(service *corev1.Service) int {
 	return 0
 }
 
+func setTargetPolicyFromAnnotations(target *types.ServiceInterfaceTarget, annotations map[string]string) {
+	if weight, ok := annotations[types.WeightQualifier]; ok {
+		if iweight, err := strconv.Atoi(weight); err == nil && iweight > 0 && iweight <= types.MaxTargetWeight {
+			target.Weight = iweight
+		} else {
+			log.Printf("Ignoring invalid weight annotation for target %s: %q", target.Name, weight)
+		}
+	}
+	if preference, ok := annotations[types.SitePreferenceQualifier]; ok {
+		switch preference {
+		case types.SitePreferencePreferLocal, types.SitePreferenceLocalOnly, types.SitePreferenceFailoverOnly:
+			target.SitePreference = preference
+		default:
+			log.Printf("Ignoring invalid site preference annotation for target %s: %q", target.Name, preference)
+		}
+	}
+}
+
 func updateAnnotatedServiceDefinition(actual *types.ServiceInterface, desired *types.ServiceInterface) bool {
 	if actual.Origin != "annotation" {
 		return false
 	}
-	if actual.Protocol != desired.Protocol || actual.Port != desired.Port {
+	if actual.Protocol != desired.Protocol || actual.Port != desired.Port || !reflect.DeepEqual(actual.Ports, desired.Ports) {
 		return true
 	}
 	if len(actual.Targets) != len(desired.Targets) {
@@ -136,7 +220,9 @@ func updateAnnotatedServiceDefinition(actual *types.ServiceInterface, desired *t
 		nameChanged := actual.Targets[0].Name != desired.Targets[0].Name
 		selectorChanged := actual.Targets[0].Selector != desired.Targets[0].Selector
 		targetPortChanged := actual.Targets[0].TargetPort != desired.Targets[0].TargetPort
-		if nameChanged || selectorChanged || targetPortChanged {
+		targetPortsChanged := !reflect.DeepEqual(actual.Targets[0].TargetPorts, desired.Targets[0].TargetPorts)
+		policyChanged := actual.Targets[0].Weight != desired.Targets[0].Weight || actual.Targets[0].SitePreference != desired.Targets[0].SitePreference
+		if nameChanged || selectorChanged || targetPortChanged || targetPortsChanged || policyChanged {
 			return true
 		}
 	}
@@ -154,6 +240,7 @@ func (m *DefinitionMonitor) getServiceDefinitionFromAnnotatedDeployment(deployme
 			log.Printf("Ignoring annotated deployment %s; cannot deduce port", deployment.ObjectMeta.Name)
 			return svc, false
 		}
+		svc.Ports = deducePorts(deployment)
 		svc.Protocol = protocol
 		if address, ok := deployment.ObjectMeta.Annotations[types.AddressQualifier]; ok {
 			svc.Address = address
@@ -165,11 +252,13 @@ func (m *DefinitionMonitor) getServiceDefinitionFromAnnotatedDeployment(deployme
 		if deployment.Spec.Selector != nil {
 			selector = utils.StringifySelector(deployment.Spec.Selector.MatchLabels)
 		}
+		target := types.ServiceInterfaceTarget{
+			Name:     deployment.ObjectMeta.Name,
+			Selector: selector,
+		}
+		setTargetPolicyFromAnnotations(&target, deployment.ObjectMeta.Annotations)
 		svc.Targets = []types.ServiceInterfaceTarget{
-			types.ServiceInterfaceTarget{
-				Name:     deployment.ObjectMeta.Name,
-				Selector: selector,
-			},
+			target,
 		}
 		svc.Origin = "annotation"
 		return svc, true
@@ -184,6 +273,7 @@ func (m *DefinitionMonitor) getServiceDefinitionFromAnnotatedService(service *co
 		if port := deducePortFromService(service); port != 0 {
 			svc.Port = int(port)
 		}
+		svc.Ports = deducePortsFromService(service)
 		svc.Protocol = protocol
 		if address, ok := service.ObjectMeta.Annotations[types.AddressQualifier]; ok {
 			svc.Address = address
@@ -212,6 +302,7 @@ func (m *DefinitionMonitor) getServiceDefinitionFromAnnotatedService(service *co
 			if port != 0 && port != svc.Port {
 				svcTgt.TargetPort = port
 			}
+			setTargetPolicyFromAnnotations(&svcTgt, service.ObjectMeta.Annotations)
 			svc.Targets = []types.ServiceInterfaceTarget{
 				svcTgt,
 			}
@@ -248,6 +339,8 @@ func (m *DefinitionMonitor) getServiceDefinitionFromAnnotatedService(service *co
 				originalTargetPort, _ := strconv.Atoi(service.Annotations[types.OriginalTargetPortQualifier])
 				target.TargetPort = originalTargetPort
 			}
+			target.TargetPorts = deduceTargetPortsFromService(service)
+			setTargetPolicyFromAnnotations(&target, service.ObjectMeta.Annotations)
 			svc.Targets = []types.ServiceInterfaceTarget{
 				target,
 			}
@@ -310,6 +403,16 @@ func (m *DefinitionMonitor) restoreServiceDefinitions(service *corev1.Service) e
 		delete(service.ObjectMeta.Annotations, types.OriginalTargetPortQualifier)
 		service.Spec.Ports[0].TargetPort = intstr.FromInt(originalTargetPort)
 	}
+	if hasOriginalTargetPorts(*service) {
+		updated = true
+		originalTargetPorts := utils.LabelToMap(service.ObjectMeta.Annotations[types.OriginalTargetPortsQualifier])
+		delete(service.ObjectMeta.Annotations, types.OriginalTargetPortsQualifier)
+		for i, p := range service.Spec.Ports {
+			if port, err := strconv.Atoi(originalTargetPorts[p.Name]); err == nil && i > 0 {
+				service.Spec.Ports[i].TargetPort = intstr.FromInt(port)
+			}
+		}
+	}
 	if hasOriginalAssigned(*service) {
 		updated = true
 		delete(service.ObjectMeta.Annotations, types.OriginalAssignedQualifier)
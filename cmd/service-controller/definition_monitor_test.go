@@ -563,3 +563,86 @@ func TestDeduceTargetPortFromService(t *testing.T) {
 		})
 	}
 }
+
+func TestSetTargetPolicyFromAnnotations(t *testing.T) {
+	target := types.ServiceInterfaceTarget{Name: "dep1"}
+	setTargetPolicyFromAnnotations(&target, map[string]string{
+		types.WeightQualifier:         "9",
+		types.SitePreferenceQualifier: types.SitePreferencePreferLocal,
+	})
+	assert.Equal(t, target.Weight, 9)
+	assert.Equal(t, target.SitePreference, types.SitePreferencePreferLocal)
+
+	target = types.ServiceInterfaceTarget{Name: "dep1"}
+	setTargetPolicyFromAnnotations(&target, map[string]string{
+		types.WeightQualifier:         "11",
+		types.SitePreferenceQualifier: "nearby",
+	})
+	assert.Equal(t, target.Weight, 0)
+	assert.Equal(t, target.SitePreference, "")
+}
+
+func TestDeducePorts(t *testing.T) {
+	newDeployment := func(annotations map[string]string, ports ...corev1.ContainerPort) *v1.Deployment {
+		return &v1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "dep1",
+				Namespace:   "ns1",
+				Annotations: annotations,
+			},
+			Spec: v1.DeploymentSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{
+							Ports: ports,
+						}},
+					},
+				},
+			},
+		}
+	}
+	web := corev1.ContainerPort{Name: "web", ContainerPort: 8080}
+	admin := corev1.ContainerPort{Name: "admin", ContainerPort: 9090}
+	unnamed := corev1.ContainerPort{ContainerPort: 9090}
+
+	assert.Assert(t, deducePorts(newDeployment(nil, web)) == nil)
+	assert.Assert(t, deducePorts(newDeployment(nil, web, unnamed)) == nil)
+	assert.Assert(t, deducePorts(newDeployment(map[string]string{types.PortQualifier: "8080"}, web, admin)) == nil)
+	assert.DeepEqual(t, deducePorts(newDeployment(nil, web, admin)), []types.ServiceInterfacePort{
+		{Name: "web", Port: 8080},
+		{Name: "admin", Port: 9090},
+	})
+}
+
+func TestDeduceTargetPortsFromService(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "svc1",
+			Annotations: map[string]string{},
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{Name: "web", Port: 80, TargetPort: intstr.FromInt(8080)},
+				{Name: "admin", Port: 9090, TargetPort: intstr.FromInt(9091)},
+				{Name: "metrics", Port: 9100, TargetPort: intstr.FromInt(9100)},
+			},
+		},
+	}
+	assert.DeepEqual(t, deducePortsFromService(service), []types.ServiceInterfacePort{
+		{Name: "web", Port: 80},
+		{Name: "admin", Port: 9090},
+		{Name: "metrics", Port: 9100},
+	})
+	assert.DeepEqual(t, deduceTargetPortsFromService(service), map[string]int{"admin": 9091})
+
+	// once the service points at the router, the original target
+	// ports are used
+	service.Annotations[types.OriginalTargetPortsQualifier] = stringifyTargetPorts(service.Spec.Ports[1:])
+	service.Spec.Ports[1].TargetPort = intstr.FromInt(1025)
+	service.Spec.Ports[2].TargetPort = intstr.FromInt(1026)
+	assert.DeepEqual(t, deduceTargetPortsFromService(service), map[string]int{"admin": 9091})
+
+	service.Spec.Ports = service.Spec.Ports[:1]
+	assert.Assert(t, deducePortsFromService(service) == nil)
+	assert.Assert(t, deduceTargetPortsFromService(service) == nil)
+}
@@ -70,9 +70,28 @@ func getTlsConfig(verify bool, cert, key, ca string) (*tls.Config, error) {
 	return &config, nil
 }
 
+func getDurationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("Ignoring invalid value for %s: %q", name, value)
+		return defaultValue
+	}
+	return duration
+}
+
 func main() {
 	origin := os.Getenv("SKUPPER_SERVICE_SYNC_ORIGIN")
 	namespace := os.Getenv("SKUPPER_NAMESPACE")
+	syncInterval := getDurationFromEnv("SKUPPER_SERVICE_SYNC_INTERVAL", types.DefaultServiceSyncInterval)
+	syncAgeOut := getDurationFromEnv("SKUPPER_SERVICE_SYNC_AGE_OUT", types.DefaultServiceSyncAgeOut)
+	if syncAgeOut <= syncInterval {
+		log.Printf("Service sync age out %s must be longer than the interval %s, using %s", syncAgeOut, syncInterval, 2*syncInterval)
+		syncAgeOut = 2 * syncInterval
+	}
 
 	// set up signals so we handle the first shutdown signal gracefully
 	stopCh := SetupSignalHandler()
@@ -88,7 +107,7 @@ func main() {
 		log.Fatal("Error getting tls config", err.Error())
 	}
 
-	controller, err := NewController(cli, origin, tlsConfig)
+	controller, err := NewController(cli, origin, syncInterval, syncAgeOut, tlsConfig)
 	if err != nil {
 		log.Fatal("Error getting new controller", err.Error())
 	}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type MetricLabels map[string]string
+
+type MetricSample struct {
+	labels MetricLabels
+	value  int
+}
+
+type MetricFamily struct {
+	name       string
+	help       string
+	metricType string
+	aggregate  func(a int, b int) int
+	samples    []MetricSample
+}
+
+type MetricSet struct {
+	families map[string]*MetricFamily
+	order    []string
+}
+
+func newMetricSet() *MetricSet {
+	return &MetricSet{
+		families: map[string]*MetricFamily{},
+	}
+}
+
+func sum(a int, b int) int {
+	return a + b
+}
+
+func (m *MetricSet) define(name string, metricType string, help string) *MetricFamily {
+	if _, ok := m.families[name]; !ok {
+		m.families[name] = &MetricFamily{
+			name:       name,
+			help:       help,
+			metricType: metricType,
+			aggregate:  sum,
+		}
+		m.order = append(m.order, name)
+	}
+	return m.families[name]
+}
+
+func (m *MetricSet) add(name string, labels MetricLabels, value int) {
+	family, ok := m.families[name]
+	if !ok {
+		return
+	}
+	for i, s := range family.samples {
+		if s.labels.equals(labels) {
+			family.samples[i].value = family.aggregate(s.value, value)
+			return
+		}
+	}
+	family.samples = append(family.samples, MetricSample{labels: labels, value: value})
+}
+
+func (a MetricLabels) equals(b MetricLabels) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if v2, ok := b[k]; !ok || v != v2 {
+			return false
+		}
+	}
+	return true
+}
+
+func escapeLabelValue(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, "\n", `\n`, -1)
+	return strings.Replace(value, `"`, `\"`, -1)
+}
+
+func (l MetricLabels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	keys := []string{}
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=\"%s\"", k, escapeLabelValue(l[k]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func (m *MetricSet) write(w io.Writer) error {
+	for _, name := range m.order {
+		family := m.families[name]
+		if len(family.samples) == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", family.name, family.help, family.name, family.metricType); err != nil {
+			return err
+		}
+		lines := make([]string, len(family.samples))
+		for i, s := range family.samples {
+			lines[i] = fmt.Sprintf("%s%s %d\n", family.name, s.labels, s.value)
+		}
+		sort.Strings(lines)
+		for _, line := range lines {
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+const (
+	MetricServiceTargets        string = "skupper_service_targets"
+	MetricTcpConnections        string = "skupper_tcp_connections"
+	MetricTcpBytesIn            string = "skupper_tcp_bytes_in"
+	MetricTcpBytesOut           string = "skupper_tcp_bytes_out"
+	MetricHttpRequests          string = "skupper_http_requests_total"
+	MetricHttpBytesIn           string = "skupper_http_bytes_in_total"
+	MetricHttpBytesOut          string = "skupper_http_bytes_out_total"
+	MetricHttpLatencyMax        string = "skupper_http_latency_max"
+	MetricHttpRequestsByDetails string = "skupper_http_requests_by_details_total"
+)
+
+func newConsoleMetricSet() *MetricSet {
+	m := newMetricSet()
+	m.define(MetricServiceTargets, "gauge", "Number of targets registered for an address at a site.")
+	m.define(MetricTcpConnections, "gauge", "Number of open tcp connections for an address.")
+	m.define(MetricTcpBytesIn, "gauge", "Bytes received over open tcp connections for an address.")
+	m.define(MetricTcpBytesOut, "gauge", "Bytes sent over open tcp connections for an address.")
+	m.define(MetricHttpRequests, "counter", "Number of http requests for an address.")
+	m.define(MetricHttpBytesIn, "counter", "Bytes received in http requests for an address.")
+	m.define(MetricHttpBytesOut, "counter", "Bytes sent in http responses for an address.")
+	m.define(MetricHttpLatencyMax, "gauge", "Maximum latency observed for http requests for an address.").aggregate = max
+	m.define(MetricHttpRequestsByDetails, "counter", "Number of http requests for an address by response details (e.g. status code).")
+	return m
+}
+
+func (m *MetricSet) addServiceTargets(stats *ServiceStats) {
+	for _, t := range stats.Targets {
+		m.add(MetricServiceTargets, MetricLabels{
+			"address":  stats.Address,
+			"protocol": stats.Protocol,
+			"site_id":  t.SiteId,
+			"target":   t.Target,
+		}, 1)
+	}
+}
+
+func (m *MetricSet) addTcpConnections(address string, direction string, sites SiteConnectionsList) {
+	for _, site := range sites {
+		for _, c := range site.Connections {
+			target := c.Server
+			if direction == "ingress" {
+				target = c.Client
+			}
+			labels := MetricLabels{
+				"address":   address,
+				"site_id":   site.SiteId,
+				"direction": direction,
+				"target":    target,
+			}
+			m.add(MetricTcpConnections, labels, 1)
+			m.add(MetricTcpBytesIn, labels, c.BytesIn)
+			m.add(MetricTcpBytesOut, labels, c.BytesOut)
+		}
+	}
+}
+
+func (m *MetricSet) addHttpRequestStats(address string, siteId string, direction string, byTarget map[string]HttpRequestStats) {
+	for target, stats := range byTarget {
+		labels := MetricLabels{
+			"address":   address,
+			"site_id":   siteId,
+			"direction": direction,
+			"target":    target,
+		}
+		m.add(MetricHttpRequests, labels, stats.Requests)
+		m.add(MetricHttpBytesIn, labels, stats.BytesIn)
+		m.add(MetricHttpBytesOut, labels, stats.BytesOut)
+		m.add(MetricHttpLatencyMax, labels, stats.LatencyMax)
+		for detail, count := range stats.Details {
+			m.add(MetricHttpRequestsByDetails, MetricLabels{
+				"address":   address,
+				"site_id":   siteId,
+				"direction": direction,
+				"target":    target,
+				"details":   detail,
+			}, count)
+		}
+	}
+}
+
+func getConsoleMetrics(data *ConsoleData) *MetricSet {
+	m := newConsoleMetricSet()
+	for _, s := range data.Services {
+		switch service := s.(type) {
+		case TcpServiceStats:
+			m.addServiceTargets(&service.ServiceStats)
+			m.addTcpConnections(service.Address, "ingress", service.ConnectionsIngress)
+			m.addTcpConnections(service.Address, "egress", service.ConnectionsEgress)
+		case HttpServiceStats:
+			m.addServiceTargets(&service.ServiceStats)
+			for _, r := range service.RequestsReceived {
+				m.addHttpRequestStats(service.Address, r.SiteId, "in", r.ByClient)
+			}
+			for _, r := range service.RequestsHandled {
+				m.addHttpRequestStats(service.Address, r.SiteId, "out", r.ByServer)
+			}
+		}
+	}
+	return m
+}
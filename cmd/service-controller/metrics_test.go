@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestConsoleMetrics(t *testing.T) {
+	data := &ConsoleData{
+		Services: []interface{}{
+			TcpServiceStats{
+				ServiceStats: ServiceStats{
+					Address:  "db",
+					Protocol: "tcp",
+					Targets: []ServiceTarget{
+						{Name: "db-1", Target: "db", SiteId: "site-a"},
+					},
+				},
+				ConnectionsIngress: SiteConnectionsList{
+					{
+						SiteId: "site-b",
+						Connections: map[string]ConnectionStats{
+							"c1": {Id: "c1", BytesIn: 10, BytesOut: 20, Client: "client-1"},
+							"c2": {Id: "c2", BytesIn: 5, BytesOut: 1, Client: "client-1"},
+						},
+					},
+				},
+				ConnectionsEgress: SiteConnectionsList{
+					{
+						SiteId: "site-a",
+						Connections: map[string]ConnectionStats{
+							"c3": {Id: "c3", BytesIn: 7, BytesOut: 8, Server: "db-1"},
+						},
+					},
+				},
+			},
+			HttpServiceStats{
+				ServiceStats: ServiceStats{
+					Address:  "web",
+					Protocol: "http",
+				},
+				RequestsReceived: HttpRequestsReceivedList{
+					{
+						SiteId: "site-b",
+						ByClient: map[string]HttpRequestStats{
+							"client-2": {Requests: 3, BytesIn: 30, BytesOut: 300, LatencyMax: 12, Details: map[string]int{"GET:200": 3}},
+						},
+					},
+				},
+				RequestsHandled: HttpRequestsHandledList{
+					{
+						SiteId: "site-a",
+						ByServer: map[string]HttpRequestStats{
+							"web-\"1\"": {Requests: 3, LatencyMax: 4},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	var out bytes.Buffer
+	err := getConsoleMetrics(data).write(&out)
+	assert.Assert(t, err)
+	lines := strings.Split(out.String(), "\n")
+	expected := []string{
+		`# TYPE skupper_service_targets gauge`,
+		`skupper_service_targets{address="db",protocol="tcp",site_id="site-a",target="db"} 1`,
+		`skupper_tcp_connections{address="db",direction="ingress",site_id="site-b",target="client-1"} 2`,
+		`skupper_tcp_connections{address="db",direction="egress",site_id="site-a",target="db-1"} 1`,
+		`skupper_tcp_bytes_in{address="db",direction="ingress",site_id="site-b",target="client-1"} 15`,
+		`skupper_tcp_bytes_out{address="db",direction="egress",site_id="site-a",target="db-1"} 8`,
+		`# TYPE skupper_http_requests_total counter`,
+		`skupper_http_requests_total{address="web",direction="in",site_id="site-b",target="client-2"} 3`,
+		`skupper_http_requests_total{address="web",direction="out",site_id="site-a",target="web-\"1\""} 3`,
+		`skupper_http_latency_max{address="web",direction="in",site_id="site-b",target="client-2"} 12`,
+		`skupper_http_requests_by_details_total{address="web",details="GET:200",direction="in",site_id="site-b",target="client-2"} 3`,
+	}
+	for _, e := range expected {
+		assert.Assert(t, contains(lines, e), "missing %q in:\n%s", e, out.String())
+	}
+}
+
+func TestMetricSetAggregation(t *testing.T) {
+	m := newConsoleMetricSet()
+	labels := MetricLabels{"address": "a"}
+	m.add(MetricHttpLatencyMax, labels, 5)
+	m.add(MetricHttpLatencyMax, MetricLabels{"address": "a"}, 3)
+	m.add(MetricHttpRequests, labels, 5)
+	m.add(MetricHttpRequests, MetricLabels{"address": "a"}, 3)
+	m.add("undefined_metric", labels, 1)
+
+	var out bytes.Buffer
+	assert.Assert(t, m.write(&out))
+	lines := strings.Split(out.String(), "\n")
+	assert.Assert(t, contains(lines, `skupper_http_latency_max{address="a"} 5`), out.String())
+	assert.Assert(t, contains(lines, `skupper_http_requests_total{address="a"} 8`), out.String())
+	assert.Assert(t, !strings.Contains(out.String(), "undefined_metric"))
+	assert.Assert(t, !strings.Contains(out.String(), MetricTcpConnections))
+}
+
+func contains(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
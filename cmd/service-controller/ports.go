@@ -196,6 +196,9 @@ func portAsInt(port string) int {
 	return result
 }
 
+// Returns the ports in use by the bridge configuration; listeners are
+// keyed by name, which is the service address regardless of whether
+// the listener uses a site local address
 func (ports *FreePorts) getPortAllocations(bridges *qdr.BridgeConfig) map[string]int {
 	allocations := map[string]int{}
 	if bridges != nil {
@@ -206,7 +209,7 @@ func (ports *FreePorts) getPortAllocations(bridges *qdr.BridgeConfig) map[string
 		}
 		for _, b := range bridges.HttpListeners {
 			port := portAsInt(b.Port)
-			allocations[b.Address] = port
+			allocations[b.Name] = port
 			ports.inuse(port)
 		}
 		for _, b := range bridges.TcpConnectors {
@@ -215,10 +218,20 @@ func (ports *FreePorts) getPortAllocations(bridges *qdr.BridgeConfig) map[string
 			ports.inuse(port)
 		}
 		for _, b := range bridges.TcpListeners {
+			port := portAsInt(b.Port)
+			allocations[b.Name] = port
+			ports.inuse(port)
+		}
+		for _, b := range bridges.UdpConnectors {
 			port := portAsInt(b.Port)
 			allocations[b.Address] = port
 			ports.inuse(port)
 		}
+		for _, b := range bridges.UdpListeners {
+			port := portAsInt(b.Port)
+			allocations[b.Name] = port
+			ports.inuse(port)
+		}
 	}
 	return allocations
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/client"
+	"github.com/skupperproject/skupper/pkg/kube"
+	"github.com/skupperproject/skupper/pkg/qdr"
+)
+
+// The prefix of the connectors through which router replicas are
+// linked to each other
+const peerConnectorPrefix = "peer-"
+
+// Links the replicas of a replicated router to each other. Every
+// replica has the same configuration, so makes its own links to the
+// sites this site connects to, but a link made to this site lands on
+// whichever replica the service selects. Linking the replicas lets
+// each reach every site, whichever of them fails.
+//
+// The replicas are linked by pod IP through the management agent of
+// each pod, as they cannot be addressed through one another until they
+// are linked. The agent is reached directly at the pod's IP, verifying
+// the certificate of the messaging service.
+type RouterPeers struct {
+	vanClient *client.VanClient
+	tlsConfig *tls.Config
+	// set while the router is replicated, so that links to removed
+	// replicas are cleaned up once only one remains
+	replicated bool
+}
+
+func newRouterPeers(cli *client.VanClient, config *tls.Config) *RouterPeers {
+	peers := &RouterPeers{
+		vanClient: cli,
+	}
+	if config != nil {
+		peers.tlsConfig = config.Clone()
+		peers.tlsConfig.ServerName = "skupper-messaging"
+	}
+	return peers
+}
+
+func (p *RouterPeers) start(stopCh <-chan struct{}) {
+	go wait.Until(p.run, 10*time.Second, stopCh)
+}
+
+func (p *RouterPeers) run() {
+	if err := p.linkReplicas(); err != nil {
+		log.Printf("[router_peers] Failed to link router replicas: %s", err)
+	}
+}
+
+// Returns the connectors each ready router pod should have to the
+// others, keyed by pod name. Each pair of pods is linked once, by the
+// pod whose name sorts later connecting to the other.
+func getPeerConnectors(pods []corev1.Pod) map[string][]qdr.Connector {
+	ready := []corev1.Pod{}
+	for _, pod := range pods {
+		if kube.IsPodReady(&pod) && pod.Status.PodIP != "" && pod.ObjectMeta.DeletionTimestamp == nil {
+			ready = append(ready, pod)
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool {
+		return ready[i].Name < ready[j].Name
+	})
+	connectors := map[string][]qdr.Connector{}
+	for i, pod := range ready {
+		connectors[pod.Name] = []qdr.Connector{}
+		for _, peer := range ready[:i] {
+			connectors[pod.Name] = append(connectors[pod.Name], qdr.Connector{
+				Name:       peerConnectorPrefix + peer.Name,
+				Role:       qdr.RoleInterRouter,
+				Host:       peer.Status.PodIP,
+				Port:       strconv.Itoa(int(types.InterRouterListenerPort)),
+				SslProfile: types.InterRouterProfile,
+			})
+		}
+	}
+	return connectors
+}
+
+func (p *RouterPeers) linkReplicas() error {
+	cli := p.vanClient
+	pods, err := cli.KubeClient.CoreV1().Pods(cli.Namespace).List(metav1.ListOptions{LabelSelector: "skupper.io/component=" + types.TransportComponentName})
+	if err != nil {
+		return err
+	}
+	desired := getPeerConnectors(pods.Items)
+	if len(desired) <= 1 && !p.replicated {
+		return nil
+	}
+	ips := map[string]string{}
+	for _, pod := range pods.Items {
+		ips[pod.Name] = pod.Status.PodIP
+	}
+	for pod, connectors := range desired {
+		if err := p.syncPeerConnectors(pod, ips[pod], connectors); err != nil {
+			return err
+		}
+	}
+	p.replicated = len(desired) > 1
+	return nil
+}
+
+func (p *RouterPeers) syncPeerConnectors(pod string, ip string, desired []qdr.Connector) error {
+	agent, err := qdr.Connect("amqps://"+net.JoinHostPort(ip, "5671"), p.tlsConfig)
+	if err != nil {
+		return fmt.Errorf("Could not connect to management agent of %s: %s", pod, err)
+	}
+	defer agent.Close()
+	actual, err := agent.GetConnectors()
+	if err != nil {
+		return fmt.Errorf("Could not retrieve connectors of %s: %s", pod, err)
+	}
+	existing := map[string]qdr.Connector{}
+	for _, connector := range actual {
+		if strings.HasPrefix(connector.Name, peerConnectorPrefix) {
+			existing[connector.Name] = connector
+		}
+	}
+	for _, connector := range desired {
+		if current, ok := existing[connector.Name]; ok {
+			delete(existing, connector.Name)
+			if current.Host == connector.Host {
+				continue
+			}
+			if err := agent.DeleteConnector(connector.Name); err != nil {
+				return fmt.Errorf("Could not remove link from %s to %s: %s", pod, connector.Name, err)
+			}
+		}
+		log.Printf("[router_peers] Linking router replica %s to %s at %s", pod, strings.TrimPrefix(connector.Name, peerConnectorPrefix), connector.Host)
+		if err := agent.CreateConnector(connector); err != nil {
+			return fmt.Errorf("Could not link %s to %s: %s", pod, connector.Name, err)
+		}
+	}
+	for name := range existing {
+		log.Printf("[router_peers] Removing link from router replica %s to %s", pod, strings.TrimPrefix(name, peerConnectorPrefix))
+		if err := agent.DeleteConnector(name); err != nil {
+			return fmt.Errorf("Could not remove link from %s to %s: %s", pod, name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/qdr"
+)
+
+func routerPod(name string, ip string, ready bool) corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.PodStatus{
+			PodIP:      ip,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+		},
+	}
+}
+
+func TestGetPeerConnectors(t *testing.T) {
+	peer := func(name string, ip string) qdr.Connector {
+		return qdr.Connector{
+			Name:       "peer-" + name,
+			Role:       qdr.RoleInterRouter,
+			Host:       ip,
+			Port:       "55671",
+			SslProfile: types.InterRouterProfile,
+		}
+	}
+
+	connectors := getPeerConnectors([]corev1.Pod{routerPod("router-a", "10.0.0.1", true)})
+	assert.DeepEqual(t, connectors, map[string][]qdr.Connector{"router-a": {}})
+
+	connectors = getPeerConnectors([]corev1.Pod{
+		routerPod("router-c", "10.0.0.3", true),
+		routerPod("router-a", "10.0.0.1", true),
+		routerPod("router-d", "10.0.0.4", false),
+		routerPod("router-b", "10.0.0.2", true),
+	})
+	assert.DeepEqual(t, connectors, map[string][]qdr.Connector{
+		"router-a": {},
+		"router-b": {peer("router-a", "10.0.0.1")},
+		"router-c": {peer("router-a", "10.0.0.1"), peer("router-b", "10.0.0.2")},
+	})
+}
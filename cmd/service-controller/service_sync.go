@@ -6,13 +6,17 @@ import (
 	"fmt"
 	"log"
 	"reflect"
+	"sort"
+	"strings"
 	"time"
 
 	amqp "github.com/interconnectedcloud/go-amqp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 
 	"github.com/skupperproject/skupper/api/types"
 	"github.com/skupperproject/skupper/pkg/kube"
+	"github.com/skupperproject/skupper/pkg/qdr"
 )
 
 func (c *Controller) pareByOrigin(service string) {
@@ -25,6 +29,8 @@ func (c *Controller) pareByOrigin(service string) {
 }
 
 func (c *Controller) serviceSyncDefinitionsUpdated(definitions map[string]types.ServiceInterface) {
+	c.serviceSyncLock.Lock()
+	defer c.serviceSyncLock.Unlock()
 	latest := make(map[string]types.ServiceInterface) // becomes c.localServices
 	byName := make(map[string]types.ServiceInterface)
 	var added []types.ServiceInterface
@@ -36,11 +42,12 @@ func (c *Controller) serviceSyncDefinitionsUpdated(definitions map[string]types.
 			Address:  original.Address,
 			Protocol: original.Protocol,
 			Port:     original.Port,
+			Ports:    original.Ports,
 			Origin:   original.Origin,
 			Headless: original.Headless,
 			Targets:  []types.ServiceInterfaceTarget{},
 		}
-		if service.Origin != "" && service.Origin != "annotation" {
+		if !isLocalOrigin(service.Origin) {
 			if _, ok := c.byOrigin[service.Origin]; !ok {
 				c.byOrigin[service.Origin] = make(map[string]types.ServiceInterface)
 			}
@@ -76,6 +83,10 @@ func (c *Controller) serviceSyncDefinitionsUpdated(definitions map[string]types.
 	if len(modified) > 0 {
 		log.Println("Service interface(s) modified", modified)
 	}
+	if len(added) > 0 || len(removed) > 0 || len(modified) > 0 {
+		c.localVersion++
+		c.requestServiceSyncUpdate()
+	}
 
 	c.localServices = latest
 	c.byName = byName
@@ -85,6 +96,9 @@ func equivalentServiceDefinition(a *types.ServiceInterface, b *types.ServiceInte
 	if a.Protocol != b.Protocol || a.Port != b.Port || a.EventChannel != b.EventChannel || a.Aggregate != b.Aggregate {
 		return false
 	}
+	if !reflect.DeepEqual(a.Ports, b.Ports) {
+		return false
+	}
 	if a.Headless == nil && b.Headless == nil {
 		return true
 	} else if a.Headless != nil && b.Headless != nil {
@@ -98,7 +112,28 @@ func equivalentServiceDefinition(a *types.ServiceInterface, b *types.ServiceInte
 	}
 }
 
-func (c *Controller) ensureServiceInterfaceDefinitions(origin string, serviceInterfaceDefs map[string]types.ServiceInterface) {
+// The changes to make to the definitions from an origin in the
+// skupper-services configmap
+type serviceDefinitionUpdate struct {
+	origin  string
+	changed []types.ServiceInterface
+	deleted []string
+}
+
+// Applies the changes to the skupper-services configmap. Must be called
+// with serviceDefinitionsLock held, but not serviceSyncLock.
+func (c *Controller) updateServiceDefinitions(updates ...serviceDefinitionUpdate) {
+	for _, update := range updates {
+		if err := kube.UpdateSkupperServices(update.changed, update.deleted, update.origin, c.vanClient.Namespace, c.vanClient.KubeClient); err != nil {
+			log.Printf("Failed to update service definitions from %s: %s", update.origin, err)
+		}
+	}
+}
+
+// Records the definitions received from an origin, returning the
+// changes to make to the skupper-services configmap. Must be called
+// with serviceSyncLock held.
+func (c *Controller) ensureServiceInterfaceDefinitions(origin string, serviceInterfaceDefs map[string]types.ServiceInterface) serviceDefinitionUpdate {
 	var changed []types.ServiceInterface
 	var deleted []string
 
@@ -122,79 +157,348 @@ func (c *Controller) ensureServiceInterfaceDefinitions(origin string, serviceInt
 		}
 	}
 
-	kube.UpdateSkupperServices(changed, deleted, origin, c.vanClient.Namespace, c.vanClient.KubeClient)
-
 	for _, name := range deleted {
 		delete(c.byOrigin[origin], name)
 	}
+	return serviceDefinitionUpdate{origin: origin, changed: changed, deleted: deleted}
 }
 
-func (c *Controller) syncSender(sendLocal chan bool) {
-	var request amqp.Message
-	var properties amqp.MessageProperties
+// The service sync state of an origin, persisted on the
+// skupper-services configmap so that it survives a restart
+type serviceSyncState struct {
+	LastHeard *time.Time `json:"lastHeard,omitempty"`
+	Version   uint64     `json:"version"`
+}
+
+// Must be called with serviceSyncLock held
+func (c *Controller) getServiceSyncState() map[string]serviceSyncState {
+	state := map[string]serviceSyncState{}
+	for origin, lastHeard := range c.heardFrom {
+		heard := lastHeard
+		state[origin] = serviceSyncState{
+			LastHeard: &heard,
+			Version:   c.versions[origin],
+		}
+	}
+	state[c.origin] = serviceSyncState{
+		Version: c.localVersion,
+	}
+	return state
+}
+
+// Must be called with serviceSyncLock held
+func (c *Controller) setServiceSyncState(state map[string]serviceSyncState) {
+	for origin, s := range state {
+		if origin == c.origin {
+			c.localVersion = s.Version
+			continue
+		}
+		c.versions[origin] = s.Version
+		if s.LastHeard != nil {
+			c.heardFrom[origin] = *s.LastHeard
+		}
+	}
+}
+
+func (c *Controller) loadServiceSyncState() {
+	current, err := c.vanClient.KubeClient.CoreV1().ConfigMaps(c.vanClient.Namespace).Get("skupper-services", metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Could not retrieve service sync state: %s", err)
+		return
+	}
+	encoded, ok := current.ObjectMeta.Annotations[types.ServiceSyncStateQualifier]
+	if !ok {
+		return
+	}
+	state := map[string]serviceSyncState{}
+	if err = jsonencoding.Unmarshal([]byte(encoded), &state); err != nil {
+		log.Printf("Ignoring invalid service sync state: %s", err)
+		return
+	}
+	c.serviceSyncLock.Lock()
+	c.setServiceSyncState(state)
+	c.serviceSyncLock.Unlock()
+}
+
+func (c *Controller) saveServiceSyncState() {
+	c.serviceSyncLock.Lock()
+	state := c.getServiceSyncState()
+	c.serviceSyncLock.Unlock()
+	encoded, err := jsonencoding.Marshal(state)
+	if err != nil {
+		log.Println("Failed to create json for service sync state: ", err.Error())
+		return
+	}
+	err = kube.UpdateSkupperServicesAnnotation(types.ServiceSyncStateQualifier, string(encoded), c.vanClient.Namespace, c.vanClient.KubeClient)
+	if err != nil {
+		log.Printf("Failed to save service sync state: %s", err)
+	}
+}
+
+// Records the version of the definitions last received from an origin,
+// returning true if it has changed. Must be called with serviceSyncLock
+// held.
+func (c *Controller) updateServiceSyncVersion(origin string, version uint64) bool {
+	if current, ok := c.versions[origin]; ok && current == version {
+		return false
+	}
+	c.versions[origin] = version
+	return true
+}
+
+// Triggers an update to be sent to the other sites without waiting
+// for the next interval
+func (c *Controller) requestServiceSyncUpdate() {
+	select {
+	case c.sendLocal <- true:
+	default:
+	}
+}
+
+// Removes the definitions of any origin not heard from within the age
+// out period, returning the origins removed
+func (c *Controller) ageOutServiceDefinitions(now time.Time) []string {
+	c.serviceDefinitionsLock.Lock()
+	defer c.serviceDefinitionsLock.Unlock()
+	c.serviceSyncLock.Lock()
+	var agedOrigins []string
+	var updates []serviceDefinitionUpdate
+
+	for origin, _ := range c.byOrigin {
+		// origins recovered from the skupper-services configmap
+		// without any record of when they were last heard from
+		if _, ok := c.heardFrom[origin]; !ok {
+			c.heardFrom[origin] = now
+		}
+	}
+	for origin, lastHeard := range c.heardFrom {
+		if now.Sub(lastHeard) >= c.syncAgeOut {
+			agedOrigins = append(agedOrigins, origin)
+			var deleted []string
+			for name, _ := range c.byOrigin[origin] {
+				deleted = append(deleted, name)
+			}
+			if len(deleted) > 0 {
+				updates = append(updates, serviceDefinitionUpdate{origin: origin, changed: []types.ServiceInterface{}, deleted: deleted})
+			}
+		}
+	}
+
+	for _, originName := range agedOrigins {
+		log.Println("Service sync aged out service definitions from origin ", originName)
+		delete(c.heardFrom, originName)
+		delete(c.byOrigin, originName)
+		delete(c.versions, originName)
+		c.forgetRemoteSite(originName)
+	}
+	c.serviceSyncLock.Unlock()
+	c.updateServiceDefinitions(updates...)
+	return agedOrigins
+}
+
+// Returns the service sync updates to send to the other sites. Unless
+// the policy restricts exports to particular sites, a single update
+// with all local services is sent to every site. Otherwise that update
+// carries only the services exported to all sites, and each known site
+// the policy exports a different set to is sent its own update on the
+// address of that site, being listed in the "targeted" property of the
+// other so that it ignores it.
+func (c *Controller) getServiceSyncUpdates() ([]*amqp.Message, error) {
+	c.serviceSyncLock.Lock()
+	defer c.serviceSyncLock.Unlock()
+	policy := c.getServiceSyncPolicy()
+	newUpdate := func(subject string, services []types.ServiceInterface) (*amqp.Message, error) {
+		encoded, err := jsonencoding.Marshal(services)
+		if err != nil {
+			return nil, err
+		}
+		return &amqp.Message{
+			Properties: &amqp.MessageProperties{Subject: subject},
+			ApplicationProperties: map[string]interface{}{
+				"origin":      c.origin,
+				"origin-name": c.siteName,
+				"version":     c.localVersion,
+			},
+			Value: string(encoded),
+		}, nil
+	}
+	addresses := []string{}
+	for address := range c.localServices {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	all := []types.ServiceInterface{}
+	for _, address := range addresses {
+		if policy.exportsToAll(address) {
+			all = append(all, c.localServices[address])
+		}
+	}
+	updates := []*amqp.Message{}
+	targeted := []string{}
+	for _, siteId := range c.getRemoteSites() {
+		exported := []types.ServiceInterface{}
+		for _, address := range addresses {
+			if policy.allowsExport(siteId, address) {
+				exported = append(exported, c.localServices[address])
+			}
+		}
+		if reflect.DeepEqual(exported, all) {
+			continue
+		}
+		update, err := newUpdate(siteServiceSyncUpdate, exported)
+		if err != nil {
+			return nil, err
+		}
+		update.Properties.To = getServiceSyncSiteAddress(siteId)
+		update.ApplicationProperties["site"] = siteId
+		updates = append(updates, update)
+		targeted = append(targeted, siteId)
+	}
+	update, err := newUpdate("service-sync-update", all)
+	if err != nil {
+		return nil, err
+	}
+	if len(targeted) > 0 {
+		update.ApplicationProperties["targeted"] = strings.Join(targeted, ",")
+	}
+	return append([]*amqp.Message{update}, updates...), nil
+}
 
+// Handles an update from another site, ignoring any not intended for
+// this site and any definitions the policy does not allow it to import
+func (c *Controller) receiveServiceSyncUpdate(msg *amqp.Message) {
+	origin, ok := msg.ApplicationProperties["origin"].(string)
+	if !ok {
+		log.Println("Skupper service sync update type assertion error")
+		return
+	}
+	if origin == c.origin {
+		return
+	}
+	if msg.Properties.Subject == siteServiceSyncUpdate {
+		if site, _ := msg.ApplicationProperties["site"].(string); site != c.origin {
+			return
+		}
+	} else if targeted, ok := msg.ApplicationProperties["targeted"].(string); ok {
+		for _, site := range strings.Split(targeted, ",") {
+			if site == c.origin {
+				return
+			}
+		}
+	}
+	siteName, _ := msg.ApplicationProperties["origin-name"].(string)
+	version, _ := qdr.AsUint64(msg.ApplicationProperties["version"])
+	updates, ok := msg.Value.(string)
+	if !ok {
+		log.Printf("Skupper service sync update from %s was not a string", origin)
+		return
+	}
+	defs := []types.ServiceInterface{}
+	if err := jsonencoding.Unmarshal([]byte(updates), &defs); err != nil {
+		log.Printf("Skupper service sync update from %s was not valid json: %s", origin, err)
+		return
+	}
+	indexed := make(map[string]types.ServiceInterface)
+	for _, def := range defs {
+		def.Origin = origin
+		indexed[def.Address] = def
+	}
+	c.serviceDefinitionsLock.Lock()
+	defer c.serviceDefinitionsLock.Unlock()
+	c.serviceSyncLock.Lock()
+	c.setRemoteSiteName(origin, siteName)
+	update := c.ensureServiceInterfaceDefinitions(origin, c.filterServiceSyncImports(origin, indexed))
+	updated := c.updateServiceSyncVersion(origin, version)
+	c.serviceSyncLock.Unlock()
+	c.updateServiceDefinitions(update)
+	if updated {
+		c.saveServiceSyncState()
+	}
+}
+
+func (c *Controller) syncSender(done <-chan struct{}) {
 	ctx := context.Background()
 	sender, err := c.amqpSession.NewSender(amqp.LinkTargetAddress(types.ServiceSyncAddress))
 	if err != nil {
 		log.Fatal("Failed to create sender: ", err.Error())
 	}
+	// updates for a single site are sent to the address of that site
+	anonymous, err := c.amqpSession.NewSender()
+	if err != nil {
+		log.Fatal("Failed to create sender: ", err.Error())
+	}
 
 	defer func() {
 		sender.Close(ctx)
+		anonymous.Close(ctx)
 	}()
 
-	tickerSend := time.NewTicker(5 * time.Second)
-	tickerAge := time.NewTicker(30 * time.Second)
+	tickerSend := time.NewTicker(c.syncInterval)
+	tickerAge := time.NewTicker(c.syncAgeOut / 2)
+	defer tickerSend.Stop()
+	defer tickerAge.Stop()
 
-	properties.Subject = "service-sync-update"
-	request.Properties = &properties
-	request.ApplicationProperties = make(map[string]interface{})
-	request.ApplicationProperties["origin"] = c.origin
+	// ask the other sites for their definitions rather than waiting
+	// for their next update
+	var request amqp.Message
+	request.Properties = &amqp.MessageProperties{Subject: "service-sync-request"}
+	request.ApplicationProperties = map[string]interface{}{"origin": c.origin, "origin-name": c.siteName}
+	if err = sender.Send(ctx, &request); err != nil {
+		log.Printf("Failed to send service sync request: %s", err)
+	}
+
+	sendUpdate := func() {
+		updates, err := c.getServiceSyncUpdates()
+		if err != nil {
+			log.Println("Failed to create json for service definition sync: ", err.Error())
+			return
+		}
+		for _, update := range updates {
+			if update.Properties.To != "" {
+				err = anonymous.Send(ctx, update)
+			} else {
+				err = sender.Send(ctx, update)
+			}
+			if err != nil {
+				log.Printf("Failed to send service sync update: %s", err)
+			}
+		}
+	}
+	sendUpdate()
 
 	for {
 		select {
+		case <-done:
+			return
+
 		case <-tickerSend.C:
-			local := make([]types.ServiceInterface, 0)
+			sendUpdate()
 
-			for _, si := range c.localServices {
-				local = append(local, si)
-			}
-
-			encoded, err := jsonencoding.Marshal(local)
-			if err != nil {
-				log.Println("Failed to create json for service definition sync: ", err.Error())
-				return
-			}
-			request.Value = string(encoded)
-			err = sender.Send(ctx, &request)
+		case <-c.sendLocal:
+			sendUpdate()
 
 		case <-tickerAge.C:
-			var agedOrigins []string
-
-			now := time.Now()
-
-			for origin, _ := range c.byOrigin {
-				var deleted []string
-
-				if lastHeard, ok := c.heardFrom[origin]; ok {
-					if now.Sub(lastHeard) >= 60*time.Second {
-						agedOrigins = append(agedOrigins, origin)
-						agedDefinitions := c.byOrigin[origin]
-						for name, _ := range agedDefinitions {
-							deleted = append(deleted, name)
-						}
-						if len(deleted) > 0 {
-							kube.UpdateSkupperServices([]types.ServiceInterface{}, deleted, origin, c.vanClient.Namespace, c.vanClient.KubeClient)
-						}
-					}
-				}
-			}
+			c.ageOutServiceDefinitions(time.Now())
+			c.saveServiceSyncState()
+		}
+	}
+}
 
-			for _, originName := range agedOrigins {
-				log.Println("Service sync aged out service definitions from origin ", originName)
-				delete(c.heardFrom, originName)
-				delete(c.byOrigin, originName)
-			}
+// Handles the updates sent to this site alone, until the receiver is
+// closed
+func (c *Controller) receiveSiteServiceSyncUpdates(ctx context.Context, receiver *amqp.Receiver) {
+	for {
+		msg, err := receiver.Receive(ctx)
+		if err != nil {
+			log.Printf("Stopped receiving service sync updates for this site: %s", err)
+			return
+		}
+		msg.Accept()
+		if msg.Properties.Subject == siteServiceSyncUpdate {
+			c.receiveServiceSyncUpdate(msg)
+		} else {
+			log.Println("Service sync subject not valid")
 		}
 	}
 }
@@ -232,13 +536,26 @@ func (c *Controller) runServiceSync() {
 		receiver.Close(ctx)
 		cancel()
 	}()
+	siteReceiver, err := c.amqpSession.NewReceiver(
+		amqp.LinkSourceAddress(getServiceSyncSiteAddress(c.origin)),
+		amqp.LinkCredit(10),
+	)
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("Failed to create amqp receiver %s", err.Error()))
+		return
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+		siteReceiver.Close(ctx)
+		cancel()
+	}()
 
-	sendLocal := make(chan bool)
-	go c.syncSender(sendLocal)
+	done := make(chan struct{})
+	defer close(done)
+	go c.syncSender(done)
+	go c.receiveSiteServiceSyncUpdates(ctx, siteReceiver)
 
 	for {
-		var ok bool
-		var origin string
 		msg, err := receiver.Receive(ctx)
 		if err != nil {
 			utilruntime.HandleError(fmt.Errorf("Failed reading message from service sync %s", err.Error()))
@@ -250,31 +567,16 @@ func (c *Controller) runServiceSync() {
 		subject := msg.Properties.Subject
 
 		if subject == "service-sync-request" {
-			//sendLocal <- true
-			log.Println("Controller received service sync request")
-		} else if subject == "service-sync-update" {
-			if origin, ok = msg.ApplicationProperties["origin"].(string); ok {
-				if origin != c.origin {
-					if updates, ok := msg.Value.(string); ok {
-						defs := []types.ServiceInterface{}
-						err := jsonencoding.Unmarshal([]byte(updates), &defs)
-						if err == nil {
-							indexed := make(map[string]types.ServiceInterface)
-							for _, def := range defs {
-								def.Origin = origin
-								indexed[def.Address] = def
-							}
-							c.ensureServiceInterfaceDefinitions(origin, indexed)
-						} else {
-							log.Printf("Skupper service sync update from %s was not valid json: %s", origin, err)
-						}
-					} else {
-						log.Printf("Skupper service sync update from %s was not a string", origin)
-					}
-				}
-			} else {
-				log.Println("Skupper service sync update type assertion error")
+			if origin, ok := msg.ApplicationProperties["origin"].(string); ok && origin != c.origin {
+				log.Printf("Controller received service sync request from %s", origin)
+				siteName, _ := msg.ApplicationProperties["origin-name"].(string)
+				c.serviceSyncLock.Lock()
+				c.setRemoteSiteName(origin, siteName)
+				c.serviceSyncLock.Unlock()
+				c.requestServiceSyncUpdate()
 			}
+		} else if subject == "service-sync-update" || subject == siteServiceSyncUpdate {
+			c.receiveServiceSyncUpdate(msg)
 		} else {
 			log.Println("Service sync subject not valid")
 		}
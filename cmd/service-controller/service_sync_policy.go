@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"reflect"
+	"sort"
+	"time"
+
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/api/v1alpha1"
+	"github.com/skupperproject/skupper/client"
+	"github.com/skupperproject/skupper/pkg/kube"
+)
+
+// The subject of service sync updates sent to a single site, used
+// where the policy exports a different set of services to that site
+// than to all others. Sites that predate these policies ignore them
+// and so receive only the services exported to all sites.
+const siteServiceSyncUpdate = "service-sync-site-update"
+
+// Returns the address on which a site receives the service sync
+// updates sent to it alone, so that the services exported to it are
+// not delivered to every site
+func getServiceSyncSiteAddress(siteId string) string {
+	return types.ServiceSyncAddress + "/" + siteId
+}
+
+// The event key through which the rejected definitions recorded by
+// service sync are written to the status of the policies
+const rejectionsEventKey = "servicesyncpolicies@rejections"
+
+func newServiceSyncPolicyInformer(cli *client.VanClient) cache.SharedIndexInformer {
+	return dynamicinformer.NewFilteredDynamicInformer(
+		cli.DynamicClient,
+		v1alpha1.ServiceSyncPolicyResource,
+		cli.Namespace,
+		time.Second*30,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		nil).Informer()
+}
+
+// The combined rules of all ServiceSyncPolicy resources in the
+// namespace. Imports or exports are only restricted if some policy
+// has rules for them.
+type serviceSyncPolicy struct {
+	imports []v1alpha1.ServiceSyncRule
+	exports []v1alpha1.ServiceSyncRule
+}
+
+func newServiceSyncPolicy(resources []*v1alpha1.ServiceSyncPolicy) *serviceSyncPolicy {
+	policy := &serviceSyncPolicy{}
+	for _, resource := range resources {
+		policy.imports = append(policy.imports, resource.Spec.Imports...)
+		policy.exports = append(policy.exports, resource.Spec.Exports...)
+	}
+	return policy
+}
+
+// Checks that the patterns of a policy are valid. Invalid patterns
+// match nothing, so the rules containing them are not ignored but
+// allow less than intended.
+func validateServiceSyncPolicy(spec *v1alpha1.ServiceSyncPolicySpec) error {
+	for _, rule := range append(append([]v1alpha1.ServiceSyncRule{}, spec.Imports...), spec.Exports...) {
+		for _, pattern := range append(append([]string{}, rule.Sites...), rule.Addresses...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("Invalid pattern %q: %s", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Returns true if any pattern matches any of the values, or if there
+// are no patterns at all
+func matchesAny(patterns []string, values ...string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if matched, _ := path.Match(pattern, value); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Sites are matched by id only: the name a site reports is chosen by
+// whoever configures it, and need not be unique
+func allows(rules []v1alpha1.ServiceSyncRule, siteId string, address string) bool {
+	for _, rule := range rules {
+		if matchesAny(rule.Sites, siteId) && matchesAny(rule.Addresses, address) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *serviceSyncPolicy) allowsImport(siteId string, address string) bool {
+	return len(p.imports) == 0 || allows(p.imports, siteId, address)
+}
+
+func (p *serviceSyncPolicy) allowsExport(siteId string, address string) bool {
+	return len(p.exports) == 0 || allows(p.exports, siteId, address)
+}
+
+// Returns true if an address is exported to every site, whether or
+// not it is known
+func (p *serviceSyncPolicy) exportsToAll(address string) bool {
+	if len(p.exports) == 0 {
+		return true
+	}
+	for _, rule := range p.exports {
+		if !matchesAny(rule.Addresses, address) {
+			continue
+		}
+		if len(rule.Sites) == 0 {
+			return true
+		}
+		for _, site := range rule.Sites {
+			if site == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *Controller) getServiceSyncPolicies() []*v1alpha1.ServiceSyncPolicy {
+	resources := []*v1alpha1.ServiceSyncPolicy{}
+	if c.serviceSyncPolicyInformer == nil {
+		return resources
+	}
+	for _, obj := range c.serviceSyncPolicyInformer.GetStore().List() {
+		resource := &v1alpha1.ServiceSyncPolicy{}
+		if err := v1alpha1.FromUnstructured(obj, resource); err != nil {
+			log.Printf("Could not read ServiceSyncPolicy resource: %s", err)
+			continue
+		}
+		resources = append(resources, resource)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].ObjectMeta.Name < resources[j].ObjectMeta.Name
+	})
+	return resources
+}
+
+func (c *Controller) getServiceSyncPolicy() *serviceSyncPolicy {
+	return newServiceSyncPolicy(c.getServiceSyncPolicies())
+}
+
+// The remote sites known to service sync and the definitions rejected
+// from them are guarded by serviceSyncLock, which must be held when
+// calling the functions below that access them, other than
+// getServiceSyncRejections.
+
+// Records the name a remote site reported along with its id
+func (c *Controller) setRemoteSiteName(siteId string, siteName string) {
+	c.siteNames[siteId] = siteName
+}
+
+func (c *Controller) getRemoteSiteName(siteId string) string {
+	return c.siteNames[siteId]
+}
+
+// Returns the ids of the remote sites known to service sync
+func (c *Controller) getRemoteSites() []string {
+	sites := []string{}
+	for siteId := range c.siteNames {
+		sites = append(sites, siteId)
+	}
+	sort.Strings(sites)
+	return sites
+}
+
+func (c *Controller) forgetRemoteSite(siteId string) {
+	delete(c.siteNames, siteId)
+	if _, ok := c.rejected[siteId]; ok {
+		delete(c.rejected, siteId)
+		c.requestRejectionsUpdate()
+	}
+}
+
+// Removes the definitions the policy does not allow a remote site to
+// define in this site, recording those rejected
+func (c *Controller) filterServiceSyncImports(origin string, defs map[string]types.ServiceInterface) map[string]types.ServiceInterface {
+	policy := c.getServiceSyncPolicy()
+	allowed := map[string]types.ServiceInterface{}
+	rejected := []string{}
+	for address, def := range defs {
+		if policy.allowsImport(origin, address) {
+			allowed[address] = def
+		} else {
+			rejected = append(rejected, address)
+		}
+	}
+	sort.Strings(rejected)
+
+	if previous := c.rejected[origin]; !reflect.DeepEqual(previous, rejected) && (len(previous) > 0 || len(rejected) > 0) {
+		if len(rejected) > 0 {
+			log.Printf("Service sync policy rejected definitions from %s: %v", origin, rejected)
+			c.rejected[origin] = rejected
+		} else {
+			delete(c.rejected, origin)
+		}
+		c.requestRejectionsUpdate()
+	}
+	return allowed
+}
+
+func (c *Controller) requestRejectionsUpdate() {
+	if c.serviceSyncPolicyInformer != nil {
+		c.events.Add(rejectionsEventKey)
+	}
+}
+
+func (c *Controller) getServiceSyncRejections() []v1alpha1.ServiceSyncRejection {
+	c.serviceSyncLock.Lock()
+	defer c.serviceSyncLock.Unlock()
+	rejections := []v1alpha1.ServiceSyncRejection{}
+	for siteId, addresses := range c.rejected {
+		for _, address := range addresses {
+			rejections = append(rejections, v1alpha1.ServiceSyncRejection{
+				Site:     siteId,
+				SiteName: c.siteNames[siteId],
+				Address:  address,
+			})
+		}
+	}
+	sort.Slice(rejections, func(i, j int) bool {
+		return rejections[i].Site < rejections[j].Site ||
+			(rejections[i].Site == rejections[j].Site && rejections[i].Address < rejections[j].Address)
+	})
+	return rejections
+}
+
+// Updates the status of each ServiceSyncPolicy resource with its
+// validity and the definitions rejected under the combined policy
+func (c *Controller) reconcileServiceSyncPolicies() error {
+	rejections := c.getServiceSyncRejections()
+	if len(rejections) == 0 {
+		rejections = nil
+	}
+	for _, resource := range c.getServiceSyncPolicies() {
+		status := v1alpha1.ServiceSyncPolicyStatus{
+			Status:   v1alpha1.StatusReady,
+			Rejected: rejections,
+		}
+		if err := validateServiceSyncPolicy(&resource.Spec); err != nil {
+			status.Status = v1alpha1.StatusError
+			status.Message = err.Error()
+		}
+		if reflect.DeepEqual(resource.Status, status) {
+			continue
+		}
+		resource.Status = status
+		if err := kube.UpdateResourceStatus(v1alpha1.ServiceSyncPolicyResource, resource, c.vanClient.Namespace, c.vanClient.DynamicClient); err != nil {
+			log.Println(err)
+		}
+	}
+	return nil
+}
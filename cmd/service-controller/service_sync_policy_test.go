@@ -0,0 +1,190 @@
+package main
+
+import (
+	jsonencoding "encoding/json"
+	"testing"
+
+	amqp "github.com/interconnectedcloud/go-amqp"
+	"gotest.tools/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/api/v1alpha1"
+)
+
+func TestServiceSyncPolicy(t *testing.T) {
+	policy := newServiceSyncPolicy(nil)
+	assert.Assert(t, policy.allowsImport("site-b", "db"))
+	assert.Assert(t, policy.allowsExport("site-b", "db"))
+	assert.Assert(t, policy.exportsToAll("db"))
+
+	policy = newServiceSyncPolicy([]*v1alpha1.ServiceSyncPolicy{
+		{
+			Spec: v1alpha1.ServiceSyncPolicySpec{
+				Imports: []v1alpha1.ServiceSyncRule{
+					{Sites: []string{"east-*"}, Addresses: []string{"db-*", "cache"}},
+				},
+			},
+		},
+		{
+			Spec: v1alpha1.ServiceSyncPolicySpec{
+				Imports: []v1alpha1.ServiceSyncRule{
+					{Sites: []string{"site-c"}},
+				},
+				Exports: []v1alpha1.ServiceSyncRule{
+					{Addresses: []string{"frontend"}},
+					{Sites: []string{"east-1", "site-d"}, Addresses: []string{"backend"}},
+				},
+			},
+		},
+	})
+	assert.Assert(t, policy.allowsImport("east-1", "db-primary"))
+	assert.Assert(t, policy.allowsImport("east-2", "cache"))
+	assert.Assert(t, !policy.allowsImport("east-1", "frontend"))
+	assert.Assert(t, !policy.allowsImport("west-1", "db-primary"))
+	assert.Assert(t, policy.allowsImport("site-c", "frontend"))
+
+	assert.Assert(t, policy.allowsExport("west-1", "frontend"))
+	assert.Assert(t, !policy.allowsExport("west-1", "backend"))
+	assert.Assert(t, policy.allowsExport("east-1", "backend"))
+	assert.Assert(t, policy.allowsExport("site-d", "backend"))
+	assert.Assert(t, !policy.allowsExport("site-d", "db"))
+	assert.Assert(t, policy.exportsToAll("frontend"))
+	assert.Assert(t, !policy.exportsToAll("backend"))
+
+	assert.Assert(t, validateServiceSyncPolicy(&v1alpha1.ServiceSyncPolicySpec{
+		Exports: []v1alpha1.ServiceSyncRule{{Sites: []string{"*"}, Addresses: []string{"db-[0-9]"}}},
+	}))
+	assert.ErrorContains(t, validateServiceSyncPolicy(&v1alpha1.ServiceSyncPolicySpec{
+		Imports: []v1alpha1.ServiceSyncRule{{Addresses: []string{"db-["}}},
+	}), `Invalid pattern "db-["`)
+}
+
+func newServiceSyncPolicyTestController(origin string, policies ...*v1alpha1.ServiceSyncPolicy) *Controller {
+	c := newServiceSyncTestController(origin)
+	objects := []runtime.Object{}
+	for _, policy := range policies {
+		policy.TypeMeta = metav1.TypeMeta{APIVersion: v1alpha1.SchemeGroupVersion.String(), Kind: v1alpha1.ServiceSyncPolicyKind}
+		policy.ObjectMeta.Namespace = c.vanClient.Namespace
+		u, _ := v1alpha1.ToUnstructured(policy)
+		objects = append(objects, u)
+	}
+	c.vanClient.DynamicClient = dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objects...)
+	c.serviceSyncPolicyInformer = newServiceSyncPolicyInformer(c.vanClient)
+	for _, obj := range objects {
+		c.serviceSyncPolicyInformer.GetStore().Add(obj)
+	}
+	c.events = workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "test")
+	return c
+}
+
+func newServiceSyncUpdate(subject string, origin string, properties map[string]interface{}, services ...types.ServiceInterface) *amqp.Message {
+	encoded, _ := jsonencoding.Marshal(services)
+	msg := &amqp.Message{
+		Properties:            &amqp.MessageProperties{Subject: subject},
+		ApplicationProperties: map[string]interface{}{"origin": origin, "version": uint64(1)},
+		Value:                 string(encoded),
+	}
+	for key, value := range properties {
+		msg.ApplicationProperties[key] = value
+	}
+	return msg
+}
+
+func TestServiceSyncPolicyImports(t *testing.T) {
+	c := newServiceSyncPolicyTestController("site-a", &v1alpha1.ServiceSyncPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "imports"},
+		Spec: v1alpha1.ServiceSyncPolicySpec{
+			Imports: []v1alpha1.ServiceSyncRule{{Sites: []string{"site-b"}, Addresses: []string{"db"}}},
+		},
+	})
+	defer c.events.ShutDown()
+	db := types.ServiceInterface{Address: "db", Protocol: "tcp", Port: 5432}
+	cache := types.ServiceInterface{Address: "cache", Protocol: "tcp", Port: 6379}
+
+	c.receiveServiceSyncUpdate(newServiceSyncUpdate("service-sync-update", "site-b", map[string]interface{}{"origin-name": "east"}, db, cache))
+	services, err := c.vanClient.KubeClient.CoreV1().ConfigMaps("test").Get("skupper-services", metav1.GetOptions{})
+	assert.Assert(t, err)
+	_, ok := services.Data["cache"]
+	assert.Assert(t, !ok)
+	assert.DeepEqual(t, c.getServiceSyncRejections(), []v1alpha1.ServiceSyncRejection{{Site: "site-b", SiteName: "east", Address: "cache"}})
+	assert.Equal(t, c.events.Len(), 1)
+	assert.Assert(t, c.reconcileServiceSyncPolicies())
+	obj, err := c.vanClient.DynamicClient.Resource(v1alpha1.ServiceSyncPolicyResource).Namespace("test").Get("imports", metav1.GetOptions{})
+	assert.Assert(t, err)
+	policy := &v1alpha1.ServiceSyncPolicy{}
+	assert.Assert(t, v1alpha1.FromUnstructured(obj, policy))
+	assert.Equal(t, policy.Status.Status, v1alpha1.StatusReady)
+	assert.Equal(t, len(policy.Status.Rejected), 1)
+
+	// updates for other sites are ignored
+	c.receiveServiceSyncUpdate(newServiceSyncUpdate(siteServiceSyncUpdate, "site-c", map[string]interface{}{"site": "site-d"}, cache))
+	c.receiveServiceSyncUpdate(newServiceSyncUpdate("service-sync-update", "site-c", map[string]interface{}{"targeted": "site-d,site-a"}, cache))
+	_, ok = c.siteNames["site-c"]
+	assert.Assert(t, !ok)
+
+	// a site that no longer sends a definition has it no longer rejected
+	c.receiveServiceSyncUpdate(newServiceSyncUpdate(siteServiceSyncUpdate, "site-b", map[string]interface{}{"origin-name": "east", "site": "site-a"}, db))
+	assert.Equal(t, len(c.getServiceSyncRejections()), 0)
+	c.forgetRemoteSite("site-b")
+	assert.Equal(t, len(c.getRemoteSites()), 0)
+
+	// sites are matched by id, not by the name they report
+	c.receiveServiceSyncUpdate(newServiceSyncUpdate("service-sync-update", "site-e", map[string]interface{}{"origin-name": "site-b"}, db))
+	assert.DeepEqual(t, c.getServiceSyncRejections(), []v1alpha1.ServiceSyncRejection{{Site: "site-e", SiteName: "site-b", Address: "db"}})
+}
+
+func TestServiceSyncPolicyExports(t *testing.T) {
+	c := newServiceSyncPolicyTestController("site-a", &v1alpha1.ServiceSyncPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "exports"},
+		Spec: v1alpha1.ServiceSyncPolicySpec{
+			Exports: []v1alpha1.ServiceSyncRule{
+				{Addresses: []string{"frontend"}},
+				{Sites: []string{"site-b"}, Addresses: []string{"backend"}},
+			},
+		},
+	})
+	defer c.events.ShutDown()
+	c.siteName = "central"
+	c.localServices = map[string]types.ServiceInterface{
+		"frontend": {Address: "frontend", Protocol: "http", Port: 8080},
+		"backend":  {Address: "backend", Protocol: "tcp", Port: 9090},
+		"db":       {Address: "db", Protocol: "tcp", Port: 5432},
+	}
+	c.setRemoteSiteName("site-b", "east")
+	c.setRemoteSiteName("site-c", "west")
+
+	addresses := func(msg *amqp.Message) []string {
+		services := []types.ServiceInterface{}
+		assert.Assert(t, jsonencoding.Unmarshal([]byte(msg.Value.(string)), &services))
+		result := []string{}
+		for _, service := range services {
+			result = append(result, service.Address)
+		}
+		return result
+	}
+	updates, err := c.getServiceSyncUpdates()
+	assert.Assert(t, err)
+	assert.Equal(t, len(updates), 2)
+	assert.Equal(t, updates[0].Properties.Subject, "service-sync-update")
+	assert.Equal(t, updates[0].ApplicationProperties["origin-name"], "central")
+	assert.Equal(t, updates[0].ApplicationProperties["targeted"], "site-b")
+	assert.DeepEqual(t, addresses(updates[0]), []string{"frontend"})
+	assert.Equal(t, updates[1].Properties.Subject, siteServiceSyncUpdate)
+	assert.Equal(t, updates[1].ApplicationProperties["site"], "site-b")
+	assert.Equal(t, updates[1].Properties.To, getServiceSyncSiteAddress("site-b"))
+	assert.DeepEqual(t, addresses(updates[1]), []string{"backend", "frontend"})
+
+	// without a policy, all services are sent in a single update
+	c.serviceSyncPolicyInformer = nil
+	updates, err = c.getServiceSyncUpdates()
+	assert.Assert(t, err)
+	assert.Equal(t, len(updates), 1)
+	_, ok := updates[0].ApplicationProperties["targeted"]
+	assert.Assert(t, !ok)
+	assert.Equal(t, updates[0].Properties.To, "")
+	assert.DeepEqual(t, addresses(updates[0]), []string{"backend", "db", "frontend"})
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/interconnectedcloud/go-amqp"
+	"gotest.tools/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/client"
+)
+
+func newServiceSyncTestController(origin string) *Controller {
+	return &Controller{
+		origin: origin,
+		vanClient: &client.VanClient{
+			Namespace: "test",
+			KubeClient: fake.NewSimpleClientset(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "skupper-services",
+					Namespace: "test",
+				},
+				Data: map[string]string{
+					"db": `{"address":"db","protocol":"tcp","port":5432,"origin":"site-b"}`,
+				},
+			}),
+		},
+		byOrigin:   map[string]map[string]types.ServiceInterface{},
+		heardFrom:  map[string]time.Time{},
+		versions:   map[string]uint64{},
+		sendLocal:  make(chan bool, 1),
+		syncAgeOut: time.Minute,
+		siteNames:  map[string]string{},
+		rejected:   map[string][]string{},
+	}
+}
+
+func TestServiceSyncStatePersistence(t *testing.T) {
+	c := newServiceSyncTestController("site-a")
+	heard := time.Now().Add(-time.Second).Round(time.Second)
+	c.heardFrom["site-b"] = heard
+	c.versions["site-b"] = 7
+	c.localVersion = 3
+	c.saveServiceSyncState()
+
+	restarted := newServiceSyncTestController("site-a")
+	restarted.vanClient = c.vanClient
+	restarted.loadServiceSyncState()
+	assert.Equal(t, restarted.localVersion, uint64(3))
+	assert.Equal(t, restarted.versions["site-b"], uint64(7))
+	assert.Assert(t, restarted.heardFrom["site-b"].Equal(heard))
+
+	assert.Assert(t, !restarted.updateServiceSyncVersion("site-b", 7))
+	assert.Assert(t, restarted.updateServiceSyncVersion("site-b", 8))
+	assert.Assert(t, restarted.updateServiceSyncVersion("site-c", 0))
+	assert.Assert(t, !restarted.updateServiceSyncVersion("site-c", 0))
+}
+
+func TestServiceSyncAgeOut(t *testing.T) {
+	c := newServiceSyncTestController("site-a")
+	now := time.Now()
+	c.byOrigin["site-b"] = map[string]types.ServiceInterface{
+		"db": types.ServiceInterface{Address: "db", Origin: "site-b"},
+	}
+	c.byOrigin["site-c"] = map[string]types.ServiceInterface{}
+	c.heardFrom["site-b"] = now.Add(-2 * time.Minute)
+	c.versions["site-b"] = 1
+
+	// site-c has no record of when it was last heard from, so its
+	// age is counted from now
+	assert.DeepEqual(t, c.ageOutServiceDefinitions(now), []string{"site-b"})
+	_, ok := c.byOrigin["site-b"]
+	assert.Assert(t, !ok)
+	_, ok = c.versions["site-b"]
+	assert.Assert(t, !ok)
+	assert.Assert(t, c.heardFrom["site-c"].Equal(now))
+	services, err := c.vanClient.KubeClient.CoreV1().ConfigMaps("test").Get("skupper-services", metav1.GetOptions{})
+	assert.Assert(t, err)
+	_, ok = services.Data["db"]
+	assert.Assert(t, !ok)
+
+	assert.Equal(t, len(c.ageOutServiceDefinitions(now.Add(30*time.Second))), 0)
+	assert.DeepEqual(t, c.ageOutServiceDefinitions(now.Add(time.Minute)), []string{"site-c"})
+}
+
+func TestRequestServiceSyncUpdate(t *testing.T) {
+	c := newServiceSyncTestController("site-a")
+	// requests are coalesced until the sender handles them
+	c.requestServiceSyncUpdate()
+	c.requestServiceSyncUpdate()
+	assert.Equal(t, len(c.sendLocal), 1)
+}
+
+func newServiceSyncTestUpdate(origin string, version uint64, services string) *amqp.Message {
+	return &amqp.Message{
+		Properties: &amqp.MessageProperties{Subject: "service-sync-update"},
+		ApplicationProperties: map[string]interface{}{
+			"origin":      origin,
+			"origin-name": origin + "-name",
+			"version":     version,
+		},
+		Value: services,
+	}
+}
+
+// The receiver, the sender and the controller all update the service
+// sync state, so this is run with -race
+func TestServiceSyncConcurrentUpdates(t *testing.T) {
+	c := newServiceSyncTestController("site-a")
+	c.syncAgeOut = time.Millisecond
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		// receiver
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			c.receiveServiceSyncUpdate(newServiceSyncTestUpdate("site-b", uint64(i), `[{"address":"web","protocol":"http","port":8080}]`))
+			c.receiveServiceSyncUpdate(newServiceSyncTestUpdate("site-c", uint64(i), `[]`))
+		}
+	}()
+	go func() {
+		// sender
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			_, err := c.getServiceSyncUpdates()
+			assert.Assert(t, err)
+			c.ageOutServiceDefinitions(time.Now())
+			c.saveServiceSyncState()
+		}
+	}()
+	go func() {
+		// controller
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			c.serviceSyncDefinitionsUpdated(map[string]types.ServiceInterface{
+				"db": types.ServiceInterface{Address: "db", Protocol: "tcp", Port: 5432 + i},
+			})
+		}
+	}()
+	wg.Wait()
+
+	updates, err := c.getServiceSyncUpdates()
+	assert.Assert(t, err)
+	assert.Equal(t, len(updates), 1)
+	assert.Equal(t, updates[0].ApplicationProperties["version"], uint64(50))
+}
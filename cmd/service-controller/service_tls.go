@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/kube"
+	"github.com/skupperproject/skupper/pkg/qdr"
+)
+
+// sslProfiles and volumes created for service tls are all named
+// with this prefix, so that they can be distinguished from those
+// managed elsewhere (e.g. for site connections)
+const ServiceTlsPrefix string = "skupper-tls-"
+
+func getServiceTlsVolumeName(secret string) string {
+	return ServiceTlsPrefix + secret
+}
+
+func getServiceTlsPath(secret string) string {
+	return "/etc/qpid-dispatch-certs/" + getServiceTlsVolumeName(secret) + "/"
+}
+
+func getServiceTlsCredentialsProfile(secret string) qdr.SslProfile {
+	return qdr.SslProfile{
+		Name:           getServiceTlsVolumeName(secret) + "-credentials",
+		CertFile:       getServiceTlsPath(secret) + "tls.crt",
+		PrivateKeyFile: getServiceTlsPath(secret) + "tls.key",
+	}
+}
+
+func getServiceTlsCaProfile(secret string) qdr.SslProfile {
+	return qdr.SslProfile{
+		Name:       getServiceTlsVolumeName(secret) + "-ca",
+		CaCertFile: getServiceTlsPath(secret) + "ca.crt",
+	}
+}
+
+// Returns true for the sslProfiles created for service tls, which are
+// hot-applied to the running router by the config sync
+func isServiceTlsSslProfile(name string) bool {
+	return strings.HasPrefix(name, ServiceTlsPrefix) && (strings.HasSuffix(name, "-credentials") || strings.HasSuffix(name, "-ca"))
+}
+
+// Returns the sslProfiles for service tls in the profiles given
+func getServiceTlsSslProfiles(profiles map[string]qdr.SslProfile) map[string]qdr.SslProfile {
+	result := map[string]qdr.SslProfile{}
+	for name, profile := range profiles {
+		if isServiceTlsSslProfile(name) {
+			result[name] = profile
+		}
+	}
+	return result
+}
+
+func getIngressSslProfile(tls *types.ServiceInterfaceTls) string {
+	if tls == nil || tls.Credentials == "" {
+		return ""
+	}
+	return getServiceTlsCredentialsProfile(tls.Credentials).Name
+}
+
+func getEgressSslProfile(tls *types.ServiceInterfaceTls) string {
+	if tls == nil || tls.CaCertificate == "" {
+		return ""
+	}
+	return getServiceTlsCaProfile(tls.CaCertificate).Name
+}
+
+func requiredSslProfiles(services map[string]*ServiceBindings) map[string]qdr.SslProfile {
+	profiles := map[string]qdr.SslProfile{}
+	for _, service := range services {
+		if service.tls == nil || service.headless != nil {
+			continue
+		}
+		if service.tls.Credentials != "" {
+			profile := getServiceTlsCredentialsProfile(service.tls.Credentials)
+			profiles[profile.Name] = profile
+		}
+		if service.tls.CaCertificate != "" {
+			profile := getServiceTlsCaProfile(service.tls.CaCertificate)
+			profiles[profile.Name] = profile
+		}
+	}
+	return profiles
+}
+
+func requiredTlsSecrets(services map[string]*ServiceBindings) []string {
+	secrets := map[string]bool{}
+	for _, service := range services {
+		if service.tls == nil || service.headless != nil {
+			continue
+		}
+		if service.tls.Credentials != "" {
+			secrets[service.tls.Credentials] = true
+		}
+		if service.tls.CaCertificate != "" {
+			secrets[service.tls.CaCertificate] = true
+		}
+	}
+	result := []string{}
+	for secret := range secrets {
+		result = append(result, secret)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func updateServiceSslProfiles(config *qdr.RouterConfig, required map[string]qdr.SslProfile) {
+	for name := range config.SslProfiles {
+		if _, ok := required[name]; !ok && isServiceTlsSslProfile(name) {
+			config.RemoveSslProfile(name)
+		}
+	}
+	for _, profile := range required {
+		config.AddSslProfile(profile)
+	}
+}
+
+func updateServiceTlsVolumes(deployment *appsv1.Deployment, secrets []string) bool {
+	required := map[string]string{}
+	for _, secret := range secrets {
+		required[getServiceTlsVolumeName(secret)] = secret
+	}
+	updated := false
+	for _, v := range deployment.Spec.Template.Spec.Volumes {
+		if !strings.HasPrefix(v.Name, ServiceTlsPrefix) {
+			continue
+		}
+		if _, ok := required[v.Name]; ok {
+			delete(required, v.Name)
+		} else {
+			kube.RemoveSecretVolumeForDeployment(v.Name, deployment, 0)
+			updated = true
+		}
+	}
+	for _, secret := range secrets {
+		name := getServiceTlsVolumeName(secret)
+		if _, ok := required[name]; ok {
+			kube.AppendNamedSecretVolume(&deployment.Spec.Template.Spec.Volumes, &deployment.Spec.Template.Spec.Containers[0].VolumeMounts, name, secret, getServiceTlsPath(secret))
+			updated = true
+		}
+	}
+	return updated
+}
+
+// The router deployment is read from the informer cache, so that it
+// is only updated, and the router restarted, when a secret must be
+// mounted or is no longer needed. The sslProfiles for secrets already
+// mounted are applied to the running router by the config sync.
+func (c *Controller) updateTlsSecretVolumes() error {
+	name := c.namespaced(types.TransportDeploymentName)
+	obj, exists, err := c.routerInformer.GetStore().GetByKey(name)
+	if err != nil {
+		return fmt.Errorf("Error reading router deployment from cache: %s", err)
+	} else if !exists {
+		return fmt.Errorf("Router deployment %s not found", name)
+	}
+	cached, ok := obj.(*appsv1.Deployment)
+	if !ok {
+		return fmt.Errorf("Expected Deployment for %s but got %#v", name, obj)
+	}
+	deployment := cached.DeepCopy()
+	if updateServiceTlsVolumes(deployment, requiredTlsSecrets(c.bindings)) {
+		log.Printf("Updating secrets mounted for service tls in %s", deployment.ObjectMeta.Name)
+		_, err = c.vanClient.KubeClient.AppsV1().Deployments(c.vanClient.Namespace).Update(deployment)
+		if err != nil {
+			return fmt.Errorf("Failed to update %s: %s", deployment.ObjectMeta.Name, err)
+		}
+	}
+	return nil
+}
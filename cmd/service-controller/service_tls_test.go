@@ -0,0 +1,140 @@
+package main
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/client"
+	"github.com/skupperproject/skupper/pkg/qdr"
+)
+
+func TestServiceTlsBridges(t *testing.T) {
+	sb := newServiceBindings("", "tcp", "db", 5432, nil, 1024, "", false, &types.ServiceInterfaceTls{
+		Credentials:   "db-server",
+		CaCertificate: "db-ca",
+	})
+	bridges := newBridgeConfiguration()
+	_, err := addIngressBridge(sb, "site-a", bridges)
+	assert.Assert(t, err)
+	assert.Equal(t, bridges.TcpListeners["db"].SslProfile, "skupper-tls-db-server-credentials")
+
+	_, err = addEgressBridge("tcp", "10.0.0.1", 5432, "db", "db", "site-a", "", getEgressSslProfile(sb.tls), false, bridges)
+	assert.Assert(t, err)
+	_, err = addEgressBridge("tcp", "db-svc", 5432, "db", "db", "site-a", "db-svc", getEgressSslProfile(sb.tls), true, bridges)
+	assert.Assert(t, err)
+	byIp := bridges.TcpConnectors["db@10.0.0.1"]
+	assert.Equal(t, byIp.SslProfile, "skupper-tls-db-ca-ca")
+	assert.Assert(t, byIp.VerifyHostname != nil && !*byIp.VerifyHostname)
+	byService := bridges.TcpConnectors["db@db-svc"]
+	assert.Equal(t, byService.SslProfile, "skupper-tls-db-ca-ca")
+	assert.Assert(t, byService.VerifyHostname != nil && *byService.VerifyHostname)
+
+	_, err = addEgressBridge("http", "10.0.0.2", 8080, "web", "web", "site-a", "", "", false, bridges)
+	assert.Assert(t, err)
+	assert.Equal(t, bridges.HttpConnectors["web@10.0.0.2"].SslProfile, "")
+	assert.Assert(t, bridges.HttpConnectors["web@10.0.0.2"].VerifyHostname == nil)
+}
+
+func TestServiceTlsProfiles(t *testing.T) {
+	services := map[string]*ServiceBindings{
+		"db":  newServiceBindings("", "tcp", "db", 5432, nil, 1024, "", false, &types.ServiceInterfaceTls{Credentials: "db-server", CaCertificate: "shared-ca"}),
+		"web": newServiceBindings("", "http", "web", 8080, nil, 1025, "", false, &types.ServiceInterfaceTls{CaCertificate: "shared-ca"}),
+		"foo": newServiceBindings("", "tcp", "foo", 9090, nil, 1026, "", false, nil),
+	}
+	config := qdr.InitialConfig("router", "site-a", false)
+	config.AddSslProfile(qdr.SslProfile{Name: types.InterRouterProfile})
+	config.AddSslProfile(qdr.SslProfile{Name: "skupper-tls-stale-ca"})
+
+	updateServiceSslProfiles(&config, requiredSslProfiles(services))
+	assert.Equal(t, len(config.SslProfiles), 3)
+	_, ok := config.SslProfiles[types.InterRouterProfile]
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, config.SslProfiles["skupper-tls-db-server-credentials"], qdr.SslProfile{
+		Name:           "skupper-tls-db-server-credentials",
+		CertFile:       "/etc/qpid-dispatch-certs/skupper-tls-db-server/tls.crt",
+		PrivateKeyFile: "/etc/qpid-dispatch-certs/skupper-tls-db-server/tls.key",
+	})
+	assert.DeepEqual(t, config.SslProfiles["skupper-tls-shared-ca-ca"], qdr.SslProfile{
+		Name:       "skupper-tls-shared-ca-ca",
+		CaCertFile: "/etc/qpid-dispatch-certs/skupper-tls-shared-ca/ca.crt",
+	})
+	assert.DeepEqual(t, requiredTlsSecrets(services), []string{"db-server", "shared-ca"})
+}
+
+func TestServiceTlsVolumes(t *testing.T) {
+	deployment := &appsv1.Deployment{}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{Name: "router"}}
+	deployment.Spec.Template.Spec.Volumes = []corev1.Volume{{Name: "skupper-amqps"}, {Name: "skupper-tls-old"}}
+	deployment.Spec.Template.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{{Name: "skupper-amqps"}, {Name: "skupper-tls-old"}}
+
+	assert.Assert(t, updateServiceTlsVolumes(deployment, []string{"db-server"}))
+	volumes := deployment.Spec.Template.Spec.Volumes
+	assert.Equal(t, len(volumes), 2)
+	assert.Equal(t, volumes[0].Name, "skupper-amqps")
+	assert.Equal(t, volumes[1].Name, "skupper-tls-db-server")
+	assert.Equal(t, volumes[1].Secret.SecretName, "db-server")
+	mounts := deployment.Spec.Template.Spec.Containers[0].VolumeMounts
+	assert.Equal(t, len(mounts), 2)
+	assert.Equal(t, mounts[1].MountPath, "/etc/qpid-dispatch-certs/skupper-tls-db-server/")
+
+	assert.Assert(t, !updateServiceTlsVolumes(deployment, []string{"db-server"}))
+}
+
+func TestServiceTlsSslProfilesForSync(t *testing.T) {
+	profiles := map[string]qdr.SslProfile{
+		types.InterRouterProfile:            {Name: types.InterRouterProfile},
+		"skupper-tls-db-server-credentials": {Name: "skupper-tls-db-server-credentials"},
+		"skupper-tls-shared-ca-ca":          {Name: "skupper-tls-shared-ca-ca"},
+		// the sslProfile of a link to a site named skupper-tls-east
+		"skupper-tls-east-profile": {Name: "skupper-tls-east-profile"},
+	}
+	synced := getServiceTlsSslProfiles(profiles)
+	assert.Equal(t, len(synced), 2)
+	_, ok := synced["skupper-tls-db-server-credentials"]
+	assert.Assert(t, ok)
+	_, ok = synced["skupper-tls-shared-ca-ca"]
+	assert.Assert(t, ok)
+}
+
+func TestUpdateTlsSecretVolumesFromCache(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      types.TransportDeploymentName,
+			Namespace: "test",
+		},
+	}
+	deployment.Spec.Template.Spec.Containers = []corev1.Container{{Name: "router"}}
+	kubeClient := fake.NewSimpleClientset(deployment)
+	routerInformer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &appsv1.Deployment{}, 0, cache.Indexers{})
+	routerInformer.GetStore().Add(deployment.DeepCopy())
+	c := &Controller{
+		vanClient: &client.VanClient{
+			Namespace:  "test",
+			KubeClient: kubeClient,
+		},
+		routerInformer: routerInformer,
+		bindings: map[string]*ServiceBindings{
+			"db": newServiceBindings("", "tcp", "db", 5432, nil, 1024, "", false, &types.ServiceInterfaceTls{Credentials: "db-server"}),
+		},
+	}
+	assert.Assert(t, c.updateTlsSecretVolumes())
+	updated, err := kubeClient.AppsV1().Deployments("test").Get(types.TransportDeploymentName, metav1.GetOptions{})
+	assert.Assert(t, err)
+	assert.Equal(t, len(updated.Spec.Template.Spec.Volumes), 1)
+	// the cached deployment is not modified
+	cached, _, _ := routerInformer.GetStore().GetByKey("test/" + types.TransportDeploymentName)
+	assert.Equal(t, len(cached.(*appsv1.Deployment).Spec.Template.Spec.Volumes), 0)
+
+	// no update is made once the cache has the volume
+	routerInformer.GetStore().Update(updated)
+	kubeClient.ClearActions()
+	assert.Assert(t, c.updateTlsSecretVolumes())
+	assert.Equal(t, len(kubeClient.Actions()), 0)
+}
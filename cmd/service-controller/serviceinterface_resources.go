@@ -0,0 +1,166 @@
+package main
+
+import (
+	jsonencoding "encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/api/v1alpha1"
+	"github.com/skupperproject/skupper/client"
+	"github.com/skupperproject/skupper/pkg/kube"
+)
+
+// The origin recorded for definitions taken from ServiceInterface
+// resources; like those from annotations, these are local services
+const resourceOrigin = "resource"
+
+func isLocalOrigin(origin string) bool {
+	return origin == "" || origin == "annotation" || origin == resourceOrigin
+}
+
+func newServiceInterfaceInformer(cli *client.VanClient) cache.SharedIndexInformer {
+	return dynamicinformer.NewFilteredDynamicInformer(
+		cli.DynamicClient,
+		v1alpha1.ServiceInterfaceResource,
+		cli.Namespace,
+		time.Second*30,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		nil).Informer()
+}
+
+func UnstructuredResourceVersionTest(a interface{}, b interface{}) bool {
+	aa := a.(*unstructured.Unstructured)
+	bb := b.(*unstructured.Unstructured)
+	return aa.GetResourceVersion() == bb.GetResourceVersion()
+}
+
+// Determines the changes needed to bring the service definitions in
+// line with the resources, along with the status of each resource
+// other than its target counts. Definitions that came from resources
+// that no longer exist are deleted; those from annotations are left
+// in place.
+func getServiceInterfaceResourceChanges(resources []*v1alpha1.ServiceInterface, current map[string]types.ServiceInterface) ([]types.ServiceInterface, []string, map[string]*v1alpha1.ServiceInterfaceStatus) {
+	changed := []types.ServiceInterface{}
+	deleted := []string{}
+	statuses := map[string]*v1alpha1.ServiceInterfaceStatus{}
+	claimed := map[string]string{}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].ObjectMeta.CreationTimestamp.Before(&resources[j].ObjectMeta.CreationTimestamp) ||
+			(resources[i].ObjectMeta.CreationTimestamp.Equal(&resources[j].ObjectMeta.CreationTimestamp) && resources[i].ObjectMeta.Name < resources[j].ObjectMeta.Name)
+	})
+	for _, resource := range resources {
+		status := &v1alpha1.ServiceInterfaceStatus{Status: v1alpha1.StatusReady}
+		statuses[resource.ObjectMeta.Name] = status
+		desired := resource.GetServiceInterface()
+		desired.Origin = resourceOrigin
+		if err := client.ValidateServiceInterface(&desired); err != nil {
+			status.Status = v1alpha1.StatusError
+			status.Message = err.Error()
+			continue
+		}
+		if other, ok := claimed[desired.Address]; ok {
+			status.Status = v1alpha1.StatusError
+			status.Message = fmt.Sprintf("Address %s is already defined by %s", desired.Address, other)
+			continue
+		}
+		actual, ok := current[desired.Address]
+		if ok && actual.Origin == "annotation" {
+			status.Status = v1alpha1.StatusError
+			status.Message = fmt.Sprintf("Address %s is already defined through an annotation", desired.Address)
+			continue
+		}
+		claimed[desired.Address] = resource.ObjectMeta.Name
+		if !ok || !reflect.DeepEqual(actual, desired) {
+			changed = append(changed, desired)
+		}
+	}
+	for address, def := range current {
+		if _, ok := claimed[address]; !ok && def.Origin == resourceOrigin {
+			deleted = append(deleted, address)
+		}
+	}
+	sort.Strings(deleted)
+	return changed, deleted, statuses
+}
+
+func (c *Controller) getServiceInterfaceResources() []*v1alpha1.ServiceInterface {
+	resources := []*v1alpha1.ServiceInterface{}
+	for _, obj := range c.serviceInterfaceInformer.GetStore().List() {
+		resource := &v1alpha1.ServiceInterface{}
+		if err := v1alpha1.FromUnstructured(obj, resource); err != nil {
+			log.Printf("Could not read ServiceInterface resource: %s", err)
+			continue
+		}
+		resources = append(resources, resource)
+	}
+	return resources
+}
+
+// Brings the service definitions in line with the ServiceInterface
+// resources and updates the status of each resource. This is run from
+// the event loop, as the target counts are read from the bindings.
+func (c *Controller) reconcileServiceInterfaceResources() error {
+	if c.serviceInterfaceInformer == nil {
+		return nil
+	}
+	obj, exists, err := c.svcDefInformer.GetStore().GetByKey(c.namespaced("skupper-services"))
+	if err != nil {
+		return fmt.Errorf("Error reading skupper-services from cache: %s", err)
+	} else if !exists {
+		return nil
+	}
+	cm, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return fmt.Errorf("Expected ConfigMap for skupper-services but got %#v", obj)
+	}
+	current := map[string]types.ServiceInterface{}
+	for _, v := range cm.Data {
+		si := types.ServiceInterface{}
+		if err := jsonencoding.Unmarshal([]byte(v), &si); err == nil {
+			current[si.Address] = si
+		}
+	}
+	resources := c.getServiceInterfaceResources()
+	changed, deleted, statuses := getServiceInterfaceResourceChanges(resources, current)
+	if len(changed) > 0 || len(deleted) > 0 {
+		log.Printf("Updating service definitions from resources, %d changed, %d deleted", len(changed), len(deleted))
+		if err = kube.UpdateSkupperServices(changed, deleted, resourceOrigin, c.vanClient.Namespace, c.vanClient.KubeClient); err != nil {
+			return err
+		}
+	}
+	for _, resource := range resources {
+		status := statuses[resource.ObjectMeta.Name]
+		if status.Status == v1alpha1.StatusReady {
+			if bindings, ok := c.bindings[resource.GetServiceInterface().Address]; ok {
+				status.Targets, status.Endpoints = bindings.getTargetCounts()
+			}
+		}
+		if reflect.DeepEqual(resource.Status, *status) {
+			continue
+		}
+		resource.Status = *status
+		if err = kube.UpdateResourceStatus(v1alpha1.ServiceInterfaceResource, resource, c.vanClient.Namespace, c.vanClient.DynamicClient); err != nil {
+			log.Println(err)
+		}
+	}
+	return nil
+}
+
+// Returns the number of targets bound for a service in this site,
+// along with the number of endpoints available for them
+func (sb *ServiceBindings) getTargetCounts() (int, int) {
+	endpoints := 0
+	for _, eb := range sb.targets {
+		endpoints += len(eb.getEndpoints())
+	}
+	return len(sb.targets), endpoints
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/api/v1alpha1"
+)
+
+func TestGetServiceInterfaceResourceChanges(t *testing.T) {
+	now := time.Now()
+	newResource := func(name string, created time.Time, spec v1alpha1.ServiceInterfaceSpec) *v1alpha1.ServiceInterface {
+		return &v1alpha1.ServiceInterface{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.Time{Time: created}},
+			Spec:       spec,
+		}
+	}
+	resources := []*v1alpha1.ServiceInterface{
+		newResource("unchanged", now, v1alpha1.ServiceInterfaceSpec{Protocol: "tcp", Port: 8080}),
+		newResource("modified", now, v1alpha1.ServiceInterfaceSpec{Protocol: "http", Port: 8080}),
+		newResource("added", now, v1alpha1.ServiceInterfaceSpec{Address: "new-service", Protocol: "tcp", Port: 9090}),
+		newResource("invalid", now, v1alpha1.ServiceInterfaceSpec{Protocol: "sctp", Port: 9090}),
+		newResource("duplicate", now.Add(time.Minute), v1alpha1.ServiceInterfaceSpec{Address: "new-service", Protocol: "tcp", Port: 9091}),
+		newResource("annotated", now, v1alpha1.ServiceInterfaceSpec{Protocol: "tcp", Port: 8080}),
+	}
+	current := map[string]types.ServiceInterface{
+		"unchanged": {Address: "unchanged", Protocol: "tcp", Port: 8080, Origin: resourceOrigin, Targets: []types.ServiceInterfaceTarget{}},
+		"modified":  {Address: "modified", Protocol: "tcp", Port: 8080, Origin: resourceOrigin, Targets: []types.ServiceInterfaceTarget{}},
+		"annotated": {Address: "annotated", Protocol: "tcp", Port: 8080, Origin: "annotation"},
+		"removed":   {Address: "removed", Protocol: "tcp", Port: 8080, Origin: resourceOrigin},
+		"created":   {Address: "created", Protocol: "tcp", Port: 8080},
+	}
+	changed, deleted, statuses := getServiceInterfaceResourceChanges(resources, current)
+	addresses := []string{}
+	for _, def := range changed {
+		assert.Equal(t, def.Origin, resourceOrigin)
+		addresses = append(addresses, def.Address)
+	}
+	assert.DeepEqual(t, addresses, []string{"new-service", "modified"})
+	assert.DeepEqual(t, deleted, []string{"removed"})
+	assert.Equal(t, statuses["unchanged"].Status, v1alpha1.StatusReady)
+	assert.Equal(t, statuses["added"].Status, v1alpha1.StatusReady)
+	assert.Equal(t, statuses["invalid"].Status, v1alpha1.StatusError)
+	assert.Equal(t, statuses["duplicate"].Status, v1alpha1.StatusError)
+	assert.Equal(t, statuses["duplicate"].Message, "Address new-service is already defined by added")
+	assert.Equal(t, statuses["annotated"].Status, v1alpha1.StatusError)
+}
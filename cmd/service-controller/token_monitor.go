@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/client"
+	"github.com/skupperproject/skupper/pkg/certs"
+	"github.com/skupperproject/skupper/pkg/kube"
+	"github.com/skupperproject/skupper/pkg/qdr"
+)
+
+// Tracks the use of the connection tokens issued by this site,
+// recording the sites that redeem them and closing any connection
+// made with a token that has been revoked, has expired or has no
+// remaining uses.
+type TokenMonitor struct {
+	vanClient *client.VanClient
+	agentPool *qdr.AgentPool
+	sites     map[string]string
+}
+
+func newTokenMonitor(cli *client.VanClient, config *tls.Config) *TokenMonitor {
+	return &TokenMonitor{
+		vanClient: cli,
+		agentPool: qdr.NewAgentPool("amqps://skupper-messaging:5671", config),
+		sites:     map[string]string{},
+	}
+}
+
+func (m *TokenMonitor) start(stopCh <-chan struct{}) {
+	go wait.Until(m.run, 10*time.Second, stopCh)
+}
+
+func (m *TokenMonitor) run() {
+	if err := m.checkConnections(); err != nil {
+		log.Printf("[token_monitor] Failed to check connections: %s", err)
+	}
+}
+
+func isTokenConnection(c qdr.Connection) bool {
+	return c.Dir == "in" && (c.Role == string(qdr.RoleInterRouter) || c.Role == string(qdr.RoleEdge))
+}
+
+// Determines which connections made using the specified tokens should
+// be closed, recording any new redemptions in the token records
+func checkTokenUse(connections []qdr.Connection, tokens map[string]*types.IssuedToken, siteFor func(qdr.Connection) string, now time.Time) ([]qdr.Connection, bool) {
+	bySerial := map[string]*types.IssuedToken{}
+	for _, token := range tokens {
+		bySerial[token.Serial] = token
+	}
+	rejected := []qdr.Connection{}
+	updated := false
+	for _, c := range connections {
+		if !isTokenConnection(c) {
+			continue
+		}
+		serial := certs.GetTokenSerialFromSubject(c.User)
+		if serial == "" {
+			// token predates tracking of use
+			continue
+		}
+		token, ok := bySerial[serial]
+		if !ok {
+			// token has been superseded by another of the same
+			// name, or has expired and its record been removed
+			rejected = append(rejected, c)
+			continue
+		}
+		accepted, recorded := token.Redeem(siteFor(c), now)
+		if recorded {
+			updated = true
+		}
+		if !accepted {
+			rejected = append(rejected, c)
+		}
+	}
+	return rejected, updated
+}
+
+func (m *TokenMonitor) getSiteIdFor(agent *qdr.Agent, c qdr.Connection) string {
+	if site, ok := m.sites[c.Container]; ok {
+		return site
+	}
+	site, err := agent.GetSiteIdFor(c.Container, c.Role == string(qdr.RoleEdge))
+	if err != nil || site == "" {
+		log.Printf("[token_monitor] Could not determine site for %s, using router id: %v", c.Container, err)
+		return c.Container
+	}
+	m.sites[c.Container] = site
+	return site
+}
+
+func (m *TokenMonitor) checkConnections() error {
+	_, tokens, err := kube.GetIssuedTokens(m.vanClient.Namespace, m.vanClient.KubeClient)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	agent, err := m.agentPool.Get()
+	if err != nil {
+		return fmt.Errorf("Could not get management agent: %s", err)
+	}
+	defer m.agentPool.Put(agent)
+	// each replica of a replicated router accepts its own connections
+	addresses, err := agent.GetLocalSiteAgents()
+	if err != nil {
+		return fmt.Errorf("Could not determine routers of site: %s", err)
+	}
+	connections := map[string][]qdr.Connection{}
+	for _, address := range addresses {
+		if connections[address], err = agent.GetConnectionsFor(address); err != nil {
+			return err
+		}
+	}
+	siteFor := func(c qdr.Connection) string {
+		return m.getSiteIdFor(agent, c)
+	}
+	var rejected map[string][]qdr.Connection
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, tokens, err := kube.GetIssuedTokens(m.vanClient.Namespace, m.vanClient.KubeClient)
+		if err != nil {
+			return err
+		}
+		if cm == nil {
+			return nil
+		}
+		rejected = map[string][]qdr.Connection{}
+		updated := false
+		now := time.Now()
+		for _, address := range addresses {
+			var recorded bool
+			rejected[address], recorded = checkTokenUse(connections[address], tokens, siteFor, now)
+			updated = updated || recorded
+		}
+		if !updated {
+			return nil
+		}
+		if err = kube.UpdateIssuedTokensConfigMap(cm, tokens); err != nil {
+			return err
+		}
+		_, err = m.vanClient.KubeClient.CoreV1().ConfigMaps(m.vanClient.Namespace).Update(cm)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to record token redemptions: %s", err)
+	}
+	// tokens that are revoked or expired are refused by the router;
+	// connections are closed here if they were established before
+	// that, or with a token that has no remaining uses or predates
+	// each token having its own CA
+	for address, closing := range rejected {
+		for _, c := range closing {
+			log.Printf("[token_monitor] Closing connection %s from %s, token is no longer valid (%s)", c.Name, c.Container, c.User)
+			if err := agent.CloseConnectionFor(address, c.Name); err != nil {
+				log.Printf("[token_monitor] Failed to close connection %s: %s", c.Name, err)
+			}
+		}
+	}
+	return nil
+}
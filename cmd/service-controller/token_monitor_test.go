@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/qdr"
+)
+
+func TestCheckTokenUse(t *testing.T) {
+	now := time.Now()
+	tokens := map[string]*types.IssuedToken{
+		"single": {Name: "single", Serial: "a1", Expiry: now.Add(time.Hour), Uses: 1},
+		"many":   {Name: "many", Serial: "b2", Expiry: now.Add(time.Hour)},
+		"old":    {Name: "old", Serial: "c3", Expiry: now.Add(-time.Hour)},
+		"gone":   {Name: "gone", Serial: "d4", Expiry: now.Add(time.Hour), Revoked: true},
+	}
+	connections := []qdr.Connection{
+		{Name: "c1", Container: "router-1", Role: "inter-router", Dir: "in", User: "CN=skupper,OU=a1"},
+		{Name: "c2", Container: "router-2", Role: "inter-router", Dir: "in", User: "OU=a1,CN=skupper"},
+		{Name: "c3", Container: "router-1b", Role: "edge", Dir: "in", User: "CN=skupper,OU=a1"},
+		{Name: "c4", Container: "router-3", Role: "edge", Dir: "in", User: "CN=skupper,OU=b2"},
+		{Name: "c5", Container: "router-4", Role: "inter-router", Dir: "in", User: "CN=skupper,OU=c3"},
+		{Name: "c6", Container: "router-5", Role: "inter-router", Dir: "in", User: "CN=skupper,OU=d4"},
+		{Name: "c7", Container: "router-6", Role: "inter-router", Dir: "in", User: "CN=skupper,OU=e5"},
+		{Name: "c8", Container: "router-7", Role: "inter-router", Dir: "in", User: "CN=skupper"},
+		{Name: "c9", Container: "router-8", Role: "inter-router", Dir: "out", User: "CN=skupper,OU=e5"},
+		{Name: "c10", Container: "controller", Role: "normal", Dir: "in", User: "CN=skupper,OU=e5"},
+	}
+	sites := map[string]string{
+		"router-1":  "site-a",
+		"router-1b": "site-a",
+		"router-2":  "site-b",
+		"router-3":  "site-c",
+	}
+	rejected, updated := checkTokenUse(connections, tokens, func(c qdr.Connection) string {
+		return sites[c.Container]
+	}, now)
+	assert.Assert(t, updated)
+	names := []string{}
+	for _, c := range rejected {
+		names = append(names, c.Name)
+	}
+	assert.DeepEqual(t, names, []string{"c2", "c5", "c6", "c7"})
+	assert.DeepEqual(t, tokens["single"].Redemptions, []string{"site-a"})
+	assert.DeepEqual(t, tokens["many"].Redemptions, []string{"site-c"})
+
+	_, updated = checkTokenUse(connections[:1], tokens, func(c qdr.Connection) string {
+		return sites[c.Container]
+	}, now)
+	assert.Assert(t, !updated)
+}
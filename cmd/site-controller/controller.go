@@ -11,15 +11,24 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	corev1informer "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/informers/internalinterfaces"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 
 	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/api/v1alpha1"
 	"github.com/skupperproject/skupper/client"
+	"github.com/skupperproject/skupper/pkg/kube"
 )
 
 type SiteController struct {
@@ -27,7 +36,11 @@ type SiteController struct {
 	siteInformer         cache.SharedIndexInformer
 	tokenInformer        cache.SharedIndexInformer
 	tokenRequestInformer cache.SharedIndexInformer
+	skupperSiteInformer  cache.SharedIndexInformer
+	skupperTokenInformer cache.SharedIndexInformer
 	workqueue            workqueue.RateLimitingInterface
+	recorder             record.EventRecorder
+	watchNamespace       string
 }
 
 func NewSiteController(cli *client.VanClient) (*SiteController, error) {
@@ -67,6 +80,9 @@ func NewSiteController(cli *client.VanClient) (*SiteController, error) {
 			options.LabelSelector = types.TypeTokenRequestQualifier
 		}))
 	workqueue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "skupper-site-controller")
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: cli.KubeClient.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "skupper-site-controller"})
 
 	controller := &SiteController{
 		vanClient:            cli,
@@ -74,14 +90,39 @@ func NewSiteController(cli *client.VanClient) (*SiteController, error) {
 		tokenInformer:        tokenInformer,
 		tokenRequestInformer: tokenRequestInformer,
 		workqueue:            workqueue,
+		recorder:             recorder,
+		watchNamespace:       watchNamespace,
 	}
 
 	siteInformer.AddEventHandler(controller.getHandlerFuncs(SiteConfig, configmapResourceVersionTest))
 	tokenInformer.AddEventHandler(controller.getHandlerFuncs(Token, secretResourceVersionTest))
 	tokenRequestInformer.AddEventHandler(controller.getHandlerFuncs(TokenRequest, secretResourceVersionTest))
+
+	// sites and tokens can also be defined through custom resources,
+	// if their definitions have been installed
+	if kube.IsResourceAvailable(v1alpha1.SkupperSiteResource, cli.KubeClient) {
+		log.Println("Watching SkupperSite resources")
+		controller.skupperSiteInformer = newResourceInformer(cli, v1alpha1.SkupperSiteResource, watchNamespace)
+		controller.skupperSiteInformer.AddEventHandler(controller.getHandlerFuncs(SiteResource, unstructuredResourceVersionTest))
+	}
+	if kube.IsResourceAvailable(v1alpha1.SkupperTokenResource, cli.KubeClient) {
+		log.Println("Watching SkupperToken resources")
+		controller.skupperTokenInformer = newResourceInformer(cli, v1alpha1.SkupperTokenResource, watchNamespace)
+		controller.skupperTokenInformer.AddEventHandler(controller.getHandlerFuncs(TokenResource, unstructuredResourceVersionTest))
+	}
 	return controller, nil
 }
 
+func newResourceInformer(cli *client.VanClient, resource schema.GroupVersionResource, watchNamespace string) cache.SharedIndexInformer {
+	return dynamicinformer.NewFilteredDynamicInformer(
+		cli.DynamicClient,
+		resource,
+		watchNamespace,
+		time.Second*30,
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		nil).Informer()
+}
+
 type resourceVersionTest func(a interface{}, b interface{}) bool
 
 func configmapResourceVersionTest(a interface{}, b interface{}) bool {
@@ -96,6 +137,12 @@ func secretResourceVersionTest(a interface{}, b interface{}) bool {
 	return aa.ResourceVersion == bb.ResourceVersion
 }
 
+func unstructuredResourceVersionTest(a interface{}, b interface{}) bool {
+	aa := a.(*unstructured.Unstructured)
+	bb := b.(*unstructured.Unstructured)
+	return aa.GetResourceVersion() == bb.GetResourceVersion()
+}
+
 func (c *SiteController) getHandlerFuncs(category triggerType, test resourceVersionTest) *cache.ResourceEventHandlerFuncs {
 	return &cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -120,14 +167,24 @@ func (c *SiteController) Run(stopCh <-chan struct{}) error {
 	go c.siteInformer.Run(stopCh)
 	go c.tokenInformer.Run(stopCh)
 	go c.tokenRequestInformer.Run(stopCh)
+	synced := []cache.InformerSynced{c.siteInformer.HasSynced, c.tokenInformer.HasSynced}
+	for _, informer := range []cache.SharedIndexInformer{c.skupperSiteInformer, c.skupperTokenInformer} {
+		if informer != nil {
+			go informer.Run(stopCh)
+			synced = append(synced, informer.HasSynced)
+		}
+	}
 
 	log.Println("Waiting for informer caches to sync")
-	if ok := cache.WaitForCacheSync(stopCh, c.siteInformer.HasSynced, c.tokenInformer.HasSynced); !ok {
+	if ok := cache.WaitForCacheSync(stopCh, synced...); !ok {
 		return fmt.Errorf("Failed to wait for caches to sync")
 	}
 
 	log.Println("Starting workers")
 	go wait.Until(c.run, time.Second, stopCh)
+	go wait.Until(c.collectExpiredTokens, time.Minute, stopCh)
+	go wait.Until(c.checkLinkStatus, time.Second*30, stopCh)
+	go wait.Until(c.refreshResourceStatus, time.Second*30, stopCh)
 	log.Println("Started workers")
 
 	<-stopCh
@@ -141,6 +198,8 @@ const (
 	SiteConfig triggerType = iota
 	Token
 	TokenRequest
+	SiteResource
+	TokenResource
 )
 
 type trigger struct {
@@ -187,6 +246,10 @@ func (c *SiteController) dispatchTrigger(trigger trigger) error {
 		return c.checkToken(trigger.key)
 	case TokenRequest:
 		return c.checkTokenRequest(trigger.key)
+	case SiteResource:
+		return c.checkSkupperSite(trigger.key)
+	case TokenResource:
+		return c.checkSkupperToken(trigger.key)
 	default:
 		return fmt.Errorf("invalid trigger %d", trigger.category)
 	}
@@ -212,6 +275,12 @@ func (c *SiteController) checkAllForSite() {
 	c.checkAllTokens()
 	log.Println("Checking token requests...")
 	c.checkAllTokenRequests()
+	if c.skupperTokenInformer != nil {
+		log.Println("Checking token resources...")
+		for _, t := range c.skupperTokenInformer.GetStore().List() {
+			c.enqueueTrigger(t, TokenResource)
+		}
+	}
 	log.Println("Done.")
 }
 
@@ -229,36 +298,102 @@ func (c *SiteController) checkSite(key string) error {
 		return err
 	} else if exists {
 		configmap := obj.(*corev1.ConfigMap)
-		routerInspectResponse, err := c.vanClient.RouterInspect(context.Background())
-		if err == nil {
-			log.Println("Skupper site exists ", key)
-			wantEdgeMode := configmap.Data["edge"] == "true"
-			haveEdgeMode := routerInspectResponse.Status.Mode == string(types.TransportModeEdge)
-			// TODO: enable richer comparison/checking (possibly with GetRouterSpecFromOpts?)
-			if wantEdgeMode != haveEdgeMode {
-				//TODO: enable van router update
-			}
-			c.checkAllForSite()
-		} else if errors.IsNotFound(err) {
-			log.Println("Initialising skupper site ...")
-			siteConfig, _ := c.vanClient.SiteConfigInspect(context.Background(), configmap)
-			siteConfig.Spec.SkupperNamespace = siteNamespace
-			err = c.vanClient.RouterCreate(context.Background(), *siteConfig)
-			if err != nil {
-				log.Println("Error initialising skupper: ", err)
-				return err
-			} else {
-				log.Println("Skupper site initialised")
-				c.checkAllForSite()
-			}
-		} else {
-			log.Println("Error inspecting VAN router: ", err)
+		siteConfig, err := c.vanClient.SiteConfigInspect(context.Background(), configmap)
+		if err != nil {
+			log.Println("Error reading skupper-site config map: ", err)
 			return err
 		}
+		siteConfig.Spec.SkupperNamespace = siteNamespace
+		updated, err := c.reconcileSite(key, siteConfig, configmap)
+		c.updateSiteStatus(configmap, err, updated)
+		return err
 	}
 	return nil
 }
 
+// Initialises the site if it does not yet exist, otherwise updates it
+// to match its configuration. Events are recorded against the object
+// through which the site is configured. Returns true if the site was
+// created or changed.
+func (c *SiteController) reconcileSite(key string, siteConfig *types.SiteConfig, object runtime.Object) (bool, error) {
+	_, err := kube.GetDeployment(types.TransportDeploymentName, siteConfig.Spec.SkupperNamespace, c.vanClient.KubeClient)
+	if err == nil {
+		log.Println("Skupper site exists ", key)
+		updated, err := c.vanClient.RouterUpdate(context.Background(), *siteConfig)
+		if err != nil {
+			log.Println("Error updating skupper site: ", err)
+			c.recorder.Event(object, corev1.EventTypeWarning, "UpdateFailed", err.Error())
+			return false, err
+		}
+		if updated {
+			log.Println("Skupper site updated ", key)
+			c.recorder.Event(object, corev1.EventTypeNormal, "Updated", "Site updated to match configuration")
+		}
+		c.checkAllForSite()
+		return updated, nil
+	} else if errors.IsNotFound(err) {
+		log.Println("Initialising skupper site ...")
+		err = c.vanClient.RouterCreate(context.Background(), *siteConfig)
+		if err != nil {
+			log.Println("Error initialising skupper: ", err)
+			c.recorder.Event(object, corev1.EventTypeWarning, "CreateFailed", err.Error())
+			return false, err
+		}
+		log.Println("Skupper site initialised")
+		c.recorder.Event(object, corev1.EventTypeNormal, "Created", "Site initialised")
+		c.checkAllForSite()
+		return true, nil
+	} else {
+		log.Println("Error inspecting VAN router: ", err)
+		return false, err
+	}
+}
+
+// Records the outcome of reconciling a site through annotations on its
+// config map. Returns true if the annotations were changed.
+func setSiteStatus(configmap *corev1.ConfigMap, err error, updated bool, now time.Time) bool {
+	status := types.SiteStatusReady
+	message := ""
+	if err != nil {
+		status = types.SiteStatusError
+		message = err.Error()
+	}
+	if configmap.ObjectMeta.Annotations == nil {
+		configmap.ObjectMeta.Annotations = map[string]string{}
+	}
+	annotations := configmap.ObjectMeta.Annotations
+	changed := false
+	if annotations[types.SiteStatusQualifier] != status {
+		annotations[types.SiteStatusQualifier] = status
+		changed = true
+	}
+	if current, ok := annotations[types.SiteStatusMessageQualifier]; message == "" && ok {
+		delete(annotations, types.SiteStatusMessageQualifier)
+		changed = true
+	} else if message != "" && current != message {
+		annotations[types.SiteStatusMessageQualifier] = message
+		changed = true
+	}
+	if updated {
+		annotations[types.SiteConfigUpdatedQualifier] = now.Format(time.RFC3339)
+		changed = true
+	}
+	return changed
+}
+
+// The config map is only updated when the status has changed, as each
+// update triggers a further check of the site
+func (c *SiteController) updateSiteStatus(configmap *corev1.ConfigMap, err error, updated bool) {
+	configmap = configmap.DeepCopy()
+	if !setSiteStatus(configmap, err, updated, time.Now()) {
+		return
+	}
+	_, err = c.vanClient.KubeClient.CoreV1().ConfigMaps(configmap.ObjectMeta.Namespace).Update(configmap)
+	if err != nil {
+		log.Printf("Failed to update status of skupper-site in %s: %s", configmap.ObjectMeta.Namespace, err)
+	}
+}
+
 func getTokenCost(token *corev1.Secret) (int32, bool) {
 	if token.ObjectMeta.Annotations == nil {
 		return 0, false
@@ -297,7 +432,9 @@ func (c *SiteController) disconnect(name string, namespace string) error {
 
 func (c *SiteController) generate(token *corev1.Secret) error {
 	log.Printf("Generating token for request %s...", token.ObjectMeta.Name)
-	generated, _, err := c.vanClient.ConnectorTokenCreate(context.Background(), token.ObjectMeta.Name, token.ObjectMeta.Namespace)
+	generated, _, err := c.vanClient.ConnectorTokenCreateWithOptions(context.Background(), token.ObjectMeta.Name, token.ObjectMeta.Namespace, types.ConnectorTokenCreateOptions{
+		Name: token.ObjectMeta.Name,
+	})
 	if err == nil {
 		token.Data = generated.Data
 		if token.ObjectMeta.Annotations == nil {
@@ -347,7 +484,12 @@ func (c *SiteController) checkToken(key string) error {
 		if err == nil {
 			token := obj.(*corev1.Secret)
 			if c.isTokenValidInSite(token) {
-				return c.connect(token, siteNamespace)
+				if err := c.connect(token, siteNamespace); err != nil {
+					c.updateLinkStatus(token, getLinkFailedStatus(err))
+					return err
+				}
+				c.updateLinkStatus(token, c.getLinkStatus(token))
+				return nil
 			} else {
 				return nil
 			}
@@ -384,6 +526,11 @@ func (c *SiteController) checkTokenRequest(key string) error {
 
 func (c *SiteController) getSiteIdForNamespace(namespace string) string {
 	cm, err := c.vanClient.KubeClient.CoreV1().ConfigMaps(namespace).Get("skupper-site", metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		if site := c.getSkupperSiteForNamespace(namespace); site != nil {
+			return string(site.ObjectMeta.UID)
+		}
+	}
 	if err != nil {
 		if errors.IsNotFound(err) {
 			log.Printf("Could not obtain siteid for namespace %q, assuming not yet initialised", namespace)
@@ -412,3 +559,47 @@ func (c *SiteController) isTokenRequestValidInSite(token *corev1.Secret) bool {
 	}
 	return true
 }
+
+func removeExpiredTokens(tokens map[string]*types.IssuedToken, now time.Time) bool {
+	removed := false
+	for name, token := range tokens {
+		if token.IsExpired(now) {
+			delete(tokens, name)
+			removed = true
+		}
+	}
+	return removed
+}
+
+// Removes the records of tokens that have expired; the certificates
+// for those tokens are no longer accepted, so the records are not
+// needed to reject connections made with them
+func (c *SiteController) collectExpiredTokens() {
+	configmaps, err := c.vanClient.KubeClient.CoreV1().ConfigMaps(c.watchNamespace).List(metav1.ListOptions{
+		FieldSelector: "metadata.name=" + types.IssuedTokensConfigMap,
+	})
+	if err != nil {
+		log.Printf("Failed to retrieve issued token records: %s", err)
+		return
+	}
+	now := time.Now()
+	for _, cm := range configmaps.Items {
+		tokens, err := kube.GetIssuedTokensFromConfigMap(&cm)
+		if err != nil {
+			log.Printf("Failed to read issued token records in %s: %s", cm.ObjectMeta.Namespace, err)
+			continue
+		}
+		if !removeExpiredTokens(tokens, now) {
+			continue
+		}
+		if err = kube.UpdateIssuedTokensConfigMap(&cm, tokens); err != nil {
+			log.Printf("Failed to update issued token records in %s: %s", cm.ObjectMeta.Namespace, err)
+			continue
+		}
+		if _, err = c.vanClient.KubeClient.CoreV1().ConfigMaps(cm.ObjectMeta.Namespace).Update(&cm); err != nil {
+			log.Printf("Failed to remove expired token records in %s: %s", cm.ObjectMeta.Namespace, err)
+		} else {
+			log.Printf("Removed expired token records in %s", cm.ObjectMeta.Namespace)
+		}
+	}
+}
@@ -2,8 +2,14 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/skupperproject/skupper/api/types"
 )
 
 var clusterRun = flag.Bool("use-cluster", false, "run tests against a configured cluster")
@@ -12,3 +18,58 @@ func TestMain(m *testing.M) {
 	flag.Parse()
 	os.Exit(m.Run())
 }
+
+func TestRemoveExpiredTokens(t *testing.T) {
+	now := time.Now()
+	tokens := map[string]*types.IssuedToken{
+		"current": {Name: "current", Expiry: now.Add(time.Minute)},
+		"expired": {Name: "expired", Expiry: now.Add(-time.Minute), Revoked: true},
+	}
+	if !removeExpiredTokens(tokens, now) {
+		t.Errorf("Expected expired token to be removed")
+	}
+	if _, ok := tokens["expired"]; ok {
+		t.Errorf("Expected expired token to be removed")
+	}
+	if _, ok := tokens["current"]; !ok {
+		t.Errorf("Expected current token to be retained")
+	}
+	if removeExpiredTokens(tokens, now) {
+		t.Errorf("Expected no further tokens to be removed")
+	}
+}
+
+func TestSetSiteStatus(t *testing.T) {
+	now := time.Now()
+	configmap := &corev1.ConfigMap{}
+	if !setSiteStatus(configmap, nil, true, now) {
+		t.Errorf("Expected status to be set")
+	}
+	if configmap.ObjectMeta.Annotations[types.SiteStatusQualifier] != types.SiteStatusReady {
+		t.Errorf("Expected status %s, got %s", types.SiteStatusReady, configmap.ObjectMeta.Annotations[types.SiteStatusQualifier])
+	}
+	if configmap.ObjectMeta.Annotations[types.SiteConfigUpdatedQualifier] != now.Format(time.RFC3339) {
+		t.Errorf("Expected time of update to be recorded")
+	}
+	if setSiteStatus(configmap, nil, false, now) {
+		t.Errorf("Expected no change to status")
+	}
+	if !setSiteStatus(configmap, fmt.Errorf("failed"), false, now) {
+		t.Errorf("Expected error status to be set")
+	}
+	if configmap.ObjectMeta.Annotations[types.SiteStatusQualifier] != types.SiteStatusError {
+		t.Errorf("Expected status %s, got %s", types.SiteStatusError, configmap.ObjectMeta.Annotations[types.SiteStatusQualifier])
+	}
+	if configmap.ObjectMeta.Annotations[types.SiteStatusMessageQualifier] != "failed" {
+		t.Errorf("Expected error message to be recorded")
+	}
+	if setSiteStatus(configmap, fmt.Errorf("failed"), false, now) {
+		t.Errorf("Expected no change to status")
+	}
+	if !setSiteStatus(configmap, nil, false, now) {
+		t.Errorf("Expected status to be cleared")
+	}
+	if _, ok := configmap.ObjectMeta.Annotations[types.SiteStatusMessageQualifier]; ok {
+		t.Errorf("Expected error message to be removed")
+	}
+}
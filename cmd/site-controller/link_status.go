@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/kube"
+	"github.com/skupperproject/skupper/pkg/qdr"
+)
+
+// Determines the state of the link made with a token from the router
+// config and the router's connections, as ConnectorInspect does
+func (c *SiteController) getLinkStatus(token *corev1.Secret) string {
+	namespace := token.ObjectMeta.Namespace
+	configmap, err := kube.GetConfigMap("skupper-internal", namespace, c.vanClient.KubeClient)
+	if err != nil {
+		return getLinkFailedStatus(fmt.Errorf("Could not retrieve router config: %s", err))
+	}
+	current, err := qdr.GetRouterConfigFromConfigMap(configmap)
+	if err != nil {
+		return getLinkFailedStatus(fmt.Errorf("Could not read router config: %s", err))
+	}
+	connector, ok := current.Connectors[token.ObjectMeta.Name]
+	if !ok {
+		return getLinkFailedStatus(fmt.Errorf("No connector is configured for the token"))
+	}
+	connections, err := qdr.GetConnections(namespace, c.vanClient.KubeClient, c.vanClient.RestConfig)
+	if err != nil {
+		// the router may not yet be running
+		return types.LinkStatusConnecting
+	}
+	connection := qdr.GetInterRouterOrEdgeConnection(connector.Host+":"+connector.Port, connections)
+	if connection != nil && connection.Active {
+		return types.LinkStatusConnected
+	}
+	return types.LinkStatusConnecting
+}
+
+func getLinkFailedStatus(err error) string {
+	return types.LinkStatusFailed + ": " + err.Error()
+}
+
+func isLinkFailed(status string) bool {
+	return strings.HasPrefix(status, types.LinkStatusFailed)
+}
+
+// Records the state of the link made with a token through annotations
+// on the token secret. The time of the last successful connection is
+// only updated when the link comes up. Returns true if the annotations
+// were changed.
+func setLinkStatus(token *corev1.Secret, status string, now time.Time) bool {
+	if token.ObjectMeta.Annotations == nil {
+		token.ObjectMeta.Annotations = map[string]string{}
+	}
+	annotations := token.ObjectMeta.Annotations
+	changed := false
+	if annotations[types.LinkStatusQualifier] != status {
+		if status == types.LinkStatusConnected {
+			annotations[types.LinkLastConnectedQualifier] = now.Format(time.RFC3339)
+		}
+		annotations[types.LinkStatusQualifier] = status
+		changed = true
+	}
+	// the token is generated by the site it links to
+	if remote, ok := annotations[types.TokenGeneratedBy]; ok && annotations[types.LinkRemoteSiteQualifier] != remote {
+		annotations[types.LinkRemoteSiteQualifier] = remote
+		changed = true
+	}
+	return changed
+}
+
+// The secret is only updated when the status has changed, as each
+// update triggers a further check of the token. Events are recorded
+// when the link comes up or fails.
+func (c *SiteController) updateLinkStatus(token *corev1.Secret, status string) {
+	previous := token.ObjectMeta.Annotations[types.LinkStatusQualifier]
+	token = token.DeepCopy()
+	if !setLinkStatus(token, status, time.Now()) {
+		return
+	}
+	if status != previous {
+		if status == types.LinkStatusConnected {
+			c.recorder.Event(token, corev1.EventTypeNormal, "Connected", "Link established")
+		} else if isLinkFailed(status) {
+			c.recorder.Event(token, corev1.EventTypeWarning, "LinkFailed", strings.TrimPrefix(status, types.LinkStatusFailed+": "))
+		}
+	}
+	_, err := c.vanClient.KubeClient.CoreV1().Secrets(token.ObjectMeta.Namespace).Update(token)
+	if err != nil {
+		log.Printf("Failed to update link status of token %s in %s: %s", token.ObjectMeta.Name, token.ObjectMeta.Namespace, err)
+	}
+}
+
+// Links can come up or go down at any time, so their state is checked
+// periodically
+func (c *SiteController) checkLinkStatus() {
+	for _, obj := range c.tokenInformer.GetStore().List() {
+		token, ok := obj.(*corev1.Secret)
+		if !ok || !c.isTokenValidInSite(token) {
+			continue
+		}
+		if isLinkFailed(token.ObjectMeta.Annotations[types.LinkStatusQualifier]) {
+			// failures are retried when the token is next checked
+			c.enqueueTrigger(token, Token)
+			continue
+		}
+		c.updateLinkStatus(token, c.getLinkStatus(token))
+	}
+}
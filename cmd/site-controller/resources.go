@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/api/v1alpha1"
+	"github.com/skupperproject/skupper/client"
+	"github.com/skupperproject/skupper/pkg/kube"
+	"github.com/skupperproject/skupper/pkg/qdr"
+)
+
+func (c *SiteController) checkSkupperSite(key string) error {
+	obj, exists, err := c.skupperSiteInformer.GetStore().GetByKey(key)
+	if err != nil {
+		log.Println("Error checking SkupperSite: ", err)
+		return err
+	} else if !exists {
+		// the components of the site are owned by the resource, so
+		// are removed along with it
+		return nil
+	}
+	site := &v1alpha1.SkupperSite{}
+	if err = v1alpha1.FromUnstructured(obj, site); err != nil {
+		log.Println("Error reading SkupperSite: ", err)
+		return err
+	}
+	if c.hasSiteConfigMap(site.ObjectMeta.Namespace) {
+		err = fmt.Errorf("Site is already configured by the skupper-site ConfigMap")
+		c.recorder.Event(obj.(runtime.Object), corev1.EventTypeWarning, "Ignored", err.Error())
+		c.updateSkupperSiteStatus(site, getSkupperSiteStatus(site.Status, err, false, time.Now()))
+		return nil
+	}
+	updated, err := c.reconcileSite(key, client.GetSiteConfigForSkupperSite(site), obj.(runtime.Object))
+	status := getSkupperSiteStatus(site.Status, err, updated, time.Now())
+	if err == nil {
+		c.getRouterStatus(&status, site)
+	}
+	c.updateSkupperSiteStatus(site, status)
+	return err
+}
+
+func (c *SiteController) hasSiteConfigMap(namespace string) bool {
+	_, exists, err := c.siteInformer.GetStore().GetByKey(namespace + "/skupper-site")
+	return err == nil && exists
+}
+
+func (c *SiteController) getSkupperSiteForNamespace(namespace string) *v1alpha1.SkupperSite {
+	if c.skupperSiteInformer == nil {
+		return nil
+	}
+	objects, err := c.skupperSiteInformer.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+	if err != nil || len(objects) == 0 {
+		return nil
+	}
+	site := &v1alpha1.SkupperSite{}
+	if err = v1alpha1.FromUnstructured(objects[0], site); err != nil {
+		return nil
+	}
+	return site
+}
+
+// Returns the status of a site after reconciling it; the state of its
+// routers is filled in separately
+func getSkupperSiteStatus(current v1alpha1.SkupperSiteStatus, err error, updated bool, now time.Time) v1alpha1.SkupperSiteStatus {
+	status := current
+	if err != nil {
+		status.Status = v1alpha1.StatusError
+		status.Message = err.Error()
+	} else {
+		status.Status = v1alpha1.StatusReady
+		status.Message = ""
+	}
+	if updated {
+		status.LastUpdated = &metav1.Time{Time: now.Truncate(time.Second)}
+	}
+	return status
+}
+
+func (c *SiteController) getRouterStatus(status *v1alpha1.SkupperSiteStatus, site *v1alpha1.SkupperSite) {
+	namespace := site.ObjectMeta.Namespace
+	router, err := kube.GetDeployment(types.TransportDeploymentName, namespace, c.vanClient.KubeClient)
+	if err != nil {
+		return
+	}
+	if env := kube.FindEnvVar(router.Spec.Template.Spec.Containers[0].Env, "SKUPPER_SITE_ID"); env != nil {
+		status.SiteId = env.Value
+	}
+	if router.Spec.Replicas != nil {
+		status.Routers = *router.Spec.Replicas
+	}
+	status.ReadyRouters = router.Status.ReadyReplicas
+	if status.ReadyRouters == 0 {
+		status.ConnectedSites = 0
+		return
+	}
+	sites, err := qdr.GetConnectedSites(site.Spec.Edge, namespace, c.vanClient.KubeClient, c.vanClient.RestConfig)
+	if err != nil {
+		log.Printf("Could not determine sites connected to %s: %s", namespace, err)
+		return
+	}
+	status.ConnectedSites = sites.Total
+}
+
+// The status is only written when it has changed, as each update
+// triggers a further check of the resource
+func (c *SiteController) updateSkupperSiteStatus(site *v1alpha1.SkupperSite, status v1alpha1.SkupperSiteStatus) {
+	if equality.Semantic.DeepEqual(site.Status, status) {
+		return
+	}
+	site.Status = status
+	if err := kube.UpdateResourceStatus(v1alpha1.SkupperSiteResource, site, site.ObjectMeta.Namespace, c.vanClient.DynamicClient); err != nil {
+		log.Println(err)
+	}
+}
+
+func (c *SiteController) checkSkupperToken(key string) error {
+	obj, exists, err := c.skupperTokenInformer.GetStore().GetByKey(key)
+	if err != nil {
+		log.Println("Error checking SkupperToken: ", err)
+		return err
+	} else if !exists {
+		// the secret for the token is owned by the resource, so is
+		// removed along with it, which for a link removes the
+		// connection
+		return nil
+	}
+	token := &v1alpha1.SkupperToken{}
+	if err = v1alpha1.FromUnstructured(obj, token); err != nil {
+		log.Println("Error reading SkupperToken: ", err)
+		return err
+	}
+	var status v1alpha1.SkupperTokenStatus
+	switch token.Spec.Type {
+	case v1alpha1.TokenTypeRequest:
+		status, err = c.checkTokenResourceRequest(token)
+	case v1alpha1.TokenTypeLink:
+		status, err = c.checkTokenResourceLink(token)
+	default:
+		err = fmt.Errorf("Invalid token type %q", token.Spec.Type)
+		status = v1alpha1.SkupperTokenStatus{Status: v1alpha1.StatusError, Message: err.Error()}
+	}
+	if err != nil {
+		c.recorder.Event(obj.(runtime.Object), corev1.EventTypeWarning, "Failed", err.Error())
+	}
+	c.updateSkupperTokenStatus(token, status)
+	return err
+}
+
+func (c *SiteController) getTokenSecret(token *v1alpha1.SkupperToken) (*corev1.Secret, error) {
+	secret, err := c.vanClient.KubeClient.CoreV1().Secrets(token.ObjectMeta.Namespace).Get(token.ObjectMeta.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve secret %s: %w", token.ObjectMeta.Name, err)
+	}
+	return secret, nil
+}
+
+// A token is generated into a secret owned by the resource, once the
+// site has been initialised
+func (c *SiteController) checkTokenResourceRequest(token *v1alpha1.SkupperToken) (v1alpha1.SkupperTokenStatus, error) {
+	namespace := token.ObjectMeta.Namespace
+	secret, err := c.getTokenSecret(token)
+	if err != nil {
+		return v1alpha1.SkupperTokenStatus{Status: v1alpha1.StatusError, Message: err.Error()}, err
+	}
+	if secret == nil {
+		siteId := c.getSiteIdForNamespace(namespace)
+		if siteId == "" {
+			return v1alpha1.SkupperTokenStatus{Status: v1alpha1.StatusPending, Message: "Site not yet initialised"}, nil
+		}
+		secret, err = c.generateTokenForResource(token, siteId)
+		if err != nil {
+			return v1alpha1.SkupperTokenStatus{Status: v1alpha1.StatusError, Message: err.Error()}, err
+		}
+	}
+	status := v1alpha1.SkupperTokenStatus{
+		Status: v1alpha1.StatusGenerated,
+		Expiry: secret.ObjectMeta.Annotations[types.TokenExpiry],
+	}
+	_, issued, err := kube.GetIssuedTokens(namespace, c.vanClient.KubeClient)
+	if err != nil {
+		log.Printf("Could not retrieve issued token records in %s: %s", namespace, err)
+	} else if record, ok := issued[token.ObjectMeta.Name]; ok {
+		status.Redemptions = record.Redemptions
+	}
+	return status, nil
+}
+
+func (c *SiteController) generateTokenForResource(token *v1alpha1.SkupperToken, siteId string) (*corev1.Secret, error) {
+	log.Printf("Generating token for %s/%s...", token.ObjectMeta.Namespace, token.ObjectMeta.Name)
+	options := types.ConnectorTokenCreateOptions{
+		Name: token.ObjectMeta.Name,
+		Uses: token.Spec.Uses,
+	}
+	if token.Spec.Expiry != "" {
+		expiry, err := time.ParseDuration(token.Spec.Expiry)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid expiry %q: %s", token.Spec.Expiry, err)
+		}
+		options.Expiry = expiry
+	}
+	secret, _, err := c.vanClient.ConnectorTokenCreateWithOptions(context.Background(), token.ObjectMeta.Name, token.ObjectMeta.Namespace, options)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate token: %w", err)
+	}
+	secret.ObjectMeta.Name = token.ObjectMeta.Name
+	secret.ObjectMeta.Annotations[types.TokenGeneratedBy] = siteId
+	secret.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+		kube.GetOwnerReferenceForResource(v1alpha1.SkupperTokenKind, token.ObjectMeta),
+	}
+	created, err := c.vanClient.KubeClient.CoreV1().Secrets(token.ObjectMeta.Namespace).Create(secret)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create token secret: %w", err)
+	}
+	return created, nil
+}
+
+// The secret for a link is labelled as a connection token, so that the
+// connection is made as for any other token, and is owned by the
+// resource, so that the connection is removed along with it
+func (c *SiteController) checkTokenResourceLink(token *v1alpha1.SkupperToken) (v1alpha1.SkupperTokenStatus, error) {
+	secret, err := c.getTokenSecret(token)
+	if err != nil {
+		return v1alpha1.SkupperTokenStatus{Status: v1alpha1.StatusError, Message: err.Error()}, err
+	}
+	if secret == nil {
+		return v1alpha1.SkupperTokenStatus{Status: v1alpha1.StatusPending, Message: "Waiting for secret " + token.ObjectMeta.Name}, nil
+	}
+	if adoptTokenSecret(secret, token) {
+		_, err = c.vanClient.KubeClient.CoreV1().Secrets(secret.ObjectMeta.Namespace).Update(secret)
+		if err != nil {
+			err = fmt.Errorf("Failed to update secret %s: %w", secret.ObjectMeta.Name, err)
+			return v1alpha1.SkupperTokenStatus{Status: v1alpha1.StatusError, Message: err.Error()}, err
+		}
+	}
+	// the state of the link is that recorded on the secret
+	linkStatus := secret.ObjectMeta.Annotations[types.LinkStatusQualifier]
+	if linkStatus == types.LinkStatusConnected {
+		return v1alpha1.SkupperTokenStatus{Status: v1alpha1.StatusConnected}, nil
+	} else if isLinkFailed(linkStatus) {
+		return v1alpha1.SkupperTokenStatus{Status: v1alpha1.StatusError, Message: strings.TrimPrefix(linkStatus, types.LinkStatusFailed+": ")}, nil
+	}
+	return v1alpha1.SkupperTokenStatus{Status: v1alpha1.StatusPending, Message: "Not yet connected"}, nil
+}
+
+// Labels the secret for a link as a connection token owned by the
+// resource, with the cost it specifies. Returns true if the secret
+// was changed.
+func adoptTokenSecret(secret *corev1.Secret, token *v1alpha1.SkupperToken) bool {
+	changed := false
+	if secret.ObjectMeta.Labels == nil {
+		secret.ObjectMeta.Labels = map[string]string{}
+	}
+	if secret.ObjectMeta.Labels[types.SkupperTypeQualifier] != types.TypeToken {
+		secret.ObjectMeta.Labels[types.SkupperTypeQualifier] = types.TypeToken
+		changed = true
+	}
+	if token.Spec.Cost > 0 {
+		cost := strconv.Itoa(int(token.Spec.Cost))
+		if secret.ObjectMeta.Annotations == nil {
+			secret.ObjectMeta.Annotations = map[string]string{}
+		}
+		if secret.ObjectMeta.Annotations[types.TokenCost] != cost {
+			secret.ObjectMeta.Annotations[types.TokenCost] = cost
+			changed = true
+		}
+	}
+	owner := kube.GetOwnerReferenceForResource(v1alpha1.SkupperTokenKind, token.ObjectMeta)
+	for _, ref := range secret.ObjectMeta.OwnerReferences {
+		if ref.UID == owner.UID {
+			return changed
+		}
+	}
+	secret.ObjectMeta.OwnerReferences = append(secret.ObjectMeta.OwnerReferences, owner)
+	return true
+}
+
+func (c *SiteController) updateSkupperTokenStatus(token *v1alpha1.SkupperToken, status v1alpha1.SkupperTokenStatus) {
+	if equality.Semantic.DeepEqual(token.Status, status) {
+		return
+	}
+	token.Status = status
+	if err := kube.UpdateResourceStatus(v1alpha1.SkupperTokenResource, token, token.ObjectMeta.Namespace, c.vanClient.DynamicClient); err != nil {
+		log.Println(err)
+	}
+}
+
+// The state of the routers of a site, the connections made through
+// links and the redemption of requested tokens change independently
+// of the resources, so their status is refreshed periodically
+func (c *SiteController) refreshResourceStatus() {
+	if c.skupperSiteInformer != nil {
+		for _, obj := range c.skupperSiteInformer.GetStore().List() {
+			site := &v1alpha1.SkupperSite{}
+			if err := v1alpha1.FromUnstructured(obj, site); err != nil || site.Status.Status != v1alpha1.StatusReady {
+				continue
+			}
+			status := site.Status
+			c.getRouterStatus(&status, site)
+			c.updateSkupperSiteStatus(site, status)
+		}
+	}
+	if c.skupperTokenInformer != nil {
+		for _, obj := range c.skupperTokenInformer.GetStore().List() {
+			c.enqueueTrigger(obj, TokenResource)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/api/v1alpha1"
+)
+
+func TestGetSkupperSiteStatus(t *testing.T) {
+	now := time.Now()
+	current := v1alpha1.SkupperSiteStatus{SiteId: "abc", ReadyRouters: 1}
+	status := getSkupperSiteStatus(current, nil, true, now)
+	if status.Status != v1alpha1.StatusReady {
+		t.Errorf("Expected status %s, got %s", v1alpha1.StatusReady, status.Status)
+	}
+	if status.LastUpdated == nil || !status.LastUpdated.Time.Equal(now.Truncate(time.Second)) {
+		t.Errorf("Expected time of update to be recorded")
+	}
+	if status.SiteId != "abc" || status.ReadyRouters != 1 {
+		t.Errorf("Expected state of routers to be retained")
+	}
+	status = getSkupperSiteStatus(status, fmt.Errorf("failed"), false, now.Add(time.Minute))
+	if status.Status != v1alpha1.StatusError || status.Message != "failed" {
+		t.Errorf("Expected error status, got %s %q", status.Status, status.Message)
+	}
+	if !status.LastUpdated.Time.Equal(now.Truncate(time.Second)) {
+		t.Errorf("Expected time of last update to be retained")
+	}
+	status = getSkupperSiteStatus(status, nil, false, now)
+	if status.Message != "" {
+		t.Errorf("Expected error message to be cleared")
+	}
+}
+
+func TestAdoptTokenSecret(t *testing.T) {
+	token := &v1alpha1.SkupperToken{
+		ObjectMeta: metav1.ObjectMeta{Name: "link1", UID: "1234"},
+		Spec:       v1alpha1.SkupperTokenSpec{Type: v1alpha1.TokenTypeLink, Cost: 5},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "link1"},
+	}
+	if !adoptTokenSecret(secret, token) {
+		t.Errorf("Expected secret to be changed")
+	}
+	if secret.ObjectMeta.Labels[types.SkupperTypeQualifier] != types.TypeToken {
+		t.Errorf("Expected secret to be labelled as a connection token")
+	}
+	if secret.ObjectMeta.Annotations[types.TokenCost] != "5" {
+		t.Errorf("Expected cost to be set, got %q", secret.ObjectMeta.Annotations[types.TokenCost])
+	}
+	if len(secret.ObjectMeta.OwnerReferences) != 1 || secret.ObjectMeta.OwnerReferences[0].Kind != v1alpha1.SkupperTokenKind {
+		t.Errorf("Expected secret to be owned by token, got %v", secret.ObjectMeta.OwnerReferences)
+	}
+	if adoptTokenSecret(secret, token) {
+		t.Errorf("Expected no further change to secret")
+	}
+	token.Spec.Cost = 10
+	if !adoptTokenSecret(secret, token) {
+		t.Errorf("Expected cost to be changed")
+	}
+	if len(secret.ObjectMeta.OwnerReferences) != 1 {
+		t.Errorf("Expected a single owner, got %v", secret.ObjectMeta.OwnerReferences)
+	}
+}
+
+func TestSetLinkStatus(t *testing.T) {
+	now := time.Now()
+	token := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "link1",
+			Annotations: map[string]string{
+				types.TokenGeneratedBy: "remote-site",
+			},
+		},
+	}
+	if !setLinkStatus(token, types.LinkStatusConnecting, now) {
+		t.Errorf("Expected annotations to be changed")
+	}
+	if token.ObjectMeta.Annotations[types.LinkRemoteSiteQualifier] != "remote-site" {
+		t.Errorf("Expected remote site id to be recorded")
+	}
+	if _, ok := token.ObjectMeta.Annotations[types.LinkLastConnectedQualifier]; ok {
+		t.Errorf("Expected no time of last connection before link is established")
+	}
+	if setLinkStatus(token, types.LinkStatusConnecting, now) {
+		t.Errorf("Expected annotations to be unchanged")
+	}
+	if !setLinkStatus(token, types.LinkStatusConnected, now) {
+		t.Errorf("Expected annotations to be changed")
+	}
+	if token.ObjectMeta.Annotations[types.LinkLastConnectedQualifier] != now.Format(time.RFC3339) {
+		t.Errorf("Expected time of last connection to be recorded")
+	}
+	if setLinkStatus(token, types.LinkStatusConnected, now.Add(time.Minute)) {
+		t.Errorf("Expected annotations to be unchanged while link remains up")
+	}
+	failed := getLinkFailedStatus(fmt.Errorf("bad token"))
+	if failed != "failed: bad token" || !isLinkFailed(failed) {
+		t.Errorf("Unexpected failed status %q", failed)
+	}
+	setLinkStatus(token, failed, now.Add(time.Minute))
+	if token.ObjectMeta.Annotations[types.LinkLastConnectedQualifier] != now.Format(time.RFC3339) {
+		t.Errorf("Expected time of last connection to be retained on failure")
+	}
+}
@@ -1245,7 +1245,7 @@ func TestBindWithCluster(t *testing.T) {
 			args:            []string{"tcp-go-echo", "deployment", "tcp-go-echo3", "--protocol", "sctp"},
 			expectedCapture: "",
 			expectedOutput:  "",
-			expectedError:   "sctp is not a valid protocol. Choose 'tcp', 'http' or 'http2'",
+			expectedError:   "sctp is not a valid protocol. Choose 'tcp', 'http', 'http2' or 'udp'",
 			realCluster:     true,
 		},
 	}
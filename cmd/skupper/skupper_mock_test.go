@@ -90,9 +90,15 @@ func (v *vanClientMock) RouterCreate(ctx context.Context, options types.SiteConf
 func (v *vanClientMock) RouterInspect(ctx context.Context) (*types.RouterInspectResponse, error) {
 	return nil, nil
 }
+func (v *vanClientMock) RouterUpdate(ctx context.Context, options types.SiteConfig) (bool, error) {
+	return false, nil
+}
 func (v *vanClientMock) RouterRemove(ctx context.Context) error {
 	return nil
 }
+func (v *vanClientMock) RouterWaitReady(ctx context.Context) error {
+	return nil
+}
 func (v *vanClientMock) ConnectorCreateFromFile(ctx context.Context, secretFile string, options types.ConnectorCreateOptions) (*corev1.Secret, error) {
 	return nil, nil
 }
@@ -113,12 +119,36 @@ func (v *vanClientMock) ConnectorList(ctx context.Context) ([]*types.Connector,
 func (v *vanClientMock) ConnectorRemove(ctx context.Context, options types.ConnectorRemoveOptions) error {
 	return nil
 }
+func (v *vanClientMock) ConnectorUpdate(ctx context.Context, options types.ConnectorUpdateOptions) (bool, error) {
+	return false, nil
+}
+func (v *vanClientMock) ConnectorWaitConnected(ctx context.Context, name string) error {
+	return nil
+}
 func (v *vanClientMock) ConnectorTokenCreate(ctx context.Context, subject string, namespace string) (*corev1.Secret, bool, error) {
 	return nil, false, nil
 }
 func (v *vanClientMock) ConnectorTokenCreateFile(ctx context.Context, subject string, secretFile string) error {
 	return nil
 }
+func (v *vanClientMock) ConnectorTokenCreateWithOptions(ctx context.Context, subject string, namespace string, options types.ConnectorTokenCreateOptions) (*corev1.Secret, bool, error) {
+	return nil, false, nil
+}
+func (v *vanClientMock) ConnectorTokenCreateFileWithOptions(ctx context.Context, subject string, secretFile string, options types.ConnectorTokenCreateOptions) error {
+	return nil
+}
+func (v *vanClientMock) ConnectorTokenRevoke(ctx context.Context, name string) error {
+	return nil
+}
+func (v *vanClientMock) CertificatesRotate(ctx context.Context, options types.CertificatesRotateOptions) error {
+	return nil
+}
+func (v *vanClientMock) NetworkGraph(ctx context.Context) (*types.NetworkGraph, error) {
+	return &types.NetworkGraph{}, nil
+}
+func (v *vanClientMock) NetworkServiceList(ctx context.Context) ([]*types.NetworkService, error) {
+	return []*types.NetworkService{}, nil
+}
 func (v *vanClientMock) ServiceInterfaceCreate(ctx context.Context, service *types.ServiceInterface) error {
 	return nil
 }
@@ -153,6 +183,9 @@ func (v *vanClientMock) SkupperDump(ctx context.Context, tarName string, version
 	return nil
 }
 
+func (v *vanClientMock) ServiceInterfaceBindWithOptions(ctx context.Context, service *types.ServiceInterface, targetType string, targetName string, protocol string, targetPort int, options types.ServiceInterfaceBindOptions) error {
+	return v.ServiceInterfaceBind(ctx, service, targetType, targetName, protocol, targetPort)
+}
 func (v *vanClientMock) ServiceInterfaceBind(ctx context.Context, service *types.ServiceInterface, targetType string, targetName string, protocol string, targetPort int) error {
 	var calledWith = serviceInterfaceBindCallArgs{
 		service:    service,
@@ -185,6 +218,14 @@ func (v *vanClientMock) ServiceInterfaceUpdate(ctx context.Context, service *typ
 	return v.injectedReturns.serviceInterfaceUpdate
 }
 
+func (v *vanClientMock) ServiceInterfaceWaitReady(ctx context.Context, address string) error {
+	return nil
+}
+
+func (v *vanClientMock) ServiceInterfaceApply(ctx context.Context, services []*types.ServiceInterface, options types.ServiceInterfaceApplyOptions) (*types.ServiceInterfaceApplyResponse, error) {
+	return &types.ServiceInterfaceApplyResponse{}, nil
+}
+
 func (v *vanClientMock) GetHeadlessServiceConfiguration(targetName string, protocol string, address string, port int) (*types.ServiceInterface, error) {
 	var calledWith = getHeadlessServiceConfigurationCallArgs{
 		targetName: targetName,
@@ -283,7 +324,7 @@ func TestCmdInit(t *testing.T) {
 			lcli.injectedReturns.siteConfigCreate.err = fmt.Errorf("some error")
 			err := cmd.RunE(&cobra.Command{}, args)
 			assert.Error(t, err, "some error")
-			assert.Assert(t, lcli.siteConfigCreateCalledWith[0] == routerCreateOpts)
+			assert.DeepEqual(t, lcli.siteConfigCreateCalledWith[0], routerCreateOpts)
 		})
 
 	t.Run("routerCreateFails",
@@ -519,7 +560,7 @@ func TestCmdBind(t *testing.T) {
 			resetCli()
 			protocol = "invalidProtocol"
 			err := cmd.RunE(&cobra.Command{}, args)
-			assert.Error(t, err, "invalidProtocol is not a valid protocol. Choose 'tcp', 'http' or 'http2'.")
+			assert.Error(t, err, "invalidProtocol is not a valid protocol. Choose 'tcp', 'http', 'http2' or 'udp'.")
 		})
 
 	t.Run("serviceNotFound",
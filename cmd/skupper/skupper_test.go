@@ -2,10 +2,15 @@ package main
 
 import (
 	"flag"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"gotest.tools/assert"
+
+	"github.com/skupperproject/skupper/api/types"
 )
 
 func Test_parseTargetTypeAndName(t *testing.T) {
@@ -111,3 +116,176 @@ func TestMain(m *testing.M) {
 	flag.Parse()
 	os.Exit(m.Run())
 }
+
+func Test_readServiceInterfaceManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skupper-apply")
+	assert.Assert(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name string, content string) string {
+		filename := filepath.Join(dir, name)
+		assert.Assert(t, ioutil.WriteFile(filename, []byte(content), 0644))
+		return filename
+	}
+
+	list := write("list.yaml", `
+- address: db
+  protocol: tcp
+  port: 5432
+- address: web
+  protocol: http
+  port: 8080
+  targets:
+  - name: web
+    selector: app=web
+`)
+	services, err := readServiceInterfaceManifest(list)
+	assert.Assert(t, err)
+	assert.Equal(t, len(services), 2)
+	assert.Equal(t, services[1].Targets[0].Selector, "app=web")
+
+	single := write("single.json", `{"address": "db", "protocol": "tcp", "port": 5432}`)
+	services, err = readServiceInterfaceManifest(single)
+	assert.Assert(t, err)
+	assert.Equal(t, len(services), 1)
+	assert.Equal(t, services[0].Port, 5432)
+
+	invalid := write("invalid.yaml", `{"address": "db", "prot": "tcp"}`)
+	_, err = readServiceInterfaceManifest(invalid)
+	assert.ErrorContains(t, err, "Could not parse manifest")
+	// the error for a single definition describes that definition
+	assert.ErrorContains(t, err, "prot")
+	assert.Assert(t, !strings.Contains(err.Error(), "[]"), err.Error())
+
+	invalidList := write("invalid-list.yaml", `
+- address: db
+  prot: tcp
+`)
+	_, err = readServiceInterfaceManifest(invalidList)
+	assert.ErrorContains(t, err, "prot")
+
+	_, err = readServiceInterfaceManifest(filepath.Join(dir, "missing.yaml"))
+	assert.ErrorContains(t, err, "Could not read manifest")
+}
+
+func Test_formatNetworkGraph(t *testing.T) {
+	graph := &types.NetworkGraph{
+		Sites: []types.NetworkGraphSite{
+			{Id: "site-a", Routers: []string{"router-a"}, Services: []string{"db", "web"}},
+			{Id: "site-b", Edge: true, Routers: []string{"router-b"}},
+		},
+		Links: []types.NetworkGraphLink{
+			{From: "router-b", To: "router-a", Role: "edge"},
+		},
+	}
+	assert.Equal(t, formatGraphDot(graph), `digraph skupper {
+  subgraph cluster_0 {
+    label="site-a\nservices: db, web";
+    "router-a";
+  }
+  subgraph cluster_1 {
+    label="site-b (edge)";
+    "router-b";
+  }
+  "router-b" -> "router-a" [label="edge", style=dashed];
+}
+`)
+	assert.Equal(t, formatGraphMermaid(graph), `graph LR
+  subgraph site0["site-a<br/>services: db, web"]
+    r0["router-a"]
+  end
+  subgraph site1["site-b (edge)"]
+    r1["router-b"]
+  end
+  r1 -. "edge" .-> r0
+`)
+	graph.Links[0] = types.NetworkGraphLink{From: "router-b", To: "router-a", Role: "inter-router", Cost: 2}
+	assert.Assert(t, strings.Contains(formatGraphDot(graph), `"router-b" -> "router-a" [label="cost 2"];`))
+	assert.Assert(t, strings.Contains(formatGraphMermaid(graph), `r1 -- "cost 2" --> r0`))
+}
+
+func Test_formatOutput(t *testing.T) {
+	connectors := []*types.ConnectorInspectResponse{
+		{
+			Connector: &types.Connector{Name: "conn1", Host: "example.com", Port: "55671", Cost: 2},
+			Connected: true,
+		},
+	}
+	out, err := formatOutput(connectors, "json")
+	assert.Assert(t, err)
+	assert.Equal(t, out, `[
+  {
+    "connector": {
+      "name": "conn1",
+      "host": "example.com",
+      "port": "55671",
+      "cost": 2
+    },
+    "connected": true
+  }
+]
+`)
+
+	status := &types.RouterInspectResponse{
+		Status: types.RouterStatusSpec{
+			Mode:           string(types.TransportModeInterior),
+			ConnectedSites: types.TransportConnectedSites{Direct: 1, Total: 1},
+		},
+		TransportVersion: "1.0",
+		ExposedServices:  2,
+	}
+	out, err = formatOutput(status, "yaml")
+	assert.Assert(t, err)
+	assert.Equal(t, out, `controllerVersion: ""
+exposedServices: 2
+status:
+  connectedSites:
+    direct: 1
+    indirect: 0
+    total: 1
+  mode: interior
+  transportReadyReplicas: 0
+transportVersion: "1.0"
+`)
+
+	_, err = formatOutput(status, "xml")
+	assert.Error(t, err, `Unsupported output format "xml"`)
+
+	outputFormat = "xml"
+	assert.Error(t, verifyOutputFormat(nil, nil), "output format must be one of: [table, json, yaml]")
+	outputFormat = "yaml"
+	assert.Assert(t, verifyOutputFormat(nil, nil))
+	assert.Assert(t, isStructuredOutput())
+	outputFormat = "table"
+	assert.Assert(t, !isStructuredOutput())
+}
+
+func Test_formatNetworkServices(t *testing.T) {
+	services := []*types.NetworkService{
+		{
+			Address:  "db",
+			Protocol: "tcp",
+			Origin:   "site-a",
+			Sites: []types.NetworkServiceSite{
+				{Id: "site-a", Targets: 0},
+				{Id: "site-b", Targets: 2},
+			},
+			Reachable: true,
+		},
+		{
+			Address:  "web",
+			Protocol: "http",
+			Sites: []types.NetworkServiceSite{
+				{Id: "site-a", Targets: 0},
+			},
+		},
+	}
+	assert.Equal(t, formatNetworkServices(services), `Services in the network:
+    db (tcp) defined by site site-a
+      => site site-a with 0 targets
+      => site site-b with 2 targets
+    web (http) has no reachable targets
+      => site site-a with 0 targets
+`)
+	assert.Equal(t, formatNetworkServices(nil), "No services in the network\n")
+}
@@ -81,30 +81,97 @@ func getCAFromSecret(secret *corev1.Secret) CertificateAuthority {
 	return CertificateAuthority{
 		Certificate: cert,
 		Key:         key,
-		CrtData:     secret.Data["tls.crt"],
+		CrtData:     GetCABundle(secret),
 	}
 }
 
-func generateSecret(name string, subject string, hosts string, ca *CertificateAuthority) corev1.Secret {
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+// The key under which a CA secret retains its previous certificate
+// while a rotation is in progress
+const PreviousCertificateKey = "previous.crt"
+
+// Returns the certificates to be trusted for the CA held in the
+// specified secret, which during a rotation includes the certificate
+// it is replacing
+func GetCABundle(ca *corev1.Secret) []byte {
+	bundle := append([]byte{}, ca.Data["tls.crt"]...)
+	if previous, ok := ca.Data[PreviousCertificateKey]; ok {
+		bundle = append(bundle, previous...)
+	}
+	return bundle
+}
+
+func IsRotationInProgress(ca *corev1.Secret) bool {
+	_, ok := ca.Data[PreviousCertificateKey]
+	return ok
+}
+
+// Generates a replacement for the CA held in the specified secret,
+// which retains the current certificate so that both continue to be
+// trusted until the rotation is completed
+func GenerateRotatedCASecret(current *corev1.Secret) corev1.Secret {
+	secret := GenerateCASecret(current.ObjectMeta.Name, current.ObjectMeta.Name)
+	secret.ObjectMeta = *current.ObjectMeta.DeepCopy()
+	secret.Data[PreviousCertificateKey] = current.Data["tls.crt"]
+	return secret
+}
+
+// Completes the rotation of the CA held in the specified secret, such
+// that its previous certificate is no longer trusted
+func DropPreviousCA(ca *corev1.Secret) {
+	delete(ca.Data, PreviousCertificateKey)
+}
+
+// Reissues the certificate held in the specified secret from the
+// specified CA, retaining its subject, hosts and any additional data
+func ReissueSecret(current *corev1.Secret, ca *corev1.Secret) (corev1.Secret, error) {
+	cert, err := GetCertificateFromSecret(current)
 	if err != nil {
-		log.Fatalf("failed to generate private key: %s", err)
+		return corev1.Secret{}, err
+	}
+	hosts := []string{}
+	hosts = append(hosts, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		hosts = append(hosts, ip.String())
+	}
+	caCert := getCAFromSecret(ca)
+	secret := generateSecretWithSubject(current.ObjectMeta.Name, pkix.Name{CommonName: cert.Subject.CommonName, OrganizationalUnit: cert.Subject.OrganizationalUnit}, newSerialNumber(), strings.Join(hosts, ","), DefaultValidity, &caCert)
+	secret.ObjectMeta = *current.ObjectMeta.DeepCopy()
+	secret.Type = current.Type
+	for k, v := range current.Data {
+		if _, ok := secret.Data[k]; !ok {
+			secret.Data[k] = v
+		}
 	}
+	return secret, nil
+}
 
-	notBefore := time.Now()
-	notAfter := notBefore.Add(5 * 365 * 24 * time.Hour) //TODO: make configurable?
+const DefaultValidity time.Duration = 5 * 365 * 24 * time.Hour
 
+func newSerialNumber() *big.Int {
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
 	if err != nil {
 		log.Fatalf("failed to generate serial number: %s", err)
 	}
+	return serialNumber
+}
+
+func generateSecret(name string, subject string, hosts string, ca *CertificateAuthority) corev1.Secret {
+	return generateSecretWithSubject(name, pkix.Name{CommonName: subject}, newSerialNumber(), hosts, DefaultValidity, ca)
+}
+
+func generateSecretWithSubject(name string, subject pkix.Name, serialNumber *big.Int, hosts string, validity time.Duration, ca *CertificateAuthority) corev1.Secret {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("failed to generate private key: %s", err)
+	}
+
+	notBefore := time.Now()
+	notAfter := notBefore.Add(validity)
 
 	template := x509.Certificate{
-		SerialNumber: serialNumber,
-		Subject: pkix.Name{
-			CommonName: subject,
-		},
+		SerialNumber:          serialNumber,
+		Subject:               subject,
 		NotBefore:             notBefore,
 		NotAfter:              notAfter,
 		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
@@ -195,6 +262,46 @@ func GenerateSecret(name string, subject string, hosts string, ca *corev1.Secret
 	return generateSecret(name, subject, hosts, &caCert)
 }
 
+// Generates a secret for a connection token, valid for the specified
+// duration, along with the certificate of the CA that signed it. Each
+// token has its own CA, whose key is discarded once the token is
+// signed, so that the issuing site can refuse a token by no longer
+// trusting that CA. The ca.crt of the token remains that of the
+// specified site CA, with which the site's router is verified. The
+// serial number of the certificate is included in its subject as the
+// organizational unit, so that the issuing site can identify
+// connections established using the token.
+func GenerateTokenSecret(name string, subject string, hosts string, validity time.Duration, ca *corev1.Secret) (corev1.Secret, []byte) {
+	tokenCA := generateSecretWithSubject(name+"-ca", pkix.Name{CommonName: subject + "-ca"}, newSerialNumber(), "", validity, nil)
+	caCert := getCAFromSecret(&tokenCA)
+	caCert.CrtData = GetCABundle(ca)
+	serialNumber := newSerialNumber()
+	secret := generateSecretWithSubject(name, pkix.Name{CommonName: subject, OrganizationalUnit: []string{serialNumber.Text(16)}}, serialNumber, hosts, validity, &caCert)
+	return secret, tokenCA.Data["tls.crt"]
+}
+
+func GetCertificateFromSecret(secret *corev1.Secret) (*x509.Certificate, error) {
+	block, _ := pem.Decode(secret.Data["tls.crt"])
+	if block == nil {
+		return nil, fmt.Errorf("No certificate found in secret %s", secret.ObjectMeta.Name)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// Extracts the token serial number from the subject of a connection,
+// as reported by the router for peers authenticated through a token
+// certificate (e.g. "CN=skupper,OU=1f3a..."). Tokens issued before
+// serial numbers were included have none.
+func GetTokenSerialFromSubject(subject string) string {
+	for _, part := range strings.Split(subject, ",") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, "OU=") {
+			return strings.TrimPrefix(part, "OU=")
+		}
+	}
+	return ""
+}
+
 func GenerateCASecret(name string, subject string) corev1.Secret {
 	return generateSecret(name, subject, "", nil)
 }
@@ -69,6 +69,27 @@ func GetConfigMap(name string, namespace string, cli kubernetes.Interface) (*cor
 	}
 }
 
+// UpdateSkupperServicesAnnotation sets an annotation on the
+// skupper-services configmap, if it does not already hold that value
+func UpdateSkupperServicesAnnotation(key string, value string, namespace string, cli kubernetes.Interface) error {
+	current, err := cli.CoreV1().ConfigMaps(namespace).Get("skupper-services", metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Could not retrive configmap 'skupper-services', Error: %v", err)
+	}
+	if current.ObjectMeta.Annotations[key] == value {
+		return nil
+	}
+	if current.ObjectMeta.Annotations == nil {
+		current.ObjectMeta.Annotations = map[string]string{}
+	}
+	current.ObjectMeta.Annotations[key] = value
+	_, err = cli.CoreV1().ConfigMaps(namespace).Update(current)
+	if err != nil {
+		return fmt.Errorf("Failed to update skupper-services config map: %s", err)
+	}
+	return nil
+}
+
 func UpdateSkupperServices(changed []types.ServiceInterface, deleted []string, origin string, namespace string, cli kubernetes.Interface) error {
 	current, err := cli.CoreV1().ConfigMaps(namespace).Get("skupper-services", metav1.GetOptions{})
 	if err == nil {
@@ -9,9 +9,10 @@ import (
 // TODO - remove constants, get from spec
 func ContainerForController(ds types.DeploymentSpec) corev1.Container {
 	container := corev1.Container{
-		Image: ds.Image,
-		Name:  types.ControllerContainerName,
-		Env:   ds.EnvVar,
+		Image:     ds.Image,
+		Name:      types.ControllerContainerName,
+		Env:       ds.EnvVar,
+		Resources: ds.Resources,
 	}
 	return container
 }
@@ -29,8 +30,9 @@ func ContainerForTransport(ds types.DeploymentSpec) corev1.Container {
 				},
 			},
 		},
-		Env:   ds.EnvVar,
-		Ports: ds.Ports,
+		Env:       ds.EnvVar,
+		Ports:     ds.Ports,
+		Resources: ds.Resources,
 	}
 	return container
 }
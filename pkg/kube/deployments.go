@@ -9,6 +9,7 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -95,6 +96,15 @@ func CheckProxyStatefulSet(desired types.ServiceInterface, actual *appsv1.Statef
 		SetEnvVarForStatefulSet(actual, "QDROUTERD_CONF", desiredConfig)
 		change = true
 	}
+	// keep the placement and resources in line with the transport,
+	// which may have changed since the proxy was created
+	if transportDep, err := cli.AppsV1().Deployments(namespace).Get(types.TransportDeploymentName, metav1.GetOptions{}); err == nil {
+		original := actual.Spec.Template.Spec.DeepCopy()
+		copyTransportScheduling(&actual.Spec.Template.Spec, &transportDep.Spec.Template.Spec)
+		if !equality.Semantic.DeepEqual(original, &actual.Spec.Template.Spec) {
+			change = true
+		}
+	}
 	if change {
 		return cli.AppsV1().StatefulSets(namespace).Update(actual)
 	} else {
@@ -197,6 +207,8 @@ func NewProxyStatefulSet(serviceInterface types.ServiceInterface, config string,
 		},
 	}
 
+	copyTransportScheduling(&proxyStatefulSet.Spec.Template.Spec, &transportDep.Spec.Template.Spec)
+
 	created, err := statefulSets.Create(proxyStatefulSet)
 
 	if err != nil {
@@ -247,6 +259,7 @@ func NewControllerDeployment(van *types.RouterSpec, ownerRef *metav1.OwnerRefere
 		}
 
 		dep.Spec.Template.Spec.Volumes = van.Controller.Volumes
+		SetPodScheduling(&dep.Spec.Template.Spec, van.Controller)
 		for i, _ := range van.Controller.VolumeMounts {
 			dep.Spec.Template.Spec.Containers[i].VolumeMounts = van.Controller.VolumeMounts[i]
 		}
@@ -309,6 +322,7 @@ func NewTransportDeployment(van *types.RouterSpec, ownerRef *metav1.OwnerReferen
 			}
 		}
 		dep.Spec.Template.Spec.Volumes = van.Transport.Volumes
+		SetPodScheduling(&dep.Spec.Template.Spec, van.Transport)
 		for i, _ := range van.Transport.VolumeMounts {
 			dep.Spec.Template.Spec.Containers[i].VolumeMounts = van.Transport.VolumeMounts[i]
 		}
@@ -337,19 +351,80 @@ func GetContainerPort(deployment *appsv1.Deployment) int32 {
 // WaitDeploymentReadyReplicas waits till given deployment contains the expected
 // number of readyReplicas, or until it times out
 func WaitDeploymentReadyReplicas(name string, namespace string, readyReplicas int, cli kubernetes.Interface, timeout, interval time.Duration) (*appsv1.Deployment, error) {
-	var dep *appsv1.Deployment
-	var err error
-
 	ctx, cancel := context.WithTimeout(context.TODO(), timeout)
 	defer cancel()
-	err = utils.RetryWithContext(ctx, interval, func() (bool, error) {
-		dep, err = cli.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+	return waitDeploymentReplicas(ctx, name, namespace, func(dep *appsv1.Deployment) int32 {
+		return int32(readyReplicas)
+	}, cli, interval)
+}
+
+// WaitDeploymentReady waits till all the replicas the given deployment
+// specifies are ready, or until the context is done
+func WaitDeploymentReady(ctx context.Context, name string, namespace string, cli kubernetes.Interface, interval time.Duration) (*appsv1.Deployment, error) {
+	return waitDeploymentReplicas(ctx, name, namespace, func(dep *appsv1.Deployment) int32 {
+		if dep.Spec.Replicas != nil {
+			return *dep.Spec.Replicas
+		}
+		return 1
+	}, cli, interval)
+}
+
+// On timeout the error returned describes what was still pending
+func waitDeploymentReplicas(ctx context.Context, name string, namespace string, expected func(*appsv1.Deployment) int32, cli kubernetes.Interface, interval time.Duration) (*appsv1.Deployment, error) {
+	var dep *appsv1.Deployment
+	err := utils.RetryWithContext(ctx, interval, func() (bool, error) {
+		current, err := cli.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
 		if err != nil {
 			// dep does not exist yet
 			return false, nil
 		}
-		return dep.Status.ReadyReplicas == int32(readyReplicas), nil
+		dep = current
+		return dep.Status.ReadyReplicas == expected(dep), nil
 	})
+	if err != nil {
+		if dep == nil {
+			return nil, fmt.Errorf("Timed out waiting for deployment %s to be created", name)
+		}
+		return dep, fmt.Errorf("Timed out waiting for deployment %s to be ready: %d of %d replicas ready", name, dep.Status.ReadyReplicas, expected(dep))
+	}
+	return dep, nil
+}
+
+// RolloutDeployment triggers a rolling restart of the given deployment
+// by recording the specified reason in its pod template
+func RolloutDeployment(name string, namespace string, annotation string, value string, cli kubernetes.Interface) error {
+	dep, err := cli.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if dep.Spec.Template.ObjectMeta.Annotations == nil {
+		dep.Spec.Template.ObjectMeta.Annotations = map[string]string{}
+	}
+	dep.Spec.Template.ObjectMeta.Annotations[annotation] = value
+	_, err = cli.AppsV1().Deployments(namespace).Update(dep)
+	return err
+}
 
-	return dep, err
+func IsDeploymentRolledOut(dep *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if dep.Spec.Replicas != nil {
+		replicas = *dep.Spec.Replicas
+	}
+	return dep.Status.ObservedGeneration >= dep.ObjectMeta.Generation &&
+		dep.Status.UpdatedReplicas == replicas &&
+		dep.Status.Replicas == replicas &&
+		dep.Status.AvailableReplicas == replicas
+}
+
+// WaitDeploymentRolledOut waits till all replicas of the given deployment
+// have been updated to its current template and are available, or until
+// the context is done
+func WaitDeploymentRolledOut(ctx context.Context, name string, namespace string, cli kubernetes.Interface, interval time.Duration) error {
+	return utils.RetryWithContext(ctx, interval, func() (bool, error) {
+		dep, err := cli.AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return IsDeploymentRolledOut(dep), nil
+	})
 }
@@ -1,13 +1,16 @@
 package kube_test
 
 import (
+	"context"
 	"fmt"
 	"github.com/skupperproject/skupper/pkg/kube"
 	"gotest.tools/assert"
 	v1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 	"testing"
+	"time"
 )
 
 const (
@@ -73,3 +76,39 @@ func TestGetContainerPort(t *testing.T) {
 	}
 
 }
+
+func TestWaitDeploymentReady(t *testing.T) {
+	replicas := int32(2)
+	dep := &v1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "router",
+			Namespace: NS,
+		},
+		Spec: v1.DeploymentSpec{
+			Replicas: &replicas,
+		},
+		Status: v1.DeploymentStatus{
+			ReadyReplicas: 1,
+		},
+	}
+	cli := fake.NewSimpleClientset(dep)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err := kube.WaitDeploymentReady(ctx, "router", NS, cli, 50*time.Millisecond)
+	assert.Error(t, err, "Timed out waiting for deployment router to be ready: 1 of 2 replicas ready")
+
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = kube.WaitDeploymentReady(ctx, "missing", NS, cli, 50*time.Millisecond)
+	assert.Error(t, err, "Timed out waiting for deployment missing to be created")
+
+	dep.Status.ReadyReplicas = 2
+	_, err = cli.AppsV1().Deployments(NS).UpdateStatus(dep)
+	assert.Assert(t, err)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	result, err := kube.WaitDeploymentReady(ctx, "router", NS, cli, 50*time.Millisecond)
+	assert.Assert(t, err)
+	assert.Equal(t, result.Status.ReadyReplicas, int32(2))
+}
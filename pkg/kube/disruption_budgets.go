@@ -0,0 +1,74 @@
+package kube
+
+import (
+	"fmt"
+
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/skupperproject/skupper/api/types"
+)
+
+// GetTransportDisruptionBudget returns the budget allowing no more than
+// one router replica to be voluntarily disrupted at a time, or nil if
+// the router is not replicated
+func GetTransportDisruptionBudget(van *types.RouterSpec, owner *metav1.OwnerReference) *policyv1beta1.PodDisruptionBudget {
+	if van.Transport.Replicas <= 1 {
+		return nil
+	}
+	maxUnavailable := intstr.FromInt(1)
+	budget := &policyv1beta1.PodDisruptionBudget{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "policy/v1beta1",
+			Kind:       "PodDisruptionBudget",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: types.TransportDisruptionBudgetName,
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			MaxUnavailable: &maxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"skupper.io/component": types.TransportComponentName,
+				},
+			},
+		},
+	}
+	if owner != nil {
+		budget.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+	return budget
+}
+
+// SyncTransportDisruptionBudget creates, replaces or removes the
+// disruption budget of the router to match its replicas. The spec of a
+// budget cannot be updated in older clusters, so a changed budget is
+// deleted and recreated.
+func SyncTransportDisruptionBudget(van *types.RouterSpec, owner *metav1.OwnerReference, namespace string, cli kubernetes.Interface) error {
+	desired := GetTransportDisruptionBudget(van, owner)
+	budgets := cli.PolicyV1beta1().PodDisruptionBudgets(namespace)
+	actual, err := budgets.Get(types.TransportDisruptionBudgetName, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("Failed to retrieve router disruption budget: %w", err)
+	}
+	exists := err == nil
+	if exists && desired != nil && equality.Semantic.DeepEqual(actual.Spec, desired.Spec) {
+		return nil
+	}
+	if exists {
+		err = budgets.Delete(types.TransportDisruptionBudgetName, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("Failed to delete router disruption budget: %w", err)
+		}
+	}
+	if desired != nil {
+		if _, err = budgets.Create(desired); err != nil {
+			return fmt.Errorf("Failed to create router disruption budget: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package kube
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/skupperproject/skupper/api/v1alpha1"
+)
+
+// IsResourceAvailable determines whether the custom resource definition
+// for the specified resource has been installed in the cluster
+func IsResourceAvailable(resource schema.GroupVersionResource, kubeclient kubernetes.Interface) bool {
+	resources, err := kubeclient.Discovery().ServerResourcesForGroupVersion(resource.GroupVersion().String())
+	if err != nil {
+		return false
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == resource.Resource {
+			return true
+		}
+	}
+	return false
+}
+
+func GetOwnerReferenceForResource(kind string, meta metav1.ObjectMeta) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		Kind:       kind,
+		Name:       meta.Name,
+		UID:        meta.UID,
+	}
+}
+
+// UpdateResourceStatus writes the status of one of the skupper custom
+// resources through its status subresource
+func UpdateResourceStatus(resource schema.GroupVersionResource, obj interface{}, namespace string, dc dynamic.Interface) error {
+	u, err := v1alpha1.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	_, err = dc.Resource(resource).Namespace(namespace).UpdateStatus(u, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("Failed to update status of %s %s: %w", resource.Resource, u.GetName(), err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package kube
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/skupperproject/skupper/api/types"
+)
+
+// GetResourceRequirements returns the resources requested for and
+// limiting a container
+func GetResourceRequirements(tuning types.Tuning) (corev1.ResourceRequirements, error) {
+	requirements := corev1.ResourceRequirements{}
+	add := func(list *corev1.ResourceList, name corev1.ResourceName, value string) error {
+		if value == "" {
+			return nil
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return fmt.Errorf("Invalid %s quantity %q: %s", name, value, err)
+		}
+		if *list == nil {
+			*list = corev1.ResourceList{}
+		}
+		(*list)[name] = quantity
+		return nil
+	}
+	if err := add(&requirements.Requests, corev1.ResourceCPU, tuning.Cpu); err != nil {
+		return requirements, err
+	}
+	if err := add(&requirements.Requests, corev1.ResourceMemory, tuning.Memory); err != nil {
+		return requirements, err
+	}
+	if err := add(&requirements.Limits, corev1.ResourceCPU, tuning.CpuLimit); err != nil {
+		return requirements, err
+	}
+	if err := add(&requirements.Limits, corev1.ResourceMemory, tuning.MemoryLimit); err != nil {
+		return requirements, err
+	}
+	for name, limit := range requirements.Limits {
+		if request, ok := requirements.Requests[name]; ok && request.Cmp(limit) > 0 {
+			return requirements, fmt.Errorf("The %s requested (%s) exceeds the limit (%s)", name, request.String(), limit.String())
+		}
+	}
+	return requirements, nil
+}
+
+// ParseNodeLabels parses comma separated key=value pairs into a map
+func ParseNodeLabels(value string) (map[string]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	labels := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid node label %q, expected key=value", pair)
+		}
+		labels[parts[0]] = parts[1]
+	}
+	return labels, nil
+}
+
+// GetNodeAffinity returns an affinity preferring, though not
+// requiring, nodes with the labels given
+func GetNodeAffinity(labels map[string]string) *corev1.Affinity {
+	if len(labels) == 0 {
+		return nil
+	}
+	keys := []string{}
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	requirements := []corev1.NodeSelectorRequirement{}
+	for _, key := range keys {
+		requirements = append(requirements, corev1.NodeSelectorRequirement{
+			Key:      key,
+			Operator: corev1.NodeSelectorOpIn,
+			Values:   []string{labels[key]},
+		})
+	}
+	return &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []corev1.PreferredSchedulingTerm{
+				{
+					Weight: 100,
+					Preference: corev1.NodeSelectorTerm{
+						MatchExpressions: requirements,
+					},
+				},
+			},
+		},
+	}
+}
+
+// WithReplicaAntiAffinity adds to an affinity a preference, though not
+// a requirement, for the pods with the labels given to be scheduled on
+// different nodes
+func WithReplicaAntiAffinity(affinity *corev1.Affinity, labels map[string]string) *corev1.Affinity {
+	if affinity == nil {
+		affinity = &corev1.Affinity{}
+	}
+	affinity.PodAntiAffinity = &corev1.PodAntiAffinity{
+		PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+			{
+				Weight: 100,
+				PodAffinityTerm: corev1.PodAffinityTerm{
+					LabelSelector: &metav1.LabelSelector{
+						MatchLabels: labels,
+					},
+					TopologyKey: "kubernetes.io/hostname",
+				},
+			},
+		},
+	}
+	return affinity
+}
+
+// ParseTolerations parses tolerations of the form key[=value][:effect],
+// as used by kubectl taint. Without a value, any taint with the key is
+// tolerated; without an effect, any effect is.
+func ParseTolerations(values []string) ([]corev1.Toleration, error) {
+	tolerations := []corev1.Toleration{}
+	for _, value := range values {
+		toleration := corev1.Toleration{}
+		if i := strings.LastIndex(value, ":"); i >= 0 {
+			toleration.Effect = corev1.TaintEffect(value[i+1:])
+			value = value[:i]
+			switch toleration.Effect {
+			case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+			default:
+				return nil, fmt.Errorf("Invalid toleration effect %q, expected NoSchedule, PreferNoSchedule or NoExecute", toleration.Effect)
+			}
+		}
+		parts := strings.SplitN(value, "=", 2)
+		if parts[0] == "" {
+			return nil, fmt.Errorf("Invalid toleration %q, a key is required", value)
+		}
+		toleration.Key = parts[0]
+		if len(parts) == 2 {
+			toleration.Operator = corev1.TolerationOpEqual
+			toleration.Value = parts[1]
+		} else {
+			toleration.Operator = corev1.TolerationOpExists
+		}
+		tolerations = append(tolerations, toleration)
+	}
+	if len(tolerations) == 0 {
+		return nil, nil
+	}
+	return tolerations, nil
+}
+
+// SetPodScheduling applies the placement of a deployment spec to the
+// spec of its pods
+func SetPodScheduling(spec *corev1.PodSpec, ds types.DeploymentSpec) {
+	spec.NodeSelector = ds.NodeSelector
+	spec.Affinity = ds.Affinity
+	spec.Tolerations = ds.Tolerations
+	spec.PriorityClassName = ds.PriorityClassName
+}
+
+// Pods running the router on behalf of the transport deployment, such
+// as the headless proxies, are placed like the transport and given the
+// same resources
+func copyTransportScheduling(spec *corev1.PodSpec, transport *corev1.PodSpec) {
+	spec.NodeSelector = transport.NodeSelector
+	spec.Affinity = nil
+	if transport.Affinity != nil && transport.Affinity.NodeAffinity != nil {
+		spec.Affinity = &corev1.Affinity{NodeAffinity: transport.Affinity.NodeAffinity}
+	}
+	spec.Tolerations = transport.Tolerations
+	spec.PriorityClassName = transport.PriorityClassName
+	for _, container := range transport.Containers {
+		if container.Name == types.TransportContainerName {
+			for i := range spec.Containers {
+				spec.Containers[i].Resources = container.Resources
+			}
+		}
+	}
+}
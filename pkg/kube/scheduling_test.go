@@ -0,0 +1,99 @@
+package kube_test
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/skupperproject/skupper/api/types"
+	"github.com/skupperproject/skupper/pkg/kube"
+)
+
+func TestParseTolerations(t *testing.T) {
+	tolerations, err := kube.ParseTolerations([]string{"dedicated=skupper:NoSchedule", "spot", "gpu:NoExecute"})
+	assert.Assert(t, err)
+	assert.DeepEqual(t, tolerations, []corev1.Toleration{
+		{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "skupper", Effect: corev1.TaintEffectNoSchedule},
+		{Key: "spot", Operator: corev1.TolerationOpExists},
+		{Key: "gpu", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+	})
+	tolerations, err = kube.ParseTolerations(nil)
+	assert.Assert(t, err)
+	assert.Assert(t, tolerations == nil)
+	_, err = kube.ParseTolerations([]string{"=skupper"})
+	assert.Error(t, err, `Invalid toleration "=skupper", a key is required`)
+}
+
+func TestGetResourceRequirements(t *testing.T) {
+	requirements, err := kube.GetResourceRequirements(types.Tuning{})
+	assert.Assert(t, err)
+	assert.Assert(t, requirements.Requests == nil && requirements.Limits == nil)
+
+	requirements, err = kube.GetResourceRequirements(types.Tuning{Cpu: "250m", CpuLimit: "1", MemoryLimit: "512Mi"})
+	assert.Assert(t, err)
+	assert.Equal(t, len(requirements.Requests), 1)
+	assert.Equal(t, len(requirements.Limits), 2)
+
+	_, err = kube.GetResourceRequirements(types.Tuning{Cpu: "2", CpuLimit: "1"})
+	assert.Error(t, err, "The cpu requested (2) exceeds the limit (1)")
+	_, err = kube.GetResourceRequirements(types.Tuning{Memory: "lots"})
+	assert.ErrorContains(t, err, `Invalid memory quantity "lots"`)
+}
+
+// Headless proxies run the router, so are placed like the transport
+// and given its resources, though not its affinity to other pods
+func TestProxyStatefulSetScheduling(t *testing.T) {
+	transport := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      types.TransportDeploymentName,
+			Namespace: NS,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name: types.TransportContainerName,
+							Resources: corev1.ResourceRequirements{
+								Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+							},
+						},
+					},
+					NodeSelector: map[string]string{"zone": "east"},
+					Affinity: &corev1.Affinity{
+						NodeAffinity:    kube.GetNodeAffinity(map[string]string{"disk": "ssd"}).NodeAffinity,
+						PodAntiAffinity: &corev1.PodAntiAffinity{},
+					},
+					PriorityClassName: "high",
+				},
+			},
+		},
+	}
+	cli := fake.NewSimpleClientset(transport)
+	service := types.ServiceInterface{
+		Address:  "db",
+		Protocol: "tcp",
+		Port:     5432,
+		Headless: &types.Headless{Name: "db", Size: 2},
+	}
+	proxy, err := kube.NewProxyStatefulSet(service, "{}", NS, cli)
+	assert.Assert(t, err)
+	spec := proxy.Spec.Template.Spec
+	assert.DeepEqual(t, spec.NodeSelector, transport.Spec.Template.Spec.NodeSelector)
+	assert.Assert(t, spec.Affinity.PodAntiAffinity == nil)
+	assert.Equal(t, spec.PriorityClassName, "high")
+	assert.Assert(t, spec.Containers[0].Resources.Limits.Memory().Equal(resource.MustParse("1Gi")))
+
+	// changes to the transport are applied to an existing proxy
+	transport.Spec.Template.Spec.NodeSelector = map[string]string{"zone": "west"}
+	_, err = cli.AppsV1().Deployments(NS).Update(transport)
+	assert.Assert(t, err)
+	proxy, err = kube.CheckProxyStatefulSet(service, proxy, "{}", NS, cli)
+	assert.Assert(t, err)
+	assert.Equal(t, proxy.Spec.Template.Spec.NodeSelector["zone"], "west")
+}
@@ -44,22 +44,41 @@ func GetService(name string, namespace string, kubeclient kubernetes.Interface)
 	return current, err
 }
 
-func NewServiceForAddress(address string, port int, targetPort int, owner *metav1.OwnerReference, namespace string, kubeclient kubernetes.Interface) (*corev1.Service, error) {
+// GetServicePortProtocol returns the protocol of the kubernetes service
+// port through which a service with the given skupper protocol is
+// accessed
+func GetServicePortProtocol(protocol string) corev1.Protocol {
+	if protocol == "udp" {
+		return corev1.ProtocolUDP
+	}
+	return corev1.ProtocolTCP
+}
+
+func NewServicePort(name string, protocol string, port int, targetPort int) corev1.ServicePort {
+	return corev1.ServicePort{
+		Name:       name,
+		Protocol:   GetServicePortProtocol(protocol),
+		Port:       int32(port),
+		TargetPort: intstr.FromInt(targetPort),
+	}
+}
+
+func NewServiceForAddress(address string, ports []corev1.ServicePort, owner *metav1.OwnerReference, namespace string, kubeclient kubernetes.Interface) (*corev1.Service, error) {
 	labels := GetLabelsForRouter()
-	service := makeServiceObjectForAddress(address, port, targetPort, labels, owner)
+	service := makeServiceObjectForAddress(address, ports, labels, owner)
 	return createServiceFromObject(service, namespace, kubeclient)
 }
 
-func NewHeadlessServiceForAddress(address string, port int, targetPort int, owner *metav1.OwnerReference, namespace string, kubeclient kubernetes.Interface) (*corev1.Service, error) {
+func NewHeadlessServiceForAddress(address string, protocol string, port int, targetPort int, owner *metav1.OwnerReference, namespace string, kubeclient kubernetes.Interface) (*corev1.Service, error) {
 	labels := map[string]string{
 		"internal.skupper.io/service": address,
 	}
-	service := makeServiceObjectForAddress(address, port, targetPort, labels, owner)
+	service := makeServiceObjectForAddress(address, []corev1.ServicePort{NewServicePort(address, protocol, port, targetPort)}, labels, owner)
 	service.Spec.ClusterIP = "None"
 	return createServiceFromObject(service, namespace, kubeclient)
 }
 
-func makeServiceObjectForAddress(address string, port int, targetPort int, labels map[string]string, owner *metav1.OwnerReference) *corev1.Service {
+func makeServiceObjectForAddress(address string, ports []corev1.ServicePort, labels map[string]string, owner *metav1.OwnerReference) *corev1.Service {
 	// TODO: make common service creation and deal with annotation, label differences
 	service := &corev1.Service{
 		TypeMeta: metav1.TypeMeta{
@@ -74,13 +93,7 @@ func makeServiceObjectForAddress(address string, port int, targetPort int, label
 		},
 		Spec: corev1.ServiceSpec{
 			Selector: labels,
-			Ports: []corev1.ServicePort{
-				corev1.ServicePort{
-					Name:       address,
-					Port:       int32(port),
-					TargetPort: intstr.FromInt(targetPort),
-				},
-			},
+			Ports:    ports,
 		},
 	}
 	if owner != nil {
@@ -88,3 +88,20 @@ func TestGetPortForServiceTarget(t *testing.T) {
 		})
 	}
 }
+
+func TestNewServiceForAddress(t *testing.T) {
+	kubeclient := fake.NewSimpleClientset()
+	ports := []corev1.ServicePort{
+		NewServicePort("dns", "udp", 53, 1024),
+		NewServicePort("admin", "tcp", 8080, 1025),
+	}
+	_, err := NewServiceForAddress("dns", ports, nil, "test", kubeclient)
+	assert.Assert(t, err)
+	service, err := kubeclient.CoreV1().Services("test").Get("dns", metav1.GetOptions{})
+	assert.Assert(t, err)
+	assert.Equal(t, len(service.Spec.Ports), 2)
+	assert.Equal(t, service.Spec.Ports[0].Protocol, corev1.ProtocolUDP)
+	assert.Equal(t, service.Spec.Ports[0].TargetPort.IntValue(), 1024)
+	assert.Equal(t, service.Spec.Ports[1].Protocol, corev1.ProtocolTCP)
+	assert.Equal(t, service.Spec.Ports[1].Name, "admin")
+}
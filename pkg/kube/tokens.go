@@ -0,0 +1,118 @@
+package kube
+
+import (
+	jsonencoding "encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/skupperproject/skupper/api/types"
+)
+
+func GetIssuedTokensFromConfigMap(cm *corev1.ConfigMap) (map[string]*types.IssuedToken, error) {
+	tokens := map[string]*types.IssuedToken{}
+	for name, data := range cm.Data {
+		token := types.IssuedToken{}
+		if err := jsonencoding.Unmarshal([]byte(data), &token); err != nil {
+			return nil, fmt.Errorf("Failed to read record for token %s: %s", name, err)
+		}
+		tokens[name] = &token
+	}
+	return tokens, nil
+}
+
+func UpdateIssuedTokensConfigMap(cm *corev1.ConfigMap, tokens map[string]*types.IssuedToken) error {
+	data := map[string]string{}
+	for name, token := range tokens {
+		encoded, err := jsonencoding.Marshal(token)
+		if err != nil {
+			return fmt.Errorf("Failed to encode record for token %s: %s", name, err)
+		}
+		data[name] = string(encoded)
+	}
+	cm.Data = data
+	return nil
+}
+
+// Returns the records for tokens issued in the specified namespace,
+// along with the configmap they are held in, which will be nil if no
+// tokens have yet been issued.
+func GetIssuedTokens(namespace string, cli kubernetes.Interface) (*corev1.ConfigMap, map[string]*types.IssuedToken, error) {
+	cm, err := cli.CoreV1().ConfigMaps(namespace).Get(types.IssuedTokensConfigMap, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, map[string]*types.IssuedToken{}, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	tokens, err := GetIssuedTokensFromConfigMap(cm)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cm, tokens, nil
+}
+
+func RecordIssuedToken(token *types.IssuedToken, owner *metav1.OwnerReference, namespace string, cli kubernetes.Interface) error {
+	err := retry.OnError(retry.DefaultRetry, func(err error) bool {
+		// the configmap may be created by another token issued
+		// concurrently
+		return errors.IsConflict(err) || errors.IsAlreadyExists(err)
+	}, func() error {
+		cm, tokens, err := GetIssuedTokens(namespace, cli)
+		if err != nil {
+			return err
+		}
+		tokens[token.Name] = token
+		if cm == nil {
+			cm = &corev1.ConfigMap{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "v1",
+					Kind:       "ConfigMap",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name: types.IssuedTokensConfigMap,
+				},
+			}
+			if owner != nil {
+				cm.ObjectMeta.OwnerReferences = []metav1.OwnerReference{*owner}
+			}
+			if err = UpdateIssuedTokensConfigMap(cm, tokens); err != nil {
+				return err
+			}
+			_, err = cli.CoreV1().ConfigMaps(namespace).Create(cm)
+			return err
+		}
+		if err = UpdateIssuedTokensConfigMap(cm, tokens); err != nil {
+			return err
+		}
+		_, err = cli.CoreV1().ConfigMaps(namespace).Update(cm)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to record issued token: %w", err)
+	}
+	return nil
+}
+
+// GetTrustedTokenCAs returns the certificates of the CAs of the tokens
+// that are still valid, which the router trusts in addition to the
+// site CA
+func GetTrustedTokenCAs(tokens map[string]*types.IssuedToken, now time.Time) []byte {
+	names := []string{}
+	for name, token := range tokens {
+		if token.IsTrusted(now) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	bundle := []byte{}
+	for _, name := range names {
+		bundle = append(bundle, tokens[name].CA...)
+	}
+	return bundle
+}
@@ -68,3 +68,57 @@ func RemoveSecretVolumeForDeployment(name string, dep *appsv1.Deployment, index
 	}
 	dep.Spec.Template.Spec.Containers[index].VolumeMounts = volumeMounts
 }
+
+func AppendNamedSecretVolume(volumes *[]corev1.Volume, mounts *[]corev1.VolumeMount, volName string, secretName string, path string) {
+	*volumes = append(*volumes, corev1.Volume{
+		Name: volName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: secretName,
+			},
+		},
+	})
+	*mounts = append(*mounts, corev1.VolumeMount{
+		Name:      volName,
+		MountPath: path,
+	})
+}
+
+// AppendProjectedSecretVolume mounts the secrets given through a single
+// projected volume. The secrets are optional, and as with any secret
+// volume changes to their data reach running pods without a restart.
+func AppendProjectedSecretVolume(volumes *[]corev1.Volume, mounts *[]corev1.VolumeMount, volName string, secretNames []string, path string) {
+	optional := true
+	sources := []corev1.VolumeProjection{}
+	for _, name := range secretNames {
+		sources = append(sources, corev1.VolumeProjection{
+			Secret: &corev1.SecretProjection{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: name,
+				},
+				Optional: &optional,
+			},
+		})
+	}
+	*volumes = append(*volumes, corev1.Volume{
+		Name: volName,
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: sources,
+			},
+		},
+	})
+	*mounts = append(*mounts, corev1.VolumeMount{
+		Name:      volName,
+		MountPath: path,
+	})
+}
+
+func HasVolume(name string, dep *appsv1.Deployment) bool {
+	for _, v := range dep.Spec.Template.Spec.Volumes {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
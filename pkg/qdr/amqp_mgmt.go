@@ -45,6 +45,14 @@ func (r Record) AsBool(field string) bool {
 	}
 }
 
+func (r Record) AsBoolPtr(field string) *bool {
+	if value, ok := r[field].(bool); ok {
+		return &value
+	} else {
+		return nil
+	}
+}
+
 func (r Record) AsInt(field string) int {
 	value, _ := AsInt(r[field])
 	return value
@@ -64,7 +72,23 @@ func (r Record) AsRecord(field string) Record {
 }
 
 func asTcpEndpoint(record Record) TcpEndpoint {
-	return TcpEndpoint{
+	endpoint := TcpEndpoint{
+		Name:       record.AsString("name"),
+		Host:       record.AsString("host"),
+		Port:       record.AsString("port"),
+		Address:    record.AsString("address"),
+		SiteId:     record.AsString("siteId"),
+		SslProfile: record.AsString("sslProfile"),
+	}
+	//hostname verification is only relevant when tls is in use
+	if endpoint.SslProfile != "" {
+		endpoint.VerifyHostname = record.AsBoolPtr("verifyHostname")
+	}
+	return endpoint
+}
+
+func asUdpEndpoint(record Record) UdpEndpoint {
+	return UdpEndpoint{
 		Name:    record.AsString("name"),
 		Host:    record.AsString("host"),
 		Port:    record.AsString("port"),
@@ -74,7 +98,7 @@ func asTcpEndpoint(record Record) TcpEndpoint {
 }
 
 func asHttpEndpoint(record Record) HttpEndpoint {
-	return HttpEndpoint{
+	endpoint := HttpEndpoint{
 		Name:            record.AsString("name"),
 		Host:            record.AsString("host"),
 		Port:            record.AsString("port"),
@@ -84,17 +108,54 @@ func asHttpEndpoint(record Record) HttpEndpoint {
 		Aggregation:     record.AsString("aggregation"),
 		EventChannel:    record.AsBool("eventChannel"),
 		HostOverride:    record.AsString("hostOverride"),
+		SslProfile:      record.AsString("sslProfile"),
+	}
+	if endpoint.SslProfile != "" {
+		endpoint.VerifyHostname = record.AsBoolPtr("verifyHostname")
 	}
+	return endpoint
 }
 
 func asConnection(record Record) Connection {
 	return Connection{
+		Name:       record.AsString("name"),
 		Role:       record.AsString("role"),
 		Container:  record.AsString("container"),
 		Host:       record.AsString("host"),
 		OperStatus: record.AsString("operStatus"),
 		Dir:        record.AsString("dir"),
 		Active:     record.AsBool("active"),
+		User:       record.AsString("user"),
+	}
+}
+
+func asConnector(record Record) Connector {
+	return Connector{
+		Name:         record.AsString("name"),
+		Role:         Role(record.AsString("role")),
+		Host:         record.AsString("host"),
+		Port:         record.AsString("port"),
+		Cost:         int32(record.AsInt("cost")),
+		SslProfile:   record.AsString("sslProfile"),
+		LinkCapacity: int32(record.AsInt("linkCapacity")),
+	}
+}
+
+func asSslProfile(record Record) SslProfile {
+	return SslProfile{
+		Name:           record.AsString("name"),
+		CertFile:       record.AsString("certFile"),
+		PrivateKeyFile: record.AsString("privateKeyFile"),
+		CaCertFile:     record.AsString("caCertFile"),
+	}
+}
+
+func asAddress(record Record) Address {
+	return Address{
+		Name:         record.AsString("name"),
+		Prefix:       record.AsString("prefix"),
+		Pattern:      record.AsString("pattern"),
+		Distribution: record.AsString("distribution"),
 	}
 }
 
@@ -273,6 +334,12 @@ func getRouterAddress(id string, edge bool) string {
 }
 
 func (a *Agent) request(operation string, typename string, name string, attributes *map[string]interface{}) error {
+	return a.requestFor("", operation, typename, name, attributes)
+}
+
+// Sends a request to the agent at the address given, or to the local
+// agent if the address is empty
+func (a *Agent) requestFor(agent string, operation string, typename string, name string, attributes *map[string]interface{}) error {
 	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
 	defer cancel()
 
@@ -289,7 +356,14 @@ func (a *Agent) request(operation string, typename string, name string, attribut
 		request.Value = attributes
 	}
 
-	if err := a.sender.Send(ctx, &request); err != nil {
+	var err error
+	if agent == "" {
+		err = a.sender.Send(ctx, &request)
+	} else {
+		request.Properties.To = agent
+		err = a.anonymous.Send(ctx, &request)
+	}
+	if err != nil {
 		a.Close()
 		return fmt.Errorf("Could not send request: %s", err)
 	}
@@ -300,23 +374,36 @@ func (a *Agent) request(operation string, typename string, name string, attribut
 		return fmt.Errorf("Failed to receive reponse: %s", err)
 	}
 	response.Accept()
-	if status, ok := AsInt(response.ApplicationProperties["statusCode"]); !ok && !isOk(status) {
+	if status, ok := AsInt(response.ApplicationProperties["statusCode"]); !ok || !isOk(status) {
 		return fmt.Errorf("Query failed with: %s", response.ApplicationProperties["statusDescription"])
 	}
 	return nil
 }
 
 func (a *Agent) Create(typename string, name string, attributes map[string]interface{}) error {
-	log.Println("CREATE", typename, name, attributes)
-	return a.request("CREATE", typename, name, &attributes)
+	return a.createFor("", typename, name, attributes)
+}
+
+func (a *Agent) createFor(agent string, typename string, name string, attributes map[string]interface{}) error {
+	log.Println("CREATE", agent, typename, name, attributes)
+	return a.requestFor(agent, "CREATE", typename, name, &attributes)
+}
+
+func (a *Agent) Update(typename string, name string, attributes map[string]interface{}) error {
+	log.Println("UPDATE", typename, name, attributes)
+	return a.request("UPDATE", typename, name, &attributes)
 }
 
 func (a *Agent) Delete(typename string, name string) error {
+	return a.deleteFor("", typename, name)
+}
+
+func (a *Agent) deleteFor(agent string, typename string, name string) error {
 	if name == "" {
 		return fmt.Errorf("Cannot delete entity of type %s with no name", typename)
 	}
-	log.Println("DELETE", typename, name)
-	return a.request("DELETE", typename, name, nil)
+	log.Println("DELETE", agent, typename, name)
+	return a.requestFor(agent, "DELETE", typename, name, nil)
 }
 
 func (a *Agent) Query(typename string, attributes []string) ([]Record, error) {
@@ -562,12 +649,46 @@ func (a *Agent) GetInteriorNodes() ([]RouterNode, error) {
 	return nodes, nil
 }
 
+// GetLocalSiteAgents returns the addresses of the management agents of
+// the routers of the local site, which has more than one router only if
+// it is replicated. The local router is represented by an empty
+// address.
+func (a *Agent) GetLocalSiteAgents() ([]string, error) {
+	agents := []string{""}
+	if a.isEdgeRouter() {
+		return agents, nil
+	}
+	nodes, err := a.GetInteriorNodes()
+	if err != nil {
+		return nil, err
+	}
+	routers := []Router{}
+	for _, n := range nodes {
+		if n.Id != a.local.Id {
+			routers = append(routers, *n.asRouter())
+		}
+	}
+	if len(routers) == 0 {
+		return agents, nil
+	}
+	if err = a.getSiteIds(routers); err != nil {
+		return nil, err
+	}
+	addresses := getAddressesFor(routers)
+	for i, r := range routers {
+		if r.SiteId == a.local.SiteId {
+			agents = append(agents, addresses[i])
+		}
+	}
+	return agents, nil
+}
+
 func (a *Agent) GetConnections() ([]Connection, error) {
 	return a.GetConnectionsFor("")
 }
 
 func (a *Agent) GetConnectionsFor(agent string) ([]Connection, error) {
-	records, err := a.Query("org.apache.qpid.dispatch.connection", []string{})
+	records, err := a.QueryByAgentAddress("org.apache.qpid.dispatch.connection", []string{}, agent)
 	if err != nil {
 		return nil, err
 	}
@@ -648,6 +769,63 @@ func (a *Agent) getSiteIds(routers []Router) error {
 	return nil
 }
 
+// Forces the router to close the named connection
+func (a *Agent) CloseConnection(name string) error {
+	return a.CloseConnectionFor("", name)
+}
+
+// Forces the router whose agent has the address given to close the
+// named connection
+func (a *Agent) CloseConnectionFor(agent string, name string) error {
+	attributes := map[string]interface{}{
+		"adminStatus": "deleted",
+	}
+	log.Println("UPDATE", agent, "org.apache.qpid.dispatch.connection", name, attributes)
+	return a.requestFor(agent, "UPDATE", "org.apache.qpid.dispatch.connection", name, &attributes)
+}
+
+// Returns the connectors of the router the agent is connected to
+func (a *Agent) GetConnectors() ([]Connector, error) {
+	records, err := a.Query("org.apache.qpid.dispatch.connector", []string{})
+	if err != nil {
+		return nil, err
+	}
+	connectors := make([]Connector, len(records))
+	for i, r := range records {
+		connectors[i] = asConnector(r)
+	}
+	return connectors, nil
+}
+
+// Adds a connector to the router the agent is connected to. Hostnames
+// are only verified if the connector requests it.
+func (a *Agent) CreateConnector(connector Connector) error {
+	record := map[string]interface{}{}
+	if err := convert(connector, &record); err != nil {
+		return fmt.Errorf("Failed to convert record: %s", err)
+	}
+	record["verifyHostname"] = connector.VerifyHostname
+	return a.Create("org.apache.qpid.dispatch.connector", connector.Name, record)
+}
+
+// Removes the named connector from the router the agent is connected to
+func (a *Agent) DeleteConnector(name string) error {
+	return a.Delete("org.apache.qpid.dispatch.connector", name)
+}
+
+// Retrieves the site id for the router with the specified container
+// id (as reported for a connection from that router)
+func (a *Agent) GetSiteIdFor(container string, edge bool) (string, error) {
+	records, err := a.QueryByAgentAddress("org.apache.qpid.dispatch.router", []string{}, getRouterAgentAddress(container, edge))
+	if err != nil {
+		return "", err
+	}
+	if len(records) != 1 {
+		return "", fmt.Errorf("Unexpected number of router records: %d", len(records))
+	}
+	return records[0].AsString("metadata"), nil
+}
+
 func (a *Agent) getConnectedTo(routers []Router) error {
 	results, err := a.BatchQuery(queryAllAgents("org.apache.qpid.dispatch.connection", getAddressesFor(routers)))
 	if err != nil {
@@ -671,13 +849,22 @@ func getBridgeTypes() []string {
 		"org.apache.qpid.dispatch.tcpListener",
 		"org.apache.qpid.dispatch.httpConnector",
 		"org.apache.qpid.dispatch.httpListener",
+		"org.apache.qpid.dispatch.udpConnector",
+		"org.apache.qpid.dispatch.udpListener",
 	}
 }
 
 func (a *Agent) GetLocalBridgeConfig() (*BridgeConfig, error) {
+	return a.GetBridgeConfigFor("")
+}
+
+// GetBridgeConfigFor retrieves the bridge configuration of the router
+// whose agent has the address given, or of the local router if the
+// address is empty
+func (a *Agent) GetBridgeConfigFor(agent string) (*BridgeConfig, error) {
 	config := NewBridgeConfig()
 
-	results, err := a.Query("org.apache.qpid.dispatch.tcpConnector", []string{})
+	results, err := a.QueryByAgentAddress("org.apache.qpid.dispatch.tcpConnector", []string{}, agent)
 	if err != nil {
 		return nil, err
 	}
@@ -685,7 +872,7 @@ func (a *Agent) GetLocalBridgeConfig() (*BridgeConfig, error) {
 		config.AddTcpConnector(asTcpEndpoint(record))
 	}
 
-	results, err = a.Query("org.apache.qpid.dispatch.tcpListener", []string{})
+	results, err = a.QueryByAgentAddress("org.apache.qpid.dispatch.tcpListener", []string{}, agent)
 	if err != nil {
 		return nil, err
 	}
@@ -693,7 +880,7 @@ func (a *Agent) GetLocalBridgeConfig() (*BridgeConfig, error) {
 		config.AddTcpListener(asTcpEndpoint(record))
 	}
 
-	results, err = a.Query("org.apache.qpid.dispatch.httpConnector", []string{})
+	results, err = a.QueryByAgentAddress("org.apache.qpid.dispatch.httpConnector", []string{}, agent)
 	if err != nil {
 		return nil, err
 	}
@@ -701,7 +888,7 @@ func (a *Agent) GetLocalBridgeConfig() (*BridgeConfig, error) {
 		config.AddHttpConnector(asHttpEndpoint(record))
 	}
 
-	results, err = a.Query("org.apache.qpid.dispatch.httpListener", []string{})
+	results, err = a.QueryByAgentAddress("org.apache.qpid.dispatch.httpListener", []string{}, agent)
 	if err != nil {
 		return nil, err
 	}
@@ -709,63 +896,250 @@ func (a *Agent) GetLocalBridgeConfig() (*BridgeConfig, error) {
 		config.AddHttpListener(asHttpEndpoint(record))
 	}
 
+	results, err = a.QueryByAgentAddress("org.apache.qpid.dispatch.udpConnector", []string{}, agent)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range results {
+		config.AddUdpConnector(asUdpEndpoint(record))
+	}
+
+	results, err = a.QueryByAgentAddress("org.apache.qpid.dispatch.udpListener", []string{}, agent)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range results {
+		config.AddUdpListener(asUdpEndpoint(record))
+	}
+
 	return &config, nil
 }
 
 func (a *Agent) UpdateLocalBridgeConfig(changes *BridgeConfigDifference) error {
+	return a.UpdateBridgeConfigFor("", changes)
+}
+
+// UpdateBridgeConfigFor applies changes to the bridge configuration of
+// the router whose agent has the address given, or of the local router
+// if the address is empty
+func (a *Agent) UpdateBridgeConfigFor(agent string, changes *BridgeConfigDifference) error {
 	for _, deleted := range changes.TcpConnectors.Deleted {
-		if err := a.Delete("org.apache.qpid.dispatch.tcpConnector", deleted); err != nil {
+		if err := a.deleteFor(agent, "org.apache.qpid.dispatch.tcpConnector", deleted); err != nil {
 			return fmt.Errorf("Error deleting tcp connectors: %s", err)
 		}
 	}
 	for _, deleted := range changes.HttpConnectors.Deleted {
-		if err := a.Delete("org.apache.qpid.dispatch.httpConnector", deleted); err != nil {
+		if err := a.deleteFor(agent, "org.apache.qpid.dispatch.httpConnector", deleted); err != nil {
 			return fmt.Errorf("Error deleting http connectors: %s", err)
 		}
 	}
+	for _, deleted := range changes.UdpConnectors.Deleted {
+		if err := a.deleteFor(agent, "org.apache.qpid.dispatch.udpConnector", deleted); err != nil {
+			return fmt.Errorf("Error deleting udp connectors: %s", err)
+		}
+	}
 	for _, deleted := range changes.TcpListeners.Deleted {
-		if err := a.Delete("org.apache.qpid.dispatch.tcpListener", deleted); err != nil {
+		if err := a.deleteFor(agent, "org.apache.qpid.dispatch.tcpListener", deleted); err != nil {
 			return fmt.Errorf("Error deleting tcp listeners: %s", err)
 		}
 	}
 	for _, deleted := range changes.HttpListeners.Deleted {
-		if err := a.Delete("org.apache.qpid.dispatch.httpListener", deleted); err != nil {
+		if err := a.deleteFor(agent, "org.apache.qpid.dispatch.httpListener", deleted); err != nil {
 			return fmt.Errorf("Error deleting http listeners: %s", err)
 		}
 	}
+	for _, deleted := range changes.UdpListeners.Deleted {
+		if err := a.deleteFor(agent, "org.apache.qpid.dispatch.udpListener", deleted); err != nil {
+			return fmt.Errorf("Error deleting udp listeners: %s", err)
+		}
+	}
 	for _, added := range changes.TcpConnectors.Added {
 		record := map[string]interface{}{}
 		if err := convert(added, &record); err != nil {
 			return fmt.Errorf("Failed to convert record: %s", err)
 		}
-		if err := a.Create("org.apache.qpid.dispatch.tcpConnector", added.Name, record); err != nil {
+		if err := a.createFor(agent, "org.apache.qpid.dispatch.tcpConnector", added.Name, record); err != nil {
 			return fmt.Errorf("Error adding tcp connectors: %s", err)
 		}
 	}
 	for _, added := range changes.HttpConnectors.Added {
 		record := map[string]interface{}{}
 		convert(added, &record)
-		if err := a.Create("org.apache.qpid.dispatch.httpConnector", added.Name, record); err != nil {
+		if err := a.createFor(agent, "org.apache.qpid.dispatch.httpConnector", added.Name, record); err != nil {
 			return fmt.Errorf("Error adding http connectors: %s", err)
 		}
 	}
+	for _, added := range changes.UdpConnectors.Added {
+		record := map[string]interface{}{}
+		convert(added, &record)
+		if err := a.createFor(agent, "org.apache.qpid.dispatch.udpConnector", added.Name, record); err != nil {
+			return fmt.Errorf("Error adding udp connectors: %s", err)
+		}
+	}
 	for _, added := range changes.TcpListeners.Added {
 		record := map[string]interface{}{}
 		convert(added, &record)
-		if err := a.Create("org.apache.qpid.dispatch.tcpListener", added.Name, record); err != nil {
+		if err := a.createFor(agent, "org.apache.qpid.dispatch.tcpListener", added.Name, record); err != nil {
 			return fmt.Errorf("Error adding tcp listeners: %s", err)
 		}
 	}
 	for _, added := range changes.HttpListeners.Added {
 		record := map[string]interface{}{}
 		convert(added, &record)
-		if err := a.Create("org.apache.qpid.dispatch.httpListener", added.Name, record); err != nil {
+		if err := a.createFor(agent, "org.apache.qpid.dispatch.httpListener", added.Name, record); err != nil {
 			return fmt.Errorf("Error adding http listeners: %s", err)
 		}
 	}
+	for _, added := range changes.UdpListeners.Added {
+		record := map[string]interface{}{}
+		convert(added, &record)
+		if err := a.createFor(agent, "org.apache.qpid.dispatch.udpListener", added.Name, record); err != nil {
+			return fmt.Errorf("Error adding udp listeners: %s", err)
+		}
+	}
+	return nil
+}
+
+// GetSslProfilesFor retrieves the sslProfiles of the router whose
+// agent has the address given
+func (a *Agent) GetSslProfilesFor(agent string) (map[string]SslProfile, error) {
+	results, err := a.QueryByAgentAddress("org.apache.qpid.dispatch.sslProfile", []string{}, agent)
+	if err != nil {
+		return nil, err
+	}
+	profiles := map[string]SslProfile{}
+	for _, record := range results {
+		profile := asSslProfile(record)
+		profiles[profile.Name] = profile
+	}
+	return profiles, nil
+}
+
+func (a *Agent) AddSslProfilesFor(agent string, profiles []SslProfile) error {
+	for _, added := range profiles {
+		record := map[string]interface{}{}
+		if err := convert(added, &record); err != nil {
+			return fmt.Errorf("Failed to convert record: %s", err)
+		}
+		if err := a.createFor(agent, "org.apache.qpid.dispatch.sslProfile", added.Name, record); err != nil {
+			return fmt.Errorf("Error adding ssl profiles: %s", err)
+		}
+	}
+	return nil
+}
+
+func (a *Agent) DeleteSslProfilesFor(agent string, names []string) error {
+	for _, deleted := range names {
+		if err := a.deleteFor(agent, "org.apache.qpid.dispatch.sslProfile", deleted); err != nil {
+			return fmt.Errorf("Error deleting ssl profiles: %s", err)
+		}
+	}
+	return nil
+}
+
+// GetAddressesFor retrieves the addresses configured in the router
+// whose agent has the address given, keyed by name
+func (a *Agent) GetAddressesFor(agent string) (map[string]Address, error) {
+	results, err := a.QueryByAgentAddress("org.apache.qpid.dispatch.router.config.address", []string{}, agent)
+	if err != nil {
+		return nil, err
+	}
+	addresses := map[string]Address{}
+	for _, record := range results {
+		address := asAddress(record)
+		addresses[address.Name] = address
+	}
+	return addresses, nil
+}
+
+func (a *Agent) AddAddressesFor(agent string, addresses []Address) error {
+	for _, added := range addresses {
+		record := map[string]interface{}{}
+		if err := convert(added, &record); err != nil {
+			return fmt.Errorf("Failed to convert record: %s", err)
+		}
+		if err := a.createFor(agent, "org.apache.qpid.dispatch.router.config.address", added.Name, record); err != nil {
+			return fmt.Errorf("Error adding addresses: %s", err)
+		}
+	}
 	return nil
 }
 
+func (a *Agent) DeleteAddressesFor(agent string, names []string) error {
+	for _, deleted := range names {
+		if err := a.deleteFor(agent, "org.apache.qpid.dispatch.router.config.address", deleted); err != nil {
+			return fmt.Errorf("Error deleting addresses: %s", err)
+		}
+	}
+	return nil
+}
+
+// GetLinkConfigFor retrieves the connectors through which the router
+// whose agent has the address given links to other sites, along with
+// their sslProfiles
+func (a *Agent) GetLinkConfigFor(agent string) (*LinkConfig, error) {
+	config := NewLinkConfig()
+
+	profiles, err := a.GetSslProfilesFor(agent)
+	if err != nil {
+		return nil, err
+	}
+	for _, profile := range profiles {
+		config.AddSslProfile(profile)
+	}
+
+	results, err := a.QueryByAgentAddress("org.apache.qpid.dispatch.connector", []string{}, agent)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range results {
+		config.AddConnector(asConnector(record))
+	}
+
+	return &config, nil
+}
+
+// UpdateLinkConfigFor applies changes to the links of the router whose
+// agent has the address given. Connectors are removed before the
+// sslProfiles they may use, and sslProfiles added before the
+// connectors that use them. A connector is not added if its sslProfile
+// could not be, e.g. as its certificates have not yet been mounted,
+// but the other links are still changed; the first such error is
+// returned.
+func (a *Agent) UpdateLinkConfigFor(agent string, changes *LinkConfigDifference) error {
+	for _, deleted := range changes.Connectors.Deleted {
+		if err := a.deleteFor(agent, "org.apache.qpid.dispatch.connector", deleted); err != nil {
+			return fmt.Errorf("Error deleting connectors: %s", err)
+		}
+	}
+	if err := a.DeleteSslProfilesFor(agent, changes.SslProfiles.Deleted); err != nil {
+		return err
+	}
+	var result error
+	failed := map[string]bool{}
+	for _, added := range changes.SslProfiles.Added {
+		if err := a.AddSslProfilesFor(agent, []SslProfile{added}); err != nil {
+			failed[added.Name] = true
+			if result == nil {
+				result = err
+			}
+		}
+	}
+	for _, added := range changes.Connectors.Added {
+		if failed[added.SslProfile] {
+			continue
+		}
+		record := map[string]interface{}{}
+		if err := convert(added, &record); err != nil {
+			return fmt.Errorf("Failed to convert record: %s", err)
+		}
+		if err := a.createFor(agent, "org.apache.qpid.dispatch.connector", added.Name, record); err != nil {
+			return fmt.Errorf("Error adding connectors: %s", err)
+		}
+	}
+	return result
+}
+
 func (a *Agent) GetBridges(routers []Router) ([]BridgeConfig, error) {
 	configs := []BridgeConfig{}
 	agents := getAddressesFor(routers)
@@ -802,6 +1176,22 @@ func (a *Agent) GetBridges(routers []Router) ([]BridgeConfig, error) {
 			config.AddHttpListener(asHttpEndpoint(record))
 		}
 
+		results, err = a.QueryByAgentAddress("org.apache.qpid.dispatch.udpConnector", []string{}, agent)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range results {
+			config.AddUdpConnector(asUdpEndpoint(record))
+		}
+
+		results, err = a.QueryByAgentAddress("org.apache.qpid.dispatch.udpListener", []string{}, agent)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range results {
+			config.AddUdpListener(asUdpEndpoint(record))
+		}
+
 		configs = append(configs, config)
 	}
 	return configs, nil
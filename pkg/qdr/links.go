@@ -0,0 +1,219 @@
+package qdr
+
+import (
+	"log"
+	"strings"
+)
+
+// The sslProfile of a connector linking to another site is named after
+// the connector with this suffix, which distinguishes the connectors
+// and sslProfiles used for links from those managed elsewhere (e.g.
+// for service tls or for linking router replicas)
+const linkProfileSuffix string = "-profile"
+
+// GetLinkSslProfileName returns the name of the sslProfile for the
+// connector linking to another site with the name given
+func GetLinkSslProfileName(connector string) string {
+	return connector + linkProfileSuffix
+}
+
+func isLinkConnector(c Connector) bool {
+	return c.SslProfile == GetLinkSslProfileName(c.Name)
+}
+
+func isLinkSslProfile(s SslProfile) bool {
+	return strings.HasSuffix(s.Name, linkProfileSuffix)
+}
+
+// LinkConfig holds the connectors through which a router links to
+// other sites, along with their sslProfiles
+type LinkConfig struct {
+	SslProfiles map[string]SslProfile
+	Connectors  map[string]Connector
+}
+
+func NewLinkConfig() LinkConfig {
+	return LinkConfig{
+		SslProfiles: map[string]SslProfile{},
+		Connectors:  map[string]Connector{},
+	}
+}
+
+// Adds the connector if it links to another site
+func (lc *LinkConfig) AddConnector(c Connector) {
+	if isLinkConnector(c) {
+		lc.Connectors[c.Name] = c
+	}
+}
+
+// Adds the sslProfile if it is one used for linking to another site
+func (lc *LinkConfig) AddSslProfile(s SslProfile) {
+	if isLinkSslProfile(s) {
+		lc.SslProfiles[s.Name] = s
+	}
+}
+
+func (r *RouterConfig) GetLinkConfig() LinkConfig {
+	config := NewLinkConfig()
+	for _, c := range r.Connectors {
+		config.AddConnector(c)
+	}
+	for _, s := range r.SslProfiles {
+		config.AddSslProfile(s)
+	}
+	return config
+}
+
+func (a Connector) effectiveCost() int32 {
+	if a.Cost == 0 {
+		return 1
+	}
+	return a.Cost
+}
+
+// Equivalent returns true if the connector need not be replaced by
+// the one desired, b. Attributes that b leaves to the router's
+// defaults, such as the link capacity, are ignored.
+func (a Connector) Equivalent(b Connector) bool {
+	if a.Role != b.Role || a.Host != b.Host || a.Port != b.Port ||
+		a.SslProfile != b.SslProfile || a.effectiveCost() != b.effectiveCost() {
+		return false
+	}
+	return b.LinkCapacity == 0 || a.LinkCapacity == b.LinkCapacity
+}
+
+type SslProfileDifference struct {
+	Deleted []string
+	Added   []SslProfile
+}
+
+type ConnectorDifference struct {
+	Deleted []string
+	Added   []Connector
+}
+
+type LinkConfigDifference struct {
+	SslProfiles SslProfileDifference
+	Connectors  ConnectorDifference
+}
+
+// GetSslProfileDifference returns the changes needed to make the
+// sslProfiles a match those desired, b. An sslProfile that differs is
+// both deleted and added, as sslProfiles cannot be updated.
+func GetSslProfileDifference(a map[string]SslProfile, b map[string]SslProfile) SslProfileDifference {
+	result := SslProfileDifference{}
+	for key, v1 := range b {
+		v2, ok := a[key]
+		if !ok {
+			result.Added = append(result.Added, v1)
+		} else if v1 != v2 {
+			result.Deleted = append(result.Deleted, v1.Name)
+			result.Added = append(result.Added, v1)
+		}
+	}
+	for key, v1 := range a {
+		if _, ok := b[key]; !ok {
+			result.Deleted = append(result.Deleted, v1.Name)
+		}
+	}
+	return result
+}
+
+// AddressDifference holds the changes to the addresses configured in a
+// router
+type AddressDifference struct {
+	Deleted []string
+	Added   []Address
+}
+
+// GetAddressDifference returns the changes needed to make the
+// addresses a, keyed by name, match those desired, b. An address that
+// differs is both deleted and added, as addresses cannot be updated.
+func GetAddressDifference(a map[string]Address, b map[string]Address) AddressDifference {
+	result := AddressDifference{}
+	for key, v1 := range b {
+		v2, ok := a[key]
+		if !ok {
+			result.Added = append(result.Added, v1)
+		} else if v1 != v2 {
+			result.Deleted = append(result.Deleted, v1.Name)
+			result.Added = append(result.Added, v1)
+		}
+	}
+	for key, v1 := range a {
+		if _, ok := b[key]; !ok {
+			result.Deleted = append(result.Deleted, v1.Name)
+		}
+	}
+	return result
+}
+
+func (a *AddressDifference) Empty() bool {
+	return len(a.Deleted) == 0 && len(a.Added) == 0
+}
+
+func (a *AddressDifference) Print() {
+	log.Printf("Addresses added=%v, deleted=%v", a.Added, a.Deleted)
+}
+
+// Changed returns the names of the sslProfiles that are replaced,
+// i.e. both deleted and added
+func (a *SslProfileDifference) Changed() map[string]bool {
+	added := map[string]bool{}
+	for _, s := range a.Added {
+		added[s.Name] = true
+	}
+	changed := map[string]bool{}
+	for _, name := range a.Deleted {
+		if added[name] {
+			changed[name] = true
+		}
+	}
+	return changed
+}
+
+// Difference returns the changes needed to make the links of a router
+// match those desired. An sslProfile is only read when a connector
+// using it is created, so a connector whose sslProfile changes is also
+// replaced.
+func (a *LinkConfig) Difference(b *LinkConfig) *LinkConfigDifference {
+	result := LinkConfigDifference{}
+	result.SslProfiles = GetSslProfileDifference(a.SslProfiles, b.SslProfiles)
+	changedProfiles := result.SslProfiles.Changed()
+	for key, v1 := range b.Connectors {
+		v2, ok := a.Connectors[key]
+		if !ok {
+			result.Connectors.Added = append(result.Connectors.Added, v1)
+		} else if !v2.Equivalent(v1) || changedProfiles[v2.SslProfile] {
+			result.Connectors.Deleted = append(result.Connectors.Deleted, v1.Name)
+			result.Connectors.Added = append(result.Connectors.Added, v1)
+		}
+	}
+	for key, v1 := range a.Connectors {
+		if _, ok := b.Connectors[key]; !ok {
+			result.Connectors.Deleted = append(result.Connectors.Deleted, v1.Name)
+		}
+	}
+	return &result
+}
+
+func (a *SslProfileDifference) Empty() bool {
+	return len(a.Deleted) == 0 && len(a.Added) == 0
+}
+
+func (a *SslProfileDifference) Print() {
+	log.Printf("SslProfiles added=%v, deleted=%v", a.Added, a.Deleted)
+}
+
+func (a *ConnectorDifference) Empty() bool {
+	return len(a.Deleted) == 0 && len(a.Added) == 0
+}
+
+func (a *LinkConfigDifference) Empty() bool {
+	return a.SslProfiles.Empty() && a.Connectors.Empty()
+}
+
+func (a *LinkConfigDifference) Print() {
+	a.SslProfiles.Print()
+	log.Printf("Connectors added=%v, deleted=%v", a.Connectors.Added, a.Connectors.Deleted)
+}
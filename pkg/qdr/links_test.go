@@ -0,0 +1,93 @@
+package qdr
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestGetLinkConfig(t *testing.T) {
+	config := InitialConfig("foo", "bar", false)
+	config.AddSslProfile(SslProfile{Name: "skupper-internal"})
+	config.AddSslProfile(SslProfile{Name: "skupper-tls-mysecret-ca", CaCertFile: "/etc/ca.crt"})
+	config.AddSslProfile(SslProfile{Name: GetLinkSslProfileName("east")})
+	config.AddConnector(Connector{Name: "east", Host: "east.example.com", Port: "55671", SslProfile: GetLinkSslProfileName("east")})
+	config.AddConnector(Connector{Name: "peer-skupper-router-1", Host: "10.0.0.1", Port: "55671", SslProfile: "skupper-internal"})
+
+	links := config.GetLinkConfig()
+	if len(links.Connectors) != 1 || links.Connectors["east"].Host != "east.example.com" {
+		t.Errorf("Expected only the connector linking to east, got %#v", links.Connectors)
+	}
+	if len(links.SslProfiles) != 1 || links.SslProfiles["east-profile"].CaCertFile != "/etc/qpid-dispatch-certs/east-profile/ca.crt" {
+		t.Errorf("Expected only the sslProfile for east, got %#v", links.SslProfiles)
+	}
+}
+
+func TestLinkConfigDifference(t *testing.T) {
+	before := NewLinkConfig()
+	before.AddSslProfile(SslProfile{Name: "east-profile", CaCertFile: "/certs/east-ca.crt"})
+	before.AddSslProfile(SslProfile{Name: "west-profile", CaCertFile: "/certs/west-ca.crt"})
+	before.AddSslProfile(SslProfile{Name: "north-profile", CaCertFile: "/certs/north-ca.crt"})
+	before.AddConnector(Connector{Name: "east", Role: RoleInterRouter, Host: "east", Port: "55671", SslProfile: "east-profile", LinkCapacity: 250})
+	before.AddConnector(Connector{Name: "west", Role: RoleInterRouter, Host: "west", Port: "55671", SslProfile: "west-profile"})
+	before.AddConnector(Connector{Name: "north", Role: RoleInterRouter, Host: "north", Port: "55671", SslProfile: "north-profile"})
+
+	after := NewLinkConfig()
+	after.AddSslProfile(SslProfile{Name: "east-profile", CaCertFile: "/certs/east-ca.crt"})
+	after.AddSslProfile(SslProfile{Name: "west-profile", CaCertFile: "/links/west-ca.crt"})
+	after.AddSslProfile(SslProfile{Name: "south-profile", CaCertFile: "/links/south-ca.crt"})
+	// the default cost and link capacity are equivalent to those not set
+	after.AddConnector(Connector{Name: "east", Role: RoleInterRouter, Host: "east", Port: "55671", SslProfile: "east-profile", Cost: 1})
+	after.AddConnector(Connector{Name: "west", Role: RoleInterRouter, Host: "west", Port: "55671", SslProfile: "west-profile"})
+	after.AddConnector(Connector{Name: "south", Role: RoleInterRouter, Host: "south", Port: "55671", SslProfile: "south-profile"})
+
+	diff := before.Difference(&after)
+	sort.Strings(diff.SslProfiles.Deleted)
+	sort.Strings(diff.Connectors.Deleted)
+	if !reflect.DeepEqual(diff.SslProfiles.Deleted, []string{"north-profile", "west-profile"}) || len(diff.SslProfiles.Added) != 2 {
+		t.Errorf("Incorrect sslProfile changes: %#v", diff.SslProfiles)
+	}
+	// west is replaced as its sslProfile changed
+	if !reflect.DeepEqual(diff.Connectors.Deleted, []string{"north", "west"}) || len(diff.Connectors.Added) != 2 {
+		t.Errorf("Incorrect connector changes: %#v", diff.Connectors)
+	}
+
+	after.AddConnector(Connector{Name: "east", Role: RoleInterRouter, Host: "east", Port: "55671", SslProfile: "east-profile", Cost: 5})
+	diff = before.Difference(&after)
+	found := false
+	for _, added := range diff.Connectors.Added {
+		if added.Name == "east" && added.Cost == 5 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected change of cost to replace connector, got %#v", diff.Connectors)
+	}
+
+	diff = after.Difference(&after)
+	if !diff.Empty() {
+		t.Errorf("Expected no differences, got %#v", diff)
+	}
+}
+
+func TestGetAddressDifference(t *testing.T) {
+	before := map[string]Address{
+		"a": Address{Name: "a", Pattern: "db", Distribution: DistributionClosest},
+		"b": Address{Name: "b", Pattern: "web", Distribution: DistributionClosest},
+		"c": Address{Name: "c", Pattern: "cache", Distribution: DistributionClosest},
+	}
+	after := map[string]Address{
+		"a": Address{Name: "a", Pattern: "db", Distribution: DistributionClosest},
+		"b": Address{Name: "b", Pattern: "web", Distribution: string(DistributionBalanced)},
+		"d": Address{Name: "d", Pattern: "queue", Distribution: DistributionClosest},
+	}
+	diff := GetAddressDifference(before, after)
+	sort.Strings(diff.Deleted)
+	if !reflect.DeepEqual(diff.Deleted, []string{"b", "c"}) || len(diff.Added) != 2 {
+		t.Errorf("Incorrect address changes: %#v", diff)
+	}
+	diff = GetAddressDifference(after, after)
+	if !diff.Empty() {
+		t.Errorf("Expected no differences, got %#v", diff)
+	}
+}
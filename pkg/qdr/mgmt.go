@@ -18,8 +18,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 
@@ -35,12 +38,14 @@ type RouterNode struct {
 }
 
 type Connection struct {
+	Name       string `json:"name"`
 	Container  string `json:"container"`
 	OperStatus string `json:"operStatus"`
 	Host       string `json:"host"`
 	Role       string `json:"role"`
 	Active     bool   `json:"active"`
 	Dir        string `json:"dir"`
+	User       string `json:"user"`
 }
 
 func getConnectedSitesFromNodesEdge(namespace string, clientset kubernetes.Interface, config *restclient.Config) (types.TransportConnectedSites, error) {
@@ -110,27 +115,49 @@ func getConnectedSitesFromNodesEdge(namespace string, clientset kubernetes.Inter
 	return result, nil
 }
 
+// The replicas of a site's router are linked to each other, so the
+// routers of other sites are counted once per site rather than once per
+// router, and are directly connected if linked to any replica
 func getConnectedSitesFromNodesInterior(nodes []RouterNode, namespace string, clientset kubernetes.Interface, config *restclient.Config) (types.TransportConnectedSites, error) {
 	result := types.TransportConnectedSites{}
 	direct := make(map[string]bool)
 	indirect := make(map[string]bool)
+	localSiteId, err := getSiteIdForRouter("", namespace, clientset, config)
+	if err != nil {
+		return result, err
+	}
+	sites := map[string]string{}
 	for _, n := range nodes {
 		if n.NextHop == "(self)" {
+			sites[n.Id] = localSiteId
+			continue
+		}
+		siteId, err := getSiteIdForRouter(n.Id, namespace, clientset, config)
+		if err != nil {
+			return result, fmt.Errorf("Failed to check site for %s: %w", n.Id, err)
+		}
+		if siteId == "" {
+			siteId = n.Id
+		}
+		sites[n.Id] = siteId
+	}
+	isLocal := func(id string) bool {
+		return id == "" || sites[id] == localSiteId
+	}
+	for _, n := range nodes {
+		if isLocal(n.Id) {
 			edges, err := getEdgeConnectionsForInterior(n.Id, namespace, clientset, config)
 			if err != nil {
 				return result, fmt.Errorf("Failed to check edge nodes for %s: %w", n.Id, err)
 			}
 			edges = filterSiteRouters(edges)
 			for _, edge := range edges {
-				if _, present := direct[edge.Container]; !present {
-					direct[edge.Container] = true
-				}
+				direct[edge.Container] = true
 			}
-			break
 		}
 	}
 	for _, n := range nodes {
-		if n.NextHop != "(self)" {
+		if !isLocal(n.Id) {
 			edges, err := getEdgeConnectionsForInterior(n.Id, namespace, clientset, config)
 			if err != nil {
 				return result, fmt.Errorf("Failed to check edge nodes for %s: %w", n.Id, err)
@@ -138,18 +165,19 @@ func getConnectedSitesFromNodesInterior(nodes []RouterNode, namespace string, cl
 			edges = filterSiteRouters(edges)
 			for _, edge := range edges {
 				if _, present := direct[edge.Container]; !present {
-					if _, present = indirect[edge.Container]; !present {
-						indirect[edge.Container] = true
-					}
+					indirect[edge.Container] = true
 				}
 			}
-			if n.NextHop == "" {
-				direct[n.Id] = true
-			} else {
-				indirect[n.Id] = true
+			if isLocal(n.NextHop) {
+				direct[sites[n.Id]] = true
 			}
 		}
 	}
+	for _, n := range nodes {
+		if !isLocal(n.Id) && !direct[sites[n.Id]] {
+			indirect[sites[n.Id]] = true
+		}
+	}
 	result.Direct = len(direct)
 	result.Indirect = len(indirect)
 	result.Total = result.Direct + result.Indirect
@@ -313,6 +341,157 @@ func getLocalRouterId(namespace string, clientset kubernetes.Interface, config *
 	}
 }
 
+// Returns the site id recorded in the metadata of the router with the
+// id given, or of the local router if none is
+func getSiteIdForRouter(routerid string, namespace string, clientset kubernetes.Interface, config *restclient.Config) (string, error) {
+	command := get_query_for_router("router", routerid)
+	buffer, err := router_exec(command, namespace, clientset, config)
+	if err != nil {
+		return "", err
+	}
+	results := []map[string]interface{}{}
+	if err = json.Unmarshal(buffer.Bytes(), &results); err != nil {
+		return "", fmt.Errorf("Failed to parse JSON: %s %q", err, buffer.String())
+	}
+	if len(results) != 1 {
+		return "", fmt.Errorf("Unexpected number of router records: %d", len(results))
+	}
+	siteId, _ := results[0]["metadata"].(string)
+	return siteId, nil
+}
+
+// GetRouterReplicas reports, for each pod running the router of the
+// site, whether it is ready and how many links it has to the routers
+// of other sites and to the other replicas
+func GetRouterReplicas(namespace string, clientset kubernetes.Interface, config *restclient.Config) ([]types.RouterReplicaStatus, error) {
+	pods, err := clientset.CoreV1().Pods(namespace).List(metav1.ListOptions{LabelSelector: "skupper.io/component=" + types.TransportComponentName})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Name < pods.Items[j].Name
+	})
+	names := []string{}
+	for _, pod := range pods.Items {
+		names = append(names, pod.Name)
+	}
+	replicas := []types.RouterReplicaStatus{}
+	for _, pod := range pods.Items {
+		replica := types.RouterReplicaStatus{
+			Name:  pod.Name,
+			Ready: kube.IsPodReady(&pod),
+		}
+		if replica.Ready {
+			connections, err := GetConnectionsForPod(pod.Name, namespace, clientset, config)
+			if err != nil {
+				return nil, err
+			}
+			replica.Links, replica.LinkedReplicas = countReplicaLinks(pod.Name, names, connections)
+		}
+		replicas = append(replicas, replica)
+	}
+	return replicas, nil
+}
+
+// Counts the active links of a router replica, distinguishing those to
+// the other replicas, whose router ids end in their pod names, from
+// those to the routers of other sites
+func countReplicaLinks(name string, replicas []string, connections []Connection) (int, int) {
+	links := 0
+	peers := map[string]bool{}
+	for _, c := range connections {
+		if c.Role != string(RoleInterRouter) && c.Role != string(RoleEdge) {
+			continue
+		}
+		if c.OperStatus != "" && c.OperStatus != "up" {
+			continue
+		}
+		peer := ""
+		for _, replica := range replicas {
+			if replica != name && strings.HasSuffix(c.Container, "-"+replica) {
+				peer = replica
+			}
+		}
+		if peer != "" {
+			peers[peer] = true
+		} else {
+			links++
+		}
+	}
+	return links, len(peers)
+}
+
+// GetConnectionsForPod returns the connections of the router in the
+// pod named, whether or not it is reachable through the other routers
+// of the site
+func GetConnectionsForPod(podName string, namespace string, clientset kubernetes.Interface, config *restclient.Config) ([]Connection, error) {
+	buffer, err := kube.ExecCommandInContainer(get_query("connection"), podName, types.TransportContainerName, namespace, clientset, config)
+	if err != nil {
+		return nil, err
+	}
+	results := []Connection{}
+	if err = json.Unmarshal(buffer.Bytes(), &results); err != nil {
+		return nil, fmt.Errorf("Failed to parse JSON: %s %q", err, buffer.String())
+	}
+	return results, nil
+}
+
+// GetConnectorsForPod returns the connectors of the router in the pod
+// named
+func GetConnectorsForPod(podName string, namespace string, clientset kubernetes.Interface, config *restclient.Config) ([]Connector, error) {
+	buffer, err := kube.ExecCommandInContainer(get_query("connector"), podName, types.TransportContainerName, namespace, clientset, config)
+	if err != nil {
+		return nil, err
+	}
+	results := []Connector{}
+	if err = json.Unmarshal(buffer.Bytes(), &results); err != nil {
+		return nil, fmt.Errorf("Failed to parse JSON: %s %q", err, buffer.String())
+	}
+	return results, nil
+}
+
+// CreateConnectorForPod adds a connector to the router in the pod
+// named. Hostnames are only verified if the connector requests it.
+func CreateConnectorForPod(podName string, connector Connector, namespace string, clientset kubernetes.Interface, config *restclient.Config) error {
+	command := []string{
+		"qdmanage",
+		"create",
+		"--type",
+		"connector",
+		"name=" + connector.Name,
+		"host=" + connector.Host,
+		"port=" + connector.Port,
+		"role=" + string(connector.Role),
+		"verifyHostname=" + strconv.FormatBool(connector.VerifyHostname),
+	}
+	if connector.SslProfile != "" {
+		command = append(command, "sslProfile="+connector.SslProfile)
+	}
+	if connector.Cost != 0 {
+		command = append(command, "cost="+strconv.Itoa(int(connector.Cost)))
+	}
+	if connector.LinkCapacity != 0 {
+		command = append(command, "linkCapacity="+strconv.Itoa(int(connector.LinkCapacity)))
+	}
+	_, err := kube.ExecCommandInContainer(command, podName, types.TransportContainerName, namespace, clientset, config)
+	return err
+}
+
+// DeleteConnectorForPod removes the named connector from the router in
+// the pod named
+func DeleteConnectorForPod(podName string, name string, namespace string, clientset kubernetes.Interface, config *restclient.Config) error {
+	command := []string{
+		"qdmanage",
+		"delete",
+		"--type",
+		"connector",
+		"--name",
+		name,
+	}
+	_, err := kube.ExecCommandInContainer(command, podName, types.TransportContainerName, namespace, clientset, config)
+	return err
+}
+
 func router_exec(command []string, namespace string, clientset kubernetes.Interface, config *restclient.Config) (*bytes.Buffer, error) {
 	pod, err := kube.GetReadyPod(namespace, clientset, "router")
 	if err != nil {
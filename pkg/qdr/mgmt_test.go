@@ -0,0 +1,25 @@
+package qdr
+
+import (
+	"testing"
+)
+
+func TestCountReplicaLinks(t *testing.T) {
+	replicas := []string{"skupper-router-7c9-a1", "skupper-router-7c9-b2", "skupper-router-7c9-c3"}
+	connections := []Connection{
+		{Container: "west-skupper-router-7c9-b2", Role: "inter-router", Dir: "out", OperStatus: "up"},
+		{Container: "west-skupper-router-7c9-c3", Role: "inter-router", Dir: "in", OperStatus: "up"},
+		{Container: "east-skupper-router-5d4-x9", Role: "inter-router", Dir: "out", OperStatus: "up"},
+		{Container: "north-skupper-router-6e2-y8", Role: "edge", Dir: "in", OperStatus: "up"},
+		{Container: "south-skupper-router-4f1-z7", Role: "inter-router", Dir: "out", OperStatus: "down"},
+		{Container: "client", Role: "normal", Dir: "in", OperStatus: "up"},
+	}
+	links, peers := countReplicaLinks("skupper-router-7c9-a1", replicas, connections)
+	if links != 2 || peers != 2 {
+		t.Errorf("Expected 2 links and 2 linked replicas, got %d and %d", links, peers)
+	}
+	links, peers = countReplicaLinks("skupper-router-7c9-b2", replicas, connections[2:])
+	if links != 2 || peers != 0 {
+		t.Errorf("Expected 2 links and no linked replicas, got %d and %d", links, peers)
+	}
+}
@@ -0,0 +1,272 @@
+package qdr
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	"github.com/skupperproject/skupper/api/types"
+)
+
+type routerRecord struct {
+	Id       string `json:"id"`
+	Mode     string `json:"mode"`
+	Metadata string `json:"metadata"`
+}
+
+// The management data gathered for each router in the network
+type routerInfo struct {
+	id          string
+	edge        bool
+	siteId      string
+	connections []Connection
+	connectors  []Connector
+	services    []string
+	endpoints   []serviceEndpoint
+}
+
+// An address served (through a connector) or exposed (through a
+// listener) by one of the bridges of a router
+type serviceEndpoint struct {
+	address  string
+	protocol string
+	target   bool
+}
+
+func get_query_for_edge_router(typename string, routerid string) []string {
+	return append(get_query(typename), "--edge-router", routerid)
+}
+
+func queryRouter(typename string, routerid string, edge bool, results interface{}, namespace string, clientset kubernetes.Interface, config *restclient.Config) error {
+	var command []string
+	if edge && routerid != "" {
+		command = get_query_for_edge_router(typename, routerid)
+	} else {
+		command = get_query_for_router(typename, routerid)
+	}
+	buffer, err := router_exec(command, namespace, clientset, config)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(buffer.Bytes(), results)
+	if err != nil {
+		return fmt.Errorf("Failed to parse JSON: %s %q", err, buffer.String())
+	}
+	return nil
+}
+
+func getRouterInfo(routerid string, edge bool, namespace string, clientset kubernetes.Interface, config *restclient.Config) (*routerInfo, error) {
+	routers := []routerRecord{}
+	err := queryRouter("router", routerid, edge, &routers, namespace, clientset, config)
+	if err != nil {
+		return nil, err
+	}
+	if len(routers) != 1 {
+		return nil, fmt.Errorf("Unexpected number of router records: %d", len(routers))
+	}
+	info := &routerInfo{
+		id:     routers[0].Id,
+		edge:   routers[0].Mode == "edge",
+		siteId: routers[0].Metadata,
+	}
+	if err = queryRouter("connection", routerid, edge, &info.connections, namespace, clientset, config); err != nil {
+		return nil, err
+	}
+	if err = queryRouter("connector", routerid, edge, &info.connectors, namespace, clientset, config); err != nil {
+		return nil, err
+	}
+	tcpConnectors := []TcpEndpoint{}
+	if err = queryRouter("tcpConnector", routerid, edge, &tcpConnectors, namespace, clientset, config); err != nil {
+		return nil, err
+	}
+	for _, c := range tcpConnectors {
+		info.services = append(info.services, c.Address)
+		info.endpoints = append(info.endpoints, serviceEndpoint{address: c.Address, protocol: "tcp", target: true})
+	}
+	httpConnectors := []HttpEndpoint{}
+	if err = queryRouter("httpConnector", routerid, edge, &httpConnectors, namespace, clientset, config); err != nil {
+		return nil, err
+	}
+	for _, c := range httpConnectors {
+		info.services = append(info.services, c.Address)
+		info.endpoints = append(info.endpoints, serviceEndpoint{address: c.Address, protocol: getHttpProtocol(c.ProtocolVersion), target: true})
+	}
+	udpConnectors := []UdpEndpoint{}
+	if err = queryRouter("udpConnector", routerid, edge, &udpConnectors, namespace, clientset, config); err != nil {
+		return nil, err
+	}
+	for _, c := range udpConnectors {
+		info.services = append(info.services, c.Address)
+		info.endpoints = append(info.endpoints, serviceEndpoint{address: c.Address, protocol: "udp", target: true})
+	}
+	tcpListeners := []TcpEndpoint{}
+	if err = queryRouter("tcpListener", routerid, edge, &tcpListeners, namespace, clientset, config); err != nil {
+		return nil, err
+	}
+	for _, l := range tcpListeners {
+		info.endpoints = append(info.endpoints, serviceEndpoint{address: l.Address, protocol: "tcp"})
+	}
+	httpListeners := []HttpEndpoint{}
+	if err = queryRouter("httpListener", routerid, edge, &httpListeners, namespace, clientset, config); err != nil {
+		return nil, err
+	}
+	for _, l := range httpListeners {
+		info.endpoints = append(info.endpoints, serviceEndpoint{address: l.Address, protocol: getHttpProtocol(l.ProtocolVersion)})
+	}
+	udpListeners := []UdpEndpoint{}
+	if err = queryRouter("udpListener", routerid, edge, &udpListeners, namespace, clientset, config); err != nil {
+		return nil, err
+	}
+	for _, l := range udpListeners {
+		info.endpoints = append(info.endpoints, serviceEndpoint{address: l.Address, protocol: "udp"})
+	}
+	return info, nil
+}
+
+func getHttpProtocol(protocolVersion string) string {
+	if protocolVersion == HttpVersion2 {
+		return "http2"
+	}
+	return "http"
+}
+
+// GetNetworkGraph queries the routers of every site reachable from the
+// local router to determine the topology of the network
+func GetNetworkGraph(namespace string, clientset kubernetes.Interface, config *restclient.Config) (*types.NetworkGraph, error) {
+	routers, err := getNetworkRouters(namespace, clientset, config)
+	if err != nil {
+		return nil, err
+	}
+	return newNetworkGraph(routers), nil
+}
+
+func getNetworkRouters(namespace string, clientset kubernetes.Interface, config *restclient.Config) ([]*routerInfo, error) {
+	local, err := getRouterInfo("", false, namespace, clientset, config)
+	if err != nil {
+		return nil, err
+	}
+	routers := map[string]*routerInfo{}
+	var nodes []RouterNode
+	if local.edge {
+		routers[local.id] = local
+		uplinks, _ := getEdgeConnections("out", local.connections)
+		if len(uplinks) > 0 {
+			nodes, err = getNodesForRouter(uplinks[0].Container, namespace, clientset, config)
+		}
+	} else {
+		nodes, err = GetNodes(namespace, clientset, config)
+	}
+	if err != nil {
+		return nil, err
+	}
+	interiors := []*routerInfo{}
+	for _, n := range nodes {
+		info := local
+		if n.Id != local.id {
+			info, err = getRouterInfo(n.Id, false, namespace, clientset, config)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to query router %s: %w", n.Id, err)
+			}
+		}
+		routers[info.id] = info
+		interiors = append(interiors, info)
+	}
+	for _, interior := range interiors {
+		edges, _ := getEdgeConnections("in", interior.connections)
+		for _, c := range edges {
+			if _, ok := routers[c.Container]; ok {
+				continue
+			}
+			info, err := getRouterInfo(c.Container, true, namespace, clientset, config)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to query edge router %s: %w", c.Container, err)
+			}
+			routers[info.id] = info
+		}
+	}
+	list := []*routerInfo{}
+	for _, r := range routers {
+		list = append(list, r)
+	}
+	return list, nil
+}
+
+func getConnectorCost(host string, connectors []Connector) int {
+	for _, c := range connectors {
+		if c.Host+":"+c.Port == host {
+			if c.Cost == 0 {
+				return 1
+			}
+			return int(c.Cost)
+		}
+	}
+	return 1
+}
+
+func newNetworkGraph(routers []*routerInfo) *types.NetworkGraph {
+	graph := &types.NetworkGraph{
+		Sites: []types.NetworkGraphSite{},
+		Links: []types.NetworkGraphLink{},
+	}
+	sort.Slice(routers, func(i, j int) bool {
+		return routers[i].id < routers[j].id
+	})
+	sites := map[string]int{}
+	for _, r := range routers {
+		index, ok := sites[r.siteId]
+		if !ok {
+			index = len(graph.Sites)
+			sites[r.siteId] = index
+			graph.Sites = append(graph.Sites, types.NetworkGraphSite{
+				Id:      r.siteId,
+				Edge:    r.edge,
+				Routers: []string{},
+			})
+		}
+		site := &graph.Sites[index]
+		site.Routers = append(site.Routers, r.id)
+		for _, service := range r.services {
+			if !containsString(site.Services, service) {
+				site.Services = append(site.Services, service)
+			}
+		}
+		for _, c := range r.connections {
+			if c.Dir != "out" {
+				continue
+			}
+			if c.Role == string(RoleInterRouter) {
+				graph.Links = append(graph.Links, types.NetworkGraphLink{
+					From: r.id,
+					To:   c.Container,
+					Role: c.Role,
+					Cost: getConnectorCost(c.Host, r.connectors),
+				})
+			} else if c.Role == string(RoleEdge) {
+				graph.Links = append(graph.Links, types.NetworkGraphLink{
+					From: r.id,
+					To:   c.Container,
+					Role: c.Role,
+				})
+			}
+		}
+	}
+	sort.Slice(graph.Sites, func(i, j int) bool {
+		return graph.Sites[i].Id < graph.Sites[j].Id
+	})
+	for _, site := range graph.Sites {
+		sort.Strings(site.Services)
+	}
+	return graph
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package qdr
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/skupperproject/skupper/api/types"
+)
+
+func TestNewNetworkGraph(t *testing.T) {
+	routers := []*routerInfo{
+		{
+			id:     "b-skupper-router-1",
+			siteId: "site-b",
+			connections: []Connection{
+				{Container: "a-skupper-router-1", Role: "inter-router", Dir: "out", Host: "skupper-inter-router-a:55671"},
+				{Container: "c-skupper-router-1", Role: "edge", Dir: "in"},
+				{Container: "client", Role: "normal", Dir: "in"},
+			},
+			connectors: []Connector{
+				{Name: "conn1", Host: "skupper-inter-router-a", Port: "55671", Cost: 5},
+			},
+			services: []string{"db"},
+		},
+		{
+			id:     "a-skupper-router-1",
+			siteId: "site-a",
+			connections: []Connection{
+				{Container: "b-skupper-router-1", Role: "inter-router", Dir: "in"},
+			},
+			services: []string{"web", "api"},
+		},
+		{
+			id:     "c-skupper-router-1",
+			siteId: "site-c",
+			edge:   true,
+			connections: []Connection{
+				{Container: "b-skupper-router-1", Role: "edge", Dir: "out"},
+			},
+			services: []string{"db", "db"},
+		},
+	}
+	expected := &types.NetworkGraph{
+		Sites: []types.NetworkGraphSite{
+			{Id: "site-a", Routers: []string{"a-skupper-router-1"}, Services: []string{"api", "web"}},
+			{Id: "site-b", Routers: []string{"b-skupper-router-1"}, Services: []string{"db"}},
+			{Id: "site-c", Edge: true, Routers: []string{"c-skupper-router-1"}, Services: []string{"db"}},
+		},
+		Links: []types.NetworkGraphLink{
+			{From: "b-skupper-router-1", To: "a-skupper-router-1", Role: "inter-router", Cost: 5},
+			{From: "c-skupper-router-1", To: "b-skupper-router-1", Role: "edge"},
+		},
+	}
+	actual := newNetworkGraph(routers)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected graph, expected %v got %v", expected, actual)
+	}
+}
@@ -0,0 +1,60 @@
+package qdr
+
+import (
+	"sort"
+
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+
+	"github.com/skupperproject/skupper/api/types"
+)
+
+// GetNetworkServices queries the routers of every site reachable from
+// the local router to determine where each address is served
+func GetNetworkServices(namespace string, clientset kubernetes.Interface, config *restclient.Config) ([]*types.NetworkService, error) {
+	routers, err := getNetworkRouters(namespace, clientset, config)
+	if err != nil {
+		return nil, err
+	}
+	return newNetworkServices(routers), nil
+}
+
+func newNetworkServices(routers []*routerInfo) []*types.NetworkService {
+	services := map[string]*types.NetworkService{}
+	// target counts by address, then by site
+	targets := map[string]map[string]int{}
+	for _, r := range routers {
+		for _, e := range r.endpoints {
+			service, ok := services[e.address]
+			if !ok {
+				service = &types.NetworkService{
+					Address:  e.address,
+					Protocol: e.protocol,
+					Sites:    []types.NetworkServiceSite{},
+				}
+				services[e.address] = service
+				targets[e.address] = map[string]int{}
+			}
+			if e.target {
+				targets[e.address][r.siteId] += 1
+				service.Reachable = true
+			} else if _, ok := targets[e.address][r.siteId]; !ok {
+				targets[e.address][r.siteId] = 0
+			}
+		}
+	}
+	list := []*types.NetworkService{}
+	for address, service := range services {
+		for site, count := range targets[address] {
+			service.Sites = append(service.Sites, types.NetworkServiceSite{Id: site, Targets: count})
+		}
+		sort.Slice(service.Sites, func(i, j int) bool {
+			return service.Sites[i].Id < service.Sites[j].Id
+		})
+		list = append(list, service)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Address < list[j].Address
+	})
+	return list
+}
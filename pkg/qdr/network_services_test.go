@@ -0,0 +1,70 @@
+package qdr
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/skupperproject/skupper/api/types"
+)
+
+func TestNewNetworkServices(t *testing.T) {
+	routers := []*routerInfo{
+		{
+			id:     "a-skupper-router-1",
+			siteId: "site-a",
+			endpoints: []serviceEndpoint{
+				{address: "web", protocol: "http"},
+				{address: "web", protocol: "http", target: true},
+				{address: "db", protocol: "tcp"},
+				{address: "cache", protocol: "tcp"},
+			},
+		},
+		{
+			id:     "b-skupper-router-1",
+			siteId: "site-b",
+			endpoints: []serviceEndpoint{
+				{address: "web", protocol: "http"},
+				{address: "db", protocol: "tcp", target: true},
+				{address: "db", protocol: "tcp", target: true},
+				{address: "cache", protocol: "tcp"},
+			},
+		},
+		{
+			id:     "c-skupper-router-1",
+			siteId: "site-c",
+			edge:   true,
+		},
+	}
+	expected := []*types.NetworkService{
+		{
+			Address:  "cache",
+			Protocol: "tcp",
+			Sites: []types.NetworkServiceSite{
+				{Id: "site-a", Targets: 0},
+				{Id: "site-b", Targets: 0},
+			},
+		},
+		{
+			Address:  "db",
+			Protocol: "tcp",
+			Sites: []types.NetworkServiceSite{
+				{Id: "site-a", Targets: 0},
+				{Id: "site-b", Targets: 2},
+			},
+			Reachable: true,
+		},
+		{
+			Address:  "web",
+			Protocol: "http",
+			Sites: []types.NetworkServiceSite{
+				{Id: "site-a", Targets: 1},
+				{Id: "site-b", Targets: 0},
+			},
+			Reachable: true,
+		},
+	}
+	actual := newNetworkServices(routers)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected services, expected %v got %v", expected, actual)
+	}
+}
@@ -23,12 +23,15 @@ type RouterConfig struct {
 
 type TcpEndpointMap map[string]TcpEndpoint
 type HttpEndpointMap map[string]HttpEndpoint
+type UdpEndpointMap map[string]UdpEndpoint
 
 type BridgeConfig struct {
 	TcpListeners   TcpEndpointMap
 	TcpConnectors  TcpEndpointMap
 	HttpListeners  HttpEndpointMap
 	HttpConnectors HttpEndpointMap
+	UdpListeners   UdpEndpointMap
+	UdpConnectors  UdpEndpointMap
 }
 
 func InitialConfig(id string, metadata string, edge bool) RouterConfig {
@@ -46,6 +49,8 @@ func InitialConfig(id string, metadata string, edge bool) RouterConfig {
 			TcpConnectors:  map[string]TcpEndpoint{},
 			HttpListeners:  map[string]HttpEndpoint{},
 			HttpConnectors: map[string]HttpEndpoint{},
+			UdpListeners:   map[string]UdpEndpoint{},
+			UdpConnectors:  map[string]UdpEndpoint{},
 		},
 	}
 	if edge {
@@ -62,6 +67,8 @@ func NewBridgeConfig() BridgeConfig {
 		TcpConnectors:  map[string]TcpEndpoint{},
 		HttpListeners:  map[string]HttpEndpoint{},
 		HttpConnectors: map[string]HttpEndpoint{},
+		UdpListeners:   map[string]UdpEndpoint{},
+		UdpConnectors:  map[string]UdpEndpoint{},
 	}
 }
 
@@ -110,7 +117,17 @@ func (r *RouterConfig) RemoveSslProfile(name string) bool {
 }
 
 func (r *RouterConfig) AddAddress(a Address) {
-	r.Addresses[a.Prefix] = a
+	r.Addresses[a.Key()] = a
+}
+
+func (r *RouterConfig) RemoveAddress(key string) bool {
+	_, ok := r.Addresses[key]
+	if ok {
+		delete(r.Addresses, key)
+		return true
+	} else {
+		return false
+	}
 }
 
 func (r *RouterConfig) AddTcpConnector(e TcpEndpoint) {
@@ -129,6 +146,14 @@ func (r *RouterConfig) AddHttpListener(e HttpEndpoint) {
 	r.Bridges.AddHttpListener(e)
 }
 
+func (r *RouterConfig) AddUdpConnector(e UdpEndpoint) {
+	r.Bridges.AddUdpConnector(e)
+}
+
+func (r *RouterConfig) AddUdpListener(e UdpEndpoint) {
+	r.Bridges.AddUdpListener(e)
+}
+
 func (r *RouterConfig) UpdateBridgeConfig(desired BridgeConfig) bool {
 	if reflect.DeepEqual(r.Bridges, desired) {
 		return false
@@ -154,6 +179,14 @@ func (bc *BridgeConfig) AddHttpListener(e HttpEndpoint) {
 	bc.HttpListeners[e.Name] = e
 }
 
+func (bc *BridgeConfig) AddUdpConnector(e UdpEndpoint) {
+	bc.UdpConnectors[e.Name] = e
+}
+
+func (bc *BridgeConfig) AddUdpListener(e UdpEndpoint) {
+	bc.UdpListeners[e.Name] = e
+}
+
 type Role string
 
 const (
@@ -224,17 +257,33 @@ const (
 	DistributionClosest                = "closest"
 )
 
+// An address matches either those with the prefix given or, where a
+// pattern is given instead, those matching that pattern, a pattern
+// without wildcards matching only the address itself
 type Address struct {
+	Name         string `json:"name,omitempty"`
 	Prefix       string `json:"prefix,omitempty"`
+	Pattern      string `json:"pattern,omitempty"`
 	Distribution string `json:"distribution,omitempty"`
 }
 
+// Key returns the key under which the address is held in the router
+// config, which is its prefix or, if it has none, its pattern
+func (a Address) Key() string {
+	if a.Prefix != "" {
+		return a.Prefix
+	}
+	return a.Pattern
+}
+
 type TcpEndpoint struct {
-	Name    string `json:"name,omitempty"`
-	Host    string `json:"host,omitempty"`
-	Port    string `json:"port,omitempty"`
-	Address string `json:"address,omitempty"`
-	SiteId  string `json:"siteId,omitempty"`
+	Name           string `json:"name,omitempty"`
+	Host           string `json:"host,omitempty"`
+	Port           string `json:"port,omitempty"`
+	Address        string `json:"address,omitempty"`
+	SiteId         string `json:"siteId,omitempty"`
+	SslProfile     string `json:"sslProfile,omitempty"`
+	VerifyHostname *bool  `json:"verifyHostname,omitempty"`
 }
 
 type HttpEndpoint struct {
@@ -247,6 +296,16 @@ type HttpEndpoint struct {
 	Aggregation     string `json:"aggregation,omitempty"`
 	EventChannel    bool   `json:"eventChannel,omitempty"`
 	HostOverride    string `json:"hostOverride,omitempty"`
+	SslProfile      string `json:"sslProfile,omitempty"`
+	VerifyHostname  *bool  `json:"verifyHostname,omitempty"`
+}
+
+type UdpEndpoint struct {
+	Name    string `json:"name,omitempty"`
+	Host    string `json:"host,omitempty"`
+	Port    string `json:"port,omitempty"`
+	Address string `json:"address,omitempty"`
+	SiteId  string `json:"siteId,omitempty"`
 }
 
 func convert(from interface{}, to interface{}) error {
@@ -273,6 +332,8 @@ func UnmarshalRouterConfig(config string) (RouterConfig, error) {
 			TcpConnectors:  map[string]TcpEndpoint{},
 			HttpListeners:  map[string]HttpEndpoint{},
 			HttpConnectors: map[string]HttpEndpoint{},
+			UdpListeners:   map[string]UdpEndpoint{},
+			UdpConnectors:  map[string]UdpEndpoint{},
 		},
 	}
 	var obj interface{}
@@ -307,7 +368,7 @@ func UnmarshalRouterConfig(config string) (RouterConfig, error) {
 			if err != nil {
 				return result, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
 			}
-			result.Addresses[address.Prefix] = address
+			result.Addresses[address.Key()] = address
 		case "connector":
 			connector := Connector{}
 			err = convert(element[1], &connector)
@@ -357,6 +418,20 @@ func UnmarshalRouterConfig(config string) (RouterConfig, error) {
 				return result, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
 			}
 			result.Bridges.HttpListeners[listener.Name] = listener
+		case "udpConnector":
+			connector := UdpEndpoint{}
+			err = convert(element[1], &connector)
+			if err != nil {
+				return result, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
+			}
+			result.Bridges.UdpConnectors[connector.Name] = connector
+		case "udpListener":
+			listener := UdpEndpoint{}
+			err = convert(element[1], &listener)
+			if err != nil {
+				return result, fmt.Errorf("Invalid %s element got %#v", entityType, element[1])
+			}
+			result.Bridges.UdpListeners[listener.Name] = listener
 		default:
 		}
 	}
@@ -426,6 +501,20 @@ func MarshalRouterConfig(config RouterConfig) (string, error) {
 		}
 		elements = append(elements, tuple)
 	}
+	for _, e := range config.Bridges.UdpConnectors {
+		tuple := []interface{}{
+			"udpConnector",
+			e,
+		}
+		elements = append(elements, tuple)
+	}
+	for _, e := range config.Bridges.UdpListeners {
+		tuple := []interface{}{
+			"udpListener",
+			e,
+		}
+		elements = append(elements, tuple)
+	}
 	data, err := json.MarshalIndent(elements, "", "    ")
 	if err != nil {
 		return "", err
@@ -461,7 +550,7 @@ func (r *RouterConfig) UpdateConfigMap(configmap *corev1.ConfigMap) (bool, error
 		if err != nil {
 			return false, err
 		}
-		if reflect.DeepEqual(existing, r) {
+		if reflect.DeepEqual(existing, *r) {
 			return false, nil
 		}
 	}
@@ -523,11 +612,18 @@ type HttpEndpointDifference struct {
 	Added   []HttpEndpoint
 }
 
+type UdpEndpointDifference struct {
+	Deleted []string
+	Added   []UdpEndpoint
+}
+
 type BridgeConfigDifference struct {
 	TcpListeners   TcpEndpointDifference
 	TcpConnectors  TcpEndpointDifference
 	HttpListeners  HttpEndpointDifference
 	HttpConnectors HttpEndpointDifference
+	UdpListeners   UdpEndpointDifference
+	UdpConnectors  UdpEndpointDifference
 }
 
 func (a TcpEndpointMap) Difference(b TcpEndpointMap) TcpEndpointDifference {
@@ -550,10 +646,18 @@ func (a TcpEndpointMap) Difference(b TcpEndpointMap) TcpEndpointDifference {
 	return result
 }
 
+func equivalentVerifyHostname(a *bool, b *bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
 func (a HttpEndpoint) Equivalent(b HttpEndpoint) bool {
 	if a.Host != b.Host || a.Port != b.Port || a.Address != b.Address ||
 		a.SiteId != b.SiteId || a.Aggregation != b.Aggregation ||
-		a.EventChannel != b.EventChannel || a.HostOverride != b.HostOverride {
+		a.EventChannel != b.EventChannel || a.HostOverride != b.HostOverride ||
+		a.SslProfile != b.SslProfile || !equivalentVerifyHostname(a.VerifyHostname, b.VerifyHostname) {
 		return false
 	}
 	if a.ProtocolVersion == HttpVersion2 && b.ProtocolVersion != HttpVersion2 {
@@ -582,12 +686,34 @@ func (a HttpEndpointMap) Difference(b HttpEndpointMap) HttpEndpointDifference {
 	return result
 }
 
+func (a UdpEndpointMap) Difference(b UdpEndpointMap) UdpEndpointDifference {
+	result := UdpEndpointDifference{}
+	for key, v1 := range b {
+		v2, ok := a[key]
+		if !ok {
+			result.Added = append(result.Added, v1)
+		} else if v1 != v2 {
+			result.Deleted = append(result.Deleted, v1.Name)
+			result.Added = append(result.Added, v1)
+		}
+	}
+	for key, v1 := range a {
+		_, ok := b[key]
+		if !ok {
+			result.Deleted = append(result.Deleted, v1.Name)
+		}
+	}
+	return result
+}
+
 func (a *BridgeConfig) Difference(b *BridgeConfig) *BridgeConfigDifference {
 	result := BridgeConfigDifference{
 		TcpConnectors:  a.TcpConnectors.Difference(b.TcpConnectors),
 		TcpListeners:   a.TcpListeners.Difference(b.TcpListeners),
 		HttpConnectors: a.HttpConnectors.Difference(b.HttpConnectors),
 		HttpListeners:  a.HttpListeners.Difference(b.HttpListeners),
+		UdpConnectors:  a.UdpConnectors.Difference(b.UdpConnectors),
+		UdpListeners:   a.UdpListeners.Difference(b.UdpListeners),
 	}
 	return &result
 }
@@ -600,8 +726,12 @@ func (a *HttpEndpointDifference) Empty() bool {
 	return len(a.Deleted) == 0 && len(a.Added) == 0
 }
 
+func (a *UdpEndpointDifference) Empty() bool {
+	return len(a.Deleted) == 0 && len(a.Added) == 0
+}
+
 func (a *BridgeConfigDifference) Empty() bool {
-	return a.TcpConnectors.Empty() && a.TcpListeners.Empty() && a.HttpConnectors.Empty() && a.HttpListeners.Empty()
+	return a.TcpConnectors.Empty() && a.TcpListeners.Empty() && a.HttpConnectors.Empty() && a.HttpListeners.Empty() && a.UdpConnectors.Empty() && a.UdpListeners.Empty()
 }
 
 func (a *BridgeConfigDifference) Print() {
@@ -609,6 +739,8 @@ func (a *BridgeConfigDifference) Print() {
 	log.Printf("TcpListeners added=%v, deleted=%v", a.TcpListeners.Added, a.TcpListeners.Deleted)
 	log.Printf("HttpConnectors added=%v, deleted=%v", a.HttpConnectors.Added, a.HttpConnectors.Deleted)
 	log.Printf("HttpListeners added=%v, deleted=%v", a.HttpListeners.Added, a.HttpListeners.Deleted)
+	log.Printf("UdpConnectors added=%v, deleted=%v", a.UdpConnectors.Added, a.UdpConnectors.Deleted)
+	log.Printf("UdpListeners added=%v, deleted=%v", a.UdpListeners.Added, a.UdpListeners.Deleted)
 }
 
 func GetRouterConfigForHeadlessProxy(definition types.ServiceInterface, siteId string, namespace string) (string, error) {
@@ -663,6 +795,14 @@ func GetRouterConfigForHeadlessProxy(definition types.ServiceInterface, siteId s
 				ProtocolVersion: HttpVersion2,
 				SiteId:          siteId,
 			})
+		case "udp":
+			config.AddUdpConnector(UdpEndpoint{
+				Name:    "egress",
+				Host:    host,
+				Port:    strconv.Itoa(port),
+				Address: address,
+				SiteId:  siteId,
+			})
 		default:
 		}
 	} else {
@@ -695,6 +835,14 @@ func GetRouterConfigForHeadlessProxy(definition types.ServiceInterface, siteId s
 				ProtocolVersion: HttpVersion2,
 				SiteId:          siteId,
 			})
+		case "udp":
+			config.AddUdpListener(UdpEndpoint{
+				Name:    "ingress",
+				Host:    host,
+				Port:    strconv.Itoa(port),
+				Address: address,
+				SiteId:  siteId,
+			})
 		default:
 		}
 	}
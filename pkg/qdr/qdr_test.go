@@ -81,6 +81,17 @@ func TestAddAddress(t *testing.T) {
 	if config.Addresses["foo"].Distribution != "multicast" {
 		t.Errorf("Expected distribution %q but got %q", DistributionMulticast, config.Addresses["foo"].Distribution)
 	}
+	config.AddAddress(Address{
+		Name:         "bar",
+		Pattern:      "bar",
+		Distribution: DistributionClosest,
+	})
+	if config.Addresses["bar"].Distribution != "closest" {
+		t.Errorf("Expected distribution %q but got %q", DistributionClosest, config.Addresses["bar"].Distribution)
+	}
+	if !config.RemoveAddress("bar") || len(config.Addresses) != 1 {
+		t.Errorf("Expected address bar to be removed, got %#v", config.Addresses)
+	}
 }
 
 func TestMarshalUnmarshalRouterConfig(t *testing.T) {
@@ -199,6 +210,24 @@ func TestMarshalUnmarshalRouterConfig(t *testing.T) {
 					SiteId:  "def",
 				},
 			},
+			UdpConnectors: map[string]UdpEndpoint{
+				"c5": UdpEndpoint{
+					Name:    "c5",
+					Address: "dns",
+					Host:    "resolver.com",
+					Port:    "53",
+					SiteId:  "abc",
+				},
+			},
+			UdpListeners: map[string]UdpEndpoint{
+				"l5": UdpEndpoint{
+					Name:    "l5",
+					Address: "dns",
+					Host:    "0.0.0.0",
+					Port:    "1053",
+					SiteId:  "def",
+				},
+			},
 		},
 		Addresses: map[string]Address{
 			"happy": Address{
@@ -334,6 +363,44 @@ func TestUnmarshalErrorInvalidHttpListenerValue(t *testing.T) {
 	}
 }
 
+func TestUnmarshalErrorInvalidUdpConnectorValue(t *testing.T) {
+	_, err := UnmarshalRouterConfig(`[["udpConnector", ["wrong"]]]`)
+	if err == nil {
+		t.Errorf("Expected error for invalid udpconnector value")
+	}
+}
+
+func TestUnmarshalErrorInvalidUdpListenerValue(t *testing.T) {
+	_, err := UnmarshalRouterConfig(`[["udpListener", ["wrong"]]]`)
+	if err == nil {
+		t.Errorf("Expected error for invalid udplistener value")
+	}
+}
+
+func TestUdpEndpointDifference(t *testing.T) {
+	before := NewBridgeConfig()
+	before.AddUdpListener(UdpEndpoint{Name: "dns", Host: "0.0.0.0", Port: "1024", Address: "dns"})
+	before.AddUdpConnector(UdpEndpoint{Name: "dns@10.0.0.1", Host: "10.0.0.1", Port: "53", Address: "dns"})
+	after := NewBridgeConfig()
+	after.AddUdpListener(UdpEndpoint{Name: "dns", Host: "0.0.0.0", Port: "1025", Address: "dns"})
+	after.AddUdpConnector(UdpEndpoint{Name: "dns@10.0.0.2", Host: "10.0.0.2", Port: "53", Address: "dns"})
+
+	diff := before.Difference(&after)
+	if diff.Empty() {
+		t.Errorf("Expected differences in udp bridges")
+	}
+	if !reflect.DeepEqual(diff.UdpListeners.Deleted, []string{"dns"}) || len(diff.UdpListeners.Added) != 1 || diff.UdpListeners.Added[0].Port != "1025" {
+		t.Errorf("Incorrect udp listener changes: %#v", diff.UdpListeners)
+	}
+	if !reflect.DeepEqual(diff.UdpConnectors.Deleted, []string{"dns@10.0.0.1"}) || len(diff.UdpConnectors.Added) != 1 || diff.UdpConnectors.Added[0].Host != "10.0.0.2" {
+		t.Errorf("Incorrect udp connector changes: %#v", diff.UdpConnectors)
+	}
+	diff = after.Difference(&after)
+	if !diff.Empty() {
+		t.Errorf("Expected no differences, got %#v", diff)
+	}
+}
+
 func TestFailedConvert(t *testing.T) {
 	a := []string{"random"}
 	b := SslProfile{}
@@ -342,3 +409,58 @@ func TestFailedConvert(t *testing.T) {
 		t.Errorf("Expected error for invalid conversion")
 	}
 }
+
+func TestHttpEndpointEquivalentTls(t *testing.T) {
+	verify := true
+	noVerify := false
+	a := HttpEndpoint{Name: "a", Host: "foo", Port: "8080", Address: "a"}
+	b := a
+	if !a.Equivalent(b) {
+		t.Errorf("Expected %v to be equivalent to %v", a, b)
+	}
+	b.SslProfile = "my-profile"
+	if a.Equivalent(b) {
+		t.Errorf("Expected difference in sslProfile to be detected")
+	}
+	a.SslProfile = "my-profile"
+	a.VerifyHostname = &verify
+	if a.Equivalent(b) {
+		t.Errorf("Expected difference in verifyHostname to be detected")
+	}
+	b.VerifyHostname = &noVerify
+	if a.Equivalent(b) {
+		t.Errorf("Expected difference in verifyHostname to be detected")
+	}
+	another := true
+	b.VerifyHostname = &another
+	if !a.Equivalent(b) {
+		t.Errorf("Expected %v to be equivalent to %v", a, b)
+	}
+}
+
+func TestAsTcpEndpointTls(t *testing.T) {
+	endpoint := asTcpEndpoint(Record{
+		"name":           "foo",
+		"host":           "10.0.0.1",
+		"port":           "8080",
+		"address":        "foo",
+		"verifyHostname": true,
+	})
+	if endpoint.VerifyHostname != nil {
+		t.Errorf("Expected verifyHostname to be ignored without sslProfile, got %v", *endpoint.VerifyHostname)
+	}
+	endpoint = asTcpEndpoint(Record{
+		"name":           "foo",
+		"host":           "10.0.0.1",
+		"port":           "8080",
+		"address":        "foo",
+		"sslProfile":     "my-profile",
+		"verifyHostname": false,
+	})
+	if endpoint.SslProfile != "my-profile" {
+		t.Errorf("Invalid sslProfile, expected 'my-profile' got %q", endpoint.SslProfile)
+	}
+	if endpoint.VerifyHostname == nil || *endpoint.VerifyHostname {
+		t.Errorf("Expected verifyHostname to be false")
+	}
+}
@@ -25,6 +25,12 @@ func getTestImage() string {
 func int32Ptr(i int32) *int32 { return &i }
 
 func CreateTestJob(ns string, kubeClient kubernetes.Interface, name string, command []string) (*batchv1.Job, error) {
+	return CreateTestJobWithEnv(ns, kubeClient, name, command, nil)
+}
+
+// CreateTestJobWithEnv creates a test job whose container has the
+// environment variables given in addition to JOB
+func CreateTestJobWithEnv(ns string, kubeClient kubernetes.Interface, name string, command []string, env []apiv1.EnvVar) (*batchv1.Job, error) {
 
 	namespace := ns
 	testImage := getTestImage()
@@ -46,9 +52,9 @@ func CreateTestJob(ns string, kubeClient kubernetes.Interface, name string, comm
 							Name:    name,
 							Image:   testImage,
 							Command: command,
-							Env: []apiv1.EnvVar{
+							Env: append([]apiv1.EnvVar{
 								{Name: "JOB", Value: name},
-							},
+							}, env...),
 							ImagePullPolicy: apiv1.PullAlways,
 						},
 					},
@@ -100,6 +106,23 @@ func WaitForJob(ns string, kubeClient kubernetes.Interface, jobName string, time
 
 }
 
+// GetJobLogs returns the logs of the pods run by a job
+func GetJobLogs(ns string, kubeClient kubernetes.Interface, jobName string) (string, error) {
+	pods, err := kubeClient.CoreV1().Pods(ns).List(metav1.ListOptions{LabelSelector: "job-name=" + jobName})
+	if err != nil {
+		return "", err
+	}
+	logs := ""
+	for _, pod := range pods.Items {
+		data, err := kubeClient.CoreV1().Pods(ns).GetLogs(pod.Name, &apiv1.PodLogOptions{}).Do().Raw()
+		if err != nil {
+			return logs, err
+		}
+		logs += string(data)
+	}
+	return logs, nil
+}
+
 func AssertJob(t *testing.T, job *batchv1.Job) {
 	t.Helper()
 	assert.Equal(t, int(job.Status.Succeeded), 1)
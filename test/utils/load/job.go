@@ -0,0 +1,163 @@
+package load
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skupperproject/skupper/test/utils/k8s"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The options for a workload run from a job are passed to it through
+// these environment variables
+const (
+	EnvProtocol    = "BENCH_PROTOCOL"
+	EnvAddress     = "BENCH_ADDRESS"
+	EnvDuration    = "BENCH_DURATION"
+	EnvRate        = "BENCH_RATE"
+	EnvConnections = "BENCH_CONNECTIONS"
+	EnvMessageSize = "BENCH_MESSAGE_SIZE"
+	EnvTimeout     = "BENCH_TIMEOUT"
+)
+
+// The report of a workload run from a job is written to its log on a
+// single line starting with this marker
+const reportMarker = "BENCH_REPORT: "
+
+// The command run by the job, the load test binary built by the
+// build-tests make target
+var jobCommand = []string{"/app/load_test", "-test.run", "Job"}
+
+// Env returns the environment variables through which the options are
+// passed to a job
+func (o *Options) Env() []apiv1.EnvVar {
+	return []apiv1.EnvVar{
+		{Name: EnvProtocol, Value: o.Protocol},
+		{Name: EnvAddress, Value: o.Address},
+		{Name: EnvDuration, Value: o.Duration.String()},
+		{Name: EnvRate, Value: strconv.Itoa(o.Rate)},
+		{Name: EnvConnections, Value: strconv.Itoa(o.Connections)},
+		{Name: EnvMessageSize, Value: strconv.Itoa(o.MessageSize)},
+		{Name: EnvTimeout, Value: o.Timeout.String()},
+	}
+}
+
+func getIntFromEnv(name string) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s: %s", name, err)
+	}
+	return i, nil
+}
+
+func getDurationFromEnv(name string) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s: %s", name, err)
+	}
+	return d, nil
+}
+
+// OptionsFromEnv reads the options passed to a job
+func OptionsFromEnv() (Options, error) {
+	var err error
+	options := Options{
+		Protocol: os.Getenv(EnvProtocol),
+		Address:  os.Getenv(EnvAddress),
+	}
+	if options.Duration, err = getDurationFromEnv(EnvDuration); err != nil {
+		return options, err
+	}
+	if options.Rate, err = getIntFromEnv(EnvRate); err != nil {
+		return options, err
+	}
+	if options.Connections, err = getIntFromEnv(EnvConnections); err != nil {
+		return options, err
+	}
+	if options.MessageSize, err = getIntFromEnv(EnvMessageSize); err != nil {
+		return options, err
+	}
+	if options.Timeout, err = getDurationFromEnv(EnvTimeout); err != nil {
+		return options, err
+	}
+	return options, options.Validate()
+}
+
+// PrintReport writes the report where it can be found by ParseReport
+func PrintReport(w io.Writer, report *Report) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", reportMarker, data)
+	return err
+}
+
+// ParseReport finds the report in the log of a job
+func ParseReport(log string) (*Report, error) {
+	scanner := bufio.NewScanner(strings.NewReader(log))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, reportMarker); i >= 0 {
+			report := &Report{}
+			if err := json.Unmarshal([]byte(line[i+len(reportMarker):]), report); err != nil {
+				return nil, fmt.Errorf("Invalid report: %s", err)
+			}
+			return report, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("No report found in job log")
+}
+
+// RunJob runs the workload from a job in the namespace given, so that
+// the address is reached as it would be by any other pod on the
+// service network. The job is deleted once its report has been read.
+func RunJob(ns string, kubeClient kubernetes.Interface, name string, options Options, timeout time.Duration) (*Report, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	_, err := k8s.CreateTestJobWithEnv(ns, kubeClient, name, jobCommand, options.Env())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create job %s: %w", name, err)
+	}
+	defer func() {
+		propagation := metav1.DeletePropagationBackground
+		kubeClient.BatchV1().Jobs(ns).Delete(name, &metav1.DeleteOptions{PropagationPolicy: &propagation})
+	}()
+	job, err := k8s.WaitForJob(ns, kubeClient, name, timeout+options.Duration)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := k8s.GetJobLogs(ns, kubeClient, name)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve logs of job %s: %w", name, err)
+	}
+	report, err := ParseReport(logs)
+	if err != nil {
+		if job.Status.Succeeded == 0 {
+			return nil, fmt.Errorf("Job %s failed: %s", name, err)
+		}
+		return nil, err
+	}
+	return report, nil
+}
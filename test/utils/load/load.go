@@ -0,0 +1,277 @@
+// Package load runs HTTP and TCP workloads against an address exposed
+// on the service network, and reports the throughput and latency
+// observed so that runs can be compared against a saved baseline.
+package load
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+const (
+	ProtocolHttp = "http"
+	ProtocolTcp  = "tcp"
+)
+
+// Options configures a workload. For http, requests are sent at the
+// given rate; for tcp, each connection sends messages of the given
+// size as fast as they are echoed back, so the target must echo what
+// it receives (e.g. the tcp-go-echo service used in the tcp_echo
+// integration test).
+type Options struct {
+	Protocol    string
+	Address     string
+	Duration    time.Duration
+	Rate        int
+	Connections int
+	MessageSize int
+	Timeout     time.Duration
+}
+
+func (o *Options) setDefaults() {
+	if o.Protocol == "" {
+		o.Protocol = ProtocolHttp
+	}
+	if o.Duration == 0 {
+		o.Duration = 10 * time.Second
+	}
+	if o.Rate == 0 {
+		o.Rate = 100
+	}
+	if o.Connections == 0 {
+		o.Connections = 1
+	}
+	if o.MessageSize == 0 {
+		o.MessageSize = 1024
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 30 * time.Second
+	}
+}
+
+// Validate checks the options, setting defaults for those not given
+func (o *Options) Validate() error {
+	o.setDefaults()
+	if o.Address == "" {
+		return fmt.Errorf("An address to run the workload against must be specified")
+	}
+	if o.Protocol != ProtocolHttp && o.Protocol != ProtocolTcp {
+		return fmt.Errorf("Invalid protocol %q, must be %s or %s", o.Protocol, ProtocolHttp, ProtocolTcp)
+	}
+	if o.Duration < 0 || o.Rate < 0 || o.Connections < 0 || o.MessageSize < 0 || o.Timeout < 0 {
+		return fmt.Errorf("The duration, rate, connections, message size and timeout cannot be negative")
+	}
+	return nil
+}
+
+// The URL requested for an address, which may be given as host:port
+func (o *Options) url() string {
+	if strings.HasPrefix(o.Address, "http://") || strings.HasPrefix(o.Address, "https://") {
+		return o.Address
+	}
+	return "http://" + o.Address + "/"
+}
+
+// Run runs the workload described by the options
+func Run(ctx context.Context, options Options) (*Report, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	if options.Protocol == ProtocolTcp {
+		return RunTcp(ctx, options)
+	}
+	return RunHttp(ctx, options)
+}
+
+// RunHttp sends GET requests to the address at a constant rate
+func RunHttp(ctx context.Context, options Options) (*Report, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	rate := vegeta.Rate{Freq: options.Rate, Per: time.Second}
+	targeter := vegeta.NewStaticTargeter(vegeta.Target{
+		Method: http.MethodGet,
+		URL:    options.url(),
+	})
+	attacker := vegeta.NewAttacker(vegeta.Connections(options.Connections), vegeta.Timeout(options.Timeout))
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			attacker.Stop()
+		case <-finished:
+		}
+	}()
+
+	var metrics vegeta.Metrics
+	for result := range attacker.Attack(targeter, rate, options.Duration, "skupper-bench") {
+		metrics.Add(result)
+	}
+	metrics.Close()
+
+	report := newReport(options)
+	report.Requests = metrics.Requests
+	report.Rate = metrics.Rate
+	report.Throughput = metrics.Throughput
+	report.Success = metrics.Success
+	report.Elapsed = metrics.Duration + metrics.Wait
+	if report.Elapsed > 0 {
+		report.BytesPerSecond = float64(metrics.BytesIn.Total) / report.Elapsed.Seconds()
+	}
+	report.Latencies = Latencies{
+		Min:  metrics.Latencies.Min,
+		Mean: metrics.Latencies.Mean,
+		P50:  metrics.Latencies.P50,
+		P90:  metrics.Latencies.P90,
+		P95:  metrics.Latencies.P95,
+		P99:  metrics.Latencies.P99,
+		Max:  metrics.Latencies.Max,
+	}
+	report.Errors = metrics.Errors
+	return report, nil
+}
+
+type tcpResult struct {
+	latencies []time.Duration
+	bytes     uint64
+	failures  uint64
+	err       error
+}
+
+// Sends messages over a connection until the deadline, timing how long
+// each takes to be echoed back
+func echo(ctx context.Context, options Options, deadline time.Time) tcpResult {
+	result := tcpResult{}
+	dialer := net.Dialer{Timeout: options.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", options.Address)
+	if err != nil {
+		result.failures++
+		result.err = err
+		return result
+	}
+	defer conn.Close()
+	message := bytes.Repeat([]byte("x"), options.MessageSize)
+	reply := make([]byte, options.MessageSize)
+	for time.Now().Before(deadline) && ctx.Err() == nil {
+		conn.SetDeadline(time.Now().Add(options.Timeout))
+		start := time.Now()
+		if _, err := conn.Write(message); err != nil {
+			result.failures++
+			result.err = err
+			return result
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			result.failures++
+			result.err = err
+			return result
+		}
+		result.latencies = append(result.latencies, time.Since(start))
+		result.bytes += uint64(options.MessageSize)
+	}
+	return result
+}
+
+// RunTcp opens the configured number of connections to the address and
+// measures the round trip of each message echoed back over them
+func RunTcp(ctx context.Context, options Options) (*Report, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	deadline := start.Add(options.Duration)
+	results := make([]tcpResult, options.Connections)
+	var wg sync.WaitGroup
+	for i := 0; i < options.Connections; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = echo(ctx, options, deadline)
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	report := newReport(options)
+	report.Elapsed = elapsed
+	latencies := []time.Duration{}
+	var received, failures uint64
+	errors := map[string]bool{}
+	for _, result := range results {
+		latencies = append(latencies, result.latencies...)
+		received += result.bytes
+		failures += result.failures
+		if result.err != nil {
+			errors[result.err.Error()] = true
+		}
+	}
+	for err := range errors {
+		report.Errors = append(report.Errors, err)
+	}
+	sort.Strings(report.Errors)
+	successes := uint64(len(latencies))
+	report.Requests = successes + failures
+	if report.Requests > 0 {
+		report.Success = float64(successes) / float64(report.Requests)
+	}
+	if elapsed > 0 {
+		report.Rate = float64(report.Requests) / elapsed.Seconds()
+		report.Throughput = float64(successes) / elapsed.Seconds()
+		report.BytesPerSecond = float64(received) / elapsed.Seconds()
+	}
+	report.Latencies = getLatencies(latencies)
+	if successes == 0 && len(report.Errors) > 0 {
+		return report, fmt.Errorf("No messages were echoed by %s: %s", options.Address, report.Errors[0])
+	}
+	return report, nil
+}
+
+// Returns the latency below which the fraction p of the sorted samples
+// fall, using the nearest rank
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	} else if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func getLatencies(samples []time.Duration) Latencies {
+	if len(samples) == 0 {
+		return Latencies{}
+	}
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	var total time.Duration
+	for _, sample := range sorted {
+		total += sample
+	}
+	return Latencies{
+		Min:  sorted[0],
+		Mean: total / time.Duration(len(sorted)),
+		P50:  percentile(sorted, 0.50),
+		P90:  percentile(sorted, 0.90),
+		P95:  percentile(sorted, 0.95),
+		P99:  percentile(sorted, 0.99),
+		Max:  sorted[len(sorted)-1],
+	}
+}
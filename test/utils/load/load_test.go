@@ -0,0 +1,163 @@
+package load
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skupperproject/skupper/test/utils/k8s"
+	"gotest.tools/assert"
+)
+
+// TestLoadJob is run by the job created through RunJob
+func TestLoadJob(t *testing.T) {
+	k8s.SkipTestJobIfMustBeSkipped(t)
+
+	options, err := OptionsFromEnv()
+	assert.Assert(t, err)
+	report, err := Run(context.Background(), options)
+	if report != nil {
+		assert.Assert(t, PrintReport(os.Stdout, report))
+	}
+	assert.Assert(t, err)
+}
+
+func TestPercentile(t *testing.T) {
+	samples := []time.Duration{}
+	for i := 100; i > 0; i-- {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	latencies := getLatencies(samples)
+	assert.Equal(t, latencies.Min, time.Millisecond)
+	assert.Equal(t, latencies.Max, 100*time.Millisecond)
+	assert.Equal(t, latencies.P50, 50*time.Millisecond)
+	assert.Equal(t, latencies.P90, 90*time.Millisecond)
+	assert.Equal(t, latencies.P99, 99*time.Millisecond)
+	assert.Equal(t, latencies.Mean, 50500*time.Microsecond)
+	assert.Equal(t, percentile(nil, 0.5), time.Duration(0))
+}
+
+func TestCompare(t *testing.T) {
+	baseline := &Report{
+		Throughput: 100,
+		Success:    1,
+		Latencies:  Latencies{P50: 10 * time.Millisecond, P90: 20 * time.Millisecond, P99: 40 * time.Millisecond},
+	}
+	current := &Report{
+		Throughput: 95,
+		Success:    1,
+		Latencies:  Latencies{P50: 11 * time.Millisecond, P90: 30 * time.Millisecond, P99: 40 * time.Millisecond},
+	}
+	comparison := Compare(baseline, current, DefaultThresholds)
+	regressions := comparison.Regressions()
+	assert.Equal(t, len(regressions), 1)
+	assert.Equal(t, regressions[0].Metric, "latency p90")
+	assert.Equal(t, regressions[0].Change, 0.5)
+	assert.Assert(t, strings.Contains(comparison.Markdown(), "| latency p90 | 20.000 | 30.000 | +50.0% | REGRESSION |"))
+
+	current.Throughput = 80
+	current.Success = 0.9
+	assert.Equal(t, len(Compare(baseline, current, DefaultThresholds).Regressions()), 3)
+	assert.Equal(t, len(Compare(baseline, current, Thresholds{Latency: 1, Throughput: 1, Success: 1}).Regressions()), 0)
+}
+
+func TestOptionsEnv(t *testing.T) {
+	options := Options{
+		Protocol:    ProtocolTcp,
+		Address:     "tcp-go-echo:9090",
+		Duration:    5 * time.Second,
+		Rate:        10,
+		Connections: 4,
+		MessageSize: 512,
+		Timeout:     time.Second,
+	}
+	for _, env := range options.Env() {
+		os.Setenv(env.Name, env.Value)
+		defer os.Unsetenv(env.Name)
+	}
+	parsed, err := OptionsFromEnv()
+	assert.Assert(t, err)
+	assert.DeepEqual(t, parsed, options)
+
+	os.Setenv(EnvRate, "fast")
+	_, err = OptionsFromEnv()
+	assert.ErrorContains(t, err, EnvRate)
+}
+
+func TestParseReport(t *testing.T) {
+	report := &Report{Protocol: ProtocolHttp, Address: "httpbin:8080", Requests: 10, Success: 1}
+	var log strings.Builder
+	log.WriteString("=== RUN   TestLoadJob\n")
+	assert.Assert(t, PrintReport(&log, report))
+	log.WriteString("--- PASS: TestLoadJob (1.00s)\n")
+	parsed, err := ParseReport(log.String())
+	assert.Assert(t, err)
+	assert.DeepEqual(t, parsed, report)
+
+	_, err = ParseReport("=== RUN   TestLoadJob\n")
+	assert.ErrorContains(t, err, "No report")
+}
+
+func TestRunHttp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	report, err := Run(context.Background(), Options{
+		Address:  server.URL,
+		Duration: 500 * time.Millisecond,
+		Rate:     20,
+	})
+	assert.Assert(t, err)
+	assert.Equal(t, report.Protocol, ProtocolHttp)
+	assert.Assert(t, report.Requests > 0)
+	assert.Equal(t, report.Success, 1.0)
+	assert.Assert(t, report.Latencies.P99 > 0)
+	assert.Assert(t, strings.Contains(report.Markdown(), "| Success | 100.00% |"))
+}
+
+func TestRunTcp(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Assert(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	report, err := Run(context.Background(), Options{
+		Protocol:    ProtocolTcp,
+		Address:     listener.Addr().String(),
+		Duration:    200 * time.Millisecond,
+		Connections: 2,
+		MessageSize: 64,
+	})
+	assert.Assert(t, err)
+	assert.Assert(t, report.Requests > 0)
+	assert.Equal(t, report.Success, 1.0)
+	assert.Equal(t, report.MessageSize, 64)
+	assert.Assert(t, report.BytesPerSecond > 0)
+
+	listener.Close()
+	_, err = Run(context.Background(), Options{
+		Protocol: ProtocolTcp,
+		Address:  listener.Addr().String(),
+		Duration: 100 * time.Millisecond,
+	})
+	assert.ErrorContains(t, err, "No messages were echoed")
+}
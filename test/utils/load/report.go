@@ -0,0 +1,213 @@
+package load
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Latencies are the percentiles of the time taken by each request, or
+// by each message to be echoed for tcp
+type Latencies struct {
+	Min  time.Duration `json:"min"`
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"p50"`
+	P90  time.Duration `json:"p90"`
+	P95  time.Duration `json:"p95"`
+	P99  time.Duration `json:"p99"`
+	Max  time.Duration `json:"max"`
+}
+
+// Report holds the results of a workload. Durations are in
+// nanoseconds when written as JSON.
+type Report struct {
+	Protocol       string        `json:"protocol"`
+	Address        string        `json:"address"`
+	Duration       time.Duration `json:"duration"`
+	Connections    int           `json:"connections"`
+	MessageSize    int           `json:"messageSize,omitempty"`
+	Elapsed        time.Duration `json:"elapsed"`
+	Requests       uint64        `json:"requests"`
+	Rate           float64       `json:"rate"`
+	Throughput     float64       `json:"throughput"`
+	BytesPerSecond float64       `json:"bytesPerSecond"`
+	Success        float64       `json:"success"`
+	Latencies      Latencies     `json:"latencies"`
+	Errors         []string      `json:"errors,omitempty"`
+}
+
+func newReport(options Options) *Report {
+	report := &Report{
+		Protocol:    options.Protocol,
+		Address:     options.Address,
+		Duration:    options.Duration,
+		Connections: options.Connections,
+	}
+	if options.Protocol == ProtocolTcp {
+		report.MessageSize = options.MessageSize
+	}
+	return report
+}
+
+// WriteReport saves a report as JSON, e.g. for use as a baseline
+func WriteReport(path string, report *Report) error {
+	data, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// ReadReport reads a report saved as JSON
+func ReadReport(path string) (*Report, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, fmt.Errorf("Invalid report in %s: %s", path, err)
+	}
+	return report, nil
+}
+
+func formatBytes(perSecond float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	i := 0
+	for ; perSecond >= 1024 && i < len(units)-1; i++ {
+		perSecond /= 1024
+	}
+	return fmt.Sprintf("%.1f %s/s", perSecond, units[i])
+}
+
+// Markdown formats the report as a markdown table
+func (r *Report) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s benchmark of %s\n\n", r.Protocol, r.Address)
+	fmt.Fprintf(&b, "| Metric | Value |\n")
+	fmt.Fprintf(&b, "|---|---|\n")
+	fmt.Fprintf(&b, "| Duration | %s |\n", r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(&b, "| Connections | %d |\n", r.Connections)
+	if r.MessageSize > 0 {
+		fmt.Fprintf(&b, "| Message size | %d |\n", r.MessageSize)
+	}
+	fmt.Fprintf(&b, "| Requests | %d |\n", r.Requests)
+	fmt.Fprintf(&b, "| Rate | %.1f/s |\n", r.Rate)
+	fmt.Fprintf(&b, "| Throughput | %.1f/s |\n", r.Throughput)
+	fmt.Fprintf(&b, "| Transfer | %s |\n", formatBytes(r.BytesPerSecond))
+	fmt.Fprintf(&b, "| Success | %.2f%% |\n", r.Success*100)
+	fmt.Fprintf(&b, "| Latency min | %s |\n", r.Latencies.Min)
+	fmt.Fprintf(&b, "| Latency mean | %s |\n", r.Latencies.Mean)
+	fmt.Fprintf(&b, "| Latency p50 | %s |\n", r.Latencies.P50)
+	fmt.Fprintf(&b, "| Latency p90 | %s |\n", r.Latencies.P90)
+	fmt.Fprintf(&b, "| Latency p95 | %s |\n", r.Latencies.P95)
+	fmt.Fprintf(&b, "| Latency p99 | %s |\n", r.Latencies.P99)
+	fmt.Fprintf(&b, "| Latency max | %s |\n", r.Latencies.Max)
+	if len(r.Errors) > 0 {
+		fmt.Fprintf(&b, "\nErrors:\n\n")
+		for _, err := range r.Errors {
+			fmt.Fprintf(&b, "- %s\n", err)
+		}
+	}
+	return b.String()
+}
+
+// Thresholds are the largest changes from a baseline that are not
+// regressions, as fractions of the baseline value. Latency is compared
+// at the p50, p90 and p99 percentiles.
+type Thresholds struct {
+	Latency    float64
+	Throughput float64
+	Success    float64
+}
+
+var DefaultThresholds = Thresholds{
+	Latency:    0.2,
+	Throughput: 0.1,
+	Success:    0.01,
+}
+
+// MetricChange is the change in a metric from the baseline. Latencies
+// are in milliseconds.
+type MetricChange struct {
+	Metric     string  `json:"metric"`
+	Baseline   float64 `json:"baseline"`
+	Current    float64 `json:"current"`
+	Change     float64 `json:"change"`
+	Regression bool    `json:"regression"`
+}
+
+type Comparison struct {
+	Changes []MetricChange `json:"changes"`
+}
+
+func getChange(metric string, baseline float64, current float64) MetricChange {
+	change := MetricChange{
+		Metric:   metric,
+		Baseline: baseline,
+		Current:  current,
+	}
+	if baseline != 0 {
+		change.Change = (current - baseline) / baseline
+	}
+	return change
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Compare returns the changes in a report from a baseline, marking
+// those beyond the thresholds as regressions
+func Compare(baseline *Report, current *Report, thresholds Thresholds) *Comparison {
+	comparison := &Comparison{}
+	throughput := getChange("throughput", baseline.Throughput, current.Throughput)
+	throughput.Regression = throughput.Change < -thresholds.Throughput
+	comparison.Changes = append(comparison.Changes, throughput)
+	success := getChange("success", baseline.Success, current.Success)
+	success.Regression = success.Change < -thresholds.Success
+	comparison.Changes = append(comparison.Changes, success)
+	latencies := []struct {
+		metric   string
+		baseline time.Duration
+		current  time.Duration
+	}{
+		{"latency p50", baseline.Latencies.P50, current.Latencies.P50},
+		{"latency p90", baseline.Latencies.P90, current.Latencies.P90},
+		{"latency p99", baseline.Latencies.P99, current.Latencies.P99},
+	}
+	for _, l := range latencies {
+		latency := getChange(l.metric, milliseconds(l.baseline), milliseconds(l.current))
+		latency.Regression = latency.Change > thresholds.Latency
+		comparison.Changes = append(comparison.Changes, latency)
+	}
+	return comparison
+}
+
+func (c *Comparison) Regressions() []MetricChange {
+	regressions := []MetricChange{}
+	for _, change := range c.Changes {
+		if change.Regression {
+			regressions = append(regressions, change)
+		}
+	}
+	return regressions
+}
+
+// Markdown formats the comparison as a markdown table
+func (c *Comparison) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Comparison with baseline\n\n")
+	fmt.Fprintf(&b, "| Metric | Baseline | Current | Change | Result |\n")
+	fmt.Fprintf(&b, "|---|---|---|---|---|\n")
+	for _, change := range c.Changes {
+		result := "ok"
+		if change.Regression {
+			result = "REGRESSION"
+		}
+		fmt.Fprintf(&b, "| %s | %.3f | %.3f | %+.1f%% | %s |\n", change.Metric, change.Baseline, change.Current, change.Change*100, result)
+	}
+	return b.String()
+}